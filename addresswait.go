@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// addressRetryBaseDelay is the default base delay between describing instance
+// again while waiting for its addresses, see retryDelay
+const addressRetryBaseDelay = time.Second
+
+// awaitAddress waits for up to s.addressWait for running instance to get
+// addresses its records can point to, describing it again with backoff. It
+// returns early if the instance is gone, not running, or cannot get records
+// for another reason, leaving it for the update to handle. Waiting stops
+// short of ctx deadline, like Lambda timeout, so that the update still has
+// time to run.
+func (s *syncer) awaitAddress(ctx context.Context, instanceID string) error {
+	if s.addressWait <= 0 {
+		return nil
+	}
+	deadline := time.Now().Add(s.addressWait)
+	if d, ok := ctx.Deadline(); ok && d.Add(-checkpointMargin).Before(deadline) {
+		deadline = d.Add(-checkpointMargin)
+	}
+	base := s.addressRetryDelay
+	if base <= 0 {
+		base = addressRetryBaseDelay
+	}
+	for attempt := 0; ; attempt++ {
+		resp, err := s.ec2.DescribeInstancesWithContext(ctx, &ec2.DescribeInstancesInput{
+			InstanceIds: []*string{&instanceID},
+		})
+		if err != nil {
+			return err
+		}
+		var inst *ec2.Instance
+		for _, r := range resp.Reservations {
+			for _, i := range r.Instances {
+				if aws.StringValue(i.InstanceId) == instanceID {
+					inst = i
+				}
+			}
+		}
+		if inst == nil || inst.State == nil || aws.StringValue(inst.State.Name) != ec2.InstanceStateNameRunning ||
+			s.instanceRecord(inst) != nil || s.skipReason(inst) != "no public address" {
+			return nil
+		}
+		delay := retryDelay(base, attempt)
+		if time.Now().Add(delay).After(deadline) {
+			logMsg("instance has no address yet, giving up waiting", "instance_id", instanceID, "attempts", attempt+1)
+			return nil
+		}
+		debugMsg("instance has no address yet, waiting", "instance_id", instanceID, "delay", delay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func TestLaunchInstance_addressWait(t *testing.T) {
+	inst := testInstance("i-1", "web", "", "")
+	svc := &assigningEC2{fakeEC2: fakeEC2{instances: []*ec2.Instance{inst}}, inst: inst, ip: "1.2.3.4", after: 3}
+	r53svc := newFakeRoute53(t)
+	s := &syncer{
+		ec2:               svc,
+		r53:               r53svc,
+		suffix:            ".foo.example.com",
+		zoneID:            "Z1",
+		addressWait:       time.Minute,
+		addressRetryDelay: time.Millisecond,
+	}
+	if err := s.launchInstance(context.Background(), "i-1"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"web.foo.example.com. A 1.2.3.4"}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	// address never assigned: waiting is bounded
+	inst = testInstance("i-2", "db", "", "")
+	s.ec2 = &fakeEC2{instances: []*ec2.Instance{inst}}
+	s.addressWait = 20 * time.Millisecond
+	start := time.Now()
+	if err := s.launchInstance(context.Background(), "i-2"); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("waited for %v", d)
+	}
+}
+
+// assigningEC2 is fakeEC2 assigning public IP address to the instance once it
+// was described a given number of times
+type assigningEC2 struct {
+	fakeEC2
+	inst  *ec2.Instance
+	ip    string
+	after int
+	calls int
+}
+
+func (f *assigningEC2) DescribeInstancesWithContext(ctx aws.Context, in *ec2.DescribeInstancesInput, opts ...request.Option) (*ec2.DescribeInstancesOutput, error) {
+	if f.calls++; f.calls == f.after {
+		f.inst.PublicIpAddress = &f.ip
+	}
+	return f.fakeEC2.DescribeInstancesWithContext(ctx, in, opts...)
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+// managedAlias reports whether record set may be deleted or overwritten by
+// the program, as far as alias records are concerned: alias record sets are
+// usually created by other tooling, so they are only managed if
+// s.manageAliases is set, or, with s.lbTag set, if they point to load
+// balancers. Non-alias record sets are always managed.
+func (s *syncer) managedAlias(rr *route53.ResourceRecordSet) bool {
+	switch {
+	case rr.AliasTarget == nil, s.manageAliases:
+		return true
+	case s.lbTag != "":
+		name := strings.ToLower(aws.StringValue(rr.AliasTarget.DNSName))
+		return strings.Contains(name, ".elb.") && strings.Contains(name, ".amazonaws.com")
+	}
+	return false
+}
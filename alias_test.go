@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+func TestReconcile_foreignAliases(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		manage bool
+		want   []string
+	}{
+		{
+			name: "kept",
+			want: []string{
+				"cdn.foo.example.com. A alias=Z2FDTNDATAQYW2/d111111abcdef8.cloudfront.net.",
+				"db.foo.example.com. A 1.2.3.5",
+				"web.foo.example.com. A alias=Z2FDTNDATAQYW2/d222222abcdef8.cloudfront.net.",
+			},
+		},
+		{
+			name:   "managed",
+			manage: true,
+			want:   []string{"db.foo.example.com. A 1.2.3.5"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r53svc := newFakeRoute53(t)
+			for _, name := range []string{"cdn", "web"} {
+				dist := "d111111abcdef8.cloudfront.net."
+				if name == "web" {
+					dist = "d222222abcdef8.cloudfront.net."
+				}
+				r53svc.records[name+".foo.example.com A "] = &route53.ResourceRecordSet{
+					Name: aws.String(name + ".foo.example.com."),
+					Type: aws.String("A"),
+					AliasTarget: &route53.AliasTarget{
+						DNSName:      aws.String(dist),
+						HostedZoneId: aws.String("Z2FDTNDATAQYW2"),
+					},
+				}
+			}
+			s := &syncer{
+				ec2: &fakeEC2{instances: []*ec2.Instance{
+					testInstance("i-1", "web", "", "1.2.3.4"),
+					testInstance("i-2", "db", "", "1.2.3.5"),
+				}},
+				r53:           r53svc,
+				suffix:        ".foo.example.com",
+				zoneID:        "Z1",
+				manageAliases: tc.manage,
+			}
+			ctx := context.Background()
+			if err := s.update(ctx, "", new(runStats)); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.removeInstance(ctx, "i-1"); err != nil {
+				t.Fatal(err)
+			}
+			// unless aliases are managed, removal of instance keeps alias record with its name
+			if got := r53svc.dump(); !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tc.want, "\n"))
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// s3Client is a subset of s3 API used by the program
+type s3Client interface {
+	PutObjectWithContext(aws.Context, *s3.PutObjectInput, ...request.Option) (*s3.PutObjectOutput, error)
+}
+
+// auditRecord describes a single applied change batch
+type auditRecord struct {
+	Time      time.Time      `json:"time"`
+	ZoneID    string         `json:"zone_id"`
+	ChangeID  string         `json:"change_id"`
+	Comment   string         `json:"comment"`
+	InvokerID string         `json:"invoker_instance_id,omitempty"`
+	RequestID string         `json:"lambda_request_id,omitempty"`
+	Changes   []recordChange `json:"changes"`
+
+	// set with audit metadata enabled
+	Principal   string   `json:"principal,omitempty"` // ARN of AWS identity the program runs as
+	Version     string   `json:"version,omitempty"`   // program version
+	InstanceIDs []string `json:"instance_ids,omitempty"`
+}
+
+// newAuditRecord returns audit record of the change batch, taking Lambda
+// request id from ctx, if any
+func newAuditRecord(ctx context.Context, zoneID, changeID, invokerID, comment string, changes []recordChange) auditRecord {
+	rec := auditRecord{
+		Time:      time.Now().UTC(),
+		ZoneID:    zoneID,
+		ChangeID:  strings.TrimPrefix(changeID, "/change/"),
+		Comment:   comment,
+		InvokerID: invokerID,
+		Changes:   changes,
+	}
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		rec.RequestID = lc.AwsRequestID
+	}
+	return rec
+}
+
+// audit saves audit record to configured destinations
+func (s *syncer) audit(ctx context.Context, rec auditRecord) {
+	if s.auditS3 == nil && s.auditDB == nil {
+		return
+	}
+	body, err := json.Marshal(rec)
+	if err != nil {
+		logMsg("encoding audit record", "zone_id", s.zoneID, "error", err)
+		return
+	}
+	if s.auditS3 != nil && s.auditBucket != "" {
+		key := path.Join(s.auditPrefix, rec.ZoneID,
+			rec.Time.Format("2006/01/02/150405.000000000")+"-"+rec.ChangeID+".json")
+		_, err := s.auditS3.PutObjectWithContext(ctx, &s3.PutObjectInput{
+			Bucket:      &s.auditBucket,
+			Key:         &key,
+			Body:        bytes.NewReader(body),
+			ContentType: aws.String("application/json"),
+		})
+		if err != nil {
+			logMsg("saving audit record to S3", "zone_id", s.zoneID, "change_id", rec.ChangeID, "error", err)
+		}
+	}
+	if s.auditDB != nil && s.auditTable != "" {
+		item := map[string]*dynamodb.AttributeValue{
+			"ChangeID": {S: &rec.ChangeID},
+			"Time":     {S: aws.String(rec.Time.Format(time.RFC3339Nano))},
+			"ZoneID":   {S: &rec.ZoneID},
+			"Record":   {S: aws.String(string(body))},
+		}
+		if rec.Principal != "" {
+			item["Principal"] = &dynamodb.AttributeValue{S: &rec.Principal}
+		}
+		if rec.Version != "" {
+			item["Version"] = &dynamodb.AttributeValue{S: &rec.Version}
+		}
+		if len(rec.InstanceIDs) != 0 {
+			item["InstanceIDs"] = &dynamodb.AttributeValue{SS: aws.StringSlice(rec.InstanceIDs)}
+		}
+		_, err := s.auditDB.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+			TableName: &s.auditTable,
+			Item:      item,
+		})
+		if err != nil {
+			logMsg("saving audit record to DynamoDB", "zone_id", s.zoneID, "change_id", rec.ChangeID, "error", err)
+		}
+	}
+}
+
+// parseS3URL splits s3://bucket/prefix URL into bucket and prefix
+func parseS3URL(s string) (bucket, prefix string, err error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", "", err
+	}
+	if u.Scheme != "s3" || u.Host == "" {
+		return "", "", fmt.Errorf("invalid S3 URL %q, must be in s3://bucket/prefix form", s)
+	}
+	return u.Host, strings.Trim(u.Path, "/"), nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestAudit(t *testing.T) {
+	s3svc := &fakeS3{objects: make(map[string][]byte)}
+	db := newFakeDynamoDB("ChangeID")
+	s := &syncer{
+		ec2:         &fakeEC2{instances: []*ec2.Instance{testInstance("i-1", "jenkins", "", "1.2.3.4")}},
+		r53:         newFakeRoute53(t, "old.foo.example.com. A 1.1.1.1"),
+		suffix:      ".foo.example.com",
+		zoneID:      "Z1",
+		auditS3:     s3svc,
+		auditBucket: "audit",
+		auditPrefix: "awsns",
+		auditDB:     db,
+		auditTable:  "audit",
+	}
+	ctx := lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{AwsRequestID: "req-1"})
+	if err := s.reconcile(ctx, "i-1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(s3svc.objects) != 1 {
+		t.Fatalf("got %d S3 objects, want 1", len(s3svc.objects))
+	}
+	for key, body := range s3svc.objects {
+		if !strings.HasPrefix(key, "audit/awsns/Z1/") || !strings.HasSuffix(key, "-C1.json") {
+			t.Errorf("unexpected S3 key %q", key)
+		}
+		var rec auditRecord
+		if err := json.Unmarshal(body, &rec); err != nil {
+			t.Fatal(err)
+		}
+		if rec.ZoneID != "Z1" || rec.ChangeID != "C1" || rec.InvokerID != "i-1" ||
+			rec.RequestID != "req-1" || len(rec.Changes) != 2 {
+			t.Errorf("unexpected audit record: %+v", rec)
+		}
+	}
+	item, ok := db.items["C1"]
+	if !ok {
+		t.Fatal("no audit record in DynamoDB")
+	}
+	if aws.StringValue(item["ZoneID"].S) != "Z1" || !json.Valid([]byte(aws.StringValue(item["Record"].S))) {
+		t.Fatalf("unexpected DynamoDB item: %v", item)
+	}
+}
+
+func TestParseS3URL(t *testing.T) {
+	bucket, prefix, err := parseS3URL("s3://my-bucket/some/prefix/")
+	if err != nil || bucket != "my-bucket" || prefix != "some/prefix" {
+		t.Fatalf("got %q, %q, %v", bucket, prefix, err)
+	}
+	if _, _, err := parseS3URL("https://my-bucket/prefix"); err == nil {
+		t.Fatal("non-s3 URL accepted")
+	}
+}
+
+// fakeS3 is an in-memory implementation of s3Client, objects are keyed by
+// "bucket/key"
+type fakeS3 struct {
+	objects map[string][]byte
+}
+
+func (f *fakeS3) PutObjectWithContext(_ aws.Context, in *s3.PutObjectInput, _ ...request.Option) (*s3.PutObjectOutput, error) {
+	body, err := io.ReadAll(in.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.objects[aws.StringValue(in.Bucket)+"/"+aws.StringValue(in.Key)] = body
+	return &s3.PutObjectOutput{}, nil
+}
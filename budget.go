@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// errBudgetExceeded is returned by EC2 and Route 53 API calls once the run
+// made apiBudget.max of them
+var errBudgetExceeded = errors.New("API call budget exceeded")
+
+// apiBudget limits the number of EC2 and Route 53 API calls, including
+// retries and pages of listings, made during a single run. Other calls, like
+// the ones reporting run results, are not limited. Methods of nil *apiBudget
+// are no-ops.
+type apiBudget struct {
+	max   int64
+	calls int64 // calls since the last reset, updated atomically
+}
+
+// reset starts a new run with the full budget
+func (b *apiBudget) reset() {
+	if b == nil {
+		return
+	}
+	atomic.StoreInt64(&b.calls, 0)
+}
+
+// resetBudget resets API call budgets of s and of its environments, if any,
+// starting a new run
+func (s *syncer) resetBudget() {
+	s.budget.reset()
+	for _, e := range s.envs {
+		e.budget.reset()
+	}
+}
+
+// check is a request handler failing EC2 and Route 53 calls with
+// errBudgetExceeded once the budget is spent; it should be attached to
+// session Sign handlers list, which runs before each attempt
+func (b *apiBudget) check(r *request.Request) {
+	if b == nil || r.ClientInfo.ServiceName != "ec2" && r.ClientInfo.ServiceName != "route53" {
+		return
+	}
+	if atomic.AddInt64(&b.calls, 1) <= b.max {
+		return
+	}
+	var op string
+	if r.Operation != nil {
+		op = r.Operation.Name
+	}
+	r.Error = fmt.Errorf("%w: %d calls made, refusing to call %s %s", errBudgetExceeded, b.max, r.ClientInfo.ServiceName, op)
+}
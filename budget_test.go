@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+func TestAPIBudget(t *testing.T) {
+	b := &apiBudget{max: 2}
+	call := func(service string) error {
+		r := &request.Request{
+			ClientInfo: metadata.ClientInfo{ServiceName: service},
+			Operation:  &request.Operation{Name: "Op"},
+		}
+		b.check(r)
+		return r.Error
+	}
+	for i := 0; i < 2; i++ {
+		if err := call("route53"); err != nil {
+			t.Fatalf("call %d: %v", i+1, err)
+		}
+	}
+	if err := call("ec2"); !errors.Is(err, errBudgetExceeded) {
+		t.Fatalf("got error %v, want %v", err, errBudgetExceeded)
+	}
+	if err := call("monitoring"); err != nil {
+		t.Fatalf("call of unlimited service: %v", err)
+	}
+	b.reset()
+	if err := call("ec2"); err != nil {
+		t.Fatalf("call after reset: %v", err)
+	}
+	var nilBudget *apiBudget
+	nilBudget.reset()
+}
+
+func TestResetBudget_envs(t *testing.T) {
+	prod, staging := &apiBudget{max: 1, calls: 5}, &apiBudget{max: 1, calls: 3}
+	s := &syncer{envs: []envSyncer{
+		{env: "prod", syncer: &syncer{budget: prod}},
+		{env: "staging", syncer: &syncer{budget: staging}},
+	}}
+	s.resetBudget()
+	if prod.calls != 0 || staging.calls != 0 {
+		t.Fatalf("got %d and %d calls after reset, want 0", prod.calls, staging.calls)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// newHTTPClient returns HTTP client for AWS API calls trusting certificates of
+// the system pool plus the ones in PEM file caBundle, like certificate of
+// TLS-intercepting proxy. Proxy is taken from HTTPS_PROXY, HTTP_PROXY and
+// NO_PROXY environment variables.
+func newHTTPClient(caBundle string) (*http.Client, error) {
+	pem, err := os.ReadFile(caBundle)
+	if err != nil {
+		return nil, fmt.Errorf("reading CA bundle: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		// not available on some platforms, only trust the bundle then
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in CA bundle %s", caBundle)
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = http.ProxyFromEnvironment
+	t.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	return &http.Client{Transport: t}, nil
+}
+
+// certHint adds a hint on trusting TLS-intercepting proxy to err if it is
+// caused by certificate signed by unknown authority. AWS SDK errors don't
+// support unwrapping, so err is matched by its message.
+func certHint(err error) error {
+	var uerr x509.UnknownAuthorityError
+	if err != nil && (errors.As(err, &uerr) || strings.Contains(err.Error(), "certificate signed by unknown authority")) {
+		return fmt.Errorf("%w (behind TLS-intercepting proxy? pass its CA certificate with -ca-bundle)", err)
+	}
+	return err
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+// canaryName returns name of the production zone record translated to the
+// canary zone: ".example.com" suffix of s.canaryFrom zone replaced with
+// s.canaryTo one
+func (s *syncer) canaryName(name string) string {
+	name = strings.TrimSuffix(name, ".")
+	if name == s.canaryFrom[1:] {
+		return s.canaryTo[1:] + "."
+	}
+	return strings.TrimSuffix(name, s.canaryFrom) + s.canaryTo + "."
+}
+
+// applyCanary rehearses changes to the production zone on s.canaryZoneID
+// zone: upserts are applied as is, and deletions remove records with the same
+// name, type and set identifier, if the canary zone has them. The change is
+// verified like production ones, see verifyChange, so that failure stops
+// changes from reaching the production zone.
+func (s *syncer) applyCanary(ctx context.Context, comment string, changes []*route53.Change) error {
+	var canary []*route53.Change
+	for _, ch := range changes {
+		rr := *ch.ResourceRecordSet
+		rr.Name = aws.String(s.canaryName(*rr.Name))
+		if aws.StringValue(ch.Action) == route53.ChangeActionDelete {
+			old, err := s.lookupRecord(ctx, s.canaryZoneID, &rr)
+			if err != nil {
+				return err
+			}
+			if old == nil {
+				continue
+			}
+			rr = *old
+		}
+		canary = append(canary, &route53.Change{Action: ch.Action, ResourceRecordSet: &rr})
+	}
+	if len(canary) == 0 {
+		return nil
+	}
+	logMsg("applying changes to canary zone", "zone_id", s.zoneID, "canary_zone_id", s.canaryZoneID, "count", len(canary))
+	changeID, err := s.provider().apply(ctx, s.canaryZoneID, comment, canary)
+	if err != nil {
+		return fmt.Errorf("canary zone %s: %w", s.canaryZoneID, err)
+	}
+	if err := s.verifyChange(ctx, s.canaryZoneID, changeID, canary); err != nil {
+		return fmt.Errorf("canary zone %s: %w", s.canaryZoneID, err)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+func TestReconcile_canary(t *testing.T) {
+	prod := &memProvider{records: map[string]*route53.ResourceRecordSet{}}
+	prod.apply(context.Background(), "Z1", "", []*route53.Change{{
+		Action: aws.String(route53.ChangeActionUpsert),
+		ResourceRecordSet: &route53.ResourceRecordSet{Name: aws.String("old.foo.example.com."), Type: aws.String("A"),
+			TTL: aws.Int64(60), ResourceRecords: []*route53.ResourceRecord{{Value: aws.String("9.9.9.9")}}},
+	}})
+	canary := &memProvider{records: map[string]*route53.ResourceRecordSet{}}
+	zones := zonesProvider{"Z1": prod, "Z2": canary}
+	s := &syncer{
+		ec2:          &fakeEC2{instances: []*ec2.Instance{testInstance("i-1", "web", "", "1.2.3.4")}},
+		dns:          zones,
+		suffix:       ".foo.example.com",
+		zoneID:       "Z1",
+		ttl:          defaultTTL,
+		canaryZoneID: "Z2",
+		canaryFrom:   ".example.com",
+		canaryTo:     ".canary.example.net",
+	}
+	ctx := context.Background()
+
+	zones["Z2"] = failingProvider{canary}
+	if err := s.update(ctx, "", new(runStats)); err == nil {
+		t.Fatal("canary failure ignored")
+	}
+	if got, want := prod.dump(), []string{"old.foo.example.com. A"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q in production zone after canary failure, want %q", got, want)
+	}
+
+	zones["Z2"] = canary
+	if err := s.update(ctx, "", new(runStats)); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := canary.dump(), []string{"web.foo.canary.example.net. A"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q in canary zone, want %q", got, want)
+	}
+	if got, want := prod.dump(), []string{"web.foo.example.com. A"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q in production zone, want %q", got, want)
+	}
+}
+
+// zonesProvider is provider dispatching calls to providers of each zone
+type zonesProvider map[string]provider
+
+func (p zonesProvider) list(ctx context.Context, zoneID, startName, startType string, fn func(*route53.ResourceRecordSet) bool) error {
+	return p[zoneID].list(ctx, zoneID, startName, startType, fn)
+}
+
+func (p zonesProvider) apply(ctx context.Context, zoneID, comment string, changes []*route53.Change) (string, error) {
+	return p[zoneID].apply(ctx, zoneID, comment, changes)
+}
+
+func (p zonesProvider) zoneInfo(ctx context.Context, zoneID string) (zoneInfo, error) {
+	return p[zoneID].zoneInfo(ctx, zoneID)
+}
+
+// failingProvider is provider failing all changes
+type failingProvider struct{ provider }
+
+func (failingProvider) apply(context.Context, string, string, []*route53.Change) (string, error) {
+	return "", errors.New("rejected")
+}
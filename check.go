@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+// checkRecordName is the name (without suffix) of TXT record created and
+// deleted by write check
+const checkRecordName = "_awsns-check"
+
+// check verifies that the zone exists and matches suffix, and that the
+// program has permissions it needs, printing each check result to w. If write
+// is set, it also creates and deletes throwaway TXT record to verify write
+// access. It reports whether all checks passed.
+func (s *syncer) check(ctx context.Context, w io.Writer, write bool) bool {
+	ok := true
+	report := func(name string, err error) bool {
+		if err != nil {
+			fmt.Fprintf(w, "FAIL %s: %v\n", name, err)
+			ok = false
+			return false
+		}
+		fmt.Fprintf(w, "ok   %s\n", name)
+		return true
+	}
+	zone, err := s.r53.GetHostedZoneWithContext(ctx, &route53.GetHostedZoneInput{Id: &s.zoneID})
+	if report("hosted zone "+s.zoneID+" exists", err) && zone.HostedZone != nil {
+		name := strings.TrimSuffix(aws.StringValue(zone.HostedZone.Name), ".")
+		report("suffix "+s.suffix+" belongs to zone", checkSuffix(s.suffix, name, true))
+	}
+	_, err = s.ec2.DescribeInstancesWithContext(ctx, &ec2.DescribeInstancesInput{MaxResults: aws.Int64(5)})
+	report("ec2:DescribeInstances", err)
+	err = s.r53.ListResourceRecordSetsPagesWithContext(ctx, &route53.ListResourceRecordSetsInput{
+		HostedZoneId: &s.zoneID,
+		MaxItems:     aws.String("1"),
+	}, func(*route53.ListResourceRecordSetsOutput, bool) bool { return false })
+	report("route53:ListResourceRecordSets", err)
+	if !write {
+		return ok
+	}
+	rr := &route53.ResourceRecordSet{
+		Name:            aws.String(checkRecordName + s.suffix),
+		Type:            aws.String(route53.RRTypeTxt),
+		TTL:             aws.Int64(60),
+		ResourceRecords: []*route53.ResourceRecord{{Value: aws.String(`"awsns permission check"`)}},
+	}
+	for _, action := range []string{route53.ChangeActionCreate, route53.ChangeActionDelete} {
+		_, err := s.r53.ChangeResourceRecordSetsWithContext(ctx, &route53.ChangeResourceRecordSetsInput{
+			HostedZoneId: &s.zoneID,
+			ChangeBatch: &route53.ChangeBatch{
+				Changes: []*route53.Change{{Action: aws.String(action), ResourceRecordSet: rr}},
+				Comment: aws.String("awsns permission check"),
+			},
+		})
+		if !report("route53:ChangeResourceRecordSets "+action+" "+*rr.Name, err) {
+			break
+		}
+	}
+	return ok
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+func TestCheck(t *testing.T) {
+	r53svc := newFakeRoute53(t, "web.foo.example.com. A 1.2.3.4")
+	r53svc.zones = []*route53.HostedZone{{Id: aws.String("/hostedzone/Z1"), Name: aws.String("example.com.")}}
+	s := &syncer{
+		ec2:    &fakeEC2{},
+		r53:    r53svc,
+		suffix: ".foo.example.com",
+		zoneID: "Z1",
+	}
+	var buf bytes.Buffer
+	if !s.check(context.Background(), &buf, true) {
+		t.Fatalf("check failed:\n%s", buf.String())
+	}
+	want := "ok   hosted zone Z1 exists\n" +
+		"ok   suffix .foo.example.com belongs to zone\n" +
+		"ok   ec2:DescribeInstances\n" +
+		"ok   route53:ListResourceRecordSets\n" +
+		"ok   route53:ChangeResourceRecordSets CREATE _awsns-check.foo.example.com\n" +
+		"ok   route53:ChangeResourceRecordSets DELETE _awsns-check.foo.example.com\n"
+	if buf.String() != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+	if l := len(r53svc.records); l != 1 {
+		t.Fatalf("got %d records after check, want 1", l)
+	}
+
+	buf.Reset()
+	s.suffix = ".foo.example.org"
+	if s.check(context.Background(), &buf, false) {
+		t.Fatalf("check of suffix outside of zone passed:\n%s", buf.String())
+	}
+	s.zoneID = "Z2"
+	buf.Reset()
+	if s.check(context.Background(), &buf, false) {
+		t.Fatalf("check of missing zone passed:\n%s", buf.String())
+	}
+}
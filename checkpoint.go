@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// checkpointS3Client is a subset of s3 API used to keep listing checkpoints
+type checkpointS3Client interface {
+	s3Client
+	s3Getter
+	DeleteObjectWithContext(aws.Context, *s3.DeleteObjectInput, ...request.Option) (*s3.DeleteObjectOutput, error)
+}
+
+// checkpointMargin is how long before context deadline, like Lambda timeout,
+// listing is interrupted to save its checkpoint
+const checkpointMargin = 15 * time.Second
+
+// checkpointMaxAge is how long checkpoint stays valid: records listed before
+// it may have changed since
+const checkpointMaxAge = 30 * time.Minute
+
+// errListingInterrupted is returned by listRecords if listing was interrupted
+// and its checkpoint saved, to be resumed by the next run
+var errListingInterrupted = errors.New("listing interrupted")
+
+// listCheckpoint is the state of interrupted listing of records under suffix
+type listCheckpoint struct {
+	Time    time.Time                    `json:"time"`
+	ZoneID  string                       `json:"zone_id"`
+	Suffix  string                       `json:"suffix"`
+	Name    string                       `json:"name"` // name of the last listed record set
+	Type    string                       `json:"type"` // type of the last listed record set
+	Records []*route53.ResourceRecordSet `json:"records"`
+}
+
+// checkpointLocation returns local path or s3://bucket/key URL of checkpoint
+// of listing s.zoneID records under s.suffix
+func (s *syncer) checkpointLocation() string {
+	name := "checkpoint-" + s.zoneID + s.suffix + ".json"
+	if s.checkpointBucket != "" {
+		return "s3://" + s.checkpointBucket + "/" + path.Join(s.checkpointPrefix, name)
+	}
+	return filepath.Join(s.checkpointDir, name)
+}
+
+// loadCheckpoint returns checkpoint of interrupted listing, or nil if there is
+// none, or it is expired
+func (s *syncer) loadCheckpoint(ctx context.Context) (*listCheckpoint, error) {
+	if s.checkpointDir == "" && s.checkpointBucket == "" {
+		return nil, nil
+	}
+	where := s.checkpointLocation()
+	r, err := openLocation(ctx, s.checkpointS3, where)
+	var aerr awserr.Error
+	switch {
+	case errors.Is(err, fs.ErrNotExist), errors.As(err, &aerr) && aerr.Code() == s3.ErrCodeNoSuchKey:
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+	defer r.Close()
+	var cp listCheckpoint
+	if err := json.NewDecoder(r).Decode(&cp); err != nil {
+		return nil, fmt.Errorf("reading checkpoint %s: %w", where, err)
+	}
+	if cp.ZoneID != s.zoneID || cp.Suffix != s.suffix || cp.Name == "" || time.Since(cp.Time) > checkpointMaxAge {
+		logMsg("ignoring stale checkpoint", "zone_id", s.zoneID, "checkpoint", where)
+		return nil, nil
+	}
+	return &cp, nil
+}
+
+// saveCheckpoint saves checkpoint of interrupted listing
+func (s *syncer) saveCheckpoint(ctx context.Context, cp *listCheckpoint) error {
+	body, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	where := s.checkpointLocation()
+	if s.checkpointBucket == "" {
+		err = os.WriteFile(where, body, 0o644)
+	} else {
+		_, err = s.checkpointS3.PutObjectWithContext(ctx, &s3.PutObjectInput{
+			Bucket:      &s.checkpointBucket,
+			Key:         aws.String(strings.TrimPrefix(where, "s3://"+s.checkpointBucket+"/")),
+			Body:        bytes.NewReader(body),
+			ContentType: aws.String("application/json"),
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("saving checkpoint: %w", err)
+	}
+	logMsg("saved listing checkpoint", "zone_id", s.zoneID, "checkpoint", where, "records", len(cp.Records),
+		"record_name", strings.TrimSuffix(cp.Name, "."))
+	return nil
+}
+
+// clearCheckpoint removes checkpoint of listing once it is complete
+func (s *syncer) clearCheckpoint(ctx context.Context) error {
+	where := s.checkpointLocation()
+	if s.checkpointBucket == "" {
+		if err := os.Remove(where); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	_, err := s.checkpointS3.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: &s.checkpointBucket,
+		Key:    aws.String(strings.TrimPrefix(where, "s3://"+s.checkpointBucket+"/")),
+	})
+	return err
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+func TestListRecords_checkpoint(t *testing.T) {
+	p := &memProvider{records: map[string]*route53.ResourceRecordSet{}}
+	var want []string
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		want = append(want, name+".foo.example.com.")
+		p.apply(context.Background(), "Z1", "", []*route53.Change{{
+			Action: aws.String(route53.ChangeActionUpsert),
+			ResourceRecordSet: &route53.ResourceRecordSet{Name: aws.String(name + ".foo.example.com."), Type: aws.String("A"),
+				TTL: aws.Int64(60), ResourceRecords: []*route53.ResourceRecord{{Value: aws.String("1.2.3.4")}}},
+		}})
+	}
+	dir := t.TempDir()
+	s := &syncer{dns: budgetProvider{memProvider: p, max: 2}, suffix: ".foo.example.com", zoneID: "Z1", checkpointDir: dir}
+	ctx := context.Background()
+	var records []record
+	var err error
+	for i := 0; i < 10; i++ {
+		if records, err = s.listRecords(ctx); !errors.Is(err, errListingInterrupted) {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range records {
+		got = append(got, r.name)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "checkpoint-Z1.foo.example.com.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("checkpoint not removed after complete listing: %v", err)
+	}
+}
+
+// budgetProvider is provider failing listings with errBudgetExceeded after
+// max record sets
+type budgetProvider struct {
+	*memProvider
+	max int
+}
+
+func (p budgetProvider) list(ctx context.Context, zoneID, startName, startType string, fn func(*route53.ResourceRecordSet) bool) error {
+	var n int
+	err := p.memProvider.list(ctx, zoneID, startName, startType, func(rr *route53.ResourceRecordSet) bool {
+		if n++; n > p.max {
+			return false
+		}
+		return fn(rr)
+	})
+	if n > p.max {
+		return errBudgetExceeded
+	}
+	return err
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+)
+
+// cloudwatchNamespace is a namespace of custom CloudWatch metrics
+const cloudwatchNamespace = "awsns"
+
+// cloudwatchClient is a subset of cloudwatch API used by the program
+type cloudwatchClient interface {
+	PutMetricDataWithContext(aws.Context, *cloudwatch.PutMetricDataInput, ...request.Option) (*cloudwatch.PutMetricDataOutput, error)
+}
+
+// publishCloudWatch publishes run statistics as custom CloudWatch metrics with
+// ZoneId dimension
+func publishCloudWatch(ctx context.Context, svc cloudwatchClient, zoneID string, st runStats, runErr error) error {
+	var errCount int
+	if runErr != nil {
+		errCount = 1
+	}
+	dims := []*cloudwatch.Dimension{{Name: aws.String("ZoneId"), Value: &zoneID}}
+	datum := func(name string, value int) *cloudwatch.MetricDatum {
+		return &cloudwatch.MetricDatum{
+			MetricName: aws.String(name),
+			Dimensions: dims,
+			Unit:       aws.String(cloudwatch.StandardUnitCount),
+			Value:      aws.Float64(float64(value)),
+		}
+	}
+	_, err := svc.PutMetricDataWithContext(ctx, &cloudwatch.PutMetricDataInput{
+		Namespace: aws.String(cloudwatchNamespace),
+		MetricData: []*cloudwatch.MetricDatum{
+			datum("RecordsUpserted", st.Upserted),
+			datum("RecordsDeleted", st.Deleted),
+			datum("InstancesSkipped", st.Skipped),
+			datum("ReconcileErrors", errCount),
+		},
+	})
+	return err
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func TestPublishCloudWatch(t *testing.T) {
+	cw := &fakeCloudWatch{}
+	s := &syncer{
+		ec2: &fakeEC2{instances: []*ec2.Instance{
+			testInstance("i-1", "jenkins", "", "1.2.3.4"),
+			testInstance("i-2", "bad name", "", "5.6.7.8"),
+		}},
+		r53:    newFakeRoute53(t, "old.foo.example.com. A 1.1.1.1"),
+		cw:     cw,
+		suffix: ".foo.example.com",
+		zoneID: "Z1",
+	}
+	if err := s.reconcile(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	if len(cw.inputs) != 1 {
+		t.Fatalf("got %d PutMetricData calls, want 1", len(cw.inputs))
+	}
+	in := cw.inputs[0]
+	if ns := aws.StringValue(in.Namespace); ns != "awsns" {
+		t.Fatalf("unexpected namespace %q", ns)
+	}
+	want := map[string]float64{
+		"RecordsUpserted":  1,
+		"RecordsDeleted":   1,
+		"InstancesSkipped": 1,
+		"ReconcileErrors":  0,
+	}
+	got := make(map[string]float64)
+	for _, d := range in.MetricData {
+		got[aws.StringValue(d.MetricName)] = aws.Float64Value(d.Value)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("metric %s: got %v, want %v", k, got[k], v)
+		}
+	}
+}
+
+type fakeCloudWatch struct {
+	inputs []*cloudwatch.PutMetricDataInput
+}
+
+func (f *fakeCloudWatch) PutMetricDataWithContext(_ aws.Context, in *cloudwatch.PutMetricDataInput, _ ...request.Option) (*cloudwatch.PutMetricDataOutput, error) {
+	f.inputs = append(f.inputs, in)
+	return &cloudwatch.PutMetricDataOutput{}, nil
+}
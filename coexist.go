@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+// coexistExternalDNS is the -coexist value making the program leave alone
+// names owned by external-dns
+const coexistExternalDNS = "external-dns"
+
+// externalDNSTypes are record type prefixes external-dns puts before names
+// of its ownership TXT records, like "cname-web.example.com"
+var externalDNSTypes = map[string]bool{
+	"a": true, "aaaa": true, "cname": true, "mx": true, "naptr": true, "ns": true, "srv": true, "txt": true,
+}
+
+// externalDNSOwned returns names claimed by external-dns ownership TXT record,
+// without trailing dot, or nil if rr is not one. Ownership record is named
+// either as the record it claims, or, in the newer format, with record type
+// prefix added to its first label, so both names are returned.
+func externalDNSOwned(rr *route53.ResourceRecordSet) []string {
+	if aws.StringValue(rr.Type) != route53.RRTypeTxt {
+		return nil
+	}
+	var owned bool
+	for _, r := range rr.ResourceRecords {
+		if strings.Contains(aws.StringValue(r.Value), "heritage=external-dns") {
+			owned = true
+			break
+		}
+	}
+	if !owned {
+		return nil
+	}
+	name := strings.TrimSuffix(aws.StringValue(rr.Name), ".")
+	out := []string{name}
+	label, rest, _ := strings.Cut(name, ".")
+	if typ, target, ok := strings.Cut(label, "-"); ok && target != "" && rest != "" && externalDNSTypes[typ] {
+		out = append(out, target+"."+rest)
+	}
+	return out
+}
+
+// foreignNames returns names under suffix owned by another controller, as
+// set by s.coexist, according to ownership records among records, or nil if
+// s.coexist is not set
+func (s *syncer) foreignNames(records []record) map[string]bool {
+	if s.coexist == "" {
+		return nil
+	}
+	out := make(map[string]bool)
+	for _, r := range records {
+		if r.typ != route53.RRTypeTxt {
+			continue
+		}
+		for _, name := range externalDNSOwned(r.recordSet()) {
+			out[name] = true
+		}
+	}
+	return out
+}
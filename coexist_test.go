@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+func TestExternalDNSOwned(t *testing.T) {
+	const owned = `"heritage=external-dns,external-dns/owner=default,external-dns/resource=service/default/web"`
+	for _, tc := range []struct {
+		name, typ, value string
+		want             []string
+	}{
+		{"web.foo.example.com.", "TXT", owned, []string{"web.foo.example.com"}},
+		{"cname-web.foo.example.com.", "TXT", owned, []string{"cname-web.foo.example.com", "web.foo.example.com"}},
+		{"my-web.foo.example.com.", "TXT", owned, []string{"my-web.foo.example.com"}},
+		{"web.foo.example.com.", "TXT", `"v=spf1 -all"`, nil},
+		{"web.foo.example.com.", "CNAME", "heritage=external-dns", nil},
+	} {
+		rr := &route53.ResourceRecordSet{Name: aws.String(tc.name), Type: aws.String(tc.typ),
+			ResourceRecords: []*route53.ResourceRecord{{Value: aws.String(tc.value)}}}
+		if got := externalDNSOwned(rr); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s %s %s: got %q, want %q", tc.name, tc.typ, tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestReconcile_coexist(t *testing.T) {
+	const owned = `"heritage=external-dns,external-dns/owner=default"`
+	r53svc := newFakeRoute53(t,
+		"web.foo.example.com. A 5.5.5.5",
+		"web.foo.example.com. TXT "+owned,
+		"api.foo.example.com. CNAME lb.example.net",
+		"cname-api.foo.example.com. TXT "+owned,
+		"svc.foo.example.com. A 6.6.6.6",
+		"a-svc.foo.example.com. TXT "+owned,
+		"gone.foo.example.com. A 7.7.7.7",
+	)
+	s := &syncer{
+		ec2: &fakeEC2{instances: []*ec2.Instance{
+			testInstance("i-1", "web", "", "1.2.3.4"),
+			testInstance("i-2", "api", "", "2.2.2.2"),
+			testInstance("i-3", "db", "", "3.3.3.3"),
+		}},
+		r53:     r53svc,
+		suffix:  ".foo.example.com",
+		zoneID:  "Z1",
+		coexist: coexistExternalDNS,
+	}
+	if err := s.update(context.Background(), "", new(runStats)); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"a-svc.foo.example.com. TXT " + owned,
+		"api.foo.example.com. CNAME lb.example.net",
+		"cname-api.foo.example.com. TXT " + owned,
+		"db.foo.example.com. A 3.3.3.3",
+		"svc.foo.example.com. A 6.6.6.6",
+		"web.foo.example.com. A 5.5.5.5",
+		"web.foo.example.com. TXT " + owned,
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
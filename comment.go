@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"text/template"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+)
+
+// maxCommentLen is the maximum length of Route 53 change batch comment
+const maxCommentLen = 256
+
+// commentData is the data -comment template is executed with
+type commentData struct {
+	Comment   string // default comment describing the update, like "automated removal of i-1"
+	ZoneID    string
+	InvokerID string // id of the instance which triggered the update, if any
+	RequestID string // Lambda request id, if running as Lambda
+	Creates   int    // number of records to create
+	Updates   int    // number of records to update
+	Deletes   int    // number of records to delete
+
+	Principal   string // ARN of AWS identity the program runs as, with -audit-metadata
+	Version     string // program version
+	InstanceIDs string // comma-separated ids of instances records to change belong to
+}
+
+// parseComment parses change batch comment template
+func parseComment(text string) (*template.Template, error) {
+	return template.New("comment").Option("missingkey=error").Parse(text)
+}
+
+// changeComment returns change batch comment for changes described by
+// summary: the default comment, or the one rendered from s.comment template,
+// if set. Rendered comment is truncated to fit Route 53 limit.
+func (s *syncer) changeComment(ctx context.Context, zoneID, invokerID, comment string, summary []recordChange) string {
+	if s.comment == nil {
+		if s.auditMetadata {
+			comment = truncateComment(comment + " " + s.commentMetadata(summary))
+		}
+		return comment
+	}
+	data := commentData{Comment: comment, ZoneID: zoneID, InvokerID: invokerID, Principal: s.principal,
+		Version: programVersion(), InstanceIDs: strings.Join(summaryInstances(summary), ",")}
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		data.RequestID = lc.AwsRequestID
+	}
+	for _, c := range summary {
+		switch c.Action {
+		case "create":
+			data.Creates++
+		case "update":
+			data.Updates++
+		case "delete":
+			data.Deletes++
+		}
+	}
+	var b strings.Builder
+	if err := s.comment.Execute(&b, data); err != nil {
+		logMsg("rendering change batch comment", "zone_id", zoneID, "error", err)
+		return comment
+	}
+	return truncateComment(b.String())
+}
+
+// truncateComment truncates change batch comment to fit Route 53 limit
+func truncateComment(s string) string {
+	if r := []rune(s); len(r) > maxCommentLen {
+		return string(r[:maxCommentLen])
+	}
+	return s
+}
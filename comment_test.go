@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func TestChangeComment(t *testing.T) {
+	r53svc := newFakeRoute53(t,
+		"web.foo.example.com. A 9.9.9.9",
+		"gone.foo.example.com. A 5.6.7.8",
+	)
+	tpl, err := parseComment("{{.Comment}} req={{.RequestID}} zone={{.ZoneID}} +{{.Creates}} ~{{.Updates}} -{{.Deletes}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &syncer{
+		ec2: &fakeEC2{instances: []*ec2.Instance{
+			testInstance("i-1", "web", "", "1.2.3.4"),
+			testInstance("i-2", "db", "", "2.2.2.2"),
+			testInstance("i-3", "ci", "", "3.3.3.3"),
+		}},
+		r53:     r53svc,
+		suffix:  ".foo.example.com",
+		zoneID:  "Z1",
+		comment: tpl,
+	}
+	ctx := lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{AwsRequestID: "req-1"})
+	if err := s.update(ctx, "", &runStats{}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"automated update for running instances req=req-1 zone=Z1 +2 ~1 -1"}
+	if !reflect.DeepEqual(r53svc.comments, want) {
+		t.Fatalf("got comments %q, want %q", r53svc.comments, want)
+	}
+
+	if s.comment, err = parseComment(strings.Repeat("x", 300)); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.changeComment(ctx, "Z1", "", "default", nil); len(got) != maxCommentLen {
+		t.Fatalf("got comment of %d characters, want %d", len(got), maxCommentLen)
+	}
+	if s.comment, err = parseComment("{{.Bogus}}"); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.changeComment(ctx, "Z1", "", "default", nil); got != "default" {
+		t.Fatalf("got comment %q for failed template, want the default one", got)
+	}
+}
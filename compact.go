@@ -0,0 +1,143 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+// compactInstance returns copy of instance as returned by DescribeInstances
+// with only the fields the program uses, so that large fleets don't keep
+// block device mappings, security groups and other unused details of every
+// instance in memory for the whole update. Fields read from instances
+// returned by runningInstances must be copied here.
+func compactInstance(inst *ec2.Instance) *ec2.Instance {
+	out := &ec2.Instance{
+		ImageId:           inst.ImageId,
+		InstanceId:        inst.InstanceId,
+		InstanceLifecycle: inst.InstanceLifecycle,
+		Ipv6Address:       inst.Ipv6Address,
+		LaunchTime:        inst.LaunchTime,
+		PrivateDnsName:    inst.PrivateDnsName,
+		PrivateIpAddress:  inst.PrivateIpAddress,
+		PublicDnsName:     inst.PublicDnsName,
+		PublicIpAddress:   inst.PublicIpAddress,
+		Tags:              inst.Tags,
+		VpcId:             inst.VpcId,
+	}
+	if inst.State != nil {
+		out.State = &ec2.InstanceState{Name: inst.State.Name}
+	}
+	if inst.Placement != nil {
+		out.Placement = &ec2.Placement{AvailabilityZone: inst.Placement.AvailabilityZone}
+	}
+	if len(inst.NetworkInterfaces) != 0 {
+		nis := make([]ec2.InstanceNetworkInterface, len(inst.NetworkInterfaces))
+		out.NetworkInterfaces = make([]*ec2.InstanceNetworkInterface, len(inst.NetworkInterfaces))
+		for i, ni := range inst.NetworkInterfaces {
+			nis[i] = ec2.InstanceNetworkInterface{
+				Association:        compactAssociation(ni.Association),
+				Ipv6Addresses:      ni.Ipv6Addresses,
+				NetworkInterfaceId: ni.NetworkInterfaceId,
+			}
+			if ni.Attachment != nil {
+				nis[i].Attachment = &ec2.InstanceNetworkInterfaceAttachment{DeviceIndex: ni.Attachment.DeviceIndex}
+			}
+			for _, addr := range ni.PrivateIpAddresses {
+				// only public addresses of secondary private ones
+				// are used
+				if a := compactAssociation(addr.Association); a != nil {
+					nis[i].PrivateIpAddresses = append(nis[i].PrivateIpAddresses,
+						&ec2.InstancePrivateIpAddress{Association: a})
+				}
+			}
+			out.NetworkInterfaces[i] = &nis[i]
+		}
+	}
+	return out
+}
+
+// compactAssociation returns copy of network interface association with only
+// the fields the program uses, or nil if a is nil
+func compactAssociation(a *ec2.InstanceNetworkInterfaceAssociation) *ec2.InstanceNetworkInterfaceAssociation {
+	if a == nil {
+		return nil
+	}
+	return &ec2.InstanceNetworkInterfaceAssociation{IpOwnerId: a.IpOwnerId, PublicIp: a.PublicIp}
+}
+
+// record is compact form of record set listed from the zone, see listRecords.
+// Most record sets only have name, type, TTL and values, which are kept as
+// plain values rather than SDK structs with a pointer per field. The rest,
+// like alias or weighted record sets, are kept as listed in rr.
+type record struct {
+	name   string // as listed, with trailing dot
+	typ    string
+	ttl    int64
+	values []string
+	rr     *route53.ResourceRecordSet // nil if simpleRecord(rr)
+}
+
+// compactRecord returns compact form of record set
+func compactRecord(rr *route53.ResourceRecordSet) record {
+	r := record{name: aws.StringValue(rr.Name), typ: aws.StringValue(rr.Type)}
+	if !simpleRecord(rr) {
+		r.rr = rr
+		return r
+	}
+	r.ttl = aws.Int64Value(rr.TTL)
+	r.values = make([]string, len(rr.ResourceRecords))
+	for i, v := range rr.ResourceRecords {
+		r.values[i] = aws.StringValue(v.Value)
+	}
+	return r
+}
+
+// simpleRecord reports whether record set has no fields set other than name,
+// type, TTL and values
+func simpleRecord(rr *route53.ResourceRecordSet) bool {
+	return rr.TTL != nil && rr.AliasTarget == nil && rr.CidrRoutingConfig == nil && rr.Failover == nil &&
+		rr.GeoLocation == nil && rr.HealthCheckId == nil && rr.MultiValueAnswer == nil && rr.Region == nil &&
+		rr.SetIdentifier == nil && rr.TrafficPolicyInstanceId == nil && rr.Weight == nil
+}
+
+// setID returns set identifier of the record set, if any
+func (r record) setID() string {
+	if r.rr == nil {
+		return ""
+	}
+	return aws.StringValue(r.rr.SetIdentifier)
+}
+
+// key returns recordKey of the record set
+func (r record) key() string {
+	return strings.TrimSuffix(r.name, ".") + " " + r.typ + " " + r.setID()
+}
+
+// recordSet returns record set r was made of, or an identical one
+func (r record) recordSet() *route53.ResourceRecordSet {
+	if r.rr != nil {
+		return r.rr
+	}
+	rr := &route53.ResourceRecordSet{
+		Name:            aws.String(r.name),
+		Type:            aws.String(r.typ),
+		TTL:             aws.Int64(r.ttl),
+		ResourceRecords: make([]*route53.ResourceRecord, len(r.values)),
+	}
+	for i, v := range r.values {
+		rr.ResourceRecords[i] = &route53.ResourceRecord{Value: aws.String(v)}
+	}
+	return rr
+}
+
+// same reports whether record set is the same as desired one, see sameRecord
+func (r record) same(desired *route53.ResourceRecordSet) bool {
+	if r.rr != nil || !simpleRecord(desired) {
+		return sameRecord(r.recordSet(), desired)
+	}
+	return r.typ == aws.StringValue(desired.Type) && r.ttl == aws.Int64Value(desired.TTL) &&
+		sameValues(r.values, recordValues(desired))
+}
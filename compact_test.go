@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+func TestCompactInstance(t *testing.T) {
+	inst := fleetInstance(1)
+	inst = withEIP(inst, "3.3.3.3")
+	inst.Ipv6Address = aws.String("2001:db8::1")
+	inst.NetworkInterfaces[0].Ipv6Addresses = []*ec2.InstanceIpv6Address{{Ipv6Address: aws.String("2001:db8::1")}}
+	inst.NetworkInterfaces[0].PrivateIpAddresses = append(inst.NetworkInterfaces[0].PrivateIpAddresses,
+		&ec2.InstancePrivateIpAddress{PrivateIpAddress: aws.String("172.16.0.2"),
+			Association: &ec2.InstanceNetworkInterfaceAssociation{IpOwnerId: aws.String("amazon"), PublicIp: aws.String("4.4.4.4")}})
+	withTag(withTag(inst, aliasesTag, "www"), wildcardTag, "true")
+	records := func(inst *ec2.Instance) []*route53.ResourceRecordSet {
+		s := &syncer{suffix: ".foo.example.com", ttl: defaultTTL, dualstack: true, txtMetadata: true, allAddresses: true}
+		desired := s.desiredRecords([]*ec2.Instance{inst}, new(runStats))
+		desired = append(desired, s.derivedRecords(desired)...)
+		var out []*route53.ResourceRecordSet
+		for _, d := range desired {
+			out = append(out, d.rr)
+		}
+		return out
+	}
+	want := records(inst)
+	if len(want) < 6 {
+		t.Fatalf("got %d records of full instance, want A, AAAA and TXT records of all names", len(want))
+	}
+	compact := compactInstance(inst)
+	if got := records(compact); !reflect.DeepEqual(got, want) {
+		t.Fatalf("records of compact instance differ:\ngot  %v\nwant %v", got, want)
+	}
+	if got, want := elasticIP(compact), elasticIP(inst); got != want {
+		t.Fatalf("got elastic IP %q of compact instance, want %q", got, want)
+	}
+	if got, want := instanceRegion(compact), instanceRegion(inst); got != want {
+		t.Fatalf("got region %q of compact instance, want %q", got, want)
+	}
+	if compact.BlockDeviceMappings != nil || compact.SecurityGroups != nil || compact.NetworkInterfaces[0].Groups != nil {
+		t.Fatal("compact instance has unused fields")
+	}
+}
+
+func TestCompactRecord(t *testing.T) {
+	table := []*route53.ResourceRecordSet{
+		{Name: aws.String("web.foo.example.com."), Type: aws.String("A"), TTL: aws.Int64(60),
+			ResourceRecords: []*route53.ResourceRecord{{Value: aws.String("1.2.3.4")}, {Value: aws.String("5.6.7.8")}}},
+		{Name: aws.String("web.foo.example.com."), Type: aws.String("TXT"), TTL: aws.Int64(60),
+			ResourceRecords: []*route53.ResourceRecord{{Value: aws.String(`"instance-id=i-1"`)}}},
+		{Name: aws.String("db.foo.example.com."), Type: aws.String("A"), TTL: aws.Int64(60), SetIdentifier: aws.String("i-1"),
+			Weight: aws.Int64(10), ResourceRecords: []*route53.ResourceRecord{{Value: aws.String("1.2.3.4")}}},
+		{Name: aws.String("lb.foo.example.com."), Type: aws.String("A"), AliasTarget: &route53.AliasTarget{
+			DNSName: aws.String("lb-1.us-east-1.elb.amazonaws.com."), HostedZoneId: aws.String("Z2"), EvaluateTargetHealth: aws.Bool(false)}},
+	}
+	for _, rr := range table {
+		r := compactRecord(rr)
+		if got, want := r.key(), recordKey(rr); got != want {
+			t.Errorf("got key %q, want %q", got, want)
+		}
+		if got := r.recordSet(); !reflect.DeepEqual(got, rr) {
+			t.Errorf("record set differs from the listed one:\ngot  %v\nwant %v", got, rr)
+		}
+		if simpleRecord(rr) != (r.rr == nil) {
+			t.Errorf("%s: got full record set kept %v", recordKey(rr), r.rr != nil)
+		}
+		desired := *rr
+		if !r.same(&desired) {
+			t.Errorf("%s: record differs from its copy", recordKey(rr))
+		}
+		desired.TTL = aws.Int64(300)
+		if r.same(&desired) {
+			t.Errorf("%s: record is the same as one with another TTL", recordKey(rr))
+		}
+		desired = *rr
+		desired.HealthCheckId = aws.String("hc-1")
+		if r.same(&desired) {
+			t.Errorf("%s: record is the same as one with health check", recordKey(rr))
+		}
+	}
+	// values may come in any order
+	r := compactRecord(table[0])
+	desired := *table[0]
+	desired.ResourceRecords = []*route53.ResourceRecord{{Value: aws.String("5.6.7.8")}, {Value: aws.String("1.2.3.4")}}
+	if !r.same(&desired) {
+		t.Error("record differs from one with values reordered")
+	}
+	if got := r.values; got[0] != "1.2.3.4" {
+		t.Errorf("values of compact record were reordered: %q", got)
+	}
+}
+
+// fleetSize is the number of instances and records of benchmarked fleet
+const fleetSize = 3000
+
+// fleetInstance returns instance as DescribeInstances returns it, with fields
+// the program doesn't use populated too
+func fleetInstance(i int) *ec2.Instance {
+	inst := testInstance(fmt.Sprintf("i-%017x", i), fmt.Sprintf("host-%d", i), "",
+		fmt.Sprintf("10.%d.%d.%d", i>>16&255, i>>8&255, i&255))
+	for _, k := range []string{"team", "env", "service", "cost-center", "owner", "aws:autoscaling:groupName"} {
+		inst.Tags = append(inst.Tags, &ec2.Tag{Key: aws.String(k), Value: aws.String(k + "-value")})
+	}
+	inst.LaunchTime = aws.Time(time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC))
+	inst.Placement = &ec2.Placement{AvailabilityZone: aws.String("us-east-1a"), Tenancy: aws.String("default")}
+	inst.ImageId, inst.InstanceType = aws.String("ami-0123456789abcdef0"), aws.String("m5.large")
+	inst.PrivateIpAddress = aws.String(fmt.Sprintf("172.16.%d.%d", i>>8&255, i&255))
+	inst.PrivateDnsName = aws.String("ip-172-16-0-1.ec2.internal")
+	inst.SubnetId, inst.VpcId = aws.String("subnet-0123456789abcdef0"), aws.String("vpc-0123456789abcdef0")
+	for _, dev := range []string{"/dev/xvda", "/dev/xvdb"} {
+		inst.BlockDeviceMappings = append(inst.BlockDeviceMappings, &ec2.InstanceBlockDeviceMapping{
+			DeviceName: aws.String(dev),
+			Ebs: &ec2.EbsInstanceBlockDevice{VolumeId: aws.String("vol-0123456789abcdef0"),
+				Status: aws.String("attached"), AttachTime: inst.LaunchTime, DeleteOnTermination: aws.Bool(true)},
+		})
+	}
+	inst.SecurityGroups = []*ec2.GroupIdentifier{{GroupId: aws.String("sg-0123456789abcdef0"), GroupName: aws.String("default")}}
+	inst.NetworkInterfaces = []*ec2.InstanceNetworkInterface{{
+		NetworkInterfaceId: aws.String("eni-0123456789abcdef0"),
+		Attachment:         &ec2.InstanceNetworkInterfaceAttachment{DeviceIndex: aws.Int64(0), Status: aws.String("attached")},
+		Association:        &ec2.InstanceNetworkInterfaceAssociation{IpOwnerId: aws.String("amazon"), PublicIp: inst.PublicIpAddress},
+		Groups:             []*ec2.GroupIdentifier{{GroupId: aws.String("sg-0123456789abcdef0"), GroupName: aws.String("default")}},
+		MacAddress:         aws.String("0a:00:00:00:00:01"),
+		PrivateIpAddress:   inst.PrivateIpAddress,
+		PrivateIpAddresses: []*ec2.InstancePrivateIpAddress{{PrivateIpAddress: inst.PrivateIpAddress, Primary: aws.Bool(true)}},
+	}}
+	inst.IamInstanceProfile = &ec2.IamInstanceProfile{Arn: aws.String("arn:aws:iam::123456789012:instance-profile/web")}
+	inst.MetadataOptions = &ec2.InstanceMetadataOptionsResponse{HttpTokens: aws.String("required")}
+	return inst
+}
+
+// fleetEC2 serves fleetSize instances in pages of 1000, freshly allocated on
+// each call like SDK responses are
+type fleetEC2 struct{}
+
+func (fleetEC2) DescribeInstancesWithContext(_ aws.Context, in *ec2.DescribeInstancesInput, _ ...request.Option) (*ec2.DescribeInstancesOutput, error) {
+	start, _ := strconv.Atoi(aws.StringValue(in.NextToken))
+	end := start + 1000
+	var next *string
+	if end < fleetSize {
+		next = aws.String(strconv.Itoa(end))
+	} else {
+		end = fleetSize
+	}
+	r := &ec2.Reservation{}
+	for i := start; i < end; i++ {
+		r.Instances = append(r.Instances, fleetInstance(i))
+	}
+	return &ec2.DescribeInstancesOutput{Reservations: []*ec2.Reservation{r}, NextToken: next}, nil
+}
+
+// fleetZone is a provider serving records of fleet instances, a tenth of them
+// outdated, surrounded by as many records of other subdomains. Records are
+// freshly allocated on each listing like SDK responses are.
+type fleetZone struct{}
+
+func (fleetZone) list(_ context.Context, _, startName, _ string, fn func(*route53.ResourceRecordSet) bool) error {
+	start := dnsOrder(startName)
+	for _, sub := range []string{"bar", "foo", "qux"} {
+		for i := 0; i < fleetSize; i++ {
+			name := fmt.Sprintf("host-%d.%s.example.com.", i, sub)
+			if dnsOrder(name) < start {
+				continue
+			}
+			value := "192.0.2.1"
+			if sub == "foo" && i%10 != 0 {
+				value = fmt.Sprintf("10.%d.%d.%d", i>>16&255, i>>8&255, i&255)
+			}
+			if !fn(&route53.ResourceRecordSet{Name: aws.String(name), Type: aws.String("A"), TTL: aws.Int64(defaultTTL),
+				ResourceRecords: []*route53.ResourceRecord{{Value: aws.String(value)}}}) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+func (fleetZone) apply(context.Context, string, string, []*route53.Change) (string, error) {
+	return "C1", nil
+}
+
+func (fleetZone) zoneInfo(context.Context, string) (zoneInfo, error) {
+	return zoneInfo{Name: "example.com"}, nil
+}
+
+func BenchmarkUpdate_fleet(b *testing.B) {
+	s := &syncer{ec2: fleetEC2{}, dns: fleetZone{}, suffix: ".foo.example.com", zoneID: "Z1", ttl: defaultTTL,
+		parallelism: 1}
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := s.update(context.Background(), "", new(runStats)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkManagedInstances_fleet reports heap retained by instances kept
+// for the duration of an update, compared to keeping them as listed
+func BenchmarkManagedInstances_fleet(b *testing.B) {
+	b.Run("sdk", func(b *testing.B) {
+		benchmarkRetained(b, func() (int, interface{}, error) {
+			var out []*ec2.Instance
+			in := &ec2.DescribeInstancesInput{}
+			for {
+				resp, err := fleetEC2{}.DescribeInstancesWithContext(context.Background(), in)
+				if err != nil {
+					return 0, nil, err
+				}
+				for _, r := range resp.Reservations {
+					out = append(out, r.Instances...)
+				}
+				if in.NextToken = resp.NextToken; in.NextToken == nil {
+					return len(out), out, nil
+				}
+			}
+		})
+	})
+	b.Run("compact", func(b *testing.B) {
+		s := &syncer{ec2: fleetEC2{}, suffix: ".foo.example.com", parallelism: 1}
+		benchmarkRetained(b, func() (int, interface{}, error) {
+			instances, err := s.managedInstances(context.Background())
+			return len(instances), instances, err
+		})
+	})
+}
+
+// BenchmarkListRecords_fleet reports heap retained by record sets kept for
+// the duration of an update, compared to keeping them as listed
+func BenchmarkListRecords_fleet(b *testing.B) {
+	b.Run("sdk", func(b *testing.B) {
+		benchmarkRetained(b, func() (int, interface{}, error) {
+			var out []*route53.ResourceRecordSet
+			err := fleetZone{}.list(context.Background(), "Z1", "foo.example.com.", "", func(rr *route53.ResourceRecordSet) bool {
+				if !strings.HasSuffix(*rr.Name, ".foo.example.com.") {
+					return false
+				}
+				out = append(out, rr)
+				return true
+			})
+			return len(out), out, err
+		})
+	})
+	b.Run("compact", func(b *testing.B) {
+		s := &syncer{dns: fleetZone{}, suffix: ".foo.example.com", zoneID: "Z1"}
+		benchmarkRetained(b, func() (int, interface{}, error) {
+			records, err := s.listRecords(context.Background())
+			return len(records), records, err
+		})
+	})
+}
+
+// benchmarkRetained runs fn, which returns fleetSize items and the value
+// holding them, reporting heap retained by that value as retained-B/op
+func benchmarkRetained(b *testing.B, fn func() (int, interface{}, error)) {
+	var before, after runtime.MemStats
+	var retained uint64
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		b.StartTimer()
+		n, v, err := fn()
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.StopTimer()
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		runtime.KeepAlive(v)
+		if n != fleetSize {
+			b.Fatalf("got %d items, want %d", n, fleetSize)
+		}
+		retained += after.HeapAlloc - before.HeapAlloc
+		b.StartTimer()
+	}
+	b.ReportMetric(float64(retained)/float64(b.N), "retained-B/op")
+}
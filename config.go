@@ -0,0 +1,618 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/elasticache"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/aws/aws-sdk-go/service/lightsail"
+	"github.com/aws/aws-sdk-go/service/organizations"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// config holds program settings. Fields with "flag" tag are set from command
+// line flags; fields with "env" tag are set from environment variables in
+// Lambda mode.
+type config struct {
+	Suffix  string `flag:"suffix,dns zone suffix, i.e. .subdomain.example.com; defaults to the hosted zone name" env:"SUFFIX"`
+	Zone    string `flag:"zone,Route 53 hosted zone id" env:"ZONE"`
+	Domain  string `flag:"domain,hosted zone domain name, alternative to -zone" env:"DOMAIN"`
+	Private bool   `flag:"prefer-private,with -domain, prefer private hosted zone if both private and public exist" env:"PREFER_PRIVATE"`
+	Create  bool   `flag:"create-zone,with -domain, create hosted zone if none exists, private one with -prefer-private" env:"CREATE_ZONE"`
+
+	ReverseZone string `flag:"reverse-zone,id of in-addr.arpa or ip6.arpa hosted zone to keep PTR records of instances private addresses in" env:"REVERSE_ZONE"`
+	AllowApex   bool   `flag:"allow-apex,allow suffix equal to hosted zone name, publishing records right under the zone apex" env:"ALLOW_APEX"`
+	CanaryZone  string `flag:"canary-zone,id of staging hosted zone to apply each change batch to first, before the production zone" env:"CANARY_ZONE"`
+
+	EndpointURL string `flag:"endpoint-url,URL to send AWS API requests to instead of default endpoints, like http://localhost:4566 for LocalStack"`
+	Profile     string `flag:"profile,shared config profile to take credentials and region from"`
+	Region      string `flag:"region,AWS region, overriding one from environment and shared config"`
+	Partition   string `flag:"partition,AWS partition to resolve endpoints in: aws, aws-cn or aws-us-gov; derived from region if empty" env:"PARTITION"`
+	FIPS        bool   `flag:"fips,use FIPS endpoints, like AWS_USE_FIPS_ENDPOINT=true"`
+
+	CABundle string `flag:"ca-bundle,PEM file with extra CA certificates to trust for AWS API calls, like one of TLS-intercepting proxy"`
+
+	EnvSuffixes string `flag:"env-suffixes,comma-separated env=suffix pairs placing instances into suffixes by their -env-tag tag, like prod=.example.com,staging=.stg.example.com" env:"ENV_SUFFIXES"`
+	EnvTag      string `flag:"env-tag,instance tag holding environment name, used with -env-suffixes" env:"ENV_TAG"`
+
+	RFC2136Server string `flag:"rfc2136-server,host:port of DNS server to also keep records with private addresses of instances on, using dynamic updates (RFC 2136)" env:"RFC2136_SERVER"`
+	RFC2136Zone   string `flag:"rfc2136-zone,zone to update on -rfc2136-server; defaults to suffix domain" env:"RFC2136_ZONE"`
+	RFC2136Key    string `flag:"rfc2136-key,TSIG key to sign updates for -rfc2136-server with, as algorithm:name:base64 secret" env:"RFC2136_KEY"`
+
+	Filters  tagFilters `flag:"filter,only manage instances with tag key=value (can be repeated)" env:"FILTER"`
+	Exclude  tagFilters `flag:"exclude-filter,do not manage instances with tag key=value (can be repeated)" env:"EXCLUDE_FILTER"`
+	VPCID    string     `flag:"vpc-id,only manage instances in these comma-separated VPCs" env:"VPC_ID"`
+	SubnetID string     `flag:"subnet-id,only manage instances in these comma-separated subnets" env:"SUBNET_ID"`
+
+	Parallelism int `flag:"parallelism,maximum number of concurrent calls discovering instances and other resources" env:"PARALLELISM"`
+	PageSize    int `flag:"describe-page-size,number of instances to describe per EC2 API call, from 5 to 1000; 0 means API default" env:"DESCRIBE_PAGE_SIZE"`
+
+	ListPageSize     int           `flag:"list-page-size,number of records to list per Route 53 API call, up to 300; 0 means API default" env:"LIST_PAGE_SIZE"`
+	ListPageInterval time.Duration `flag:"list-page-interval,minimum interval between Route 53 API calls listing pages of records" env:"LIST_PAGE_INTERVAL"`
+	ListCheckpoint   string        `flag:"list-checkpoint,directory or s3://bucket/prefix URL to save position of listing interrupted by timeout or -max-api-calls to, resuming it on the next run" env:"LIST_CHECKPOINT"`
+
+	Regions  string `flag:"regions,also manage instances in these comma-separated regions" env:"REGIONS"`
+	Accounts string `flag:"accounts,also manage instances of accounts of these comma-separated role ARNs, assuming the roles" env:"ACCOUNTS"`
+	Org      bool   `flag:"org,also manage instances of all active organization accounts, assuming -org-role in each" env:"ORG"`
+	OrgRole  string `flag:"org-role,name of role to assume in organization accounts with -org" env:"ORG_ROLE"`
+
+	ECSCluster string `flag:"ecs-cluster,also manage records of running tasks of this ECS cluster" env:"ECS_CLUSTER"`
+	Lightsail  bool   `flag:"lightsail,also manage records of running Lightsail instances" env:"LIGHTSAIL"`
+	Sources    string `flag:"sources,comma-separated sources of hosts to use: ec2, ecs, lightsail; ecs and lightsail also need their flags; empty means ec2 and sources enabled by their flags" env:"SOURCES"`
+	DBTag      string `flag:"db-tag,create CNAME records for RDS and ElastiCache endpoints with this tag, named by its value" env:"DB_TAG"`
+	Manifest   string `flag:"manifest,local file or s3://bucket/key URL of JSON manifest of static records to keep under suffix" env:"MANIFEST"`
+	LBTag      string `flag:"lb-tag,create alias records for load balancers with this tag, named by its value, like dns:name" env:"LB_TAG"`
+	Aliases    bool   `flag:"manage-aliases,delete and overwrite alias records under suffix not created by the program, like other records" env:"MANAGE_ALIASES"`
+
+	ManagePattern string `flag:"manage-pattern,only create, change and delete records which names before suffix fully match this regular expression" env:"MANAGE_PATTERN"`
+	IgnorePattern string `flag:"ignore-pattern,never create, change or delete records which names before suffix fully match this regular expression" env:"IGNORE_PATTERN"`
+	Coexist       string `flag:"coexist,never create, change or delete records under names owned by another controller sharing the zone: external-dns" env:"COEXIST"`
+
+	Sanitize     bool   `flag:"sanitize,turn invalid instance names into valid host names instead of skipping them" env:"SANITIZE"`
+	EKSCluster   string `flag:"eks-cluster,name worker nodes of this EKS cluster by their Kubernetes node names instead of Name tag" env:"EKS_CLUSTER"`
+	FallbackName string `flag:"fallback-name,name instances without Name tag by their instance-id or private-ip instead of skipping them" env:"FALLBACK_NAME"`
+	IDN          bool   `flag:"idn,convert internationalized instance names and suffix to punycode" env:"IDN"`
+	RequireEIP   bool   `flag:"require-eip,skip instances without elastic IP" env:"REQUIRE_EIP"`
+	KeepStopped  bool   `flag:"keep-stopped,keep records of stopped instances, pointing them to elastic IPs of ones having them" env:"KEEP_STOPPED"`
+	StateActions string `flag:"state-actions,comma-separated state=action pairs overriding actions on instance state-change events: upsert, delete or ignore, like stopping=delete" env:"STATE_ACTIONS"`
+	AllAddresses bool   `flag:"all-addresses,publish public IPs of all instance network interfaces as A records" env:"ALL_ADDRESSES"`
+	TXTMetadata  bool   `flag:"txt-metadata,publish TXT records with instance id, availability zone, AMI and launch time next to A records" env:"TXT_METADATA"`
+	Dualstack    bool   `flag:"dualstack,also publish AAAA records of instances with IPv6 addresses next to their A records" env:"DUALSTACK"`
+	FQDNTag      string `flag:"fqdn-tag,tag instances with their DNS names using this tag key, like awsns:fqdn" env:"FQDN_TAG"`
+	Prefer       string `flag:"prefer,record type of instances without dns:record-type tag: auto, A or CNAME" env:"PREFER"`
+	SRV          bool   `flag:"srv,publish SRV records for services listed in dns:srv instance tags" env:"SRV"`
+
+	MinAge      time.Duration `flag:"min-age,skip instances launched less than this long ago, like 90s, as their addresses may not be populated yet" env:"MIN_AGE"`
+	AddressWait time.Duration `flag:"address-wait,on instance launch events, wait up to this long for the instance to get public address, like 30s" env:"ADDRESS_WAIT"`
+
+	TTL         int           `flag:"ttl,default record TTL in seconds" env:"TTL"`
+	IgnoreTag   string        `flag:"ignore-tag,instances with this tag set to true are left alone, as are their records" env:"IGNORE_TAG"`
+	GroupPolicy string        `flag:"group-policy,how to publish instances sharing the same name: empty, weighted, multivalue or latency" env:"GROUP_POLICY"`
+	VPCCheck    string        `flag:"vpc-check,check that private zone is associated with VPCs of instances before update: off, warn or fail" env:"VPC_CHECK"`
+	OnConflict  string        `flag:"on-conflict,without -group-policy, which of instances sharing the same name gets the record: newest or oldest, or fail the update" env:"ON_CONFLICT"`
+	Grace       time.Duration `flag:"deletion-grace,only delete records after their instances are gone for this long, like 15m" env:"DELETION_GRACE"`
+	Mode        string        `flag:"mode,which changes to make: full, upsert (never delete records) or cleanup (only delete stale records)" env:"MODE"`
+	FastLaunch  bool          `flag:"fast-launch,on Lambda instance launch events only upsert records of the launched instance when possible, without full update" env:"FAST_LAUNCH"`
+	HealthCheck string        `flag:"health-check,create health checks of instances public IPs, proto:port[/path], like tcp:22 or https:443/healthz" env:"HEALTH_CHECK"`
+	Watch       bool          `flag:"watch,keep running, periodically repeating update"`
+	Self        bool          `flag:"self,only upsert records of the instance the program runs on, read from its metadata"`
+	SelfDereg   bool          `flag:"self-deregister,only delete records of the instance the program runs on, read from its metadata"`
+	Confirm     bool          `flag:"confirm,print planned changes and ask for confirmation before applying them"`
+	Interval    time.Duration `flag:"interval,delay between updates in -watch mode"`
+	LogFormat   string        `flag:"log-format,log format: text or json" env:"LOG_FORMAT"`
+	Debug       bool          `flag:"debug,log AWS API requests and responses, and why instances get no records and records are removed" env:"DEBUG"`
+	Output      string        `flag:"output,run summary printed to stdout: text (none) or json" env:"OUTPUT"`
+	Comment     string        `flag:"comment,change batch comment template, with .Comment, .ZoneID, .InvokerID, .RequestID, .Creates, .Updates, .Deletes, .Principal, .Version and .InstanceIDs fields" env:"COMMENT"`
+	Expect      bool          `flag:"expect-changes,fail if there are no changes to apply" env:"EXPECT_CHANGES"`
+	Wait        bool          `flag:"wait,wait for applied changes to propagate to all Route 53 nameservers" env:"WAIT"`
+	Verify      bool          `flag:"verify,after applying changes check that zone nameservers serve upserted records" env:"VERIFY"`
+	MaxRetries  int           `flag:"max-retries,how many times to retry throttled Route 53 record calls" env:"MAX_RETRIES"`
+	MaxAPICalls int           `flag:"max-api-calls,abort update after this many EC2 and Route 53 API calls, including retries; 0 means no limit" env:"MAX_API_CALLS"`
+
+	Probe        string        `flag:"probe,only create records of instances once they accept connections on this port, tcp:port, like tcp:22" env:"PROBE"`
+	ProbeTimeout time.Duration `flag:"probe-timeout,how long to wait for -probe connection" env:"PROBE_TIMEOUT"`
+
+	TwoPhase    bool `flag:"two-phase,apply upserts and deletions of full update in separate change batches, deletions last" env:"TWO_PHASE"`
+	KeepOnError bool `flag:"keep-on-error,with -two-phase, skip deletions if upserts fail" env:"KEEP_ON_ERROR"`
+
+	MetricsAddr string `flag:"metrics-addr,address to serve Prometheus /metrics on in -watch mode"`
+	HTTPAddr    string `flag:"http-addr,address to serve /healthz and POST /sync triggering update on in -watch mode"`
+	CloudWatch  bool   `flag:"metrics,publish custom CloudWatch metrics after each update" env:"METRICS"`
+	StatsdAddr  string `flag:"statsd-addr,host:port of statsd or DogStatsD agent to send metrics to over UDP after each update" env:"STATSD_ADDR"`
+
+	StatusRecord bool `flag:"status-record,keep _awsns TXT record under suffix with time, program version and number of changes of the last successful full update" env:"STATUS_RECORD"`
+
+	SNSTopic     string `flag:"notify-sns-arn,SNS topic ARN to publish summary of applied changes to" env:"NOTIFY_SNS_ARN"`
+	NotifyURL    string `flag:"notify-url,URL to POST summary of applied changes to" env:"NOTIFY_URL"`
+	NotifyFormat string `flag:"notify-format,format of -notify-url payload: json or slack" env:"NOTIFY_FORMAT"`
+	EventBus     string `flag:"notify-event-bus,name or ARN of EventBridge event bus to send event with applied changes to" env:"NOTIFY_EVENT_BUS"`
+
+	LockTable string        `flag:"lock-table,DynamoDB table to keep zone lock in" env:"LOCK_TABLE"`
+	LockTTL   time.Duration `flag:"lock-ttl,zone lock lease duration" env:"LOCK_TTL"`
+	LockWait  time.Duration `flag:"lock-wait,how long to wait for zone lock held by another process" env:"LOCK_WAIT"`
+
+	AuditS3    string `flag:"audit-s3,s3://bucket/prefix URL to save change batch audit records to" env:"AUDIT_S3"`
+	AuditTable string `flag:"audit-table,DynamoDB table to save change batch audit records to" env:"AUDIT_TABLE"`
+	AuditMeta  bool   `flag:"audit-metadata,include AWS principal, program version and instance ids in change batch comments and audit records" env:"AUDIT_METADATA"`
+
+	Snapshot string `flag:"snapshot,directory or s3://bucket/prefix URL to save prior state of changed records to before each change batch" env:"SNAPSHOT"`
+}
+
+// defaultConfig returns config with default values set
+func defaultConfig() config {
+	return config{
+		TTL:          defaultTTL,
+		OrgRole:      "awsns",
+		Parallelism:  defaultParallelism,
+		IgnoreTag:    defaultIgnoreTag,
+		EnvTag:       defaultEnvTag,
+		Interval:     5 * time.Minute,
+		Mode:         modeFull,
+		OnConflict:   conflictNewest,
+		VPCCheck:     vpcCheckOff,
+		Prefer:       "auto",
+		LogFormat:    "text",
+		Output:       "text",
+		MaxRetries:   5,
+		NotifyFormat: "json",
+		LockTTL:      5 * time.Minute,
+		LockWait:     30 * time.Second,
+		ProbeTimeout: defaultProbeTimeout,
+	}
+}
+
+// loadEnv sets fields with "env" tag from non-empty values returned by getenv
+func (c *config) loadEnv(getenv func(string) string) error {
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Tag.Get("env")
+		if name == "" {
+			continue
+		}
+		s := getenv(name)
+		if s == "" {
+			continue
+		}
+		switch f := v.Field(i).Addr().Interface().(type) {
+		case flag.Value:
+			// comma-separated list for repeatable flags
+			for _, part := range strings.Split(s, ",") {
+				if err := f.Set(part); err != nil {
+					return fmt.Errorf("%s: %w", name, err)
+				}
+			}
+		case *string:
+			*f = s
+		case *bool:
+			b, err := strconv.ParseBool(s)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			*f = b
+		case *int:
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			*f = n
+		case *time.Duration:
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			*f = d
+		default:
+			panic(fmt.Sprintf("config field for %s is of unsupported type %T", name, f))
+		}
+	}
+	return nil
+}
+
+// env returns environment variables which make loadEnv reproduce c, for
+// fields with "env" tag that differ from defaultConfig
+func (c config) env() map[string]string {
+	out := make(map[string]string)
+	v, def := reflect.ValueOf(&c).Elem(), reflect.ValueOf(defaultConfig())
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Tag.Get("env")
+		if name == "" || reflect.DeepEqual(v.Field(i).Interface(), def.Field(i).Interface()) {
+			continue
+		}
+		switch f := v.Field(i).Addr().Interface().(type) {
+		case flag.Value:
+			out[name] = f.String()
+		default:
+			out[name] = fmt.Sprint(v.Field(i).Interface())
+		}
+	}
+	return out
+}
+
+// setup returns syncer configured according to cfg
+func setup(ctx context.Context, sess *session.Session, cfg config) (*syncer, error) {
+	if err := setLogFormat(cfg.LogFormat); err != nil {
+		return nil, err
+	}
+	if logDebug = cfg.Debug; cfg.Debug {
+		// clients copy session config on creation, so this must be done
+		// before any of them is created
+		sess.Config.WithLogger(aws.LoggerFunc(func(args ...interface{}) { log.Println(args...) })).
+			WithLogLevel(aws.LogDebugWithHTTPBody | aws.LogDebugWithRequestRetries | aws.LogDebugWithRequestErrors)
+	}
+	if cfg.Zone != "" && cfg.Domain != "" {
+		return nil, fmt.Errorf("zone id and domain are mutually exclusive")
+	}
+	if err := checkPartition(cfg.Partition, append([]string{aws.StringValue(sess.Config.Region)}, splitList(cfg.Regions)...)...); err != nil {
+		return nil, err
+	}
+	if cfg.EnvSuffixes != "" {
+		if cfg.RFC2136Server != "" {
+			return nil, errors.New("-rfc2136-server cannot be used with -env-suffixes")
+		}
+		return setupEnvs(ctx, sess, cfg)
+	}
+	if cfg.RFC2136Server != "" {
+		c := cfg
+		c.RFC2136Server = ""
+		s, err := setup(ctx, sess, c)
+		if err != nil {
+			return nil, err
+		}
+		return withRFC2136(s, cfg)
+	}
+	if cfg.IDN {
+		cfg.Suffix, cfg.Domain = toASCII(cfg.Suffix), toASCII(cfg.Domain)
+	}
+	if cfg.Domain != "" {
+		var err error
+		cfg.Zone, err = findZone(ctx, route53.New(sess), cfg.Domain, cfg.Private)
+		switch {
+		case errors.Is(err, errNoZone) && cfg.Create:
+			var vpcs []string
+			if cfg.Private {
+				if vpcs = splitList(cfg.VPCID); len(vpcs) == 0 {
+					return nil, fmt.Errorf("-create-zone with -prefer-private requires -vpc-id to associate the zone with")
+				}
+			}
+			if cfg.Zone, err = createZone(ctx, route53.New(sess), cfg.Domain, aws.StringValue(sess.Config.Region), vpcs); err != nil {
+				return nil, err
+			}
+			logMsg("created hosted zone", "zone_id", cfg.Zone, "domain", cfg.Domain, "private", cfg.Private)
+		case err != nil:
+			return nil, err
+		default:
+			logMsg("found hosted zone", "zone_id", cfg.Zone, "domain", cfg.Domain)
+		}
+	}
+	// suffix defaulting to zone name is the zone apex by intent
+	allowApex := cfg.AllowApex || cfg.Suffix == ""
+	if cfg.Suffix == "" && cfg.Zone != "" {
+		var err error
+		if cfg.Suffix, err = zoneSuffix(ctx, route53Provider{svc: route53.New(sess)}, cfg.Zone); err != nil {
+			return nil, err
+		}
+		logMsg("using hosted zone name as suffix", "zone_id", cfg.Zone, "suffix", cfg.Suffix)
+	}
+	var m *metrics
+	if cfg.Watch && cfg.MetricsAddr != "" {
+		m = new(metrics)
+		// clients copy session handlers on creation, so this must be done
+		// before newSyncer call
+		sess.Handlers.Complete.PushBack(m.countAPIErrors)
+	}
+	var sd *statsd
+	if cfg.StatsdAddr != "" {
+		var err error
+		if sd, err = newStatsd(cfg.StatsdAddr, cfg.Zone, cfg.Suffix); err != nil {
+			return nil, err
+		}
+		sess.Handlers.Complete.PushBack(sd.countAPIErrors)
+	}
+	var budget *apiBudget
+	if cfg.MaxAPICalls > 0 {
+		budget = &apiBudget{max: int64(cfg.MaxAPICalls)}
+		sess.Handlers.Sign.PushBack(budget.check)
+	}
+	s, err := newSyncer(sess, cfg.Suffix, cfg.Zone)
+	if err != nil {
+		return nil, err
+	}
+	s.metrics, s.statsd, s.budget = m, sd, budget
+	if cfg.MaxRetries > 0 {
+		s.r53 = newRetryingRoute53(s.r53, cfg.MaxRetries)
+	}
+	if s.ttl = int64(cfg.TTL); !validTTL(s.ttl) {
+		return nil, fmt.Errorf("invalid TTL %d, must be between 0 and %d seconds", cfg.TTL, maxTTL)
+	}
+	switch cfg.Output {
+	case "", "text":
+	case "json":
+		s.summary = os.Stdout
+	default:
+		return nil, fmt.Errorf("unsupported output format %q", cfg.Output)
+	}
+	if cfg.Self {
+		switch {
+		case cfg.Watch:
+			return nil, fmt.Errorf("-self cannot be used with -watch")
+		case cfg.SelfDereg:
+			return nil, fmt.Errorf("-self cannot be used with -self-deregister")
+		case cfg.RequireEIP:
+			return nil, fmt.Errorf("-self cannot be used with -require-eip")
+		case cfg.Mode == modeCleanup:
+			return nil, fmt.Errorf("-self cannot be used with -mode=%s", modeCleanup)
+		case cfg.Coexist != "":
+			return nil, fmt.Errorf("-self cannot be used with -coexist")
+		}
+	}
+	if cfg.SelfDereg {
+		switch {
+		case cfg.Watch:
+			return nil, fmt.Errorf("-self-deregister cannot be used with -watch")
+		case cfg.Mode == modeUpsert:
+			return nil, fmt.Errorf("-self-deregister cannot be used with -mode=%s", modeUpsert)
+		case cfg.Coexist != "":
+			return nil, fmt.Errorf("-self-deregister cannot be used with -coexist")
+		}
+	}
+	if cfg.Confirm {
+		if cfg.Watch {
+			return nil, fmt.Errorf("-confirm cannot be used with -watch")
+		}
+		s.confirm = newConfirmer(os.Stdin, os.Stderr)
+	}
+	if cfg.Comment != "" {
+		if s.comment, err = parseComment(cfg.Comment); err != nil {
+			return nil, fmt.Errorf("invalid comment template: %w", err)
+		}
+	}
+	s.ignoreTag = cfg.IgnoreTag
+	s.expectChanges = cfg.Expect
+	s.wait = cfg.Wait
+	if cfg.Verify {
+		s.resolver = nameserverResolver
+	}
+	s.fastLaunch = cfg.FastLaunch
+	if s.deletionGrace = cfg.Grace; s.deletionGrace < 0 {
+		return nil, fmt.Errorf("invalid deletion grace period %v", cfg.Grace)
+	}
+	s.filters, s.exclude = cfg.Filters, cfg.Exclude
+	s.requireEIP, s.allAddresses = cfg.RequireEIP, cfg.AllAddresses
+	s.keepStopped = cfg.KeepStopped
+	if s.minAge = cfg.MinAge; s.minAge < 0 {
+		return nil, errors.New("-min-age cannot be negative")
+	}
+	s.addressWait = cfg.AddressWait
+	if cfg.KeepOnError && !cfg.TwoPhase {
+		return nil, errors.New("-keep-on-error requires -two-phase")
+	}
+	s.twoPhase, s.keepOnError = cfg.TwoPhase, cfg.KeepOnError
+	if s.stateActions, err = parseStateActions(cfg.StateActions); err != nil {
+		return nil, err
+	}
+	if s.keepStopped && s.stateActions[ec2.InstanceStateNameStopped] == actionDelete {
+		return nil, fmt.Errorf("-keep-stopped cannot be used with stopped=delete state action")
+	}
+	s.srv, s.txtMetadata = cfg.SRV, cfg.TXTMetadata
+	s.dualstack = cfg.Dualstack
+	s.parallelism = cfg.Parallelism
+	if cfg.PageSize != 0 && (cfg.PageSize < 5 || cfg.PageSize > 1000) {
+		return nil, fmt.Errorf("-describe-page-size must be between 5 and 1000")
+	}
+	s.pageSize = cfg.PageSize
+	if cfg.ListPageSize < 0 || cfg.ListPageSize > 300 {
+		return nil, fmt.Errorf("-list-page-size must be between 1 and 300")
+	}
+	s.listPageSize, s.listPageInterval = cfg.ListPageSize, cfg.ListPageInterval
+	s.sanitize, s.idn = cfg.Sanitize, cfg.IDN
+	s.eksCluster = cfg.EKSCluster
+	if s.fallbackName = cfg.FallbackName; !validFallbackName(cfg.FallbackName) {
+		return nil, fmt.Errorf("unsupported fallback name %q", cfg.FallbackName)
+	}
+	if cfg.VPCID != "" {
+		s.filters = append(s.filters, listFilter("vpc-id", cfg.VPCID))
+	}
+	if cfg.SubnetID != "" {
+		s.filters = append(s.filters, listFilter("subnet-id", cfg.SubnetID))
+	}
+	if s.groupPolicy = cfg.GroupPolicy; !validGroupPolicy(cfg.GroupPolicy) {
+		return nil, fmt.Errorf("unsupported group policy %q", cfg.GroupPolicy)
+	}
+	if s.onConflict = cfg.OnConflict; !validConflictPolicy(cfg.OnConflict) {
+		return nil, fmt.Errorf("unsupported conflict policy %q", cfg.OnConflict)
+	}
+	if s.vpcCheck = cfg.VPCCheck; !validVPCCheck(cfg.VPCCheck) {
+		return nil, fmt.Errorf("unsupported VPC check %q", cfg.VPCCheck)
+	}
+	roles := splitList(cfg.Accounts)
+	if cfg.Org {
+		id, err := sts.New(sess).GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{})
+		if err != nil {
+			return nil, err
+		}
+		more, err := orgRoles(ctx, organizations.New(sess), cfg.OrgRole, aws.StringValue(id.Account))
+		if err != nil {
+			return nil, fmt.Errorf("listing organization accounts: %w", err)
+		}
+		roles = append(roles, more...)
+	}
+	if s.remotes, err = remoteClients(sess, splitList(cfg.Regions), roles); err != nil {
+		return nil, err
+	}
+	if cfg.FQDNTag != "" {
+		switch {
+		case cfg.FQDNTag == "Name" || strings.HasPrefix(cfg.FQDNTag, "dns:"):
+			return nil, fmt.Errorf("-fqdn-tag cannot be Name or dns: tag, as these set instance records")
+		case len(s.remotes) != 0:
+			return nil, fmt.Errorf("-fqdn-tag cannot be used with -regions, -accounts or -org")
+		case cfg.Lightsail:
+			return nil, fmt.Errorf("-fqdn-tag cannot be used with -lightsail")
+		}
+		s.tagger, s.fqdnTag = ec2.New(sess), cfg.FQDNTag
+	}
+	s.manageAliases = cfg.Aliases
+	if s.managePattern, err = compileNamePattern(cfg.ManagePattern); err != nil {
+		return nil, fmt.Errorf("-manage-pattern: %w", err)
+	}
+	if s.ignorePattern, err = compileNamePattern(cfg.IgnorePattern); err != nil {
+		return nil, fmt.Errorf("-ignore-pattern: %w", err)
+	}
+	switch cfg.Coexist {
+	case "", coexistExternalDNS:
+		s.coexist = cfg.Coexist
+	default:
+		return nil, fmt.Errorf("unsupported coexist mode %q", cfg.Coexist)
+	}
+	if cfg.LBTag != "" {
+		s.elb, s.elbv2, s.lbTag = elb.New(sess), elbv2.New(sess), cfg.LBTag
+	}
+	if cfg.Lightsail {
+		s.lightsail = lightsail.New(sess)
+	}
+	if cfg.DBTag != "" {
+		s.rds, s.elasticache, s.dbTag = rds.New(sess), elasticache.New(sess), cfg.DBTag
+	}
+	if cfg.Manifest != "" {
+		s.manifest = &manifestSource{where: cfg.Manifest}
+		if strings.HasPrefix(cfg.Manifest, "s3://") {
+			if _, _, err := parseS3URL(cfg.Manifest); err != nil {
+				return nil, err
+			}
+			s.manifest.s3 = s3.New(sess)
+		}
+	}
+	if cfg.ECSCluster != "" {
+		s.ecs, s.enis, s.ecsCluster = ecs.New(sess), ec2.New(sess), cfg.ECSCluster
+	}
+	sources, err := parseSources(cfg.Sources)
+	if err != nil {
+		return nil, err
+	}
+	if sources != nil {
+		switch {
+		case sources[sourceECS] != (cfg.ECSCluster != ""):
+			return nil, errors.New("-sources must list ecs if and only if -ecs-cluster is set")
+		case sources[sourceLightsail] != cfg.Lightsail:
+			return nil, errors.New("-sources must list lightsail if and only if -lightsail is set")
+		case !sources[sourceEC2] && len(s.remotes) != 0:
+			return nil, errors.New("-regions, -accounts and -org need ec2 in -sources")
+		case !sources[sourceEC2] && (cfg.Self || cfg.SelfDereg):
+			return nil, errors.New("-self and -self-deregister need ec2 in -sources")
+		}
+		s.noEC2 = !sources[sourceEC2]
+	}
+	if err := s.validateSuffix(ctx, allowApex); err != nil {
+		return nil, err
+	}
+	if cfg.CanaryZone != "" {
+		if cfg.CanaryZone == s.zoneID {
+			return nil, errors.New("-canary-zone must differ from the production zone")
+		}
+		if s.canaryFrom, err = zoneSuffix(ctx, s.provider(), s.zoneID); err != nil {
+			return nil, err
+		}
+		if s.canaryTo, err = zoneSuffix(ctx, s.provider(), cfg.CanaryZone); err != nil {
+			return nil, err
+		}
+		s.canaryZoneID = cfg.CanaryZone
+	}
+	if cfg.ReverseZone != "" {
+		if s.reverseZone, err = zoneSuffix(ctx, route53Provider{svc: route53.New(sess)}, cfg.ReverseZone); err != nil {
+			return nil, err
+		}
+		if !strings.HasSuffix(s.reverseZone, ".in-addr.arpa") && !strings.HasSuffix(s.reverseZone, ".ip6.arpa") {
+			return nil, fmt.Errorf("zone %s (%s) is not a reverse zone", cfg.ReverseZone, s.reverseZone[1:])
+		}
+		s.reverseZoneID = cfg.ReverseZone
+	}
+	if s.mode = cfg.Mode; !validMode(cfg.Mode) {
+		return nil, fmt.Errorf("unsupported mode %q", cfg.Mode)
+	}
+	var ok bool
+	if s.prefer, ok = validPreference(cfg.Prefer); !ok {
+		return nil, fmt.Errorf("unsupported record type preference %q", cfg.Prefer)
+	}
+	if cfg.HealthCheck != "" {
+		if s.healthCheck, err = parseHealthCheck(cfg.HealthCheck); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Probe != "" {
+		if s.probePort, err = parseProbe(cfg.Probe); err != nil {
+			return nil, err
+		}
+	}
+	s.probeTimeout = cfg.ProbeTimeout
+	s.statusRecord = cfg.StatusRecord
+	if cfg.CloudWatch {
+		s.cw = cloudwatch.New(sess)
+	}
+	if cfg.SNSTopic != "" {
+		s.sns, s.snsTopic = sns.New(sess), cfg.SNSTopic
+	}
+	if cfg.EventBus != "" {
+		s.events, s.eventBus = eventbridge.New(sess), cfg.EventBus
+	}
+	if cfg.NotifyURL != "" {
+		if s.webhook, err = newWebhook(cfg.NotifyURL, cfg.NotifyFormat); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.LockTable != "" {
+		s.lock = newZoneLock(dynamodb.New(sess), cfg.LockTable, cfg.LockTTL, cfg.LockWait)
+	}
+	if cfg.AuditS3 != "" {
+		if s.auditBucket, s.auditPrefix, err = parseS3URL(cfg.AuditS3); err != nil {
+			return nil, err
+		}
+		s.auditS3 = s3.New(sess)
+	}
+	if cfg.AuditTable != "" {
+		s.auditDB, s.auditTable = dynamodb.New(sess), cfg.AuditTable
+	}
+	if cfg.AuditMeta {
+		id, err := sts.New(sess).GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{})
+		if err != nil {
+			return nil, fmt.Errorf("looking up caller identity: %w", err)
+		}
+		s.auditMetadata, s.principal = true, aws.StringValue(id.Arn)
+	}
+	if strings.HasPrefix(cfg.Snapshot, "s3://") {
+		if s.snapshotBucket, s.snapshotPrefix, err = parseS3URL(cfg.Snapshot); err != nil {
+			return nil, err
+		}
+		s.snapshotS3 = s3.New(sess)
+	} else {
+		s.snapshotDir = cfg.Snapshot
+	}
+	if strings.HasPrefix(cfg.ListCheckpoint, "s3://") {
+		if s.checkpointBucket, s.checkpointPrefix, err = parseS3URL(cfg.ListCheckpoint); err != nil {
+			return nil, err
+		}
+		s.checkpointS3 = s3.New(sess)
+	} else {
+		s.checkpointDir = cfg.ListCheckpoint
+	}
+	return s, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConfigLoadEnv(t *testing.T) {
+	env := map[string]string{
+		"SUFFIX":     ".foo.example.com",
+		"ZONE":       "Z1",
+		"METRICS":    "1",
+		"LOCK_TABLE": "locks",
+		"LOCK_WAIT":  "5s",
+	}
+	cfg := defaultConfig()
+	if err := cfg.loadEnv(func(k string) string { return env[k] }); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Suffix != ".foo.example.com" || cfg.Zone != "Z1" || !cfg.CloudWatch ||
+		cfg.LockTable != "locks" || cfg.LockWait != 5*time.Second {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+	if cfg.LockTTL != 5*time.Minute {
+		t.Fatalf("default LockTTL was overwritten: %v", cfg.LockTTL)
+	}
+	env["LOCK_TTL"] = "forever"
+	if err := cfg.loadEnv(func(k string) string { return env[k] }); err == nil {
+		t.Fatal("invalid duration accepted")
+	}
+}
+
+func TestConfigLoadEnv_filters(t *testing.T) {
+	cfg := defaultConfig()
+	env := map[string]string{"FILTER": "Environment=prod,Team=web"}
+	if err := cfg.loadEnv(func(k string) string { return env[k] }); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := cfg.Filters.String(), "Environment=prod,Team=web"; got != want {
+		t.Fatalf("got filters %q, want %q", got, want)
+	}
+	env["FILTER"] = "Environment"
+	if err := cfg.loadEnv(func(k string) string { return env[k] }); err == nil {
+		t.Fatal("invalid filter accepted")
+	}
+}
+
+func TestConfigEnv(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Suffix, cfg.Zone = ".foo.example.com", "Z1"
+	cfg.CloudWatch = true
+	cfg.LockWait = 5 * time.Second
+	cfg.Filters.Set("Environment=prod")
+	cfg.Filters.Set("Team=web")
+	cfg.Watch = true // no env tag
+	env := cfg.env()
+	want := map[string]string{
+		"SUFFIX":    ".foo.example.com",
+		"ZONE":      "Z1",
+		"METRICS":   "true",
+		"LOCK_WAIT": "5s",
+		"FILTER":    "Environment=prod,Team=web",
+	}
+	if !reflect.DeepEqual(env, want) {
+		t.Fatalf("got env %v, want %v", env, want)
+	}
+	got := defaultConfig()
+	if err := got.loadEnv(func(k string) string { return env[k] }); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Watch = false
+	if !reflect.DeepEqual(got, cfg) {
+		t.Fatalf("config loaded from env differs:\ngot  %+v\nwant %+v", got, cfg)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// errNotConfirmed is returned when user declines applying planned changes
+var errNotConfirmed = errors.New("changes were not confirmed")
+
+// confirmer prints planned changes and asks user whether they should be
+// applied
+type confirmer struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func newConfirmer(in io.Reader, out io.Writer) *confirmer {
+	return &confirmer{in: bufio.NewReader(in), out: out}
+}
+
+// ask prints changes planned for the zone and reports whether user answered
+// yes. Deletions are printed first and counted separately, as these are the
+// changes most worth a second look.
+func (c *confirmer) ask(zoneID string, changes []recordChange) (bool, error) {
+	var deletes int
+	for _, ch := range changes {
+		if ch.Action == "delete" {
+			deletes++
+		}
+	}
+	fmt.Fprintf(c.out, "planned changes for zone %s:\n", zoneID)
+	printChanges(c.out, changes)
+	fmt.Fprintf(c.out, "apply %d changes, %d of them deletions? [y/N] ", len(changes), deletes)
+	line, err := c.in.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
+
+// printChanges writes changes to w, one per line, deletions first
+func printChanges(w io.Writer, changes []recordChange) {
+	for _, del := range []bool{true, false} {
+		for _, ch := range changes {
+			if (ch.Action == "delete") != del {
+				continue
+			}
+			fmt.Fprintf(w, "  %-6s %s %s %s", ch.Action, ch.Name, ch.Type, ch.Value)
+			if ch.InstanceID != "" {
+				fmt.Fprintf(w, " (%s)", ch.InstanceID)
+			}
+			fmt.Fprintln(w)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func TestConfirmer(t *testing.T) {
+	changes := []recordChange{
+		{Action: "create", Name: "web.foo.example.com", Type: "A", Value: "1.2.3.4", InstanceID: "i-1"},
+		{Action: "delete", Name: "old.foo.example.com", Type: "A", Value: "5.6.7.8"},
+	}
+	for _, tc := range []struct {
+		input string
+		want  bool
+	}{
+		{"y\n", true},
+		{"YES\n", true},
+		{"yes", true},
+		{"\n", false},
+		{"n\n", false},
+		{"", false},
+	} {
+		var out bytes.Buffer
+		got, err := newConfirmer(strings.NewReader(tc.input), &out).ask("Z1", changes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Errorf("answer %q: got %v, want %v", tc.input, got, tc.want)
+		}
+		want := "planned changes for zone Z1:\n" +
+			"  delete old.foo.example.com A 5.6.7.8\n" +
+			"  create web.foo.example.com A 1.2.3.4 (i-1)\n" +
+			"apply 2 changes, 1 of them deletions? [y/N] "
+		if out.String() != want {
+			t.Fatalf("got prompt:\n%s\nwant:\n%s", out.String(), want)
+		}
+	}
+}
+
+func TestReconcile_notConfirmed(t *testing.T) {
+	r53svc := newFakeRoute53(t, "old.foo.example.com. A 5.6.7.8")
+	s := &syncer{
+		ec2:     &fakeEC2{instances: []*ec2.Instance{testInstance("i-1", "web", "", "1.2.3.4")}},
+		r53:     r53svc,
+		suffix:  ".foo.example.com",
+		zoneID:  "Z1",
+		confirm: newConfirmer(strings.NewReader("n\n"), new(bytes.Buffer)),
+	}
+	if err := s.update(context.Background(), "", new(runStats)); err != errNotConfirmed {
+		t.Fatalf("got error %v, want %v", err, errNotConfirmed)
+	}
+	want := []string{"old.foo.example.com. A 5.6.7.8"}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
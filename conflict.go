@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// conflict policies, how to publish instances sharing the same name without
+// group policy, see syncer.onConflict
+const (
+	conflictNewest = "newest" // the most recently launched instance gets the record
+	conflictOldest = "oldest" // the earliest launched instance gets the record
+	conflictFail   = "fail"   // update fails
+)
+
+func validConflictPolicy(policy string) bool {
+	switch policy {
+	case "", conflictNewest, conflictOldest, conflictFail:
+		return true
+	}
+	return false
+}
+
+// errNameConflict is returned by update with conflictFail policy if several
+// instances share the same name
+var errNameConflict = errors.New("several instances share the same name")
+
+// resolveConflict returns the record of the one instance to publish of the
+// group of records sharing the same name, picked by s.onConflict; with
+// conflictFail it is the newest one. Instances of other records are counted
+// in st.Skipped, and the conflict in st.Conflicts. Ties are broken by the
+// lowest instance id.
+func (s *syncer) resolveConflict(group []desiredRecord, st *runStats) desiredRecord {
+	sortByInstanceID(group)
+	sort.SliceStable(group, func(i, j int) bool {
+		a, b := aws.TimeValue(group[i].inst.LaunchTime), aws.TimeValue(group[j].inst.LaunchTime)
+		if s.onConflict == conflictOldest {
+			return a.Before(b)
+		}
+		return a.After(b)
+	})
+	ids := make([]string, len(group))
+	for i, d := range group {
+		ids[i] = aws.StringValue(d.inst.InstanceId)
+	}
+	logMsg("name is shared by several instances", "record_name", *group[0].rr.Name,
+		"instance_ids", strings.Join(ids, ","), "policy", s.conflictPolicy(), "instance_id", ids[0])
+	st.Conflicts++
+	for _, d := range group[1:] {
+		st.skip(d.inst, "name conflict")
+	}
+	return group[0]
+}
+
+// conflictPolicy returns s.onConflict, or its default
+func (s *syncer) conflictPolicy() string {
+	if s.onConflict == "" {
+		return conflictNewest
+	}
+	return s.onConflict
+}
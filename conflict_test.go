@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func TestReconcile_conflict(t *testing.T) {
+	launched := func(inst *ec2.Instance, hoursAgo int) *ec2.Instance {
+		inst.LaunchTime = aws.Time(time.Now().Add(-time.Duration(hoursAgo) * time.Hour))
+		return inst
+	}
+	for _, tc := range []struct {
+		policy string
+		want   string
+	}{
+		{"", "web.foo.example.com. A 5.6.7.8"},
+		{conflictNewest, "web.foo.example.com. A 5.6.7.8"},
+		{conflictOldest, "web.foo.example.com. A 1.2.3.4"},
+		{conflictFail, ""},
+	} {
+		r53svc := newFakeRoute53(t)
+		s := &syncer{
+			ec2: &fakeEC2{instances: []*ec2.Instance{
+				launched(testInstance("i-1", "web", "", "1.2.3.4"), 3),
+				launched(testInstance("i-2", "web", "", "5.6.7.8"), 1),
+				launched(testInstance("i-3", "web", "", "9.9.9.9"), 2),
+				testInstance("i-4", "db", "", "9.9.9.8"),
+			}},
+			r53:        r53svc,
+			suffix:     ".foo.example.com",
+			zoneID:     "Z1",
+			ttl:        defaultTTL,
+			onConflict: tc.policy,
+		}
+		var st runStats
+		err := s.update(context.Background(), "", &st)
+		if tc.policy == conflictFail {
+			if !errors.Is(err, errNameConflict) {
+				t.Fatalf("got error %v, want %v", err, errNameConflict)
+			}
+			if got := r53svc.dump(); len(got) != 0 {
+				t.Fatalf("zone changed despite conflict:\n%s", strings.Join(got, "\n"))
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"db.foo.example.com. A 9.9.9.8", tc.want}
+		if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+			t.Fatalf("policy %q: zone state mismatch\ngot:\n%s\nwant:\n%s", tc.policy,
+				strings.Join(got, "\n"), strings.Join(want, "\n"))
+		}
+		if st.Conflicts != 1 || st.Skipped != 2 {
+			t.Fatalf("policy %q: got %d conflicts and %d skipped instances, want 1 and 2",
+				tc.policy, st.Conflicts, st.Skipped)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elasticache"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+// rdsClient is a subset of rds API used by the program
+type rdsClient interface {
+	DescribeDBInstancesPagesWithContext(aws.Context, *rds.DescribeDBInstancesInput, func(*rds.DescribeDBInstancesOutput, bool) bool, ...request.Option) error
+	DescribeDBClustersPagesWithContext(aws.Context, *rds.DescribeDBClustersInput, func(*rds.DescribeDBClustersOutput, bool) bool, ...request.Option) error
+}
+
+// elasticacheClient is a subset of elasticache API used by the program
+type elasticacheClient interface {
+	DescribeCacheClustersPagesWithContext(aws.Context, *elasticache.DescribeCacheClustersInput, func(*elasticache.DescribeCacheClustersOutput, bool) bool, ...request.Option) error
+	DescribeReplicationGroupsPagesWithContext(aws.Context, *elasticache.DescribeReplicationGroupsInput, func(*elasticache.DescribeReplicationGroupsOutput, bool) bool, ...request.Option) error
+	ListTagsForResourceWithContext(aws.Context, *elasticache.ListTagsForResourceInput, ...request.Option) (*elasticache.TagListMessage, error)
+}
+
+// datastore is a database or cache that should have CNAME record
+type datastore struct {
+	id     string // RDS instance or cluster identifier, ElastiCache cluster or replication group id
+	name   string // host name from s.dbTag tag value
+	target string // endpoint address
+}
+
+// datastoreRecords returns CNAME records pointing to endpoints of RDS
+// instances and clusters and ElastiCache clusters and replication groups
+// having s.dbTag tag, named after the tag value. Each record is paired with a
+// placeholder instance having datastore id as its id. If several datastores
+// have the same name, the one with the lowest id wins.
+func (s *syncer) datastoreRecords(ctx context.Context) ([]desiredRecord, error) {
+	var stores []datastore
+	if s.rds != nil {
+		found, err := s.rdsDatastores(ctx)
+		if err != nil {
+			return nil, err
+		}
+		stores = append(stores, found...)
+	}
+	if s.elasticache != nil {
+		found, err := s.elasticacheDatastores(ctx)
+		if err != nil {
+			return nil, err
+		}
+		stores = append(stores, found...)
+	}
+	sort.Slice(stores, func(i, j int) bool { return stores[i].id < stores[j].id })
+	var out []desiredRecord
+	seen := make(map[string]string) // names to ids of datastores
+	for _, ds := range stores {
+		name := s.normalize(ds.name)
+		switch {
+		case ds.target == "":
+			continue
+		case name == "":
+			logMsg("ignoring datastore with invalid name", "datastore", ds.id, "tag", s.dbTag, "name", ds.name)
+			continue
+		case seen[name] != "":
+			logMsg("datastore name is already taken, skipping", "datastore", ds.id, "name", name,
+				"other_datastore", seen[name])
+			continue
+		}
+		seen[name] = ds.id
+		out = append(out, desiredRecord{
+			rr: &route53.ResourceRecordSet{
+				Name:            aws.String(name + s.suffix),
+				Type:            aws.String(route53.RRTypeCname),
+				TTL:             aws.Int64(s.ttl),
+				ResourceRecords: []*route53.ResourceRecord{{Value: aws.String(ds.target)}},
+			},
+			inst: &ec2.Instance{InstanceId: aws.String(ds.id)},
+		})
+	}
+	return out, nil
+}
+
+// rdsDatastores returns RDS instances and clusters having s.dbTag tag
+func (s *syncer) rdsDatastores(ctx context.Context) ([]datastore, error) {
+	tagValue := func(tags []*rds.Tag) (string, bool) {
+		for _, tag := range tags {
+			if aws.StringValue(tag.Key) == s.dbTag {
+				return aws.StringValue(tag.Value), true
+			}
+		}
+		return "", false
+	}
+	var out []datastore
+	fn := func(page *rds.DescribeDBInstancesOutput, lastPage bool) bool {
+		for _, db := range page.DBInstances {
+			name, ok := tagValue(db.TagList)
+			if !ok || aws.StringValue(db.DBInstanceStatus) == "deleting" || db.Endpoint == nil {
+				continue
+			}
+			out = append(out, datastore{
+				id:     aws.StringValue(db.DBInstanceIdentifier),
+				name:   name,
+				target: aws.StringValue(db.Endpoint.Address),
+			})
+		}
+		return true
+	}
+	if err := s.rds.DescribeDBInstancesPagesWithContext(ctx, &rds.DescribeDBInstancesInput{}, fn); err != nil {
+		return nil, err
+	}
+	clusterFn := func(page *rds.DescribeDBClustersOutput, lastPage bool) bool {
+		for _, c := range page.DBClusters {
+			name, ok := tagValue(c.TagList)
+			if !ok || aws.StringValue(c.Status) == "deleting" {
+				continue
+			}
+			out = append(out, datastore{
+				id:     aws.StringValue(c.DBClusterIdentifier),
+				name:   name,
+				target: aws.StringValue(c.Endpoint),
+			})
+		}
+		return true
+	}
+	if err := s.rds.DescribeDBClustersPagesWithContext(ctx, &rds.DescribeDBClustersInput{}, clusterFn); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// elasticacheDatastores returns ElastiCache replication groups and clusters
+// not belonging to replication groups having s.dbTag tag. Replication groups
+// point to their configuration endpoint in cluster mode, and to the primary
+// endpoint otherwise.
+func (s *syncer) elasticacheDatastores(ctx context.Context) ([]datastore, error) {
+	var candidates []datastore
+	var arns []string
+	groupFn := func(page *elasticache.DescribeReplicationGroupsOutput, lastPage bool) bool {
+		for _, g := range page.ReplicationGroups {
+			if aws.StringValue(g.Status) == "deleting" {
+				continue
+			}
+			ep := g.ConfigurationEndpoint
+			if ep == nil && len(g.NodeGroups) != 0 {
+				ep = g.NodeGroups[0].PrimaryEndpoint
+			}
+			if ep == nil {
+				continue
+			}
+			candidates = append(candidates, datastore{id: aws.StringValue(g.ReplicationGroupId), target: aws.StringValue(ep.Address)})
+			arns = append(arns, aws.StringValue(g.ARN))
+		}
+		return true
+	}
+	if err := s.elasticache.DescribeReplicationGroupsPagesWithContext(ctx, &elasticache.DescribeReplicationGroupsInput{}, groupFn); err != nil {
+		return nil, err
+	}
+	clusterFn := func(page *elasticache.DescribeCacheClustersOutput, lastPage bool) bool {
+		for _, c := range page.CacheClusters {
+			if c.ReplicationGroupId != nil || aws.StringValue(c.CacheClusterStatus) == "deleting" {
+				continue
+			}
+			ep := c.ConfigurationEndpoint
+			if ep == nil && len(c.CacheNodes) != 0 {
+				ep = c.CacheNodes[0].Endpoint
+			}
+			if ep == nil {
+				continue
+			}
+			candidates = append(candidates, datastore{id: aws.StringValue(c.CacheClusterId), target: aws.StringValue(ep.Address)})
+			arns = append(arns, aws.StringValue(c.ARN))
+		}
+		return true
+	}
+	if err := s.elasticache.DescribeCacheClustersPagesWithContext(ctx, &elasticache.DescribeCacheClustersInput{
+		ShowCacheNodeInfo: aws.Bool(true),
+	}, clusterFn); err != nil {
+		return nil, err
+	}
+	var out []datastore
+	for i, ds := range candidates {
+		resp, err := s.elasticache.ListTagsForResourceWithContext(ctx, &elasticache.ListTagsForResourceInput{
+			ResourceName: aws.String(arns[i]),
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, tag := range resp.TagList {
+			if aws.StringValue(tag.Key) == s.dbTag {
+				ds.name = aws.StringValue(tag.Value)
+				out = append(out, ds)
+				break
+			}
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elasticache"
+	"github.com/aws/aws-sdk-go/service/rds"
+)
+
+func TestReconcile_datastores(t *testing.T) {
+	tag := func(v string) []*rds.Tag { return []*rds.Tag{{Key: aws.String("dns:name"), Value: aws.String(v)}} }
+	rdssvc := &fakeRDS{
+		instances: []*rds.DBInstance{
+			{DBInstanceIdentifier: aws.String("orders"), DBInstanceStatus: aws.String("available"), TagList: tag("orders-db"),
+				Endpoint: &rds.Endpoint{Address: aws.String("orders.abc.us-east-1.rds.amazonaws.com")}},
+			{DBInstanceIdentifier: aws.String("old"), DBInstanceStatus: aws.String("deleting"), TagList: tag("old-db"),
+				Endpoint: &rds.Endpoint{Address: aws.String("old.abc.us-east-1.rds.amazonaws.com")}},
+			{DBInstanceIdentifier: aws.String("untagged"), DBInstanceStatus: aws.String("available"),
+				Endpoint: &rds.Endpoint{Address: aws.String("untagged.abc.us-east-1.rds.amazonaws.com")}},
+		},
+		clusters: []*rds.DBCluster{
+			{DBClusterIdentifier: aws.String("users"), Status: aws.String("available"), TagList: tag("db"),
+				Endpoint: aws.String("users.cluster-abc.us-east-1.rds.amazonaws.com")},
+		},
+	}
+	cachesvc := &fakeElastiCache{
+		groups: []*elasticache.ReplicationGroup{{
+			ReplicationGroupId: aws.String("sessions"),
+			ARN:                aws.String("arn:sessions"),
+			Status:             aws.String("available"),
+			NodeGroups: []*elasticache.NodeGroup{{
+				PrimaryEndpoint: &elasticache.Endpoint{Address: aws.String("sessions.abc.ng.0001.use1.cache.amazonaws.com")},
+			}},
+		}},
+		clusters: []*elasticache.CacheCluster{
+			{CacheClusterId: aws.String("sessions-001"), ReplicationGroupId: aws.String("sessions"), ARN: aws.String("arn:sessions-001")},
+			{CacheClusterId: aws.String("memcached"), ARN: aws.String("arn:memcached"), CacheClusterStatus: aws.String("available"),
+				ConfigurationEndpoint: &elasticache.Endpoint{Address: aws.String("memcached.abc.cfg.use1.cache.amazonaws.com")}},
+		},
+		tags: map[string]string{"arn:sessions": "redis", "arn:sessions-001": "node", "arn:memcached": "cache"},
+	}
+	r53svc := newFakeRoute53(t, "old-db.foo.example.com. CNAME old.abc.us-east-1.rds.amazonaws.com")
+	s := &syncer{
+		ec2:         &fakeEC2{instances: []*ec2.Instance{testInstance("i-1", "db", "", "1.2.3.4")}},
+		r53:         r53svc,
+		rds:         rdssvc,
+		elasticache: cachesvc,
+		dbTag:       "dns:name",
+		suffix:      ".foo.example.com",
+		zoneID:      "Z1",
+	}
+	if err := s.update(context.Background(), "", new(runStats)); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"cache.foo.example.com. CNAME memcached.abc.cfg.use1.cache.amazonaws.com",
+		"db.foo.example.com. A 1.2.3.4",
+		"orders-db.foo.example.com. CNAME orders.abc.us-east-1.rds.amazonaws.com",
+		"redis.foo.example.com. CNAME sessions.abc.ng.0001.use1.cache.amazonaws.com",
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+type fakeRDS struct {
+	instances []*rds.DBInstance
+	clusters  []*rds.DBCluster
+}
+
+func (f *fakeRDS) DescribeDBInstancesPagesWithContext(_ aws.Context, _ *rds.DescribeDBInstancesInput, fn func(*rds.DescribeDBInstancesOutput, bool) bool, _ ...request.Option) error {
+	fn(&rds.DescribeDBInstancesOutput{DBInstances: f.instances}, true)
+	return nil
+}
+
+func (f *fakeRDS) DescribeDBClustersPagesWithContext(_ aws.Context, _ *rds.DescribeDBClustersInput, fn func(*rds.DescribeDBClustersOutput, bool) bool, _ ...request.Option) error {
+	fn(&rds.DescribeDBClustersOutput{DBClusters: f.clusters}, true)
+	return nil
+}
+
+type fakeElastiCache struct {
+	groups   []*elasticache.ReplicationGroup
+	clusters []*elasticache.CacheCluster
+	tags     map[string]string // ARN to dns:name tag value
+}
+
+func (f *fakeElastiCache) DescribeCacheClustersPagesWithContext(_ aws.Context, _ *elasticache.DescribeCacheClustersInput, fn func(*elasticache.DescribeCacheClustersOutput, bool) bool, _ ...request.Option) error {
+	fn(&elasticache.DescribeCacheClustersOutput{CacheClusters: f.clusters}, true)
+	return nil
+}
+
+func (f *fakeElastiCache) DescribeReplicationGroupsPagesWithContext(_ aws.Context, _ *elasticache.DescribeReplicationGroupsInput, fn func(*elasticache.DescribeReplicationGroupsOutput, bool) bool, _ ...request.Option) error {
+	fn(&elasticache.DescribeReplicationGroupsOutput{ReplicationGroups: f.groups}, true)
+	return nil
+}
+
+func (f *fakeElastiCache) ListTagsForResourceWithContext(_ aws.Context, in *elasticache.ListTagsForResourceInput, _ ...request.Option) (*elasticache.TagListMessage, error) {
+	out := new(elasticache.TagListMessage)
+	if v, ok := f.tags[aws.StringValue(in.ResourceName)]; ok {
+		out.TagList = []*elasticache.Tag{{Key: aws.String("dns:name"), Value: aws.String(v)}}
+	}
+	return out, nil
+}
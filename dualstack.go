@@ -0,0 +1,71 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+// ipv6Addresses returns IPv6 addresses of the instance to publish as AAAA
+// record: the primary one, or, if s.allAddresses is set, sorted addresses of
+// all its network interfaces
+func (s *syncer) ipv6Addresses(inst *ec2.Instance) []string {
+	var primary string
+	var all []string
+	seen := make(map[string]bool)
+	for _, ni := range inst.NetworkInterfaces {
+		for _, a := range ni.Ipv6Addresses {
+			ip := aws.StringValue(a.Ipv6Address)
+			if ip == "" || seen[ip] {
+				continue
+			}
+			seen[ip] = true
+			all = append(all, ip)
+			if primary == "" && ni.Attachment != nil && aws.Int64Value(ni.Attachment.DeviceIndex) == 0 {
+				primary = ip
+			}
+		}
+	}
+	if s.allAddresses {
+		if ip := aws.StringValue(inst.Ipv6Address); ip != "" && !seen[ip] {
+			all = append(all, ip)
+		}
+		sort.Strings(all)
+		return all
+	}
+	switch {
+	case aws.StringValue(inst.Ipv6Address) != "":
+		return []string{*inst.Ipv6Address}
+	case primary != "":
+		return []string{primary}
+	case len(all) != 0:
+		return all[:1]
+	}
+	return nil
+}
+
+// dualstackRecords returns AAAA record sets for A records of instances having
+// IPv6 addresses, with the same name, TTL and routing policy. Records pointing
+// to targetTag addresses get none.
+func (s *syncer) dualstackRecords(records []desiredRecord) []desiredRecord {
+	var out []desiredRecord
+	for _, d := range records {
+		if aws.StringValue(d.rr.Type) != route53.RRTypeA || instanceTarget(d.inst) != "" {
+			continue
+		}
+		ips := s.ipv6Addresses(d.inst)
+		if len(ips) == 0 {
+			continue
+		}
+		rr := *d.rr
+		rr.Type = aws.String(route53.RRTypeAaaa)
+		rr.ResourceRecords = nil
+		for _, ip := range ips {
+			rr.ResourceRecords = append(rr.ResourceRecords, &route53.ResourceRecord{Value: aws.String(ip)})
+		}
+		out = append(out, desiredRecord{rr: &rr, inst: d.inst})
+	}
+	return out
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func TestReconcile_dualstack(t *testing.T) {
+	r53svc := newFakeRoute53(t,
+		"gone.foo.example.com. AAAA 2001:db8::9",
+		"gone.foo.example.com. A 9.9.9.9",
+	)
+	web := testInstance("i-1", "web", "ec2-1-2-3-4.compute-1.amazonaws.com", "1.2.3.4")
+	web.Ipv6Address = aws.String("2001:db8::1")
+	db := testInstance("i-2", "db", "ec2-5-6-7-8.compute-1.amazonaws.com", "5.6.7.8")
+	db.Ipv6Address = aws.String("2001:db8::2")
+	instances := []*ec2.Instance{
+		withTag(web, aliasesTag, "www"),
+		withTag(db, recordTypeTag, "CNAME"),
+		testInstance("i-3", "ci", "ec2-9-9-9-8.compute-1.amazonaws.com", "9.9.9.8"),
+	}
+	s := &syncer{
+		ec2:       &fakeEC2{instances: instances},
+		r53:       r53svc,
+		suffix:    ".foo.example.com",
+		zoneID:    "Z1",
+		ttl:       defaultTTL,
+		dualstack: true,
+	}
+	if err := s.update(context.Background(), "", &runStats{}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"ci.foo.example.com. CNAME ec2-9-9-9-8.compute-1.amazonaws.com",
+		"db.foo.example.com. CNAME ec2-5-6-7-8.compute-1.amazonaws.com",
+		"web.foo.example.com. A 1.2.3.4",
+		"web.foo.example.com. AAAA 2001:db8::1",
+		"www.foo.example.com. A 1.2.3.4",
+		"www.foo.example.com. AAAA 2001:db8::1",
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// removed instance takes its AAAA records with it
+	stopped(web)
+	if err := s.removeInstance(context.Background(), "i-1"); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{
+		"ci.foo.example.com. CNAME ec2-9-9-9-8.compute-1.amazonaws.com",
+		"db.foo.example.com. CNAME ec2-5-6-7-8.compute-1.amazonaws.com",
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
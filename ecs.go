@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+// ecsClient is a subset of ecs API used by the program
+type ecsClient interface {
+	ListTasksPagesWithContext(aws.Context, *ecs.ListTasksInput, func(*ecs.ListTasksOutput, bool) bool, ...request.Option) error
+	DescribeTasksWithContext(aws.Context, *ecs.DescribeTasksInput, ...request.Option) (*ecs.DescribeTasksOutput, error)
+}
+
+// eniClient is a subset of ec2 API used to look up addresses of ECS tasks
+type eniClient interface {
+	DescribeNetworkInterfacesWithContext(aws.Context, *ec2.DescribeNetworkInterfacesInput, ...request.Option) (*ec2.DescribeNetworkInterfacesOutput, error)
+}
+
+// ecsTasks returns running tasks of s.ecsCluster cluster having their own
+// network interface (awsvpc network mode, which includes all Fargate tasks),
+// represented as instances, so that they get records the same way instances
+// do. Such instance has task id as its id, task tags as its tags, and
+// addresses of the task network interface. If task has no "Name" tag, it is
+// named after its service, or its task definition family for tasks not
+// started by a service.
+func (s *syncer) ecsTasks(ctx context.Context) ([]*ec2.Instance, error) {
+	var arns []*string
+	fn := func(page *ecs.ListTasksOutput, lastPage bool) bool {
+		arns = append(arns, page.TaskArns...)
+		return true
+	}
+	if err := s.ecs.ListTasksPagesWithContext(ctx, &ecs.ListTasksInput{
+		Cluster:       &s.ecsCluster,
+		DesiredStatus: aws.String(ecs.DesiredStatusRunning),
+	}, fn); err != nil {
+		return nil, err
+	}
+	var out []*ec2.Instance
+	byENI := make(map[string]*ec2.Instance)
+	var eniIDs []*string
+	for len(arns) != 0 {
+		batch := arns
+		if len(batch) > 100 {
+			batch = batch[:100]
+		}
+		arns = arns[len(batch):]
+		resp, err := s.ecs.DescribeTasksWithContext(ctx, &ecs.DescribeTasksInput{
+			Cluster: &s.ecsCluster,
+			Tasks:   batch,
+			Include: []*string{aws.String(ecs.TaskFieldTags)},
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, task := range resp.Tasks {
+			if aws.StringValue(task.LastStatus) != ecs.DesiredStatusRunning {
+				continue
+			}
+			inst := taskInstance(task)
+			if inst == nil {
+				logMsg("skipping ECS task without network interface", "task_arn", aws.StringValue(task.TaskArn))
+				continue
+			}
+			out = append(out, inst)
+			eniID := inst.NetworkInterfaces[0].NetworkInterfaceId
+			byENI[*eniID] = inst
+			eniIDs = append(eniIDs, eniID)
+		}
+	}
+	for len(eniIDs) != 0 {
+		batch := eniIDs
+		if len(batch) > 200 {
+			batch = batch[:200]
+		}
+		eniIDs = eniIDs[len(batch):]
+		resp, err := s.enis.DescribeNetworkInterfacesWithContext(ctx, &ec2.DescribeNetworkInterfacesInput{
+			NetworkInterfaceIds: batch,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, eni := range resp.NetworkInterfaces {
+			inst := byENI[aws.StringValue(eni.NetworkInterfaceId)]
+			if inst == nil || eni.Association == nil {
+				continue
+			}
+			inst.PublicIpAddress = eni.Association.PublicIp
+			inst.PublicDnsName = eni.Association.PublicDnsName
+			inst.NetworkInterfaces[0].Association = &ec2.InstanceNetworkInterfaceAssociation{
+				IpOwnerId:     eni.Association.IpOwnerId,
+				PublicDnsName: eni.Association.PublicDnsName,
+				PublicIp:      eni.Association.PublicIp,
+			}
+		}
+	}
+	return out, nil
+}
+
+// taskInstance returns ECS task represented as instance without public
+// addresses, see ecsTasks. It returns nil if task has no network interface.
+func taskInstance(task *ecs.Task) *ec2.Instance {
+	var eniID, privateIP string
+	for _, att := range task.Attachments {
+		if aws.StringValue(att.Type) != "ElasticNetworkInterface" {
+			continue
+		}
+		for _, kv := range att.Details {
+			switch aws.StringValue(kv.Name) {
+			case "networkInterfaceId":
+				eniID = aws.StringValue(kv.Value)
+			case "privateIPv4Address":
+				privateIP = aws.StringValue(kv.Value)
+			}
+		}
+	}
+	if eniID == "" {
+		return nil
+	}
+	arn := aws.StringValue(task.TaskArn)
+	inst := &ec2.Instance{
+		InstanceId: aws.String(arn[strings.LastIndexByte(arn, '/')+1:]),
+		State:      &ec2.InstanceState{Name: aws.String(ec2.InstanceStateNameRunning)},
+		Placement:  &ec2.Placement{AvailabilityZone: task.AvailabilityZone},
+		NetworkInterfaces: []*ec2.InstanceNetworkInterface{{
+			NetworkInterfaceId: aws.String(eniID),
+			Attachment:         &ec2.InstanceNetworkInterfaceAttachment{DeviceIndex: aws.Int64(0)},
+		}},
+	}
+	if privateIP != "" {
+		inst.PrivateIpAddress = aws.String(privateIP)
+	}
+	var named bool
+	for _, tag := range task.Tags {
+		inst.Tags = append(inst.Tags, &ec2.Tag{Key: tag.Key, Value: tag.Value})
+		named = named || aws.StringValue(tag.Key) == "Name"
+	}
+	if !named {
+		name := strings.TrimPrefix(strings.TrimPrefix(aws.StringValue(task.Group), "service:"), "family:")
+		inst.Tags = append(inst.Tags, &ec2.Tag{Key: aws.String("Name"), Value: aws.String(name)})
+	}
+	return inst
+}
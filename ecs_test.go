@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+func TestReconcile_ecsTasks(t *testing.T) {
+	task := func(id, group, eniID string, tags ...string) *ecs.Task {
+		task := &ecs.Task{
+			TaskArn:    aws.String("arn:aws:ecs:us-east-1:123456789012:task/prod/" + id),
+			Group:      aws.String(group),
+			LastStatus: aws.String(ecs.DesiredStatusRunning),
+		}
+		if eniID != "" {
+			task.Attachments = []*ecs.Attachment{{
+				Type: aws.String("ElasticNetworkInterface"),
+				Details: []*ecs.KeyValuePair{
+					{Name: aws.String("networkInterfaceId"), Value: aws.String(eniID)},
+					{Name: aws.String("privateIPv4Address"), Value: aws.String("10.0.0.1")},
+				},
+			}}
+		}
+		for i := 0; i+1 < len(tags); i += 2 {
+			task.Tags = append(task.Tags, &ecs.Tag{Key: aws.String(tags[i]), Value: aws.String(tags[i+1])})
+		}
+		return task
+	}
+	ecssvc := &fakeECS{tasks: []*ecs.Task{
+		task("t1", "service:api", "eni-1"),
+		task("t2", "service:api", "eni-2"),
+		task("t3", "family:cron", "eni-3", "Name", "batch"),
+		task("t4", "service:bridged", ""),
+		task("t5", "family:private", "eni-5"),
+	}}
+	ecssvc.tasks[0].LastStatus = aws.String("PROVISIONING")
+	enis := fakeENIs{
+		"eni-1": "1.1.1.1",
+		"eni-2": "2.2.2.2",
+		"eni-3": "3.3.3.3",
+		"eni-5": "",
+	}
+	r53svc := newFakeRoute53(t, "old-task.foo.example.com. A 9.9.9.9")
+	s := &syncer{
+		ec2:         &fakeEC2{instances: []*ec2.Instance{testInstance("i-1", "api", "", "5.6.7.8")}},
+		r53:         r53svc,
+		ecs:         ecssvc,
+		enis:        enis,
+		ecsCluster:  "prod",
+		suffix:      ".foo.example.com",
+		zoneID:      "Z1",
+		groupPolicy: groupMultivalue,
+	}
+	var st runStats
+	if err := s.update(context.Background(), "", &st); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"api.foo.example.com. A 2.2.2.2 set=t2 multivalue",
+		"api.foo.example.com. A 5.6.7.8 set=i-1 multivalue",
+		"batch.foo.example.com. A 3.3.3.3",
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if st.Skipped != 1 {
+		t.Fatalf("got %d skipped instances, want 1 (task without public IP)", st.Skipped)
+	}
+}
+
+// fakeECS serves tasks, one per page
+type fakeECS struct {
+	tasks []*ecs.Task
+}
+
+func (f *fakeECS) ListTasksPagesWithContext(_ aws.Context, _ *ecs.ListTasksInput, fn func(*ecs.ListTasksOutput, bool) bool, _ ...request.Option) error {
+	for i, task := range f.tasks {
+		if !fn(&ecs.ListTasksOutput{TaskArns: []*string{task.TaskArn}}, i == len(f.tasks)-1) {
+			break
+		}
+	}
+	return nil
+}
+
+func (f *fakeECS) DescribeTasksWithContext(_ aws.Context, in *ecs.DescribeTasksInput, _ ...request.Option) (*ecs.DescribeTasksOutput, error) {
+	out := new(ecs.DescribeTasksOutput)
+	for _, task := range f.tasks {
+		if containsString(in.Tasks, aws.StringValue(task.TaskArn)) {
+			out.Tasks = append(out.Tasks, task)
+		}
+	}
+	return out, nil
+}
+
+// fakeENIs maps network interface ids to their public IPs
+type fakeENIs map[string]string
+
+func (f fakeENIs) DescribeNetworkInterfacesWithContext(_ aws.Context, in *ec2.DescribeNetworkInterfacesInput, _ ...request.Option) (*ec2.DescribeNetworkInterfacesOutput, error) {
+	out := new(ec2.DescribeNetworkInterfacesOutput)
+	for _, id := range in.NetworkInterfaceIds {
+		ip, ok := f[aws.StringValue(id)]
+		if !ok {
+			continue
+		}
+		eni := &ec2.NetworkInterface{NetworkInterfaceId: id}
+		if ip != "" {
+			eni.Association = &ec2.NetworkInterfaceAssociation{PublicIp: aws.String(ip), IpOwnerId: aws.String("amazon")}
+		}
+		out.NetworkInterfaces = append(out.NetworkInterfaces, eni)
+	}
+	return out, nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sns"
+)
+
+// endpointEnvSuffixes maps endpoint ids of services used by the program to
+// suffixes of their AWS_ENDPOINT_URL_<SERVICE> environment variables, which
+// are derived from service ids
+var endpointEnvSuffixes = map[string]string{
+	autoscaling.EndpointsID: "AUTO_SCALING",
+	cloudwatch.EndpointsID:  "CLOUDWATCH",
+	dynamodb.EndpointsID:    "DYNAMODB",
+	ec2.EndpointsID:         "EC2",
+	route53.EndpointsID:     "ROUTE_53",
+	s3.EndpointsID:          "S3",
+	sns.EndpointsID:         "SNS",
+}
+
+// newSession returns AWS session using credentials and region of the shared
+// config profile cfg.Profile and region cfg.Region, if set, with service
+// endpoints overridden by cfg.EndpointURL or AWS_ENDPOINT_URL* environment
+// variables, see endpointFor. Other endpoints are resolved in the AWS
+// partition cfg.Partition, like "aws-us-gov", or in the partition of the
+// session region if it is empty. If cfg.FIPS is set, FIPS endpoints are used;
+// without it, they are still used if AWS_USE_FIPS_ENDPOINT environment
+// variable is set to true. If cfg.CABundle is set, certificates from it are
+// trusted in addition to the system ones, see newHTTPClient.
+func newSession(cfg config, getenv func(string) string) (*session.Session, error) {
+	endpointURL, partition := cfg.EndpointURL, cfg.Partition
+	fallback := endpoints.DefaultResolver()
+	if partition != "" {
+		p, ok := partitionByID(partition)
+		if !ok {
+			return nil, fmt.Errorf("unsupported partition %q", partition)
+		}
+		// partition resolves endpoints of global services like Route 53
+		// even without region, and of regions unknown to the SDK
+		fallback = p
+	}
+	resolver := endpoints.ResolverFunc(func(service, region string, opts ...func(*endpoints.Options)) (endpoints.ResolvedEndpoint, error) {
+		if u := endpointFor(service, endpointURL, getenv); u != "" {
+			return endpoints.ResolvedEndpoint{URL: u, SigningRegion: region}, nil
+		}
+		return fallback.EndpointFor(service, region, opts...)
+	})
+	awsCfg := aws.NewConfig().WithEndpointResolver(resolver)
+	if cfg.Region != "" {
+		awsCfg.WithRegion(cfg.Region)
+	}
+	if cfg.FIPS {
+		awsCfg.UseFIPSEndpoint = endpoints.FIPSEndpointStateEnabled
+	}
+	if cfg.CABundle != "" {
+		if getenv("AWS_CA_BUNDLE") != "" {
+			// SDK would replace trusted certificates with the ones
+			// from AWS_CA_BUNDLE
+			return nil, errors.New("-ca-bundle cannot be used with AWS_CA_BUNDLE environment variable")
+		}
+		client, err := newHTTPClient(cfg.CABundle)
+		if err != nil {
+			return nil, err
+		}
+		awsCfg.WithHTTPClient(client)
+	}
+	if endpointFor(s3.EndpointsID, endpointURL, getenv) != "" {
+		// emulators usually don't support virtual-hosted-style bucket
+		// addressing
+		awsCfg.WithS3ForcePathStyle(true)
+	}
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            *awsCfg,
+		Profile:           cfg.Profile,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPartition(partition, aws.StringValue(sess.Config.Region)); err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+// partitionByID returns AWS partition with the given id, like "aws", "aws-cn"
+// or "aws-us-gov"
+func partitionByID(id string) (endpoints.Partition, bool) {
+	for _, p := range endpoints.DefaultPartitions() {
+		if p.ID() == id {
+			return p, true
+		}
+	}
+	return endpoints.Partition{}, false
+}
+
+// checkPartition returns an error if any of the regions known to the SDK
+// belongs to a partition other than the one with the given id. Empty
+// partition or region is not checked.
+func checkPartition(partition string, regions ...string) error {
+	if partition == "" {
+		return nil
+	}
+	for _, region := range regions {
+		if region == "" {
+			continue
+		}
+		if p, ok := endpoints.PartitionForRegion(endpoints.DefaultPartitions(), region); ok && p.ID() != partition {
+			return fmt.Errorf("region %q belongs to partition %q, not %q", region, p.ID(), partition)
+		}
+	}
+	return nil
+}
+
+// endpointFor returns endpoint URL override for the service with the given
+// endpoint id, or empty string if the default endpoint should be used.
+// Service-specific AWS_ENDPOINT_URL_<SERVICE> environment variable takes
+// precedence over endpointURL, which takes precedence over AWS_ENDPOINT_URL.
+func endpointFor(service, endpointURL string, getenv func(string) string) string {
+	if suffix, ok := endpointEnvSuffixes[service]; ok {
+		if u := getenv("AWS_ENDPOINT_URL_" + suffix); u != "" {
+			return u
+		}
+	} else if u := getenv("AWS_ENDPOINT_URL_" + strings.ToUpper(service)); u != "" {
+		return u
+	}
+	if endpointURL != "" {
+		return endpointURL
+	}
+	return getenv("AWS_ENDPOINT_URL")
+}
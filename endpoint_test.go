@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+func TestEndpointFor(t *testing.T) {
+	env := map[string]string{
+		"AWS_ENDPOINT_URL":          "http://localhost:4566",
+		"AWS_ENDPOINT_URL_ROUTE_53": "http://localhost:5000",
+	}
+	getenv := func(k string) string { return env[k] }
+	for _, tc := range []struct {
+		service, flag, want string
+	}{
+		{"ec2", "", "http://localhost:4566"},
+		{"route53", "", "http://localhost:5000"},
+		{"ec2", "http://moto:5000", "http://moto:5000"},
+		{"route53", "http://moto:5000", "http://localhost:5000"},
+	} {
+		if got := endpointFor(tc.service, tc.flag, getenv); got != tc.want {
+			t.Errorf("endpointFor(%q, %q) = %q, want %q", tc.service, tc.flag, got, tc.want)
+		}
+	}
+	if got := endpointFor("ec2", "", func(string) string { return "" }); got != "" {
+		t.Errorf("got endpoint %q without overrides, want empty", got)
+	}
+}
+
+func TestNewSession_partition(t *testing.T) {
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	getenv := func(string) string { return "" }
+	for _, tc := range []struct {
+		partition, url, signingRegion string
+	}{
+		{"aws", "https://route53.amazonaws.com", "us-east-1"},
+		{"aws-us-gov", "https://route53.us-gov.amazonaws.com", "us-gov-west-1"},
+		{"aws-cn", "https://route53.amazonaws.com.cn", "cn-northwest-1"},
+	} {
+		cfg := defaultConfig()
+		cfg.Partition = tc.partition
+		sess, err := newSession(cfg, getenv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ep, err := sess.Config.EndpointResolver.EndpointFor(route53.EndpointsID, "")
+		if err != nil {
+			t.Fatalf("%s: %v", tc.partition, err)
+		}
+		if ep.URL != tc.url || ep.SigningRegion != tc.signingRegion {
+			t.Errorf("%s: got Route 53 endpoint %s signed for %s, want %s signed for %s",
+				tc.partition, ep.URL, ep.SigningRegion, tc.url, tc.signingRegion)
+		}
+	}
+	cfg := defaultConfig()
+	cfg.Partition = "aws-mars"
+	if _, err := newSession(cfg, getenv); err == nil {
+		t.Error("got no error for unknown partition")
+	}
+}
+
+func TestNewSession_profile(t *testing.T) {
+	dir := t.TempDir()
+	config := filepath.Join(dir, "config")
+	if err := os.WriteFile(config, []byte("[profile dns-admin]\nregion = eu-west-1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_CONFIG_FILE", config)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	getenv := func(string) string { return "" }
+	cfg := defaultConfig()
+	cfg.Profile = "dns-admin"
+	sess, err := newSession(cfg, getenv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := aws.StringValue(sess.Config.Region); got != "eu-west-1" {
+		t.Errorf("got region %q from profile, want eu-west-1", got)
+	}
+	cfg.Region = "us-west-2"
+	if sess, err = newSession(cfg, getenv); err != nil {
+		t.Fatal(err)
+	}
+	if got := aws.StringValue(sess.Config.Region); got != "us-west-2" {
+		t.Errorf("got region %q with -region, want us-west-2", got)
+	}
+}
+
+func TestCheckPartition(t *testing.T) {
+	if err := checkPartition("aws-us-gov", "us-gov-west-1", "us-gov-east-1", ""); err != nil {
+		t.Error(err)
+	}
+	if err := checkPartition("", "us-east-1", "cn-north-1"); err != nil {
+		t.Error(err)
+	}
+	if err := checkPartition("aws-cn", "cn-north-1", "us-east-1"); err == nil {
+		t.Error("got no error for region of another partition")
+	}
+}
+
+func TestNewSession_caBundle(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer srv.Close()
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	pemData := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(bundle, pemData, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AWS_CA_BUNDLE", "")
+	getenv := func(string) string { return "" }
+	cfg := defaultConfig()
+	cfg.Region = "us-east-1"
+	sess, err := newSession(cfg, getenv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = sess.Config.HTTPClient.Get(srv.URL)
+	if err == nil || !strings.Contains(certHint(err).Error(), "-ca-bundle") {
+		t.Fatalf("got %v without CA bundle, want certificate error with hint", certHint(err))
+	}
+	cfg.CABundle = bundle
+	if sess, err = newSession(cfg, getenv); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := sess.Config.HTTPClient.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if _, err := newSession(cfg, func(k string) string { return map[string]string{"AWS_CA_BUNDLE": bundle}[k] }); err == nil {
+		t.Error("-ca-bundle accepted along with AWS_CA_BUNDLE")
+	}
+	cfg.CABundle = filepath.Join(t.TempDir(), "missing.pem")
+	if _, err := newSession(cfg, getenv); err == nil {
+		t.Error("missing CA bundle accepted")
+	}
+}
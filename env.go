@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+// defaultEnvTag is the default instance tag holding its environment name, see
+// config.EnvSuffixes
+const defaultEnvTag = "Environment"
+
+// envSyncer is a syncer managing instances of a single environment
+type envSyncer struct {
+	env string
+	*syncer
+}
+
+// parseEnvSuffixes parses comma-separated list of env=suffix pairs into map
+// of environment names to suffixes
+func parseEnvSuffixes(s string) (map[string]string, error) {
+	out := make(map[string]string)
+	for _, item := range splitList(s) {
+		env, suffix, ok := strings.Cut(item, "=")
+		if env, suffix = strings.TrimSpace(env), strings.TrimSpace(suffix); !ok || env == "" || suffix == "" {
+			return nil, fmt.Errorf("invalid environment suffix %q, want env=.suffix", item)
+		}
+		if _, ok := out[env]; ok {
+			return nil, fmt.Errorf("duplicate environment %q", env)
+		}
+		out[env] = suffix
+	}
+	if len(out) == 0 {
+		return nil, errors.New("no environment suffixes given")
+	}
+	return out, nil
+}
+
+// setupEnvs returns syncer dispatching updates to syncers of environments
+// listed in cfg.EnvSuffixes, each managing instances having cfg.EnvTag set to
+// the environment name, under its own suffix. Unless cfg.Zone or cfg.Domain
+// is set, each environment uses the hosted zone of its suffix or of its
+// closest parent domain.
+func setupEnvs(ctx context.Context, sess *session.Session, cfg config) (*syncer, error) {
+	if cfg.Suffix != "" {
+		return nil, errors.New("suffix and environment suffixes are mutually exclusive")
+	}
+	if cfg.EnvTag == "" {
+		return nil, errors.New("-env-suffixes requires -env-tag")
+	}
+	switch {
+	case cfg.MetricsAddr != "":
+		return nil, errors.New("-metrics-addr cannot be used with -env-suffixes")
+	case cfg.ReverseZone != "":
+		// each environment would remove PTR records of the others
+		return nil, errors.New("-reverse-zone cannot be used with -env-suffixes")
+	case cfg.LBTag != "" || cfg.DBTag != "" || cfg.ECSCluster != "" || cfg.Lightsail:
+		// these have no environment tag to filter on, and would be
+		// published under every environment suffix
+		return nil, errors.New("-lb-tag, -db-tag, -ecs-cluster and -lightsail cannot be used with -env-suffixes")
+	}
+	suffixes, err := parseEnvSuffixes(cfg.EnvSuffixes)
+	if err != nil {
+		return nil, err
+	}
+	envs := make([]string, 0, len(suffixes))
+	for env := range suffixes {
+		envs = append(envs, env)
+	}
+	sort.Strings(envs)
+	router := &syncer{parallelism: cfg.Parallelism, envTag: cfg.EnvTag}
+	for _, env := range envs {
+		c := cfg
+		c.EnvSuffixes, c.Suffix = "", suffixes[env]
+		c.Filters = append(append(tagFilters(nil), cfg.Filters...), &ec2.Filter{
+			Name:   aws.String("tag:" + cfg.EnvTag),
+			Values: []*string{aws.String(env)},
+		})
+		if c.IDN {
+			c.Suffix = toASCII(c.Suffix)
+		}
+		if c.Zone == "" && c.Domain == "" {
+			c.Zone, err = findSuffixZone(ctx, route53.New(sess), c.Suffix, c.Private)
+			switch {
+			case errors.Is(err, errNoZone) && c.Create:
+				// let setup create zone for the suffix domain
+				c.Domain = strings.Trim(c.Suffix, ".")
+			case err != nil:
+				return nil, fmt.Errorf("environment %s: %w", env, err)
+			default:
+				logMsg("found hosted zone", "zone_id", c.Zone, "environment", env, "suffix", c.Suffix)
+			}
+		}
+		s, err := setup(ctx, sess, c)
+		if err != nil {
+			return nil, fmt.Errorf("environment %s: %w", env, err)
+		}
+		s.env = env
+		// state-change events are dispatched by router
+		router.asg, router.keepStopped, router.stateActions = s.asg, s.keepStopped, s.stateActions
+		router.envs = append(router.envs, envSyncer{env: env, syncer: s})
+	}
+	return router, nil
+}
+
+// findSuffixZone returns id of the hosted zone for the suffix domain, or for
+// its closest parent domain having one
+func findSuffixZone(ctx context.Context, svc route53Client, suffix string, preferPrivate bool) (string, error) {
+	domain := strings.Trim(suffix, ".")
+	for {
+		id, err := findZone(ctx, svc, domain, preferPrivate)
+		if !errors.Is(err, errNoZone) {
+			return id, err
+		}
+		i := strings.IndexByte(domain, '.')
+		if i < 0 {
+			return "", fmt.Errorf("%w for suffix %q", errNoZone, suffix)
+		}
+		domain = domain[i+1:]
+	}
+}
+
+// eachEnv calls fn for syncers of all environments. Environments sharing a
+// hosted zone are processed one after another, so that their change batches
+// don't contend for the zone and its lock, while different zones are
+// processed concurrently, up to s.parallelism. Failure in one environment
+// doesn't stop the others; outcome of each zone is logged.
+func (s *syncer) eachEnv(ctx context.Context, fn func(*syncer) error) error {
+	var zones []string
+	byZone := make(map[string][]envSyncer)
+	for _, e := range s.envs {
+		if _, ok := byZone[e.zoneID]; !ok {
+			zones = append(zones, e.zoneID)
+		}
+		byZone[e.zoneID] = append(byZone[e.zoneID], e)
+	}
+	return parallel(ctx, s.parallelism, zones, func(ctx context.Context, i int) error {
+		var errs unitErrors
+		for _, e := range byZone[zones[i]] {
+			if err := fn(e.syncer); err != nil {
+				errs = append(errs, unitError{unit: e.env, err: err})
+			}
+		}
+		if len(errs) != 0 {
+			logMsg("zone update failed", "zone_id", zones[i], "error", errs)
+			return errs
+		}
+		debugMsg("zone updated", "zone_id", zones[i])
+		return nil
+	})
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+func TestParseEnvSuffixes(t *testing.T) {
+	got, err := parseEnvSuffixes("prod=.example.com, staging = .stg.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"prod": ".example.com", "staging": ".stg.example.com"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for _, s := range []string{"", "prod", "prod=", "=.example.com", "prod=.a.com,prod=.b.com"} {
+		if _, err := parseEnvSuffixes(s); err == nil {
+			t.Errorf("parseEnvSuffixes(%q) succeeded", s)
+		}
+	}
+}
+
+func TestFindSuffixZone(t *testing.T) {
+	svc := newFakeRoute53(t)
+	svc.zones = []*route53.HostedZone{
+		{Id: aws.String("/hostedzone/Z1"), Name: aws.String("example.com.")},
+		{Id: aws.String("/hostedzone/Z2"), Name: aws.String("stg.example.com.")},
+	}
+	for suffix, want := range map[string]string{
+		".stg.example.com":     "Z2",
+		".dev.example.com":     "Z1",
+		".a.b.stg.example.com": "Z2",
+		".example.org":         "",
+	} {
+		got, err := findSuffixZone(context.Background(), svc, suffix, false)
+		if want == "" {
+			if err == nil {
+				t.Errorf("findSuffixZone(%q): got %q, want error", suffix, got)
+			}
+			continue
+		}
+		if err != nil || got != want {
+			t.Errorf("findSuffixZone(%q): got %q, %v, want %q", suffix, got, err, want)
+		}
+	}
+}
+
+func TestReconcile_envs(t *testing.T) {
+	ec2svc := &fakeEC2{instances: []*ec2.Instance{
+		withTag(testInstance("i-1", "web", "", "1.1.1.1"), defaultEnvTag, "prod"),
+		withTag(testInstance("i-2", "web", "", "2.2.2.2"), defaultEnvTag, "staging"),
+		withTag(testInstance("i-3", "db", "", "3.3.3.3"), defaultEnvTag, "dev"),
+		testInstance("i-4", "ci", "", "4.4.4.4"),
+	}}
+	newEnv := func(env, suffix string, r53 route53Client) envSyncer {
+		return envSyncer{env: env, syncer: &syncer{
+			ec2:       ec2svc,
+			r53:       r53,
+			suffix:    suffix,
+			zoneID:    "Z1",
+			ttl:       defaultTTL,
+			ignoreTag: defaultIgnoreTag,
+			filters: tagFilters{{
+				Name:   aws.String("tag:" + defaultEnvTag),
+				Values: []*string{aws.String(env)},
+			}},
+		}}
+	}
+	prod, staging := newFakeRoute53(t), newFakeRoute53(t, "old.stg.example.com. A 9.9.9.9")
+	s := &syncer{envTag: defaultEnvTag, envs: []envSyncer{
+		newEnv("prod", ".example.com", prod),
+		newEnv("staging", ".stg.example.com", staging),
+	}}
+	if err := s.reconcile(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := prod.dump(), []string{"web.example.com. A 1.1.1.1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("prod zone: got %q, want %q", got, want)
+	}
+	if got, want := staging.dump(), []string{"web.stg.example.com. A 2.2.2.2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("staging zone: got %q, want %q", got, want)
+	}
+	ec2svc.instances[0] = stopped(ec2svc.instances[0])
+	if err := s.removeInstance(context.Background(), "i-1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := prod.dump(); len(got) != 0 {
+		t.Errorf("prod zone after removal: got %q, want it empty", got)
+	}
+	if got, want := staging.dump(), []string{"web.stg.example.com. A 2.2.2.2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("staging zone after removal: got %q, want %q", got, want)
+	}
+}
+
+func TestEachEnv_zones(t *testing.T) {
+	var mu sync.Mutex
+	running := make(map[string]int)
+	var overlap bool
+	var envs []envSyncer
+	for _, e := range []struct{ env, zone string }{
+		{"prod", "Z1"}, {"canary", "Z1"}, {"staging", "Z2"}, {"dev", "Z3"},
+	} {
+		envs = append(envs, envSyncer{env: e.env, syncer: &syncer{zoneID: e.zone}})
+	}
+	s := &syncer{envs: envs}
+	err := s.eachEnv(context.Background(), func(e *syncer) error {
+		mu.Lock()
+		if running[e.zoneID]++; running[e.zoneID] > 1 {
+			overlap = true
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		running[e.zoneID]--
+		mu.Unlock()
+		if e.zoneID == "Z2" {
+			return errors.New("boom")
+		}
+		return nil
+	})
+	if overlap {
+		t.Error("environments sharing a zone were updated concurrently")
+	}
+	var errs unitErrors
+	if !errors.As(err, &errs) || len(errs) != 1 || errs[0].unit != "Z2" {
+		t.Fatalf("got error %v, want a single error of zone Z2", err)
+	}
+	if want := "Z2: staging: boom"; err.Error() != want {
+		t.Fatalf("got error %q, want %q", err, want)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+// unescapeName replaces octal escapes Route 53 uses in names of listed record
+// sets for characters other than a-z, 0-9, "-", "_" and ".", like "\052" for
+// "*", with the characters themselves, so that names match the desired ones
+// and the suffix. It returns rr, which is modified in place.
+func unescapeName(rr *route53.ResourceRecordSet) *route53.ResourceRecordSet {
+	if rr.Name != nil && strings.Contains(*rr.Name, `\`) {
+		rr.Name = aws.String(unescape(*rr.Name))
+	}
+	return rr
+}
+
+// unescape replaces "\DDD" octal escapes in name with the bytes they encode.
+// Escapes of "." and "\\" are kept, as unescaped they would change labels of
+// the name.
+func unescape(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if !octalEscape(name[i:]) {
+			b.WriteByte(name[i])
+			continue
+		}
+		switch c := (name[i+1]-'0')<<6 | (name[i+2]-'0')<<3 | (name[i+3] - '0'); c {
+		case '.', '\\':
+			b.WriteString(name[i : i+4])
+		default:
+			b.WriteByte(c)
+		}
+		i += 3
+	}
+	return b.String()
+}
+
+// octalEscape reports whether s starts with "\DDD" octal escape
+func octalEscape(s string) bool {
+	if len(s) < 4 || s[0] != '\\' {
+		return false
+	}
+	for _, c := range []byte(s[1:4]) {
+		if c < '0' || c > '7' {
+			return false
+		}
+	}
+	return s[1] <= '3'
+}
+
+// escapeName returns name with characters Route 53 requires escaped in
+// requests, that is, other than letters, digits, "-", "_", "." and "*",
+// replaced with octal escapes. Escapes already present are kept.
+func escapeName(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if octalEscape(name[i:]) {
+			b.WriteString(name[i : i+4])
+			i += 3
+			continue
+		}
+		switch c := name[i]; {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '*':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, `\%03o`, c)
+		}
+	}
+	return b.String()
+}
+
+// escapeNames returns changes with names of their record sets escaped, see
+// escapeName. Changes needing no escaping are returned as is, others are
+// copied, so that changes stay usable for matching unescaped names.
+func escapeNames(changes []*route53.Change) []*route53.Change {
+	out := make([]*route53.Change, len(changes))
+	for i, ch := range changes {
+		out[i] = ch
+		rr := ch.ResourceRecordSet
+		if rr == nil || rr.Name == nil {
+			continue
+		}
+		if name := escapeName(*rr.Name); name != *rr.Name {
+			rrCopy := *rr
+			rrCopy.Name = &name
+			out[i] = &route53.Change{Action: ch.Action, ResourceRecordSet: &rrCopy}
+		}
+	}
+	return out
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func TestUnescape(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{`\052.web.example.com.`, "*.web.example.com."},
+		{`a\100b.example.com.`, "a@b.example.com."},
+		{`_sip._tcp.example.com.`, "_sip._tcp.example.com."},
+		{`a\056b.example.com.`, `a\056b.example.com.`},
+		{`a\134b.example.com.`, `a\134b.example.com.`},
+		{`trailing\`, `trailing\`},
+	} {
+		if got := unescape(tc.in); got != tc.want {
+			t.Errorf("unescape(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+	for _, tc := range []struct{ in, want string }{
+		{"*.web.example.com.", "*.web.example.com."},
+		{"a b@c.example.com.", `a\040b\100c.example.com.`},
+		{`a\056b.example.com.`, `a\056b.example.com.`},
+	} {
+		if got := escapeName(tc.in); got != tc.want {
+			t.Errorf("escapeName(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestReconcile_escapedNames(t *testing.T) {
+	r53svc := newFakeRoute53(t,
+		`a\100b.foo.example.com. A 1.1.1.1`,
+		`a\056b.foo.example.com. A 2.2.2.2`,
+		`\052.web.foo.example.com. A 9.9.9.9`,
+		`_http._tcp.foo.example.com. A 3.3.3.3`,
+	)
+	s := &syncer{
+		ec2:    &fakeEC2{instances: []*ec2.Instance{withTag(testInstance("i-1", "web", "", "1.2.3.4"), wildcardTag, "true")}},
+		r53:    r53svc,
+		suffix: ".foo.example.com",
+		zoneID: "Z1",
+	}
+	if err := s.update(context.Background(), "", new(runStats)); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`\052.web.foo.example.com. A 1.2.3.4`,
+		"web.foo.example.com. A 1.2.3.4",
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
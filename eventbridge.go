@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+)
+
+// eventBridgeClient is a subset of EventBridge API used by the program
+type eventBridgeClient interface {
+	PutEventsWithContext(aws.Context, *eventbridge.PutEventsInput, ...request.Option) (*eventbridge.PutEventsOutput, error)
+}
+
+// EventBridge event source and detail type of change events
+const (
+	eventSource     = "awsns"
+	eventDetailType = "DNS Records Changed"
+)
+
+// changeEvent is the detail of EventBridge event describing applied changes
+type changeEvent struct {
+	ZoneID   string         `json:"zone_id"`
+	Upserted []recordChange `json:"upserted"` // created and updated records
+	Deleted  []recordChange `json:"deleted"`
+}
+
+// putEvent sends changeEvent to EventBridge event bus, given by its name or
+// ARN
+func putEvent(ctx context.Context, svc eventBridgeClient, bus, zoneID string, changes []recordChange) error {
+	evt := changeEvent{ZoneID: zoneID, Upserted: []recordChange{}, Deleted: []recordChange{}}
+	for _, ch := range changes {
+		if ch.Action == "delete" {
+			evt.Deleted = append(evt.Deleted, ch)
+		} else {
+			evt.Upserted = append(evt.Upserted, ch)
+		}
+	}
+	detail, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+	out, err := svc.PutEventsWithContext(ctx, &eventbridge.PutEventsInput{
+		Entries: []*eventbridge.PutEventsRequestEntry{{
+			EventBusName: &bus,
+			Source:       aws.String(eventSource),
+			DetailType:   aws.String(eventDetailType),
+			Detail:       aws.String(string(detail)),
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	if aws.Int64Value(out.FailedEntryCount) != 0 && len(out.Entries) != 0 {
+		return fmt.Errorf("%s: %s", aws.StringValue(out.Entries[0].ErrorCode), aws.StringValue(out.Entries[0].ErrorMessage))
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+)
+
+func TestNotifyEventBridge(t *testing.T) {
+	svc := &fakeEventBridge{}
+	s := &syncer{
+		ec2: &fakeEC2{instances: []*ec2.Instance{
+			testInstance("i-1", "jenkins", "", "1.2.3.4"),
+			testInstance("i-2", "db", "", "5.6.7.8"),
+		}},
+		r53: newFakeRoute53(t,
+			"db.foo.example.com. A 1.1.1.1",
+			"old.foo.example.com. A 2.2.2.2",
+		),
+		events:   svc,
+		eventBus: "default",
+		suffix:   ".foo.example.com",
+		zoneID:   "Z1",
+	}
+	if err := s.reconcile(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	if len(svc.entries) != 1 {
+		t.Fatalf("got %d events, want 1", len(svc.entries))
+	}
+	e := svc.entries[0]
+	if aws.StringValue(e.EventBusName) != "default" || aws.StringValue(e.Source) != eventSource ||
+		aws.StringValue(e.DetailType) != eventDetailType {
+		t.Fatalf("unexpected event: %+v", e)
+	}
+	var got changeEvent
+	if err := json.Unmarshal([]byte(aws.StringValue(e.Detail)), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := changeEvent{
+		ZoneID: "Z1",
+		Upserted: []recordChange{
+			{Action: "create", Name: "jenkins.foo.example.com", Type: "A", Value: "1.2.3.4", InstanceID: "i-1"},
+			{Action: "update", Name: "db.foo.example.com", Type: "A", Value: "5.6.7.8", InstanceID: "i-2"},
+		},
+		Deleted: []recordChange{
+			{Action: "delete", Name: "old.foo.example.com", Type: "A", Value: "2.2.2.2"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got event detail\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+type fakeEventBridge struct {
+	entries []*eventbridge.PutEventsRequestEntry
+}
+
+func (f *fakeEventBridge) PutEventsWithContext(_ aws.Context, in *eventbridge.PutEventsInput, _ ...request.Option) (*eventbridge.PutEventsOutput, error) {
+	f.entries = append(f.entries, in.Entries...)
+	return &eventbridge.PutEventsOutput{FailedEntryCount: aws.Int64(0)}, nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+// failoverTag is the instance tag setting its failover role, PRIMARY or
+// SECONDARY
+const failoverTag = "dns:failover"
+
+// failoverRole returns normalized value of the instance failoverTag, or empty
+// string if it is not set
+func failoverRole(d desiredRecord) string {
+	return strings.ToUpper(tagValue(d.inst, failoverTag))
+}
+
+// hasFailoverRole reports whether any instance of the group has failover role
+// set
+func hasFailoverRole(group []desiredRecord) bool {
+	for _, d := range group {
+		if failoverRole(d) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// failoverRecords returns failover record sets for the group of instances
+// sharing the same name, sorted by instance id. Route 53 allows at most one
+// primary and one secondary record set, so only the first instance of each
+// role gets one; instances without valid role are skipped as well, and counted
+// in st.Skipped.
+func (s *syncer) failoverRecords(group []desiredRecord, st *runStats) []desiredRecord {
+	members := homogenize(group, false)
+	skipDropped(st, group, members)
+	var out []desiredRecord
+	taken := make(map[string]string) // role to instance id
+	for _, d := range members {
+		id, role := aws.StringValue(d.inst.InstanceId), failoverRole(d)
+		switch role {
+		case route53.ResourceRecordSetFailoverPrimary, route53.ResourceRecordSetFailoverSecondary:
+		default:
+			logMsg("skipping instance without valid failover role", "record_name", *d.rr.Name,
+				"instance_id", id, "role", role)
+			st.skip(d.inst, "no valid failover role")
+			continue
+		}
+		if other, ok := taken[role]; ok {
+			logMsg("skipping instance with already taken failover role", "record_name", *d.rr.Name,
+				"instance_id", id, "role", role, "other_instance_id", other)
+			st.skip(d.inst, "failover role taken by "+other)
+			continue
+		}
+		taken[role] = id
+		d.rr.SetIdentifier = d.inst.InstanceId
+		d.rr.Failover = aws.String(role)
+		out = append(out, d)
+	}
+	return out
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func TestReconcile_failover(t *testing.T) {
+	r53svc := newFakeRoute53(t, "web.foo.example.com. CNAME ec2-1-2-3-4.compute.amazonaws.com")
+	s := &syncer{
+		ec2: &fakeEC2{instances: []*ec2.Instance{
+			withTag(testInstance("i-1", "web", "ec2-1-2-3-4.compute.amazonaws.com", "1.2.3.4"), failoverTag, "primary"),
+			withTag(testInstance("i-2", "web", "", "5.6.7.8"), failoverTag, "SECONDARY"),
+			testInstance("i-3", "web", "", "9.9.9.9"),
+			withTag(testInstance("i-4", "web", "", "4.4.4.4"), failoverTag, "PRIMARY"),
+			withTag(testInstance("i-5", "db", "", "3.3.3.3"), failoverTag, "PRIMARY"),
+			testInstance("i-6", "ci", "", "2.2.2.2"),
+		}},
+		r53:    r53svc,
+		suffix: ".foo.example.com",
+		zoneID: "Z1",
+	}
+	var st runStats
+	if err := s.update(context.Background(), "", &st); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"ci.foo.example.com. A 2.2.2.2",
+		"db.foo.example.com. A 3.3.3.3 set=i-5 failover=PRIMARY",
+		"web.foo.example.com. A 1.2.3.4 set=i-1 failover=PRIMARY",
+		"web.foo.example.com. A 5.6.7.8 set=i-2 failover=SECONDARY",
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if st.Skipped != 2 {
+		t.Fatalf("got %d skipped instances, want 2", st.Skipped)
+	}
+}
+
+func TestHandleEvent_failoverTagChange(t *testing.T) {
+	r53svc := newFakeRoute53(t, "web.foo.example.com. A 1.2.3.4")
+	s := &syncer{
+		ec2: &fakeEC2{instances: []*ec2.Instance{
+			withTag(testInstance("i-1", "web", "", "1.2.3.4"), failoverTag, "PRIMARY"),
+		}},
+		r53:    r53svc,
+		suffix: ".foo.example.com",
+		zoneID: "Z1",
+	}
+	detail, err := json.Marshal(map[string]interface{}{
+		"changed-tag-keys": []string{failoverTag},
+		"service":          "ec2",
+		"resource-type":    "instance",
+		"tags":             map[string]string{"Name": "web", failoverTag: "PRIMARY"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	evt := events.CloudWatchEvent{
+		Source:     "aws.tag",
+		DetailType: "Tag Change on Resource",
+		Resources:  []string{"arn:aws:ec2:us-east-1:123456789012:instance/i-1"},
+		Detail:     detail,
+	}
+	if err := s.handleEvent(context.Background(), evt); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"web.foo.example.com. A 1.2.3.4 set=i-1 failover=PRIMARY"}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+// launchInstance creates records of the just launched instance with the given
+// id. If s.fastLaunch is set, it only describes this instance and upserts its
+// own records, without listing the whole zone and all instances, unless this
+// could leave records inconsistent: then, as without s.fastLaunch, it does a
+// full reconcile. Stale records are left for the next full reconcile.
+func (s *syncer) launchInstance(ctx context.Context, instanceID string) error {
+	if len(s.envs) != 0 {
+		return s.eachEnv(ctx, func(e *syncer) error { return e.launchInstance(ctx, instanceID) })
+	}
+	if err := s.awaitAddress(ctx, instanceID); err != nil {
+		return err
+	}
+	if !s.fastLaunch {
+		return s.reconcile(ctx, instanceID)
+	}
+	start := time.Now()
+	var st runStats
+	var done bool
+	err := s.locked(ctx, func() (err error) {
+		done, err = s.launchInstanceLocked(ctx, instanceID, &st)
+		return err
+	})
+	if err == nil && !done {
+		return s.reconcile(ctx, instanceID)
+	}
+	st.Duration = time.Since(start)
+	s.report(ctx, st, err)
+	return err
+}
+
+// launchInstanceLocked does the actual work of launchInstance fast path. It
+// returns false if the instance records cannot be created in isolation, and a
+// full reconcile is needed.
+func (s *syncer) launchInstanceLocked(ctx context.Context, instanceID string, st *runStats) (bool, error) {
+	if s.noEC2 {
+		logMsg("ec2 source is disabled, ignoring launched instance", "instance_id", instanceID)
+		return true, nil
+	}
+	if !s.mayUpsert() || s.groupPolicy != "" || s.hasDerived() || s.coexist != "" {
+		// records depend on other instances and records, or on
+		// ownership records of another controller
+		return false, nil
+	}
+	resp, err := s.ec2.DescribeInstancesWithContext(ctx, &ec2.DescribeInstancesInput{
+		InstanceIds: []*string{&instanceID},
+		Filters:     s.filters,
+	})
+	if err != nil {
+		return false, err
+	}
+	var inst *ec2.Instance
+	for _, r := range resp.Reservations {
+		for _, i := range r.Instances {
+			if aws.StringValue(i.InstanceId) == instanceID {
+				inst = i
+			}
+		}
+	}
+	switch {
+	case inst == nil && len(s.filters) != 0:
+		logMsg("instance does not match filters", "instance_id", instanceID)
+		return true, nil
+	case inst == nil:
+		return false, nil // not visible yet, let full reconcile decide
+	case inst.State == nil || aws.StringValue(inst.State.Name) != ec2.InstanceStateNameRunning:
+		logMsg("instance is not running", "instance_id", instanceID)
+		return true, nil
+	case inst.InstanceLifecycle != nil || s.ignored(inst) || s.excluded(inst):
+		return true, nil // spot, ignored and excluded instances are not managed
+	case s.tooYoung(inst):
+		logMsg("instance was launched too recently, skipping it in this update", "instance_id", instanceID,
+			"launch_time", inst.LaunchTime.Format(time.RFC3339))
+		return true, nil
+	case tagValue(inst, failoverTag) != "" || tagValue(inst, weightTag) != "" || tagValue(inst, geoTag) != "" ||
+		tagValue(inst, policyTag) != "":
+		return false, nil
+	}
+	st.Instances = 1
+	desired := s.desiredRecords([]*ec2.Instance{inst}, st)
+	if len(desired) == 0 {
+		return true, nil
+	}
+	if unready := s.probeNew(ctx, desired, nil, st); len(unready) != 0 {
+		return true, nil
+	}
+	st.Managed = len(desired)
+	if s.healthCheck != nil {
+		checks, err := s.listHealthChecks(ctx)
+		if err != nil {
+			return false, err
+		}
+		if _, err := s.attachHealthChecks(ctx, desired, checks); err != nil {
+			return false, err
+		}
+	}
+	targets := instanceTargets(inst)
+	var changes []*route53.Change
+	var summary []recordChange
+	for _, d := range desired {
+		records, err := s.listName(ctx, *d.rr.Name)
+		if err != nil {
+			return false, err
+		}
+		var old *route53.ResourceRecordSet
+		for _, rr := range records {
+			if !allValuesIn(rr, targets) {
+				// name is taken by another instance, or by a
+				// stale record full reconcile may remove
+				logMsg("name has other records, doing full update", "zone_id", s.zoneID,
+					"record_name", *d.rr.Name, "instance_id", instanceID)
+				return false, nil
+			}
+			if recordKey(rr) == recordKey(d.rr) {
+				old = rr
+			}
+		}
+		if old != nil && sameRecord(old, d.rr) {
+			continue
+		}
+		logMsg("upserting record", "zone_id", s.zoneID, "record_name", *d.rr.Name,
+			"action", "UPSERT", "instance_id", instanceID)
+		ch := &route53.Change{
+			Action:            aws.String("UPSERT"),
+			ResourceRecordSet: d.rr,
+		}
+		changes = append(changes, ch)
+		summary = append(summary, newRecordChange(ch, instanceID, old != nil))
+	}
+	if s.reverseZoneID != "" {
+		if err := s.launchReverse(ctx, inst); err != nil {
+			return false, err
+		}
+	}
+	if len(changes) == 0 {
+		logMsg("no changes to apply", "zone_id", s.zoneID, "instance_id", instanceID)
+		s.tagFQDNs(ctx, desired)
+		return true, s.noChanges()
+	}
+	changeID, err := s.apply(ctx, instanceID, "automated update for launch of "+instanceID, changes, summary)
+	if err != nil {
+		return false, err
+	}
+	s.tagFQDNs(ctx, desired)
+	st.Upserted = len(changes)
+	st.ChangeIDs = append(st.ChangeIDs, changeID)
+	return true, nil
+}
+
+// launchReverse upserts PTR records of the just launched instance in the
+// reverse zone
+func (s *syncer) launchReverse(ctx context.Context, inst *ec2.Instance) error {
+	id := aws.StringValue(inst.InstanceId)
+	var changes []*route53.Change
+	var summary []recordChange
+	for _, rr := range s.reverseRecords([]*ec2.Instance{inst}) {
+		old, err := s.lookupRecord(ctx, s.reverseZoneID, rr)
+		if err != nil {
+			return err
+		}
+		if old != nil && sameRecord(old, rr) {
+			continue
+		}
+		logMsg("upserting record", "zone_id", s.reverseZoneID, "record_name", *rr.Name,
+			"action", "UPSERT", "instance_id", id)
+		ch := &route53.Change{
+			Action:            aws.String("UPSERT"),
+			ResourceRecordSet: rr,
+		}
+		changes = append(changes, ch)
+		summary = append(summary, newRecordChange(ch, id, old != nil))
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	_, err := s.applyZone(ctx, s.reverseZoneID, id, "automated update for launch of "+id, changes, summary)
+	return err
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func TestHandleEvent_fastLaunch(t *testing.T) {
+	// stale record is only removed if launch event causes a full update
+	const stale = "old.foo.example.com. A 1.1.1.1"
+	table := []struct {
+		name     string
+		instance *ec2.Instance
+		records  []string
+		want     []string
+	}{
+		{
+			name:     "fast path",
+			instance: testInstance("i-1", "web", "", "1.2.3.4"),
+			records:  []string{stale},
+			want:     []string{stale, "web.foo.example.com. A 1.2.3.4"},
+		},
+		{
+			name:     "record is up to date",
+			instance: testInstance("i-1", "web", "", "1.2.3.4"),
+			records:  []string{stale, "web.foo.example.com. A 1.2.3.4"},
+			want:     []string{stale, "web.foo.example.com. A 1.2.3.4"},
+		},
+		{
+			name:     "name points elsewhere",
+			instance: testInstance("i-1", "web", "", "1.2.3.4"),
+			records:  []string{stale, "web.foo.example.com. A 9.9.9.9"},
+			want:     []string{"web.foo.example.com. A 1.2.3.4"},
+		},
+		{
+			name:     "weighted instance",
+			instance: withTag(testInstance("i-1", "web", "", "1.2.3.4"), weightTag, "10"),
+			records:  []string{stale},
+			want:     []string{"web.foo.example.com. A 1.2.3.4 set=i-1 weight=10"},
+		},
+		{
+			name: "spot instance",
+			instance: func() *ec2.Instance {
+				inst := testInstance("i-1", "web", "", "1.2.3.4")
+				inst.InstanceLifecycle = aws.String(ec2.InstanceLifecycleTypeSpot)
+				return inst
+			}(),
+			records: []string{stale},
+			want:    []string{stale},
+		},
+	}
+	for _, tc := range table {
+		t.Run(tc.name, func(t *testing.T) {
+			r53svc := newFakeRoute53(t, tc.records...)
+			s := &syncer{
+				ec2:        &fakeEC2{instances: []*ec2.Instance{tc.instance}},
+				r53:        r53svc,
+				suffix:     ".foo.example.com",
+				zoneID:     "Z1",
+				ttl:        defaultTTL,
+				ignoreTag:  defaultIgnoreTag,
+				fastLaunch: true,
+			}
+			if err := s.handleEvent(context.Background(), stateChangeEvent(t, "i-1", "running")); err != nil {
+				t.Fatal(err)
+			}
+			want := append([]string(nil), tc.want...)
+			sort.Strings(want)
+			if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+				t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s",
+					strings.Join(got, "\n"), strings.Join(want, "\n"))
+			}
+		})
+	}
+}
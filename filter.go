@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// tagFilters is a flag.Value collecting instance tag filters given in
+// "key=value" form
+type tagFilters []*ec2.Filter
+
+func (f *tagFilters) String() string {
+	if f == nil {
+		return ""
+	}
+	var out []string
+	for _, flt := range *f {
+		out = append(out, strings.TrimPrefix(aws.StringValue(flt.Name), "tag:")+"="+aws.StringValue(flt.Values[0]))
+	}
+	return strings.Join(out, ",")
+}
+
+func (f *tagFilters) Set(s string) error {
+	key, value, ok := strings.Cut(s, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("invalid tag filter %q, want key=value", s)
+	}
+	*f = append(*f, &ec2.Filter{
+		Name:   aws.String("tag:" + key),
+		Values: []*string{aws.String(value)},
+	})
+	return nil
+}
+
+// listFilter returns filter matching any of comma-separated values
+func listFilter(name, values string) *ec2.Filter {
+	f := &ec2.Filter{Name: aws.String(name)}
+	for _, v := range strings.Split(values, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			f.Values = append(f.Values, aws.String(v))
+		}
+	}
+	return f
+}
+
+// excluded reports whether instance matches any of s.exclude tag filters
+func (s *syncer) excluded(inst *ec2.Instance) bool {
+	for _, f := range s.exclude {
+		key := strings.TrimPrefix(aws.StringValue(f.Name), "tag:")
+		for _, tag := range inst.Tags {
+			if aws.StringValue(tag.Key) == key && aws.StringValue(tag.Value) == aws.StringValue(f.Values[0]) {
+				return true
+			}
+		}
+	}
+	return false
+}
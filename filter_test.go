@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func TestReconcile_filters(t *testing.T) {
+	var filters tagFilters
+	for _, f := range []string{"Environment=prod", "Team=web"} {
+		if err := filters.Set(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ec2svc := &fakeEC2{instances: []*ec2.Instance{
+		withTag(withTag(testInstance("i-1", "web", "", "1.2.3.4"), "Environment", "prod"), "Team", "web"),
+		withTag(withTag(testInstance("i-2", "db", "", "5.6.7.8"), "Environment", "prod"), "Team", "db"),
+		withTag(withTag(testInstance("i-3", "stage", "", "9.9.9.9"), "Environment", "stage"), "Team", "web"),
+		withTag(withTag(testInstance("i-4", "web", "", "4.4.4.4"), "Environment", "stage"), "Team", "web"),
+	}}
+	r53svc := newFakeRoute53(t, "old.foo.example.com. A 1.1.1.1")
+	s := &syncer{
+		ec2:     ec2svc,
+		r53:     r53svc,
+		suffix:  ".foo.example.com",
+		zoneID:  "Z1",
+		filters: filters,
+	}
+	ctx := context.Background()
+	if err := s.reconcile(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"web.foo.example.com. A 1.2.3.4"}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	// instance not matching filters shares the name with the managed one:
+	// its termination must not affect the record
+	ec2svc.instances[3] = stopped(ec2svc.instances[3])
+	if err := s.removeInstance(ctx, "i-4"); err != nil {
+		t.Fatal(err)
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestTagFilters(t *testing.T) {
+	var f tagFilters
+	if err := f.Set("=prod"); err == nil {
+		t.Fatal("filter with empty key accepted")
+	}
+	if err := f.Set("Role=web=1"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := f.String(), "Role=web=1"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestReconcile_vpcFilter(t *testing.T) {
+	inVPC := func(inst *ec2.Instance, vpc, subnet string) *ec2.Instance {
+		inst.VpcId, inst.SubnetId = aws.String(vpc), aws.String(subnet)
+		return inst
+	}
+	r53svc := newFakeRoute53(t)
+	s := &syncer{
+		ec2: &fakeEC2{instances: []*ec2.Instance{
+			inVPC(testInstance("i-1", "web", "", "1.2.3.4"), "vpc-1", "subnet-1"),
+			inVPC(testInstance("i-2", "db", "", "5.6.7.8"), "vpc-1", "subnet-2"),
+			inVPC(testInstance("i-3", "ci", "", "9.9.9.9"), "vpc-1", "subnet-3"),
+			inVPC(testInstance("i-4", "other", "", "4.4.4.4"), "vpc-2", "subnet-4"),
+		}},
+		r53:    r53svc,
+		suffix: ".foo.example.com",
+		zoneID: "Z1",
+		filters: []*ec2.Filter{
+			listFilter("vpc-id", "vpc-1"),
+			listFilter("subnet-id", "subnet-1, subnet-2,subnet-4"),
+		},
+	}
+	if err := s.reconcile(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"db.foo.example.com. A 5.6.7.8",
+		"web.foo.example.com. A 1.2.3.4",
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestReconcile_exclude(t *testing.T) {
+	var exclude tagFilters
+	if err := exclude.Set("Role=ci-runner"); err != nil {
+		t.Fatal(err)
+	}
+	ec2svc := &fakeEC2{instances: []*ec2.Instance{
+		testInstance("i-1", "web", "", "1.2.3.4"),
+		withTag(testInstance("i-2", "runner", "", "5.6.7.8"), "Role", "ci-runner"),
+		testInstance("i-3", "ci", "", "9.9.9.9"),
+		withTag(testInstance("i-4", "ci", "", "4.4.4.4"), "Role", "ci-runner"),
+	}}
+	r53svc := newFakeRoute53(t, "runner.foo.example.com. A 5.6.7.8")
+	s := &syncer{
+		ec2:     ec2svc,
+		r53:     r53svc,
+		suffix:  ".foo.example.com",
+		zoneID:  "Z1",
+		exclude: exclude,
+	}
+	ctx := context.Background()
+	if err := s.reconcile(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"ci.foo.example.com. A 9.9.9.9",
+		"web.foo.example.com. A 1.2.3.4",
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	// excluded instance sharing the name must not prevent record removal
+	ec2svc.instances[2] = stopped(ec2svc.instances[2])
+	if err := s.removeInstance(ctx, "i-3"); err != nil {
+		t.Fatal(err)
+	}
+	want = want[1:]
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
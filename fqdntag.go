@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// ec2Tagger is a subset of ec2 API used to tag instances with their DNS names
+type ec2Tagger interface {
+	CreateTagsWithContext(aws.Context, *ec2.CreateTagsInput, ...request.Option) (*ec2.CreateTagsOutput, error)
+}
+
+// tagFQDNs sets s.fqdnTag of instances having records to their DNS names,
+// without trailing dot, unless the tag already has this value. Instances
+// sharing the same name are tagged in a single call. Failures are only
+// logged, as tags are retried on the next update.
+func (s *syncer) tagFQDNs(ctx context.Context, records []desiredRecord) {
+	if s.fqdnTag == "" || s.plan != nil {
+		return
+	}
+	byName := make(map[string][]*string) // DNS names to ids of instances to tag
+	seen := make(map[string]bool)
+	for _, d := range records {
+		id := aws.StringValue(d.inst.InstanceId)
+		// other resources, like ECS tasks or load balancers, are not
+		// ec2 instances
+		if !strings.HasPrefix(id, "i-") || seen[id] || *d.rr.Name != s.hostName(d.inst)+s.suffix {
+			continue
+		}
+		seen[id] = true
+		if tagValue(d.inst, s.fqdnTag) == *d.rr.Name {
+			continue
+		}
+		byName[*d.rr.Name] = append(byName[*d.rr.Name], d.inst.InstanceId)
+	}
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ids := byName[name]
+		logMsg("tagging instances", "tag", s.fqdnTag, "record_name", name, "count", len(ids))
+		if _, err := s.tagger.CreateTagsWithContext(ctx, &ec2.CreateTagsInput{
+			Resources: ids,
+			Tags:      []*ec2.Tag{{Key: aws.String(s.fqdnTag), Value: aws.String(name)}},
+		}); err != nil {
+			logMsg("tagging instances", "tag", s.fqdnTag, "record_name", name, "error", err)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// fakeTagger records CreateTags calls as "id,... key=value" strings
+type fakeTagger struct {
+	calls []string
+}
+
+func (f *fakeTagger) CreateTagsWithContext(_ aws.Context, in *ec2.CreateTagsInput, _ ...request.Option) (*ec2.CreateTagsOutput, error) {
+	call := strings.Join(aws.StringValueSlice(in.Resources), ",")
+	for _, tag := range in.Tags {
+		call += " " + aws.StringValue(tag.Key) + "=" + aws.StringValue(tag.Value)
+	}
+	f.calls = append(f.calls, call)
+	return &ec2.CreateTagsOutput{}, nil
+}
+
+func TestTagFQDNs(t *testing.T) {
+	tagger := new(fakeTagger)
+	s := &syncer{
+		ec2: &fakeEC2{instances: []*ec2.Instance{
+			withTag(testInstance("i-1", "web", "", "1.2.3.4"), aliasesTag, "www"),
+			testInstance("i-2", "web", "", "5.6.7.8"),
+			withTag(testInstance("i-3", "db", "", "9.9.9.9"), "awsns:fqdn", "db.foo.example.com"),
+			withTag(testInstance("i-4", "ci", "", "9.9.9.8"), "awsns:fqdn", "old.foo.example.com"),
+		}},
+		r53:         newFakeRoute53(t),
+		suffix:      ".foo.example.com",
+		zoneID:      "Z1",
+		ttl:         defaultTTL,
+		groupPolicy: groupMultivalue,
+		tagger:      tagger,
+		fqdnTag:     "awsns:fqdn",
+	}
+	if err := s.update(context.Background(), "", &runStats{}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"i-4 awsns:fqdn=ci.foo.example.com",
+		"i-1,i-2 awsns:fqdn=web.foo.example.com",
+	}
+	if !reflect.DeepEqual(tagger.calls, want) {
+		t.Fatalf("got CreateTags calls:\n%s\nwant:\n%s", strings.Join(tagger.calls, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+// geoTag is the instance tag setting its geolocation: continent code like
+// "EU", country code like "US", country and subdivision code like "US-CA", or
+// "default"
+const geoTag = "dns:geo"
+
+// geoDefault is the geoTag value of the default location, matching queries
+// from locations no other record set covers
+const geoDefault = "default"
+
+// continentCodes are continent codes supported by Route 53
+var continentCodes = map[string]bool{
+	"AF": true, "AN": true, "AS": true, "EU": true, "OC": true, "NA": true, "SA": true,
+}
+
+// parseGeoLocation parses geoTag value into Route 53 geolocation
+func parseGeoLocation(s string) (*route53.GeoLocation, error) {
+	if strings.EqualFold(s, geoDefault) {
+		return &route53.GeoLocation{CountryCode: aws.String("*")}, nil
+	}
+	country, sub, hasSub := strings.Cut(strings.ToUpper(s), "-")
+	if len(country) != 2 || (hasSub && sub == "") {
+		return nil, fmt.Errorf("invalid geolocation %q, want continent, country, country-subdivision or %q", s, geoDefault)
+	}
+	switch {
+	case hasSub:
+		return &route53.GeoLocation{CountryCode: aws.String(country), SubdivisionCode: aws.String(sub)}, nil
+	case continentCodes[country]:
+		return &route53.GeoLocation{ContinentCode: aws.String(country)}, nil
+	}
+	return &route53.GeoLocation{CountryCode: aws.String(country)}, nil
+}
+
+// geoLocationString returns geolocation in the geoTag form
+func geoLocationString(loc *route53.GeoLocation) string {
+	switch {
+	case loc == nil:
+		return ""
+	case loc.ContinentCode != nil:
+		return aws.StringValue(loc.ContinentCode)
+	case aws.StringValue(loc.CountryCode) == "*":
+		return geoDefault
+	case loc.SubdivisionCode != nil:
+		return aws.StringValue(loc.CountryCode) + "-" + aws.StringValue(loc.SubdivisionCode)
+	}
+	return aws.StringValue(loc.CountryCode)
+}
+
+// hasGeoLocation reports whether any instance of the group has geolocation
+// set
+func hasGeoLocation(group []desiredRecord) bool {
+	for _, d := range group {
+		if tagValue(d.inst, geoTag) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// geoRecords returns geolocation record sets for the group of instances
+// sharing the same name, sorted by instance id. Only the first instance of
+// each location gets a record set; instances without valid location are
+// skipped. Queries from locations no record set covers get no answer, so the
+// group must have an instance of the default location, otherwise all its
+// instances are skipped. Skipped instances are counted in st.Skipped.
+func (s *syncer) geoRecords(group []desiredRecord, st *runStats) []desiredRecord {
+	members := homogenize(group, false)
+	skipDropped(st, group, members)
+	var out []desiredRecord
+	taken := make(map[string]string) // location to instance id
+	for _, d := range members {
+		id := aws.StringValue(d.inst.InstanceId)
+		loc, err := parseGeoLocation(tagValue(d.inst, geoTag))
+		if err != nil {
+			logMsg("skipping instance without valid geolocation", "record_name", *d.rr.Name,
+				"instance_id", id, "error", err)
+			st.skip(d.inst, "no valid geolocation")
+			continue
+		}
+		key := geoLocationString(loc)
+		if other, ok := taken[key]; ok {
+			logMsg("skipping instance with already taken geolocation", "record_name", *d.rr.Name,
+				"instance_id", id, "location", key, "other_instance_id", other)
+			st.skip(d.inst, "geolocation taken by "+other)
+			continue
+		}
+		taken[key] = id
+		d.rr.SetIdentifier = d.inst.InstanceId
+		d.rr.GeoLocation = loc
+		out = append(out, d)
+	}
+	if _, ok := taken[geoDefault]; !ok && len(out) != 0 {
+		logMsg("skipping instances without default geolocation", "record_name", *out[0].rr.Name)
+		for _, d := range out {
+			st.skip(d.inst, "no instance of default geolocation")
+		}
+		return nil
+	}
+	return out
+}
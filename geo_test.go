@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func TestParseGeoLocation(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string
+		wantErr  bool
+	}{
+		{in: "default", want: "default"},
+		{in: "Default", want: "default"},
+		{in: "eu", want: "EU"},
+		{in: "US", want: "US"},
+		{in: "us-ca", want: "US-CA"},
+		{in: "", wantErr: true},
+		{in: "USA", wantErr: true},
+		{in: "US-", wantErr: true},
+	} {
+		loc, err := parseGeoLocation(tc.in)
+		if (err != nil) != tc.wantErr {
+			t.Fatalf("%q: got error %v, want error: %v", tc.in, err, tc.wantErr)
+		}
+		if got := geoLocationString(loc); got != tc.want {
+			t.Fatalf("%q: got %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestReconcile_geo(t *testing.T) {
+	r53svc := newFakeRoute53(t, "web.foo.example.com. A 1.2.3.4")
+	s := &syncer{
+		ec2: &fakeEC2{instances: []*ec2.Instance{
+			withTag(testInstance("i-1", "web", "", "1.2.3.4"), geoTag, "default"),
+			withTag(testInstance("i-2", "web", "", "5.6.7.8"), geoTag, "eu"),
+			withTag(testInstance("i-3", "web", "", "9.9.9.9"), geoTag, "US-CA"),
+			withTag(testInstance("i-4", "web", "", "4.4.4.4"), geoTag, "EU"),
+			testInstance("i-5", "web", "", "6.6.6.6"),
+			withTag(testInstance("i-6", "db", "", "3.3.3.3"), geoTag, "US"),
+			withTag(testInstance("i-7", "db", "", "7.7.7.7"), geoTag, "EU"),
+			testInstance("i-8", "ci", "", "2.2.2.2"),
+		}},
+		r53:    r53svc,
+		suffix: ".foo.example.com",
+		zoneID: "Z1",
+	}
+	var st runStats
+	if err := s.update(context.Background(), "", &st); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"ci.foo.example.com. A 2.2.2.2",
+		"web.foo.example.com. A 1.2.3.4 set=i-1 geo=default",
+		"web.foo.example.com. A 5.6.7.8 set=i-2 geo=EU",
+		"web.foo.example.com. A 9.9.9.9 set=i-3 geo=US-CA",
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if st.Skipped != 4 {
+		t.Fatalf("got %d skipped instances, want 4", st.Skipped)
+	}
+}
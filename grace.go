@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+// graceRecordName is the name, relative to suffix, of TXT record keeping times
+// records became removal candidates, see syncer.deletionGrace
+const graceRecordName = "_awsns-grace"
+
+// graceRecord returns TXT record set keeping pending deletions: one value per
+// record, like "1700000000 web.foo.example.com A i-1", holding the time
+// record became removal candidate, its name, type and set identifier, if
+// any. Record set with no values is returned if there are no pending
+// deletions.
+func (s *syncer) graceRecord(pending map[string]time.Time) *route53.ResourceRecordSet {
+	rr := &route53.ResourceRecordSet{
+		Name: aws.String(graceRecordName + s.suffix),
+		Type: aws.String(route53.RRTypeTxt),
+		TTL:  aws.Int64(s.ttl),
+	}
+	keys := make([]string, 0, len(pending))
+	for k := range pending {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := strconv.FormatInt(pending[k].Unix(), 10) + " " + strings.TrimSpace(k)
+		rr.ResourceRecords = append(rr.ResourceRecords, &route53.ResourceRecord{Value: aws.String(`"` + v + `"`)})
+	}
+	return rr
+}
+
+// parseGraceRecord returns pending deletions kept in TXT record set returned
+// by graceRecord, keyed by recordKey. Malformed values are ignored.
+func parseGraceRecord(rr *route53.ResourceRecordSet) map[string]time.Time {
+	out := make(map[string]time.Time)
+	for _, r := range rr.ResourceRecords {
+		fields := strings.Fields(strings.Trim(aws.StringValue(r.Value), `"`))
+		if len(fields) != 3 && len(fields) != 4 {
+			continue
+		}
+		sec, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		key := fields[1] + " " + fields[2] + " "
+		if len(fields) == 4 {
+			key += fields[3]
+		}
+		out[key] = time.Unix(sec, 0)
+	}
+	return out
+}
+
+// deferDeletions drops records from toRemove, keyed by recordKey, which became
+// removal candidates less than s.deletionGrace ago, and returns keys of the
+// remaining ones, sorted. Times records became removal candidates are kept in
+// graceRecord; if they need to be updated, change doing so is returned too.
+func (s *syncer) deferDeletions(ctx context.Context, toRemove map[string]*record) ([]string, []*route53.Change, []recordChange, error) {
+	state := s.graceRecord(nil)
+	old, err := s.lookupRecord(ctx, s.zoneID, state)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var since map[string]time.Time
+	if old != nil {
+		since = parseGraceRecord(old)
+	}
+	now := time.Now()
+	pending := make(map[string]time.Time)
+	var keys []string
+	for k, r := range toRemove {
+		t, ok := since[k]
+		if !ok {
+			t = now
+		}
+		if now.Sub(t) >= s.deletionGrace {
+			keys = append(keys, k)
+			continue
+		}
+		logMsg("record has no instance or resource, deleting it after grace period", "zone_id", s.zoneID,
+			"record_name", strings.TrimSuffix(r.name, "."), "type", r.typ,
+			"delete_after", t.Add(s.deletionGrace).UTC().Format(time.RFC3339))
+		pending[k] = t
+		delete(toRemove, k)
+	}
+	sort.Strings(keys)
+	state = s.graceRecord(pending)
+	var ch *route53.Change
+	switch {
+	case old != nil && len(pending) == 0:
+		ch = &route53.Change{Action: aws.String("DELETE"), ResourceRecordSet: old}
+	case len(pending) != 0 && (old == nil || !sameRecord(old, state)):
+		ch = &route53.Change{Action: aws.String("UPSERT"), ResourceRecordSet: state}
+	default:
+		return keys, nil, nil, nil
+	}
+	return keys, []*route53.Change{ch}, []recordChange{newRecordChange(ch, "", old != nil)}, nil
+}
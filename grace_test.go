@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+func TestReconcile_deletionGrace(t *testing.T) {
+	r53svc := newFakeRoute53(t,
+		"web.foo.example.com. A 1.2.3.4",
+		"old.foo.example.com. A 1.1.1.1",
+		"gone.foo.example.com. A 2.2.2.2",
+	)
+	// gone record has been pending for an hour already
+	longAgo := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	r53svc.add(&route53.ResourceRecordSet{
+		Name:            aws.String(graceRecordName + ".foo.example.com."),
+		Type:            aws.String("TXT"),
+		TTL:             aws.Int64(defaultTTL),
+		ResourceRecords: []*route53.ResourceRecord{{Value: aws.String(`"` + longAgo + ` gone.foo.example.com A"`)}},
+	})
+	s := &syncer{
+		ec2:           &fakeEC2{instances: []*ec2.Instance{testInstance("i-1", "web", "", "1.2.3.4")}},
+		r53:           r53svc,
+		suffix:        ".foo.example.com",
+		zoneID:        "Z1",
+		ttl:           defaultTTL,
+		deletionGrace: 15 * time.Minute,
+	}
+	if err := s.update(context.Background(), "", &runStats{}); err != nil {
+		t.Fatal(err)
+	}
+	got := r53svc.dump()
+	if len(got) != 3 || !strings.HasPrefix(got[0], "_awsns-grace.foo.example.com. TXT") || got[1] != "old.foo.example.com. A 1.1.1.1" {
+		t.Fatalf("unexpected zone state:\n%s", strings.Join(got, "\n"))
+	}
+	pending := parseGraceRecord(r53svc.records[graceRecordName+".foo.example.com TXT "])
+	if _, ok := pending["old.foo.example.com A "]; !ok || len(pending) != 1 {
+		t.Fatalf("unexpected pending deletions: %v", pending)
+	}
+
+	// once the instance is back, its record is no longer pending
+	s.ec2 = &fakeEC2{instances: []*ec2.Instance{
+		testInstance("i-1", "web", "", "1.2.3.4"),
+		testInstance("i-2", "old", "", "1.1.1.1"),
+	}}
+	if err := s.update(context.Background(), "", &runStats{}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"old.foo.example.com. A 1.1.1.1",
+		"web.foo.example.com. A 1.2.3.4",
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
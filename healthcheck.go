@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+// healthCheckTag is the instance tag overriding default health check spec
+const healthCheckTag = "dns:healthcheck"
+
+// healthCheckRefPrefix marks caller references of health checks created by
+// the program; full reference is "awsns:<instance id>:<unix nanoseconds>"
+const healthCheckRefPrefix = "awsns:"
+
+// healthCheckSpec describes Route 53 health check of an instance public IP
+type healthCheckSpec struct {
+	Type string // TCP, HTTP or HTTPS
+	Port int64
+	Path string // only for HTTP and HTTPS
+}
+
+// parseHealthCheck parses health check spec in "proto:port[/path]" format,
+// like "tcp:22" or "https:443/healthz". It returns nil spec for "none".
+func parseHealthCheck(s string) (*healthCheckSpec, error) {
+	if s == "none" {
+		return nil, nil
+	}
+	proto, rest, ok := strings.Cut(s, ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid health check %q, want proto:port[/path]", s)
+	}
+	port, path := rest, ""
+	if i := strings.IndexByte(rest, '/'); i >= 0 {
+		port, path = rest[:i], rest[i:]
+	}
+	n, err := strconv.ParseInt(port, 10, 64)
+	if err != nil || n < 1 || n > 65535 {
+		return nil, fmt.Errorf("invalid health check %q: bad port", s)
+	}
+	spec := &healthCheckSpec{Type: strings.ToUpper(proto), Port: n, Path: path}
+	switch spec.Type {
+	case route53.HealthCheckTypeTcp:
+		if path != "" {
+			return nil, fmt.Errorf("invalid health check %q: tcp check cannot have path", s)
+		}
+	case route53.HealthCheckTypeHttp, route53.HealthCheckTypeHttps:
+	default:
+		return nil, fmt.Errorf("invalid health check %q: unsupported protocol %q", s, proto)
+	}
+	return spec, nil
+}
+
+// config returns health check config for the spec targeting ip
+func (spec *healthCheckSpec) config(ip string) *route53.HealthCheckConfig {
+	cfg := &route53.HealthCheckConfig{
+		Type:      aws.String(spec.Type),
+		IPAddress: aws.String(ip),
+		Port:      aws.Int64(spec.Port),
+	}
+	if spec.Path != "" {
+		cfg.ResourcePath = aws.String(spec.Path)
+	}
+	return cfg
+}
+
+// matches reports whether existing health check config is the one spec
+// describes for ip
+func (spec *healthCheckSpec) matches(cfg *route53.HealthCheckConfig, ip string) bool {
+	return cfg != nil && aws.StringValue(cfg.Type) == spec.Type &&
+		aws.StringValue(cfg.IPAddress) == ip && aws.Int64Value(cfg.Port) == spec.Port &&
+		aws.StringValue(cfg.ResourcePath) == spec.Path
+}
+
+// instanceHealthCheck returns health check spec for the instance: the one set
+// by its healthCheckTag, or the default one. It returns nil if health checks
+// are disabled or instance has no public IP address.
+func (s *syncer) instanceHealthCheck(inst *ec2.Instance) *healthCheckSpec {
+	if s.healthCheck == nil || aws.StringValue(inst.PublicIpAddress) == "" {
+		return nil
+	}
+	v := tagValue(inst, healthCheckTag)
+	if v == "" {
+		return s.healthCheck
+	}
+	spec, err := parseHealthCheck(v)
+	if err != nil {
+		logMsg("ignoring instance tag", "instance_id", aws.StringValue(inst.InstanceId),
+			"tag", healthCheckTag, "error", err)
+		return s.healthCheck
+	}
+	return spec
+}
+
+// listHealthChecks returns health checks created by the program, keyed by
+// instance id
+func (s *syncer) listHealthChecks(ctx context.Context) (map[string][]*route53.HealthCheck, error) {
+	out := make(map[string][]*route53.HealthCheck)
+	fn := func(page *route53.ListHealthChecksOutput, lastPage bool) bool {
+		for _, hc := range page.HealthChecks {
+			ref := strings.TrimPrefix(aws.StringValue(hc.CallerReference), healthCheckRefPrefix)
+			if ref == aws.StringValue(hc.CallerReference) {
+				continue
+			}
+			id, _, _ := strings.Cut(ref, ":")
+			out[id] = append(out[id], hc)
+		}
+		return true
+	}
+	if err := s.r53.ListHealthChecksPagesWithContext(ctx, &route53.ListHealthChecksInput{}, fn); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// attachHealthChecks sets health check ids of records, reusing matching
+// health checks from existing or creating new ones. It returns ids of health
+// checks in use.
+func (s *syncer) attachHealthChecks(ctx context.Context, records []desiredRecord, existing map[string][]*route53.HealthCheck) (map[string]bool, error) {
+	inUse := make(map[string]bool)
+	for _, d := range records {
+		spec := s.instanceHealthCheck(d.inst)
+		if spec == nil {
+			continue
+		}
+		id, ip := aws.StringValue(d.inst.InstanceId), aws.StringValue(d.inst.PublicIpAddress)
+		var hcID string
+		for _, hc := range existing[id] {
+			if spec.matches(hc.HealthCheckConfig, ip) {
+				hcID = aws.StringValue(hc.Id)
+				break
+			}
+		}
+		if hcID == "" {
+			logMsg("creating health check", "zone_id", s.zoneID, "record_name", aws.StringValue(d.rr.Name),
+				"instance_id", id)
+			out, err := s.r53.CreateHealthCheckWithContext(ctx, &route53.CreateHealthCheckInput{
+				CallerReference:   aws.String(healthCheckRefPrefix + id + ":" + strconv.FormatInt(time.Now().UnixNano(), 10)),
+				HealthCheckConfig: spec.config(ip),
+			})
+			if err != nil {
+				return nil, fmt.Errorf("creating health check for %s: %w", id, err)
+			}
+			hcID = aws.StringValue(out.HealthCheck.Id)
+		}
+		d.rr.HealthCheckId = aws.String(hcID)
+		inUse[hcID] = true
+	}
+	return inUse, nil
+}
+
+// deleteHealthChecks deletes health checks that are not in use. Failures are
+// only logged, as such health checks are retried on the next run.
+func (s *syncer) deleteHealthChecks(ctx context.Context, checks map[string][]*route53.HealthCheck, inUse map[string]bool) {
+	var ids []string
+	for _, list := range checks {
+		for _, hc := range list {
+			if id := aws.StringValue(hc.Id); !inUse[id] {
+				ids = append(ids, id)
+			}
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		logMsg("deleting health check", "zone_id", s.zoneID, "health_check_id", id)
+		if _, err := s.r53.DeleteHealthCheckWithContext(ctx, &route53.DeleteHealthCheckInput{
+			HealthCheckId: aws.String(id),
+		}); err != nil {
+			logMsg("deleting health check", "zone_id", s.zoneID, "health_check_id", id, "error", err)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func TestParseHealthCheck(t *testing.T) {
+	table := []struct {
+		in      string
+		want    *healthCheckSpec
+		wantErr bool
+	}{
+		{in: "tcp:22", want: &healthCheckSpec{Type: "TCP", Port: 22}},
+		{in: "https:443/healthz", want: &healthCheckSpec{Type: "HTTPS", Port: 443, Path: "/healthz"}},
+		{in: "HTTP:80/", want: &healthCheckSpec{Type: "HTTP", Port: 80, Path: "/"}},
+		{in: "none"},
+		{in: "tcp", wantErr: true},
+		{in: "tcp:0", wantErr: true},
+		{in: "tcp:22/path", wantErr: true},
+		{in: "udp:53", wantErr: true},
+		{in: "http:eighty", wantErr: true},
+	}
+	for _, tc := range table {
+		got, err := parseHealthCheck(tc.in)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%q: unexpected error: %v", tc.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q: got %+v, want %+v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestReconcile_healthChecks(t *testing.T) {
+	ec2svc := &fakeEC2{instances: []*ec2.Instance{
+		testInstance("i-1", "web", "", "1.2.3.4"),
+		withTag(testInstance("i-2", "db", "", "5.6.7.8"), healthCheckTag, "tcp:5432"),
+		withTag(testInstance("i-3", "misc", "", "9.9.9.9"), healthCheckTag, "none"),
+		testInstance("i-4", "private", "ec2.internal", ""),
+	}}
+	r53svc := newFakeRoute53(t)
+	s := &syncer{
+		ec2:         ec2svc,
+		r53:         r53svc,
+		suffix:      ".foo.example.com",
+		zoneID:      "Z1",
+		healthCheck: &healthCheckSpec{Type: "HTTP", Port: 80, Path: "/"},
+	}
+	ctx := context.Background()
+	if err := s.reconcile(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"db.foo.example.com. A 5.6.7.8 hc=hc-2",
+		"misc.foo.example.com. A 9.9.9.9",
+		"private.foo.example.com. CNAME ec2.internal",
+		"web.foo.example.com. A 1.2.3.4 hc=hc-1",
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if got := healthCheckTargets(r53svc); !reflect.DeepEqual(got, []string{"HTTP 1.2.3.4:80/", "TCP 5.6.7.8:5432"}) {
+		t.Fatalf("unexpected health checks: %q", got)
+	}
+
+	// second run reuses health checks; web changes its address, so its
+	// health check is replaced; db is gone, so is its health check
+	ec2svc.instances = []*ec2.Instance{
+		testInstance("i-1", "web", "", "1.1.1.1"),
+		testInstance("i-4", "private", "ec2.internal", ""),
+		testInstance("i-5", "misc", "", "9.9.9.9"),
+	}
+	if err := s.reconcile(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{
+		"misc.foo.example.com. A 9.9.9.9 hc=hc-4",
+		"private.foo.example.com. CNAME ec2.internal",
+		"web.foo.example.com. A 1.1.1.1 hc=hc-3",
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if got := healthCheckTargets(r53svc); !reflect.DeepEqual(got, []string{"HTTP 1.1.1.1:80/", "HTTP 9.9.9.9:80/"}) {
+		t.Fatalf("unexpected health checks: %q", got)
+	}
+
+	// removal of an instance removes its health check
+	ec2svc.instances = []*ec2.Instance{
+		stopped(testInstance("i-1", "web", "", "1.1.1.1")),
+		testInstance("i-4", "private", "ec2.internal", ""),
+		testInstance("i-5", "misc", "", "9.9.9.9"),
+	}
+	if err := s.removeInstance(ctx, "i-1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := healthCheckTargets(r53svc); !reflect.DeepEqual(got, []string{"HTTP 9.9.9.9:80/"}) {
+		t.Fatalf("unexpected health checks: %q", got)
+	}
+}
+
+// healthCheckTargets returns health checks of the fake in "TYPE ip:port/path"
+// form
+func healthCheckTargets(f *fakeRoute53) []string {
+	var out []string
+	for _, hc := range f.healthChecks {
+		cfg := hc.HealthCheckConfig
+		out = append(out, fmt.Sprintf("%s %s:%d%s", aws.StringValue(cfg.Type), aws.StringValue(cfg.IPAddress),
+			aws.Int64Value(cfg.Port), aws.StringValue(cfg.ResourcePath)))
+	}
+	return out
+}
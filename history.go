@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+// auditScanner is a subset of dynamodb API used to read audit records
+type auditScanner interface {
+	ScanPagesWithContext(aws.Context, *dynamodb.ScanInput, func(*dynamodb.ScanOutput, bool) bool, ...request.Option) error
+}
+
+// changeGetter is a subset of route53 API used to look up change batches
+type changeGetter interface {
+	GetChangeWithContext(aws.Context, *route53.GetChangeInput, ...request.Option) (*route53.GetChangeOutput, error)
+}
+
+// historyEntry is audit record of a change batch joined with the state of the
+// change in Route 53
+type historyEntry struct {
+	auditRecord
+	Status      string     `json:"status"` // PENDING or INSYNC, or "unknown" if Route 53 no longer has the change
+	SubmittedAt *time.Time `json:"submitted_at,omitempty"`
+}
+
+// summaryInstances returns sorted unique ids of instances changes described
+// by summary belong to
+func summaryInstances(summary []recordChange) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, c := range summary {
+		if c.InstanceID != "" && !seen[c.InstanceID] {
+			seen[c.InstanceID] = true
+			out = append(out, c.InstanceID)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// commentMetadata returns structured description of who made the changes
+// described by summary, for change batch comments, like
+// "[principal=arn:aws:sts::123456789012:assumed-role/awsns/i-1 version=v1.2.0 instances=i-1,i-2]"
+func (s *syncer) commentMetadata(summary []recordChange) string {
+	parts := []string{"principal=" + dash(s.principal), "version=" + programVersion()}
+	if ids := summaryInstances(summary); len(ids) != 0 {
+		parts = append(parts, "instances="+strings.Join(ids, ","))
+	}
+	return "[" + strings.Join(parts, " ") + "]"
+}
+
+// history returns up to limit most recent audit records of zoneID changes
+// saved in DynamoDB table, newest first, each joined with the state of its
+// change in Route 53. Zero limit means no limit.
+func history(ctx context.Context, db auditScanner, r53 changeGetter, table, zoneID string, limit int) ([]historyEntry, error) {
+	var out []historyEntry
+	var perr error
+	err := db.ScanPagesWithContext(ctx, &dynamodb.ScanInput{
+		TableName:                 &table,
+		FilterExpression:          aws.String("ZoneID = :zone"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":zone": {S: &zoneID}},
+	}, func(page *dynamodb.ScanOutput, _ bool) bool {
+		for _, item := range page.Items {
+			var e historyEntry
+			if item["Record"] == nil {
+				continue
+			}
+			if perr = json.Unmarshal([]byte(aws.StringValue(item["Record"].S)), &e.auditRecord); perr != nil {
+				perr = fmt.Errorf("audit record %s: %w", aws.StringValue(item["ChangeID"].S), perr)
+				return false
+			}
+			out = append(out, e)
+		}
+		return true
+	})
+	if err == nil {
+		err = perr
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Time.After(out[j].Time) })
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	for i := range out {
+		e := &out[i]
+		e.Status = "unknown"
+		if e.ChangeID == "" {
+			continue
+		}
+		resp, err := r53.GetChangeWithContext(ctx, &route53.GetChangeInput{Id: &e.ChangeID})
+		var aerr awserr.Error
+		switch {
+		case errors.As(err, &aerr) && aerr.Code() == route53.ErrCodeNoSuchChange:
+			continue
+		case err != nil:
+			return nil, fmt.Errorf("change %s: %w", e.ChangeID, err)
+		}
+		if resp.ChangeInfo != nil {
+			e.Status, e.SubmittedAt = aws.StringValue(resp.ChangeInfo.Status), resp.ChangeInfo.SubmittedAt
+		}
+	}
+	return out, nil
+}
+
+// writeHistory writes history entries to w in the given format, table or
+// json
+func writeHistory(w io.Writer, entries []historyEntry, format string) error {
+	switch format {
+	case "", "table":
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "TIME\tCHANGE\tSTATUS\tPRINCIPAL\tVERSION\tINSTANCES\tCHANGES\tCOMMENT")
+		for _, e := range entries {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\n", e.Time.Format(time.RFC3339), e.ChangeID, e.Status,
+				dash(e.Principal), dash(e.Version), dash(strings.Join(e.InstanceIDs, ",")), len(e.Changes), e.Comment)
+		}
+		return tw.Flush()
+	case "json":
+		if entries == nil {
+			entries = []historyEntry{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	}
+	return fmt.Errorf("unsupported history format %q", format)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+func TestHistory(t *testing.T) {
+	db := newFakeDynamoDB("ChangeID")
+	r53svc := newFakeRoute53(t, "old.foo.example.com. A 1.1.1.1")
+	s := &syncer{
+		ec2: &fakeEC2{instances: []*ec2.Instance{
+			testInstance("i-2", "db", "", "2.2.2.2"),
+			testInstance("i-1", "jenkins", "", "1.2.3.4"),
+		}},
+		r53:           r53svc,
+		suffix:        ".foo.example.com",
+		zoneID:        "Z1",
+		auditDB:       db,
+		auditTable:    "audit",
+		auditMetadata: true,
+		principal:     "arn:aws:iam::123456789012:user/ops",
+	}
+	if err := s.reconcile(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	wantSuffix := " [principal=arn:aws:iam::123456789012:user/ops version=" + programVersion() + " instances=i-1,i-2]"
+	if len(r53svc.comments) != 1 || !strings.HasSuffix(r53svc.comments[0], wantSuffix) {
+		t.Fatalf("got comments %q, want one ending with %q", r53svc.comments, wantSuffix)
+	}
+	item := db.items["C1"]
+	if item == nil || aws.StringValue(item["Principal"].S) != s.principal || len(item["InstanceIDs"].SS) != 2 {
+		t.Fatalf("unexpected DynamoDB item: %v", item)
+	}
+	old, _ := json.Marshal(auditRecord{Time: time.Now().Add(-100 * 24 * time.Hour), ZoneID: "Z1", ChangeID: "C0"})
+	db.items["C0"] = map[string]*dynamodb.AttributeValue{"ChangeID": {S: aws.String("C0")},
+		"ZoneID": {S: aws.String("Z1")}, "Record": {S: aws.String(string(old))}}
+	other, _ := json.Marshal(auditRecord{Time: time.Now(), ZoneID: "Z2", ChangeID: "C9"})
+	db.items["C9"] = map[string]*dynamodb.AttributeValue{"ChangeID": {S: aws.String("C9")},
+		"ZoneID": {S: aws.String("Z2")}, "Record": {S: aws.String(string(other))}}
+
+	changes := fakeChanges{"C1": route53.ChangeStatusInsync}
+	entries, err := history(context.Background(), db, changes, "audit", "Z1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].ChangeID != "C1" || entries[0].Status != route53.ChangeStatusInsync ||
+		entries[0].Principal != s.principal || entries[1].ChangeID != "C0" || entries[1].Status != "unknown" {
+		t.Fatalf("unexpected history: %+v", entries)
+	}
+	if entries, err = history(context.Background(), db, changes, "audit", "Z1", 1); err != nil || len(entries) != 1 {
+		t.Fatalf("got %d entries, %v with limit 1", len(entries), err)
+	}
+	var buf bytes.Buffer
+	if err := writeHistory(&buf, entries, "table"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "C1") || !strings.Contains(buf.String(), "i-1,i-2") {
+		t.Fatalf("unexpected table:\n%s", buf.String())
+	}
+	if err := writeHistory(&buf, entries, "yaml"); err == nil {
+		t.Fatal("unsupported format accepted")
+	}
+}
+
+func (f *fakeDynamoDB) ScanPagesWithContext(_ aws.Context, in *dynamodb.ScanInput, fn func(*dynamodb.ScanOutput, bool) bool, _ ...request.Option) error {
+	if err := checkExpression(in.FilterExpression, in.ExpressionAttributeNames); err != nil {
+		return err
+	}
+	zoneID := aws.StringValue(in.ExpressionAttributeValues[":zone"].S)
+	for _, item := range f.items {
+		if aws.StringValue(item["ZoneID"].S) != zoneID {
+			continue
+		}
+		if !fn(&dynamodb.ScanOutput{Items: []map[string]*dynamodb.AttributeValue{item}}, false) {
+			break
+		}
+	}
+	return nil
+}
+
+// fakeChanges is changeGetter knowing the status of changes by their ids
+type fakeChanges map[string]string
+
+func (f fakeChanges) GetChangeWithContext(_ aws.Context, in *route53.GetChangeInput, _ ...request.Option) (*route53.GetChangeOutput, error) {
+	status, ok := f[aws.StringValue(in.Id)]
+	if !ok {
+		return nil, awserr.New(route53.ErrCodeNoSuchChange, "no such change", nil)
+	}
+	return &route53.GetChangeOutput{ChangeInfo: &route53.ChangeInfo{Id: in.Id, Status: &status,
+		SubmittedAt: aws.Time(time.Now())}}, nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+)
+
+// policyDocument is IAM policy document
+type policyDocument struct {
+	Version   string
+	Statement []policyStatement
+}
+
+// policyStatement is a single statement of IAM policy document
+type policyStatement struct {
+	Effect   string
+	Action   []string
+	Resource []string
+}
+
+// iamPolicy returns least-privilege IAM policy allowing the program to run
+// with the given config: only actions it calls are allowed, and only on the
+// resources it uses, where these are known from the config.
+func iamPolicy(cfg config) (policyDocument, error) {
+	allow := func(resource string, actions ...string) policyStatement {
+		return policyStatement{Effect: "Allow", Action: actions, Resource: []string{resource}}
+	}
+	partition := cfg.Partition
+	if partition == "" {
+		partition = endpoints.AwsPartitionID
+	}
+	zoneARN := "arn:" + partition + ":route53:::hostedzone/*"
+	if cfg.Zone != "" {
+		zoneARN = "arn:" + partition + ":route53:::hostedzone/" + path.Base(cfg.Zone)
+	}
+	// hosted zone name is always looked up to validate the suffix
+	zoneActions := []string{"route53:ChangeResourceRecordSets", "route53:ListResourceRecordSets", "route53:GetHostedZone"}
+	doc := policyDocument{Version: "2012-10-17"}
+	if !cfg.Self && !cfg.SelfDereg {
+		// instance registering itself reads everything it needs from
+		// its metadata
+		doc.Statement = append(doc.Statement, allow("*", "ec2:DescribeInstances"))
+	}
+	if cfg.FQDNTag != "" {
+		doc.Statement = append(doc.Statement, allow("arn:"+partition+":ec2:*:*:instance/*", "ec2:CreateTags"))
+	}
+	doc.Statement = append(doc.Statement, allow(zoneARN, zoneActions...))
+	if cfg.ReverseZone != "" {
+		doc.Statement = append(doc.Statement, allow("arn:"+partition+":route53:::hostedzone/"+path.Base(cfg.ReverseZone),
+			"route53:ChangeResourceRecordSets", "route53:GetHostedZone", "route53:ListResourceRecordSets"))
+	}
+	if cfg.CanaryZone != "" {
+		doc.Statement = append(doc.Statement, allow("arn:"+partition+":route53:::hostedzone/"+path.Base(cfg.CanaryZone),
+			"route53:ChangeResourceRecordSets", "route53:GetHostedZone", "route53:ListResourceRecordSets"))
+	}
+	if cfg.Wait {
+		doc.Statement = append(doc.Statement, allow("arn:"+partition+":route53:::change/*", "route53:GetChange"))
+	}
+	var globalActions []string // Route 53 actions not supporting resource-level permissions
+	findsZones := cfg.Domain != "" || cfg.EnvSuffixes != "" && cfg.Zone == ""
+	if findsZones {
+		globalActions = append(globalActions, "route53:ListHostedZonesByName")
+	}
+	if findsZones && cfg.Create {
+		globalActions = append(globalActions, "route53:CreateHostedZone")
+		if cfg.Private {
+			globalActions = append(globalActions, "route53:AssociateVPCWithHostedZone", "ec2:DescribeVpcs")
+		}
+	}
+	if cfg.HealthCheck != "" {
+		globalActions = append(globalActions, "route53:CreateHealthCheck", "route53:DeleteHealthCheck",
+			"route53:ListHealthChecks")
+	}
+	if len(globalActions) != 0 {
+		doc.Statement = append(doc.Statement, allow("*", globalActions...))
+	}
+	if cfg.LBTag != "" {
+		doc.Statement = append(doc.Statement, allow("*", "elasticloadbalancing:DescribeLoadBalancers",
+			"elasticloadbalancing:DescribeTags"))
+	}
+	if cfg.DBTag != "" {
+		doc.Statement = append(doc.Statement, allow("*", "elasticache:DescribeCacheClusters",
+			"elasticache:DescribeReplicationGroups", "elasticache:ListTagsForResource",
+			"rds:DescribeDBClusters", "rds:DescribeDBInstances"))
+	}
+	if strings.HasPrefix(cfg.Manifest, "s3://") {
+		bucket, key, err := parseS3URL(cfg.Manifest)
+		if err != nil {
+			return policyDocument{}, err
+		}
+		doc.Statement = append(doc.Statement, allow("arn:"+partition+":s3:::"+path.Join(bucket, key), "s3:GetObject"))
+	}
+	if roles := splitList(cfg.Accounts); len(roles) != 0 {
+		doc.Statement = append(doc.Statement, policyStatement{Effect: "Allow", Action: []string{"sts:AssumeRole"},
+			Resource: roles})
+	}
+	if cfg.Org {
+		doc.Statement = append(doc.Statement, allow("*", "organizations:ListAccounts"),
+			allow("arn:"+partition+":iam::*:role/"+cfg.OrgRole, "sts:AssumeRole"))
+	}
+	if cfg.Lightsail {
+		doc.Statement = append(doc.Statement, allow("*", "lightsail:GetInstances"))
+	}
+	if cfg.ECSCluster != "" {
+		doc.Statement = append(doc.Statement, allow("*", "ec2:DescribeNetworkInterfaces", "ecs:DescribeTasks",
+			"ecs:ListTasks"))
+	}
+	if cfg.CloudWatch {
+		doc.Statement = append(doc.Statement, allow("*", "cloudwatch:PutMetricData"))
+	}
+	if cfg.SNSTopic != "" {
+		doc.Statement = append(doc.Statement, allow(cfg.SNSTopic, "sns:Publish"))
+	}
+	if cfg.EventBus != "" {
+		bus := cfg.EventBus
+		if !strings.HasPrefix(bus, "arn:") {
+			bus = "arn:" + partition + ":events:*:*:event-bus/" + bus
+		}
+		doc.Statement = append(doc.Statement, allow(bus, "events:PutEvents"))
+	}
+	if cfg.LockTable != "" {
+		doc.Statement = append(doc.Statement, allow("arn:"+partition+":dynamodb:*:*:table/"+cfg.LockTable,
+			"dynamodb:DeleteItem", "dynamodb:PutItem"))
+	}
+	if cfg.AuditS3 != "" {
+		bucket, prefix, err := parseS3URL(cfg.AuditS3)
+		if err != nil {
+			return policyDocument{}, err
+		}
+		doc.Statement = append(doc.Statement, allow("arn:"+partition+":s3:::"+path.Join(bucket, prefix, "*"), "s3:PutObject"))
+	}
+	if cfg.AuditTable != "" {
+		doc.Statement = append(doc.Statement, allow("arn:"+partition+":dynamodb:*:*:table/"+cfg.AuditTable, "dynamodb:PutItem"))
+	}
+	if strings.HasPrefix(cfg.Snapshot, "s3://") {
+		bucket, prefix, err := parseS3URL(cfg.Snapshot)
+		if err != nil {
+			return policyDocument{}, err
+		}
+		doc.Statement = append(doc.Statement, allow("arn:"+partition+":s3:::"+path.Join(bucket, prefix, "*"), "s3:PutObject"))
+	}
+	if strings.HasPrefix(cfg.ListCheckpoint, "s3://") {
+		bucket, prefix, err := parseS3URL(cfg.ListCheckpoint)
+		if err != nil {
+			return policyDocument{}, err
+		}
+		doc.Statement = append(doc.Statement, allow("arn:"+partition+":s3:::"+path.Join(bucket, prefix, "*"),
+			"s3:GetObject", "s3:PutObject", "s3:DeleteObject"))
+	}
+	return doc, nil
+}
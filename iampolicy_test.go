@@ -0,0 +1,64 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIAMPolicy(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Zone = "/hostedzone/Z1"
+	cfg.Suffix = ".foo.example.com"
+	doc, err := iamPolicy(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []policyStatement{
+		{Effect: "Allow", Action: []string{"ec2:DescribeInstances"}, Resource: []string{"*"}},
+		{Effect: "Allow", Action: []string{"route53:ChangeResourceRecordSets", "route53:ListResourceRecordSets",
+			"route53:GetHostedZone"}, Resource: []string{"arn:aws:route53:::hostedzone/Z1"}},
+	}
+	if !reflect.DeepEqual(doc.Statement, want) {
+		t.Fatalf("got statements\n%+v\nwant\n%+v", doc.Statement, want)
+	}
+
+	cfg.Self = true
+	if doc, err = iamPolicy(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(doc.Statement, want[1:]) {
+		t.Fatalf("got statements\n%+v\nwant\n%+v", doc.Statement, want[1:])
+	}
+	cfg.Self = false
+
+	cfg.Zone, cfg.Suffix, cfg.Domain = "", "", "foo.example.com"
+	cfg.HealthCheck = "tcp:22"
+	cfg.LockTable = "locks"
+	cfg.AuditS3 = "s3://audit/dns/"
+	if doc, err = iamPolicy(cfg); err != nil {
+		t.Fatal(err)
+	}
+	want = append(want[:1],
+		policyStatement{Effect: "Allow", Action: []string{"route53:ChangeResourceRecordSets",
+			"route53:ListResourceRecordSets", "route53:GetHostedZone"},
+			Resource: []string{"arn:aws:route53:::hostedzone/*"}},
+		policyStatement{Effect: "Allow", Action: []string{"route53:ListHostedZonesByName",
+			"route53:CreateHealthCheck", "route53:DeleteHealthCheck", "route53:ListHealthChecks"},
+			Resource: []string{"*"}},
+		policyStatement{Effect: "Allow", Action: []string{"dynamodb:DeleteItem", "dynamodb:PutItem"},
+			Resource: []string{"arn:aws:dynamodb:*:*:table/locks"}},
+		policyStatement{Effect: "Allow", Action: []string{"s3:PutObject"},
+			Resource: []string{"arn:aws:s3:::audit/dns/*"}},
+	)
+	if !reflect.DeepEqual(doc.Statement, want) {
+		t.Fatalf("got statements\n%+v\nwant\n%+v", doc.Statement, want)
+	}
+
+	cfg.Partition = "aws-us-gov"
+	if doc, err = iamPolicy(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := doc.Statement[1].Resource[0], "arn:aws-us-gov:route53:::hostedzone/*"; got != want {
+		t.Fatalf("got zone resource %q in aws-us-gov partition, want %q", got, want)
+	}
+}
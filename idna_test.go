@@ -0,0 +1,19 @@
+package main
+
+import "testing"
+
+func TestToASCII(t *testing.T) {
+	table := []struct{ in, want string }{
+		{"jenkins", "jenkins"},
+		{"Bücher", "xn--bcher-kva"},
+		{"münchen.example.com", "xn--mnchen-3ya.example.com"},
+		{"пример", "xn--e1afmkfd"},
+		{"例え", "xn--r8jz45g"},
+		{"ü", "xn--tda"},
+	}
+	for _, tc := range table {
+		if got := toASCII(tc.in); got != tc.want {
+			t.Errorf("toASCII(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
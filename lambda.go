@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+)
+
+// handleEvent processes Lambda invocation event
+func (s *syncer) handleEvent(ctx context.Context, evt events.CloudWatchEvent) error {
+	s.resetBudget()
+	switch evt.Source {
+	case "aws.ec2":
+		return s.handleStateChange(ctx, evt)
+	case "aws.autoscaling":
+		return s.handleLifecycleAction(ctx, evt)
+	case "aws.tag":
+		return s.handleTagChange(ctx, evt)
+	case "aws.events", "aws.scheduler":
+		// scheduled invocation, do a full reconciliation
+		return s.scheduledReconcile(ctx)
+	}
+	logMsg("unsupported event source", "source", evt.Source)
+	return nil
+}
+
+// handleStateChange processes "EC2 Instance State-change Notification" event
+func (s *syncer) handleStateChange(ctx context.Context, evt events.CloudWatchEvent) error {
+	det := struct {
+		ID    string `json:"instance-id"`
+		State string `json:"state"`
+	}{}
+	if err := json.Unmarshal(evt.Detail, &det); err != nil {
+		return err
+	}
+	if det.ID == "" {
+		logMsg("empty instance id")
+		return nil
+	}
+	var handle func(context.Context, string) error
+	action := s.stateAction(det.State)
+	switch action {
+	case actionUpsert:
+		handle = s.launchInstance
+	case actionDelete:
+		handle = s.removeInstance
+	case actionIgnore:
+		logMsg("ignoring instance state change", "instance_id", det.ID, "state", det.State)
+		return nil
+	default:
+		logMsg("unsupported ec2 instance state", "instance_id", det.ID, "state", det.State)
+		return nil
+	}
+	// events may be delivered late, out of order or more than once
+	stale, key, err := s.staleEvent(ctx, det.ID, det.State, action, evt.Time)
+	switch {
+	case err != nil:
+		return err
+	case stale:
+		logMsg("discarding stale event", "instance_id", det.ID, "state", det.State, "time", evt.Time)
+		return nil
+	case s.handledEvent(key):
+		logMsg("event already handled", "instance_id", det.ID, "state", det.State)
+		return nil
+	}
+	if err := handle(ctx, det.ID); err != nil {
+		return err
+	}
+	s.markHandled(key)
+	return nil
+}
+
+// handleTagChange processes "Tag Change on Resource" event, renaming record
+// if ec2 instance "Name" tag was changed, or doing a full update if any of
+// "dns:" tags or environment tag was changed
+func (s *syncer) handleTagChange(ctx context.Context, evt events.CloudWatchEvent) error {
+	det := struct {
+		Service      string            `json:"service"`
+		ResourceType string            `json:"resource-type"`
+		ChangedKeys  []string          `json:"changed-tag-keys"`
+		Tags         map[string]string `json:"tags"`
+	}{}
+	if err := json.Unmarshal(evt.Detail, &det); err != nil {
+		return err
+	}
+	if det.Service != "ec2" || det.ResourceType != "instance" {
+		logMsg("unsupported tag change resource", "service", det.Service, "resource_type", det.ResourceType)
+		return nil
+	}
+	var nameChanged, dnsChanged bool
+	for _, k := range det.ChangedKeys {
+		switch {
+		case k == "Name":
+			nameChanged = true
+		case strings.HasPrefix(k, "dns:"), s.envTag != "" && k == s.envTag:
+			dnsChanged = true
+		}
+	}
+	if !nameChanged && !dnsChanged {
+		return nil
+	}
+	if dnsChanged || s.groupPolicy != "" || det.Tags[failoverTag] != "" || det.Tags[weightTag] != "" ||
+		det.Tags[geoTag] != "" || det.Tags[policyTag] != "" {
+		// records of instances sharing the same name depend on each
+		// other, so do a full update
+		return s.reconcile(ctx, "")
+	}
+	for _, arn := range evt.Resources {
+		// arn:aws:ec2:us-east-1:123456789012:instance/i-0123456789abcdef0
+		const marker = ":instance/"
+		i := strings.LastIndex(arn, marker)
+		if i < 0 {
+			logMsg("unsupported resource arn", "arn", arn)
+			continue
+		}
+		if err := s.renameInstance(ctx, arn[i+len(marker):]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lifecycle transitions of autoscaling lifecycle hook events
+const (
+	transitionLaunching   = "autoscaling:EC2_INSTANCE_LAUNCHING"
+	transitionTerminating = "autoscaling:EC2_INSTANCE_TERMINATING"
+)
+
+// lifecycleAction is the detail of autoscaling lifecycle hook event
+type lifecycleAction struct {
+	Group      string `json:"AutoScalingGroupName"`
+	Hook       string `json:"LifecycleHookName"`
+	Token      string `json:"LifecycleActionToken"`
+	ID         string `json:"EC2InstanceId"`
+	Transition string `json:"LifecycleTransition"`
+}
+
+// handleLifecycleAction processes autoscaling lifecycle hook events: it
+// updates DNS for the launching or terminating instance, then completes
+// lifecycle action so autoscaling can proceed. If DNS update fails, lifecycle
+// action is left incomplete, so autoscaling applies hook's default result
+// after its heartbeat timeout.
+func (s *syncer) handleLifecycleAction(ctx context.Context, evt events.CloudWatchEvent) error {
+	var det lifecycleAction
+	if err := json.Unmarshal(evt.Detail, &det); err != nil {
+		return err
+	}
+	if det.ID == "" {
+		logMsg("empty instance id")
+		return nil
+	}
+	var err error
+	switch det.Transition {
+	case transitionLaunching:
+		err = s.launchInstance(ctx, det.ID)
+	case transitionTerminating:
+		err = s.removeInstance(ctx, det.ID)
+	default:
+		logMsg("unsupported lifecycle transition", "instance_id", det.ID, "transition", det.Transition)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.completeLifecycleAction(ctx, det)
+}
+
+// completeLifecycleAction completes lifecycle action with CONTINUE result
+func (s *syncer) completeLifecycleAction(ctx context.Context, det lifecycleAction) error {
+	_, err := s.asg.CompleteLifecycleActionWithContext(ctx, &autoscaling.CompleteLifecycleActionInput{
+		AutoScalingGroupName:  &det.Group,
+		LifecycleHookName:     &det.Hook,
+		LifecycleActionToken:  &det.Token,
+		InstanceId:            &det.ID,
+		LifecycleActionResult: aws.String("CONTINUE"),
+	})
+	return err
+}
+
+// handleInvocation processes Lambda invocation payload: either a single
+// EventBridge event, or a batch of them delivered through SQS queue
+func (s *syncer) handleInvocation(ctx context.Context, payload json.RawMessage) error {
+	var batch events.SQSEvent
+	if err := json.Unmarshal(payload, &batch); err == nil && len(batch.Records) != 0 &&
+		batch.Records[0].EventSource == "aws:sqs" {
+		return s.handleQueue(ctx, batch)
+	}
+	var evt events.CloudWatchEvent
+	if err := json.Unmarshal(payload, &evt); err != nil {
+		return err
+	}
+	return s.handleEvent(ctx, evt)
+}
+
+// handleQueue processes a batch of EventBridge events delivered through SQS
+// queue. Instead of handling each event on its own, it does a single full
+// update for the whole batch, then removes records of instances being
+// terminated by autoscaling, and completes lifecycle actions of the batch. If
+// any step fails, the error is returned so the whole batch is retried.
+func (s *syncer) handleQueue(ctx context.Context, batch events.SQSEvent) error {
+	var update bool
+	var actions []lifecycleAction
+	for _, msg := range batch.Records {
+		var evt events.CloudWatchEvent
+		if err := json.Unmarshal([]byte(msg.Body), &evt); err != nil || evt.Source == "" {
+			logMsg("skipping queue message without event", "message_id", msg.MessageId)
+			continue
+		}
+		switch evt.Source {
+		case "aws.ec2", "aws.tag", "aws.events", "aws.scheduler":
+		case "aws.autoscaling":
+			var det lifecycleAction
+			if err := json.Unmarshal(evt.Detail, &det); err != nil || det.ID == "" {
+				logMsg("skipping invalid lifecycle action", "message_id", msg.MessageId)
+				continue
+			}
+			switch det.Transition {
+			case transitionLaunching, transitionTerminating:
+				actions = append(actions, det)
+			default:
+				logMsg("unsupported lifecycle transition", "instance_id", det.ID, "transition", det.Transition)
+				continue
+			}
+		default:
+			logMsg("unsupported event source", "source", evt.Source, "message_id", msg.MessageId)
+			continue
+		}
+		update = true
+	}
+	if !update {
+		return nil
+	}
+	logMsg("handling queued events", "count", len(batch.Records))
+	if err := s.reconcile(ctx, ""); err != nil {
+		return err
+	}
+	for _, det := range actions {
+		// terminating instances are still running, so full update
+		// keeps their records
+		if det.Transition == transitionTerminating {
+			if err := s.removeInstance(ctx, det.ID); err != nil {
+				return err
+			}
+		}
+	}
+	for _, det := range actions {
+		if err := s.completeLifecycleAction(ctx, det); err != nil {
+			return err
+		}
+	}
+	return nil
+}
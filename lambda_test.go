@@ -0,0 +1,405 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+func TestHandleEvent_stateChange(t *testing.T) {
+	const suffix = ".foo.example.com"
+	records := []string{
+		"jenkins.foo.example.com. A 1.2.3.4",
+		"db.foo.example.com. A 5.6.7.8",
+		"web.foo.example.com. A 9.9.9.9",
+	}
+	table := []struct {
+		name      string
+		instances []*ec2.Instance
+		id, state string
+		want      []string
+	}{
+		{
+			name: "terminated",
+			instances: []*ec2.Instance{
+				stateOf(testInstance("i-1", "jenkins", "", "1.2.3.4"), ec2.InstanceStateNameTerminated),
+				testInstance("i-2", "db", "", "5.6.7.8"),
+			},
+			id: "i-1", state: "terminated",
+			want: []string{
+				"db.foo.example.com. A 5.6.7.8",
+				"web.foo.example.com. A 9.9.9.9",
+			},
+		},
+		{
+			name: "instance no longer described",
+			instances: []*ec2.Instance{
+				testInstance("i-2", "db", "", "5.6.7.8"),
+			},
+			id: "i-1", state: "terminated",
+			want: records,
+		},
+		{
+			name: "name reused by running instance",
+			instances: []*ec2.Instance{
+				stateOf(testInstance("i-1", "jenkins", "", "1.2.3.4"), ec2.InstanceStateNameShuttingDown),
+				testInstance("i-2", "jenkins", "", "4.3.2.1"),
+			},
+			id: "i-1", state: "shutting-down",
+			want: records,
+		},
+		{
+			name: "no record",
+			instances: []*ec2.Instance{
+				stopped(testInstance("i-1", "other", "", "1.2.3.4")),
+			},
+			id: "i-1", state: "stopped",
+			want: records,
+		},
+		{
+			name: "ignored instance",
+			instances: []*ec2.Instance{
+				withTag(stateOf(testInstance("i-1", "jenkins", "", "1.2.3.4"), ec2.InstanceStateNameStopped),
+					defaultIgnoreTag, "true"),
+			},
+			id: "i-1", state: "stopped",
+			want: records,
+		},
+		{
+			name: "unsupported state",
+			instances: []*ec2.Instance{
+				stateOf(testInstance("i-1", "jenkins", "", "1.2.3.4"), ec2.InstanceStateNameStopping),
+			},
+			id: "i-1", state: "stopping",
+			want: records,
+		},
+	}
+	for _, tc := range table {
+		t.Run(tc.name, func(t *testing.T) {
+			r53svc := newFakeRoute53(t, records...)
+			s := &syncer{
+				ec2:       &fakeEC2{instances: tc.instances},
+				r53:       r53svc,
+				suffix:    suffix,
+				zoneID:    "Z1",
+				ignoreTag: defaultIgnoreTag,
+			}
+			if err := s.handleEvent(context.Background(), stateChangeEvent(t, tc.id, tc.state)); err != nil {
+				t.Fatal(err)
+			}
+			want := append([]string(nil), tc.want...)
+			sort.Strings(want)
+			if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+				t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s",
+					strings.Join(got, "\n"), strings.Join(want, "\n"))
+			}
+		})
+	}
+}
+
+func TestHandleEvent_staleStateChange(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	launched := func(inst *ec2.Instance, t time.Time) *ec2.Instance {
+		inst.LaunchTime = &t
+		return inst
+	}
+	ec2svc := &fakeEC2{instances: []*ec2.Instance{
+		launched(testInstance("i-1", "web", "", "1.2.3.4"), at.Add(time.Minute)),
+		launched(stateOf(testInstance("i-2", "db", "", "5.6.7.8"), ec2.InstanceStateNameTerminated), at),
+	}}
+	r53svc := newFakeRoute53(t, "web.foo.example.com. A 1.2.3.4", "old.foo.example.com. A 9.9.9.9")
+	s := &syncer{ec2: ec2svc, r53: r53svc, suffix: ".foo.example.com", zoneID: "Z1"}
+	ctx := context.Background()
+	for _, evt := range []events.CloudWatchEvent{
+		stateChangeEvent(t, "i-1", "stopped"), // instance was started again since
+		stateChangeEvent(t, "i-2", "running"), // instance was terminated since
+	} {
+		evt.Time = at
+		if err := s.handleEvent(ctx, evt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(r53svc.batches) != 0 {
+		t.Fatalf("got %d change batches for stale events, want 0", len(r53svc.batches))
+	}
+
+	// duplicate delivery of the same event is handled once
+	ec2svc.instances[0] = stopped(ec2svc.instances[0])
+	evt := stateChangeEvent(t, "i-1", "stopped")
+	evt.Time = at.Add(time.Hour)
+	if err := s.handleEvent(ctx, evt); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := r53svc.dump(), []string{"old.foo.example.com. A 9.9.9.9"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q after stop event, want %q", got, want)
+	}
+	r53svc.add(&route53.ResourceRecordSet{Name: aws.String("web.foo.example.com."), Type: aws.String("A"),
+		TTL: aws.Int64(60), ResourceRecords: []*route53.ResourceRecord{{Value: aws.String("1.2.3.4")}}})
+	if err := s.handleEvent(ctx, evt); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(r53svc.dump()); got != 2 {
+		t.Fatalf("duplicate event was handled again, got %q", r53svc.dump())
+	}
+}
+
+func stateChangeEvent(t *testing.T, id, state string) events.CloudWatchEvent {
+	detail, err := json.Marshal(map[string]string{"instance-id": id, "state": state})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events.CloudWatchEvent{
+		Source:     "aws.ec2",
+		DetailType: "EC2 Instance State-change Notification",
+		Detail:     detail,
+	}
+}
+
+func stateOf(inst *ec2.Instance, state string) *ec2.Instance {
+	inst.State.Name = &state
+	return inst
+}
+
+func TestHandleEvent_scheduled(t *testing.T) {
+	for _, source := range []string{"aws.events", "aws.scheduler"} {
+		t.Run(source, func(t *testing.T) {
+			r53svc := newFakeRoute53(t, "old.foo.example.com. A 1.1.1.1")
+			s := &syncer{
+				ec2:    &fakeEC2{instances: []*ec2.Instance{testInstance("i-1", "jenkins", "", "1.2.3.4")}},
+				r53:    r53svc,
+				suffix: ".foo.example.com",
+				zoneID: "Z1",
+			}
+			evt := events.CloudWatchEvent{Source: source, DetailType: "Scheduled Event"}
+			if err := s.handleEvent(context.Background(), evt); err != nil {
+				t.Fatal(err)
+			}
+			want := []string{"jenkins.foo.example.com. A 1.2.3.4"}
+			if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+				t.Fatalf("got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestHandleEvent_tagChange(t *testing.T) {
+	r53svc := newFakeRoute53(t,
+		"jenkins.foo.example.com. A 1.2.3.4",
+		"db.foo.example.com. A 5.6.7.8",
+		"shared.foo.example.com. A 1.2.3.4",
+	)
+	s := &syncer{
+		ec2: &fakeEC2{instances: []*ec2.Instance{
+			testInstance("i-1", "ci", "", "1.2.3.4"),
+			testInstance("i-2", "db", "", "5.6.7.8"),
+			testInstance("i-3", "shared", "", "9.9.9.9"),
+		}},
+		r53:    r53svc,
+		suffix: ".foo.example.com",
+		zoneID: "Z1",
+	}
+	detail, err := json.Marshal(map[string]interface{}{
+		"changed-tag-keys": []string{"Name"},
+		"service":          "ec2",
+		"resource-type":    "instance",
+		"tags":             map[string]string{"Name": "ci"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	evt := events.CloudWatchEvent{
+		Source:     "aws.tag",
+		DetailType: "Tag Change on Resource",
+		Resources:  []string{"arn:aws:ec2:us-east-1:123456789012:instance/i-1"},
+		Detail:     detail,
+	}
+	if err := s.handleEvent(context.Background(), evt); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"ci.foo.example.com. A 1.2.3.4",
+		"db.foo.example.com. A 5.6.7.8",
+		"shared.foo.example.com. A 1.2.3.4",
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s",
+			strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if l := len(r53svc.batches); l != 1 {
+		t.Fatalf("got %d change batches, want 1", l)
+	}
+}
+
+func TestHandleEvent_lifecycleAction(t *testing.T) {
+	table := []struct {
+		transition string
+		want       []string
+	}{
+		{
+			transition: "autoscaling:EC2_INSTANCE_LAUNCHING",
+			want: []string{
+				"jenkins.foo.example.com. A 1.2.3.4",
+				"web.foo.example.com. A 5.6.7.8",
+			},
+		},
+		{
+			transition: "autoscaling:EC2_INSTANCE_TERMINATING",
+			want: []string{
+				"jenkins.foo.example.com. A 1.2.3.4",
+			},
+		},
+	}
+	for _, tc := range table {
+		t.Run(tc.transition, func(t *testing.T) {
+			r53svc := newFakeRoute53(t,
+				"jenkins.foo.example.com. A 1.2.3.4",
+				"web.foo.example.com. A 5.6.7.8",
+			)
+			asg := &fakeAutoscaling{}
+			s := &syncer{
+				ec2: &fakeEC2{instances: []*ec2.Instance{
+					testInstance("i-1", "jenkins", "", "1.2.3.4"),
+					testInstance("i-2", "web", "", "5.6.7.8"),
+				}},
+				r53:    r53svc,
+				asg:    asg,
+				suffix: ".foo.example.com",
+				zoneID: "Z1",
+			}
+			detail, err := json.Marshal(map[string]string{
+				"AutoScalingGroupName": "web-asg",
+				"LifecycleHookName":    "dns",
+				"LifecycleActionToken": "87654321-4321-4321-4321-210987654321",
+				"EC2InstanceId":        "i-2",
+				"LifecycleTransition":  tc.transition,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			evt := events.CloudWatchEvent{Source: "aws.autoscaling", Detail: detail}
+			if err := s.handleEvent(context.Background(), evt); err != nil {
+				t.Fatal(err)
+			}
+			if got := r53svc.dump(); !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s",
+					strings.Join(got, "\n"), strings.Join(tc.want, "\n"))
+			}
+			if len(asg.completed) != 1 {
+				t.Fatalf("got %d completed lifecycle actions, want 1", len(asg.completed))
+			}
+			in := asg.completed[0]
+			if aws.StringValue(in.InstanceId) != "i-2" || aws.StringValue(in.LifecycleActionResult) != "CONTINUE" {
+				t.Fatalf("unexpected lifecycle action completion: %v", in)
+			}
+		})
+	}
+}
+
+type fakeAutoscaling struct {
+	completed []*autoscaling.CompleteLifecycleActionInput
+}
+
+func (f *fakeAutoscaling) CompleteLifecycleActionWithContext(_ aws.Context, in *autoscaling.CompleteLifecycleActionInput, _ ...request.Option) (*autoscaling.CompleteLifecycleActionOutput, error) {
+	f.completed = append(f.completed, in)
+	return &autoscaling.CompleteLifecycleActionOutput{}, nil
+}
+
+func TestHandleInvocation_queue(t *testing.T) {
+	r53svc := newFakeRoute53(t,
+		"jenkins.foo.example.com. A 1.2.3.4",
+		"web.foo.example.com. A 5.6.7.8",
+		"old.foo.example.com. A 1.1.1.1",
+	)
+	asg := &fakeAutoscaling{}
+	s := &syncer{
+		ec2: &fakeEC2{instances: []*ec2.Instance{
+			testInstance("i-1", "jenkins", "", "1.2.3.4"),
+			testInstance("i-2", "web", "", "5.6.7.8"),
+			testInstance("i-3", "db", "", "9.9.9.9"),
+		}},
+		r53:    r53svc,
+		asg:    asg,
+		suffix: ".foo.example.com",
+		zoneID: "Z1",
+	}
+	lifecycle, err := json.Marshal(map[string]string{
+		"AutoScalingGroupName": "web-asg",
+		"LifecycleHookName":    "dns",
+		"LifecycleActionToken": "87654321-4321-4321-4321-210987654321",
+		"EC2InstanceId":        "i-2",
+		"LifecycleTransition":  "autoscaling:EC2_INSTANCE_TERMINATING",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var batch events.SQSEvent
+	for i, evt := range []interface{}{
+		stateChangeEvent(t, "i-3", "running"),
+		events.CloudWatchEvent{Source: "aws.autoscaling", Detail: lifecycle},
+		"not an event",
+	} {
+		body, err := json.Marshal(evt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		batch.Records = append(batch.Records, events.SQSMessage{
+			MessageId:   strconv.Itoa(i),
+			EventSource: "aws:sqs",
+			Body:        string(body),
+		})
+	}
+	payload, err := json.Marshal(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.handleInvocation(context.Background(), payload); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"db.foo.example.com. A 9.9.9.9",
+		"jenkins.foo.example.com. A 1.2.3.4",
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s",
+			strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if len(r53svc.batches) != 2 {
+		t.Fatalf("got %d change batches, want 2: one for full update, one for removal", len(r53svc.batches))
+	}
+	if len(asg.completed) != 1 || aws.StringValue(asg.completed[0].InstanceId) != "i-2" {
+		t.Fatalf("unexpected lifecycle action completions: %v", asg.completed)
+	}
+}
+
+func TestHandleInvocation_event(t *testing.T) {
+	r53svc := newFakeRoute53(t, "old.foo.example.com. A 1.1.1.1")
+	s := &syncer{
+		ec2:    &fakeEC2{instances: []*ec2.Instance{testInstance("i-1", "jenkins", "", "1.2.3.4")}},
+		r53:    r53svc,
+		suffix: ".foo.example.com",
+		zoneID: "Z1",
+	}
+	payload, err := json.Marshal(events.CloudWatchEvent{Source: "aws.events", DetailType: "Scheduled Event"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.handleInvocation(context.Background(), payload); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"jenkins.foo.example.com. A 1.2.3.4"}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
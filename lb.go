@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+// elbClient is a subset of elb (classic load balancers) API used by the
+// program
+type elbClient interface {
+	DescribeLoadBalancersPagesWithContext(aws.Context, *elb.DescribeLoadBalancersInput, func(*elb.DescribeLoadBalancersOutput, bool) bool, ...request.Option) error
+	DescribeTagsWithContext(aws.Context, *elb.DescribeTagsInput, ...request.Option) (*elb.DescribeTagsOutput, error)
+}
+
+// elbv2Client is a subset of elbv2 (application and network load balancers)
+// API used by the program
+type elbv2Client interface {
+	DescribeLoadBalancersPagesWithContext(aws.Context, *elbv2.DescribeLoadBalancersInput, func(*elbv2.DescribeLoadBalancersOutput, bool) bool, ...request.Option) error
+	DescribeTagsWithContext(aws.Context, *elbv2.DescribeTagsInput, ...request.Option) (*elbv2.DescribeTagsOutput, error)
+}
+
+// describeTagsLimit is the maximum number of load balancers per DescribeTags
+// call
+const describeTagsLimit = 20
+
+// loadBalancer is a load balancer that should have alias record
+type loadBalancer struct {
+	id       string // name of classic load balancer, ARN of others
+	name     string // host name from s.lbTag tag value
+	dnsName  string
+	zoneID   string // canonical hosted zone id
+	isActive bool
+}
+
+// loadBalancerRecords returns alias records for active load balancers having
+// s.lbTag tag, named after the tag value. Each record is paired with a
+// placeholder instance having load balancer name or ARN as its id. If several
+// load balancers have the same name, the one with the lowest id wins.
+func (s *syncer) loadBalancerRecords(ctx context.Context) ([]desiredRecord, error) {
+	var lbs []loadBalancer
+	if s.elb != nil {
+		classic, err := s.classicLoadBalancers(ctx)
+		if err != nil {
+			return nil, err
+		}
+		lbs = append(lbs, classic...)
+	}
+	if s.elbv2 != nil {
+		others, err := s.elbv2LoadBalancers(ctx)
+		if err != nil {
+			return nil, err
+		}
+		lbs = append(lbs, others...)
+	}
+	sort.Slice(lbs, func(i, j int) bool { return lbs[i].id < lbs[j].id })
+	var out []desiredRecord
+	seen := make(map[string]string) // names to ids of load balancers
+	for _, lb := range lbs {
+		name := s.normalize(lb.name)
+		switch {
+		case !lb.isActive:
+			continue
+		case name == "":
+			logMsg("ignoring load balancer with invalid name", "load_balancer", lb.id, "tag", s.lbTag, "name", lb.name)
+			continue
+		case seen[name] != "":
+			logMsg("load balancer name is already taken, skipping", "load_balancer", lb.id, "name", name,
+				"other_load_balancer", seen[name])
+			continue
+		}
+		seen[name] = lb.id
+		out = append(out, desiredRecord{
+			rr: &route53.ResourceRecordSet{
+				Name: aws.String(name + s.suffix),
+				Type: aws.String(route53.RRTypeA),
+				AliasTarget: &route53.AliasTarget{
+					DNSName:              aws.String(lb.dnsName),
+					HostedZoneId:         aws.String(lb.zoneID),
+					EvaluateTargetHealth: aws.Bool(false),
+				},
+			},
+			inst: &ec2.Instance{InstanceId: aws.String(lb.id)},
+		})
+	}
+	return out, nil
+}
+
+// classicLoadBalancers returns classic load balancers having s.lbTag tag
+func (s *syncer) classicLoadBalancers(ctx context.Context) ([]loadBalancer, error) {
+	byName := make(map[string]*elb.LoadBalancerDescription)
+	var names []*string
+	fn := func(page *elb.DescribeLoadBalancersOutput, lastPage bool) bool {
+		for _, lb := range page.LoadBalancerDescriptions {
+			byName[aws.StringValue(lb.LoadBalancerName)] = lb
+			names = append(names, lb.LoadBalancerName)
+		}
+		return true
+	}
+	if err := s.elb.DescribeLoadBalancersPagesWithContext(ctx, &elb.DescribeLoadBalancersInput{}, fn); err != nil {
+		return nil, err
+	}
+	var out []loadBalancer
+	for len(names) != 0 {
+		batch := names
+		if len(batch) > describeTagsLimit {
+			batch = batch[:describeTagsLimit]
+		}
+		names = names[len(batch):]
+		resp, err := s.elb.DescribeTagsWithContext(ctx, &elb.DescribeTagsInput{LoadBalancerNames: batch})
+		if err != nil {
+			return nil, err
+		}
+		for _, td := range resp.TagDescriptions {
+			lb := byName[aws.StringValue(td.LoadBalancerName)]
+			if lb == nil {
+				continue
+			}
+			for _, tag := range td.Tags {
+				if aws.StringValue(tag.Key) == s.lbTag {
+					out = append(out, loadBalancer{
+						id:       aws.StringValue(lb.LoadBalancerName),
+						name:     aws.StringValue(tag.Value),
+						dnsName:  aws.StringValue(lb.DNSName),
+						zoneID:   aws.StringValue(lb.CanonicalHostedZoneNameID),
+						isActive: true,
+					})
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+// elbv2LoadBalancers returns application and network load balancers having
+// s.lbTag tag
+func (s *syncer) elbv2LoadBalancers(ctx context.Context) ([]loadBalancer, error) {
+	byARN := make(map[string]*elbv2.LoadBalancer)
+	var arns []*string
+	fn := func(page *elbv2.DescribeLoadBalancersOutput, lastPage bool) bool {
+		for _, lb := range page.LoadBalancers {
+			byARN[aws.StringValue(lb.LoadBalancerArn)] = lb
+			arns = append(arns, lb.LoadBalancerArn)
+		}
+		return true
+	}
+	if err := s.elbv2.DescribeLoadBalancersPagesWithContext(ctx, &elbv2.DescribeLoadBalancersInput{}, fn); err != nil {
+		return nil, err
+	}
+	var out []loadBalancer
+	for len(arns) != 0 {
+		batch := arns
+		if len(batch) > describeTagsLimit {
+			batch = batch[:describeTagsLimit]
+		}
+		arns = arns[len(batch):]
+		resp, err := s.elbv2.DescribeTagsWithContext(ctx, &elbv2.DescribeTagsInput{ResourceArns: batch})
+		if err != nil {
+			return nil, err
+		}
+		for _, td := range resp.TagDescriptions {
+			lb := byARN[aws.StringValue(td.ResourceArn)]
+			if lb == nil {
+				continue
+			}
+			for _, tag := range td.Tags {
+				if aws.StringValue(tag.Key) == s.lbTag {
+					var state string
+					if lb.State != nil {
+						state = aws.StringValue(lb.State.Code)
+					}
+					out = append(out, loadBalancer{
+						id:      aws.StringValue(lb.LoadBalancerArn),
+						name:    aws.StringValue(tag.Value),
+						dnsName: aws.StringValue(lb.DNSName),
+						zoneID:  aws.StringValue(lb.CanonicalHostedZoneId),
+						isActive: state == elbv2.LoadBalancerStateEnumActive ||
+							state == elbv2.LoadBalancerStateEnumActiveImpaired,
+					})
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+// sameAlias reports whether alias targets are the same; Route 53 returns
+// target DNS name in lower case with trailing dot
+func sameAlias(a, b *route53.AliasTarget) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return strings.EqualFold(strings.TrimSuffix(aws.StringValue(a.DNSName), "."),
+		strings.TrimSuffix(aws.StringValue(b.DNSName), ".")) &&
+		aws.StringValue(a.HostedZoneId) == aws.StringValue(b.HostedZoneId) &&
+		aws.BoolValue(a.EvaluateTargetHealth) == aws.BoolValue(b.EvaluateTargetHealth)
+}
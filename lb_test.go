@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+func TestReconcile_loadBalancers(t *testing.T) {
+	elbsvc := &fakeELB{lbs: []*elb.LoadBalancerDescription{
+		{LoadBalancerName: aws.String("legacy"), DNSName: aws.String("legacy-1.us-east-1.elb.amazonaws.com"),
+			CanonicalHostedZoneNameID: aws.String("ZELB")},
+		{LoadBalancerName: aws.String("untagged"), DNSName: aws.String("untagged-1.us-east-1.elb.amazonaws.com"),
+			CanonicalHostedZoneNameID: aws.String("ZELB")},
+	}, tags: map[string]string{"legacy": "www"}}
+	nlb := func(name, state string) *elbv2.LoadBalancer {
+		return &elbv2.LoadBalancer{
+			LoadBalancerArn:       aws.String("arn:aws:elasticloadbalancing:us-east-1:123456789012:loadbalancer/net/" + name),
+			DNSName:               aws.String(name + "-1.elb.us-east-1.amazonaws.com"),
+			CanonicalHostedZoneId: aws.String("ZNLB"),
+			State:                 &elbv2.LoadBalancerState{Code: aws.String(state)},
+		}
+	}
+	elbv2svc := &fakeELBv2{lbs: []*elbv2.LoadBalancer{
+		nlb("api", elbv2.LoadBalancerStateEnumActive),
+		nlb("new", elbv2.LoadBalancerStateEnumProvisioning),
+		nlb("clash", elbv2.LoadBalancerStateEnumActive),
+	}, tags: map[string]string{"api": "api", "new": "new", "clash": "web"}}
+	r53svc := newFakeRoute53(t)
+	r53svc.records["gone.foo.example.com A "] = &route53.ResourceRecordSet{
+		Name: aws.String("gone.foo.example.com."),
+		Type: aws.String("A"),
+		AliasTarget: &route53.AliasTarget{
+			DNSName:      aws.String("gone-1.elb.us-east-1.amazonaws.com."),
+			HostedZoneId: aws.String("ZNLB"),
+		},
+	}
+	s := &syncer{
+		ec2:    &fakeEC2{instances: []*ec2.Instance{testInstance("i-1", "web", "", "1.2.3.4")}},
+		r53:    r53svc,
+		elb:    elbsvc,
+		elbv2:  elbv2svc,
+		lbTag:  "dns:name",
+		suffix: ".foo.example.com",
+		zoneID: "Z1",
+	}
+	ctx := context.Background()
+	if err := s.update(ctx, "", new(runStats)); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"api.foo.example.com. A alias=ZNLB/api-1.elb.us-east-1.amazonaws.com",
+		"web.foo.example.com. A 1.2.3.4",
+		"www.foo.example.com. A alias=ZELB/legacy-1.us-east-1.elb.amazonaws.com",
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	// alias targets as returned by Route 53 match
+	r53svc.records["api.foo.example.com A "].AliasTarget.DNSName = aws.String("api-1.elb.us-east-1.amazonaws.com.")
+	batches := len(r53svc.batches)
+	if err := s.update(ctx, "", new(runStats)); err != nil {
+		t.Fatal(err)
+	}
+	if l := len(r53svc.batches); l != batches {
+		t.Fatalf("got %d new change batches for up to date zone, want 0", l-batches)
+	}
+}
+
+// fakeELB serves classic load balancers with tags keyed by their names
+type fakeELB struct {
+	lbs  []*elb.LoadBalancerDescription
+	tags map[string]string // load balancer name to dns:name tag value
+}
+
+func (f *fakeELB) DescribeLoadBalancersPagesWithContext(_ aws.Context, _ *elb.DescribeLoadBalancersInput, fn func(*elb.DescribeLoadBalancersOutput, bool) bool, _ ...request.Option) error {
+	fn(&elb.DescribeLoadBalancersOutput{LoadBalancerDescriptions: f.lbs}, true)
+	return nil
+}
+
+func (f *fakeELB) DescribeTagsWithContext(_ aws.Context, in *elb.DescribeTagsInput, _ ...request.Option) (*elb.DescribeTagsOutput, error) {
+	out := new(elb.DescribeTagsOutput)
+	for _, name := range in.LoadBalancerNames {
+		td := &elb.TagDescription{LoadBalancerName: name}
+		if v, ok := f.tags[*name]; ok {
+			td.Tags = []*elb.Tag{{Key: aws.String("dns:name"), Value: aws.String(v)}}
+		}
+		out.TagDescriptions = append(out.TagDescriptions, td)
+	}
+	return out, nil
+}
+
+// fakeELBv2 serves load balancers with tags keyed by last element of their
+// ARNs
+type fakeELBv2 struct {
+	lbs  []*elbv2.LoadBalancer
+	tags map[string]string
+}
+
+func (f *fakeELBv2) DescribeLoadBalancersPagesWithContext(_ aws.Context, _ *elbv2.DescribeLoadBalancersInput, fn func(*elbv2.DescribeLoadBalancersOutput, bool) bool, _ ...request.Option) error {
+	fn(&elbv2.DescribeLoadBalancersOutput{LoadBalancers: f.lbs}, true)
+	return nil
+}
+
+func (f *fakeELBv2) DescribeTagsWithContext(_ aws.Context, in *elbv2.DescribeTagsInput, _ ...request.Option) (*elbv2.DescribeTagsOutput, error) {
+	out := new(elbv2.DescribeTagsOutput)
+	for _, arn := range in.ResourceArns {
+		td := &elbv2.TagDescription{ResourceArn: arn}
+		if v, ok := f.tags[(*arn)[strings.LastIndexByte(*arn, '/')+1:]]; ok {
+			td.Tags = []*elbv2.Tag{{Key: aws.String("dns:name"), Value: aws.String(v)}}
+		}
+		out.TagDescriptions = append(out.TagDescriptions, td)
+	}
+	return out, nil
+}
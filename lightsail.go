@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/lightsail"
+)
+
+// lightsailClient is a subset of lightsail API used by the program
+type lightsailClient interface {
+	GetInstancesWithContext(aws.Context, *lightsail.GetInstancesInput, ...request.Option) (*lightsail.GetInstancesOutput, error)
+}
+
+// lightsailInstances returns running Lightsail instances represented as ec2
+// instances, so that they get records the same way ec2 instances do, see
+// lightsailInstance
+func (s *syncer) lightsailInstances(ctx context.Context) ([]*ec2.Instance, error) {
+	var out []*ec2.Instance
+	input := &lightsail.GetInstancesInput{}
+	for {
+		resp, err := s.lightsail.GetInstancesWithContext(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		for _, inst := range resp.Instances {
+			if inst.State != nil && aws.StringValue(inst.State.Name) == "running" {
+				out = append(out, lightsailInstance(inst))
+			}
+		}
+		if aws.StringValue(resp.NextPageToken) == "" {
+			return out, nil
+		}
+		input.PageToken = resp.NextPageToken
+	}
+}
+
+// lightsailInstance returns Lightsail instance represented as ec2 instance
+// with instance name as both its id and "Name" tag. Lightsail static IP is
+// represented as elastic IP.
+func lightsailInstance(inst *lightsail.Instance) *ec2.Instance {
+	out := &ec2.Instance{
+		InstanceId:       inst.Name,
+		State:            &ec2.InstanceState{Name: aws.String(ec2.InstanceStateNameRunning)},
+		PrivateIpAddress: inst.PrivateIpAddress,
+		PublicIpAddress:  inst.PublicIpAddress,
+		Tags:             []*ec2.Tag{{Key: aws.String("Name"), Value: inst.Name}},
+	}
+	if inst.Location != nil {
+		out.Placement = &ec2.Placement{AvailabilityZone: inst.Location.AvailabilityZone}
+	}
+	if len(inst.Ipv6Addresses) != 0 {
+		out.Ipv6Address = inst.Ipv6Addresses[0]
+	}
+	for _, tag := range inst.Tags {
+		if aws.StringValue(tag.Key) != "Name" {
+			out.Tags = append(out.Tags, &ec2.Tag{Key: tag.Key, Value: tag.Value})
+		}
+	}
+	if inst.PublicIpAddress != nil {
+		owner := "amazon"
+		if aws.BoolValue(inst.IsStaticIp) {
+			owner = "lightsail"
+		}
+		out.NetworkInterfaces = []*ec2.InstanceNetworkInterface{{
+			Attachment: &ec2.InstanceNetworkInterfaceAttachment{DeviceIndex: aws.Int64(0)},
+			Association: &ec2.InstanceNetworkInterfaceAssociation{
+				IpOwnerId: aws.String(owner),
+				PublicIp:  inst.PublicIpAddress,
+			},
+		}}
+	}
+	return out
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/lightsail"
+)
+
+func TestReconcile_lightsail(t *testing.T) {
+	box := func(name, state, ip string, static bool) *lightsail.Instance {
+		return &lightsail.Instance{
+			Name:            aws.String(name),
+			State:           &lightsail.InstanceState{Name: aws.String(state)},
+			PublicIpAddress: aws.String(ip),
+			IsStaticIp:      aws.Bool(static),
+		}
+	}
+	lssvc := fakeLightsail{
+		box("blog", "running", "3.3.3.3", true),
+		box("shop", "running", "4.4.4.4", false),
+		box("old", "stopped", "5.5.5.5", false),
+	}
+	r53svc := newFakeRoute53(t, "old.foo.example.com. A 5.5.5.5")
+	s := &syncer{
+		ec2:        &fakeEC2{instances: []*ec2.Instance{testInstance("i-1", "web", "", "1.2.3.4")}},
+		r53:        r53svc,
+		lightsail:  lssvc,
+		suffix:     ".foo.example.com",
+		zoneID:     "Z1",
+		requireEIP: true,
+	}
+	if err := s.update(context.Background(), "", new(runStats)); err != nil {
+		t.Fatal(err)
+	}
+	// only static IP counts as elastic one
+	want := []string{"blog.foo.example.com. A 3.3.3.3"}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// fakeLightsail serves instances, one per page
+type fakeLightsail []*lightsail.Instance
+
+func (f fakeLightsail) GetInstancesWithContext(_ aws.Context, in *lightsail.GetInstancesInput, _ ...request.Option) (*lightsail.GetInstancesOutput, error) {
+	i, _ := strconv.Atoi(aws.StringValue(in.PageToken))
+	out := &lightsail.GetInstancesOutput{Instances: f[i : i+1]}
+	if i+1 < len(f) {
+		out.NextPageToken = aws.String(strconv.Itoa(i + 1))
+	}
+	return out, nil
+}
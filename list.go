@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// statuses of listed records, see listedRecord
+const (
+	listManaged  = "managed"  // record is up to date with its resource
+	listOutdated = "outdated" // record belongs to a resource, but will be updated
+	listIgnored  = "ignored"  // record is under name of an ignored instance
+	listOrphaned = "orphaned" // no resource has the record, it will be removed
+)
+
+// listedRecord describes A/CNAME record set under suffix, as returned by
+// listManaged
+type listedRecord struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	SetID    string   `json:"set_identifier,omitempty"`
+	Values   []string `json:"values"`
+	Resource string   `json:"resource,omitempty"` // instance or other resource id
+	State    string   `json:"state,omitempty"`    // instance state
+	Status   string   `json:"status"`
+}
+
+// listManaged returns A/CNAME record sets under suffix along with instances or
+// other resources they belong to, and their status as the next update would
+// see it. Records without a resource are matched to non-running instances
+// by name, so that their state is reported. It makes no changes.
+func (s *syncer) listManaged(ctx context.Context) ([]listedRecord, error) {
+	instances, err := s.managedInstances(ctx)
+	if err != nil {
+		return nil, err
+	}
+	instances, protected := s.excludeIgnored(s.dropCollisions(instances))
+	static, err := s.manifest.load(ctx, s.suffix, s.ttl)
+	if err != nil {
+		return nil, err
+	}
+	desired := s.desiredRecords(instances, new(runStats))
+	extra, err := s.extraRecords(ctx)
+	if err != nil {
+		return nil, err
+	}
+	desired = append(desired, extra...)
+	for _, rr := range static {
+		desired = append(desired, desiredRecord{rr: rr, inst: &ec2.Instance{InstanceId: aws.String(manifestResource)}})
+	}
+	owners := make(map[string]desiredRecord) // by recordKey
+	for _, d := range desired {
+		if _, ok := owners[recordKey(d.rr)]; !ok {
+			owners[recordKey(d.rr)] = d
+		}
+	}
+	records, err := s.listRecords(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for name := range s.foreignNames(records) {
+		protected[name] = true
+	}
+	var byName map[string]*ec2.Instance // host names to instances in any state
+	var out []listedRecord
+	for _, r := range records {
+		if r.typ != "A" && r.typ != "CNAME" {
+			continue
+		}
+		rr := r.recordSet()
+		name := strings.TrimSuffix(aws.StringValue(rr.Name), ".")
+		lr := listedRecord{
+			Name:  name,
+			Type:  aws.StringValue(rr.Type),
+			SetID: aws.StringValue(rr.SetIdentifier),
+		}
+		for _, v := range rr.ResourceRecords {
+			lr.Values = append(lr.Values, aws.StringValue(v.Value))
+		}
+		if rr.AliasTarget != nil {
+			lr.Values = append(lr.Values, "alias:"+strings.TrimSuffix(aws.StringValue(rr.AliasTarget.DNSName), "."))
+		}
+		if d, ok := owners[recordKey(rr)]; ok {
+			lr.Resource, lr.Status = aws.StringValue(d.inst.InstanceId), listManaged
+			if d.inst.State != nil {
+				lr.State = aws.StringValue(d.inst.State.Name)
+			}
+			want := *d.rr
+			if s.healthCheck != nil {
+				// health checks are attached on update
+				want.HealthCheckId = rr.HealthCheckId
+			}
+			if !sameRecord(rr, &want) {
+				lr.Status = listOutdated
+			}
+			out = append(out, lr)
+			continue
+		}
+		lr.Status = listOrphaned
+		if protected[name] || !s.managedAlias(rr) || !s.managedName(name) {
+			lr.Status = listIgnored
+		}
+		if byName == nil {
+			if byName, err = s.instancesByName(ctx); err != nil {
+				return nil, err
+			}
+		}
+		if inst := byName[strings.TrimSuffix(name, s.suffix)]; inst != nil {
+			lr.Resource = aws.StringValue(inst.InstanceId)
+			if inst.State != nil {
+				lr.State = aws.StringValue(inst.State.Name)
+			}
+		}
+		out = append(out, lr)
+	}
+	return out, nil
+}
+
+// instancesByName returns instances matching s.filters in any state, keyed by
+// their host names. Of instances sharing a name, the running one is
+// preferred.
+func (s *syncer) instancesByName(ctx context.Context) (map[string]*ec2.Instance, error) {
+	resp, err := s.ec2.DescribeInstancesWithContext(ctx, &ec2.DescribeInstancesInput{Filters: s.filters})
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]*ec2.Instance)
+	for _, r := range resp.Reservations {
+		for _, inst := range r.Instances {
+			for _, name := range s.hostNames(inst) {
+				if cur := out[name]; cur == nil || cur.State == nil ||
+					aws.StringValue(cur.State.Name) != ec2.InstanceStateNameRunning {
+					out[name] = inst
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+// writeList writes records returned by listManaged to w in the given format:
+// table, json or csv
+func writeList(w io.Writer, records []listedRecord, format string) error {
+	switch format {
+	case "", "table":
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tTYPE\tVALUES\tRESOURCE\tSTATE\tSTATUS")
+		for _, r := range records {
+			name := r.Name
+			if r.SetID != "" {
+				name += " (" + r.SetID + ")"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", name, r.Type, strings.Join(r.Values, ","),
+				dash(r.Resource), dash(r.State), r.Status)
+		}
+		return tw.Flush()
+	case "json":
+		if records == nil {
+			records = []listedRecord{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(records)
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"name", "type", "set_identifier", "values", "resource", "state", "status"})
+		for _, r := range records {
+			cw.Write([]string{r.Name, r.Type, r.SetID, strings.Join(r.Values, " "), r.Resource, r.State, r.Status})
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	return fmt.Errorf("unsupported list format %q", format)
+}
+
+// dash returns s, or "-" if s is empty
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func TestListManaged(t *testing.T) {
+	s := &syncer{
+		ec2: &fakeEC2{instances: []*ec2.Instance{
+			testInstance("i-1", "web", "", "1.2.3.4"),
+			testInstance("i-2", "db", "", "5.6.7.8"),
+			stopped(testInstance("i-3", "ci", "", "")),
+			withTag(testInstance("i-4", "pet", "", "9.9.9.9"), defaultIgnoreTag, "true"),
+		}},
+		r53: newFakeRoute53(t,
+			"web.foo.example.com. A 1.2.3.4",
+			"db.foo.example.com. A 1.1.1.1",
+			"ci.foo.example.com. A 2.2.2.2",
+			"pet.foo.example.com. A 3.3.3.3",
+			"gone.foo.example.com. CNAME ec2-4-4-4-4.compute.amazonaws.com",
+			"mail.foo.example.com. MX 10 mx.example.com",
+		),
+		suffix:    ".foo.example.com",
+		zoneID:    "Z1",
+		ttl:       60,
+		ignoreTag: defaultIgnoreTag,
+	}
+	got, err := s.listManaged(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []listedRecord{
+		{Name: "ci.foo.example.com", Type: "A", Values: []string{"2.2.2.2"}, Resource: "i-3", State: "stopped", Status: listOrphaned},
+		{Name: "db.foo.example.com", Type: "A", Values: []string{"1.1.1.1"}, Resource: "i-2", State: "running", Status: listOutdated},
+		{Name: "gone.foo.example.com", Type: "CNAME", Values: []string{"ec2-4-4-4-4.compute.amazonaws.com"}, Status: listOrphaned},
+		{Name: "pet.foo.example.com", Type: "A", Values: []string{"3.3.3.3"}, Resource: "i-4", State: "running", Status: listIgnored},
+		{Name: "web.foo.example.com", Type: "A", Values: []string{"1.2.3.4"}, Resource: "i-1", State: "running", Status: listManaged},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got:\n%+v\nwant:\n%+v", got, want)
+	}
+	var buf bytes.Buffer
+	if err := writeList(&buf, got[2:3], "csv"); err != nil {
+		t.Fatal(err)
+	}
+	if want := "name,type,set_identifier,values,resource,state,status\n" +
+		"gone.foo.example.com,CNAME,,ec2-4-4-4-4.compute.amazonaws.com,,,orphaned\n"; buf.String() != want {
+		t.Fatalf("csv output:\n%s\nwant:\n%s", buf.String(), want)
+	}
+	buf.Reset()
+	if err := writeList(&buf, got[2:3], "table"); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !reflect.DeepEqual(strings.Fields(lines[1]),
+		[]string{"gone.foo.example.com", "CNAME", "ec2-4-4-4-4.compute.amazonaws.com", "-", "-", "orphaned"}) {
+		t.Fatalf("unexpected table output:\n%s", buf.String())
+	}
+	if err := writeList(&buf, got, "yaml"); err == nil {
+		t.Fatal("unsupported format accepted")
+	}
+}
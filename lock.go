@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// dynamodbClient is a subset of dynamodb API used by the program
+type dynamodbClient interface {
+	PutItemWithContext(aws.Context, *dynamodb.PutItemInput, ...request.Option) (*dynamodb.PutItemOutput, error)
+	DeleteItemWithContext(aws.Context, *dynamodb.DeleteItemInput, ...request.Option) (*dynamodb.DeleteItemOutput, error)
+}
+
+// zoneLock is a lease-based lock kept in DynamoDB table with "LockID" string
+// partition key. Lock items also have "Owner" and "Expires" attributes, the
+// latter is a unix timestamp suitable for DynamoDB TTL.
+type zoneLock struct {
+	db    dynamodbClient
+	table string
+	lease time.Duration // how long acquired lock stays valid
+	wait  time.Duration // how long to retry acquiring a held lock
+	owner string
+}
+
+// errLockHeld is returned when lock is held by someone else
+var errLockHeld = errors.New("lock is held by another process")
+
+// newZoneLock returns lock with random owner id
+func newZoneLock(db dynamodbClient, table string, lease, wait time.Duration) *zoneLock {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return &zoneLock{db: db, table: table, lease: lease, wait: wait, owner: hex.EncodeToString(b)}
+}
+
+// acquire takes lock with the given id, retrying for up to l.wait if lock is
+// held by someone else. It returns errLockHeld if lock cannot be taken.
+func (l *zoneLock) acquire(ctx context.Context, id string) error {
+	deadline := time.Now().Add(l.wait)
+	for {
+		err := l.tryAcquire(ctx, id)
+		if err != errLockHeld || time.Now().After(deadline) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+func (l *zoneLock) tryAcquire(ctx context.Context, id string) error {
+	now := time.Now()
+	_, err := l.db.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName: &l.table,
+		Item: map[string]*dynamodb.AttributeValue{
+			"LockID":  {S: &id},
+			"Owner":   {S: &l.owner},
+			"Expires": {N: aws.String(strconv.FormatInt(now.Add(l.lease).Unix(), 10))},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(LockID) OR Expires < :now"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":now": {N: aws.String(strconv.FormatInt(now.Unix(), 10))},
+		},
+	})
+	var aerr awserr.Error
+	if errors.As(err, &aerr) && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return errLockHeld
+	}
+	return err
+}
+
+// release releases lock with the given id if it is still owned by l
+func (l *zoneLock) release(ctx context.Context, id string) error {
+	_, err := l.db.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+		TableName:           &l.table,
+		Key:                 map[string]*dynamodb.AttributeValue{"LockID": {S: &id}},
+		ConditionExpression: aws.String("#owner = :owner"),
+		// Owner is a DynamoDB reserved word, it can only be referred by alias
+		ExpressionAttributeNames: map[string]*string{"#owner": aws.String("Owner")},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":owner": {S: &l.owner},
+		},
+	})
+	var aerr awserr.Error
+	if errors.As(err, &aerr) && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return nil // lease expired and lock was taken over
+	}
+	return err
+}
+
+// locked calls fn while holding zone lock, if syncer has lock configured. If
+// lock is held by another process, locked returns error wrapping errLockHeld
+// without calling fn.
+func (s *syncer) locked(ctx context.Context, fn func() error) error {
+	if s.lock == nil {
+		return fn()
+	}
+	switch err := s.lock.acquire(ctx, s.zoneID); err {
+	case nil:
+	case errLockHeld:
+		return fmt.Errorf("zone %s: %w", s.zoneID, err)
+	default:
+		return err
+	}
+	defer func() {
+		// use fresh context so lock is released even if ctx is canceled
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := s.lock.release(ctx, s.zoneID); err != nil {
+			logMsg("releasing zone lock", "zone_id", s.zoneID, "error", err)
+		}
+	}()
+	return fn()
+}
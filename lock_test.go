@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func TestZoneLock(t *testing.T) {
+	db := newFakeDynamoDB("LockID")
+	ctx := context.Background()
+	l1 := newZoneLock(db, "locks", time.Minute, 0)
+	l2 := newZoneLock(db, "locks", time.Minute, 0)
+	if err := l1.acquire(ctx, "Z1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l2.acquire(ctx, "Z1"); err != errLockHeld {
+		t.Fatalf("got %v, want errLockHeld", err)
+	}
+	if err := l2.acquire(ctx, "Z2"); err != nil {
+		t.Fatalf("lock on another zone: %v", err)
+	}
+	if err := l2.release(ctx, "Z1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := db.items["Z1"]; !ok {
+		t.Fatal("lock released by non-owner")
+	}
+	if err := l1.release(ctx, "Z1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := db.items["Z1"]; ok {
+		t.Fatal("lock item was not deleted on release")
+	}
+	if err := l2.acquire(ctx, "Z1"); err != nil {
+		t.Fatalf("acquiring released lock: %v", err)
+	}
+	// expired lease can be taken over
+	db.items["Z1"]["Expires"].N = aws.String(strconv.FormatInt(time.Now().Add(-time.Second).Unix(), 10))
+	if err := l1.acquire(ctx, "Z1"); err != nil {
+		t.Fatalf("acquiring expired lock: %v", err)
+	}
+}
+
+func TestReconcileLocked(t *testing.T) {
+	db := newFakeDynamoDB("LockID")
+	ctx := context.Background()
+	if err := newZoneLock(db, "locks", time.Minute, 0).acquire(ctx, "Z1"); err != nil {
+		t.Fatal(err)
+	}
+	r53svc := newFakeRoute53(t)
+	s := &syncer{
+		ec2:    &fakeEC2{instances: []*ec2.Instance{testInstance("i-1", "jenkins", "", "1.2.3.4")}},
+		r53:    r53svc,
+		suffix: ".foo.example.com",
+		zoneID: "Z1",
+		lock:   newZoneLock(db, "locks", time.Minute, 0),
+	}
+	if err := s.reconcile(ctx, ""); !errors.Is(err, errLockHeld) {
+		t.Fatalf("got %v, want errLockHeld", err)
+	}
+	if err := s.scheduledReconcile(ctx); err != nil {
+		t.Fatalf("scheduled reconcile of locked zone: %v", err)
+	}
+	if len(r53svc.batches) != 0 {
+		t.Fatal("zone was updated while locked by another process")
+	}
+	s.zoneID = "Z2"
+	if err := s.reconcile(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+	if len(r53svc.batches) != 1 {
+		t.Fatal("zone was not updated")
+	}
+	if _, ok := db.items["Z2"]; ok {
+		t.Fatal("lock was not released after update")
+	}
+}
+
+func TestHandleEvent_lifecycleActionLocked(t *testing.T) {
+	db := newFakeDynamoDB("LockID")
+	ctx := context.Background()
+	if err := newZoneLock(db, "locks", time.Minute, 0).acquire(ctx, "Z1"); err != nil {
+		t.Fatal(err)
+	}
+	r53svc := newFakeRoute53(t, "web.foo.example.com. A 5.6.7.8")
+	asg := &fakeAutoscaling{}
+	s := &syncer{
+		ec2:    &fakeEC2{instances: []*ec2.Instance{testInstance("i-2", "web", "", "5.6.7.8")}},
+		r53:    r53svc,
+		asg:    asg,
+		suffix: ".foo.example.com",
+		zoneID: "Z1",
+		lock:   newZoneLock(db, "locks", time.Minute, 0),
+	}
+	for _, transition := range []string{transitionLaunching, transitionTerminating} {
+		detail, err := json.Marshal(map[string]string{
+			"AutoScalingGroupName": "web-asg",
+			"LifecycleHookName":    "dns",
+			"LifecycleActionToken": "87654321-4321-4321-4321-210987654321",
+			"EC2InstanceId":        "i-2",
+			"LifecycleTransition":  transition,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		evt := events.CloudWatchEvent{Source: "aws.autoscaling", Detail: detail}
+		if err := s.handleEvent(ctx, evt); !errors.Is(err, errLockHeld) {
+			t.Fatalf("%s: got %v, want errLockHeld", transition, err)
+		}
+	}
+	if len(asg.completed) != 0 {
+		t.Fatal("lifecycle action completed while zone is locked")
+	}
+	if len(r53svc.batches) != 0 {
+		t.Fatal("zone was updated while locked by another process")
+	}
+}
+
+// fakeDynamoDB is an in-memory implementation of dynamodbClient for a table
+// with string partition key; it only understands conditions used by zoneLock
+type fakeDynamoDB struct {
+	key   string                                         // partition key attribute name
+	items map[string]map[string]*dynamodb.AttributeValue // keyed by partition key
+}
+
+func newFakeDynamoDB(key string) *fakeDynamoDB {
+	return &fakeDynamoDB{key: key, items: make(map[string]map[string]*dynamodb.AttributeValue)}
+}
+
+func (f *fakeDynamoDB) PutItemWithContext(_ aws.Context, in *dynamodb.PutItemInput, _ ...request.Option) (*dynamodb.PutItemOutput, error) {
+	id := aws.StringValue(in.Item[f.key].S)
+	if err := checkExpression(in.ConditionExpression, in.ExpressionAttributeNames); err != nil {
+		return nil, err
+	}
+	if old, ok := f.items[id]; ok && in.ConditionExpression != nil {
+		now, _ := strconv.ParseInt(aws.StringValue(in.ExpressionAttributeValues[":now"].N), 10, 64)
+		expires, _ := strconv.ParseInt(aws.StringValue(old["Expires"].N), 10, 64)
+		if expires >= now {
+			return nil, awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "condition failed", nil)
+		}
+	}
+	f.items[id] = in.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (f *fakeDynamoDB) DeleteItemWithContext(_ aws.Context, in *dynamodb.DeleteItemInput, _ ...request.Option) (*dynamodb.DeleteItemOutput, error) {
+	if err := checkExpression(in.ConditionExpression, in.ExpressionAttributeNames); err != nil {
+		return nil, err
+	}
+	id := aws.StringValue(in.Key[f.key].S)
+	old, ok := f.items[id]
+	if !ok || aws.StringValue(old["Owner"].S) != aws.StringValue(in.ExpressionAttributeValues[":owner"].S) {
+		return nil, awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "condition failed", nil)
+	}
+	delete(f.items, id)
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+// dynamoReserved holds DynamoDB reserved words that could be used as
+// attribute names by the program; the full list has several hundred words
+var dynamoReserved = map[string]bool{"OWNER": true, "NAME": true, "TYPE": true, "ZONE": true,
+	"STATUS": true, "TTL": true, "DATA": true, "TIMESTAMP": true, "VALUE": true, "KEY": true}
+
+// checkExpression returns ValidationException error like DynamoDB does if
+// expr refers to a reserved word attribute name directly rather than by
+// alias, or uses alias missing in names
+func checkExpression(expr *string, names map[string]*string) error {
+	tokens := strings.FieldsFunc(aws.StringValue(expr), func(r rune) bool {
+		return !(r == '_' || r == '#' || r == ':' || unicode.IsLetter(r) || unicode.IsDigit(r))
+	})
+	for _, tok := range tokens {
+		switch {
+		case strings.HasPrefix(tok, "#"):
+			if _, ok := names[tok]; !ok {
+				return awserr.New("ValidationException", "undefined attribute name alias "+tok, nil)
+			}
+		case dynamoReserved[strings.ToUpper(tok)]:
+			return awserr.New("ValidationException", "attribute name is a reserved keyword: "+tok, nil)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// logJSON switches logMsg output to JSON objects, one per line
+var logJSON bool
+
+// setLogFormat configures logMsg output format, which is either "text" or
+// "json"
+func setLogFormat(format string) error {
+	switch format {
+	case "", "text":
+		logJSON = false
+	case "json":
+		logJSON = true
+	default:
+		return fmt.Errorf("unsupported log format %q", format)
+	}
+	return nil
+}
+
+// logDebug enables debugMsg output
+var logDebug bool
+
+// debugMsg logs message like logMsg does, but only if logDebug is set. It
+// explains decisions about individual instances and records.
+func debugMsg(msg string, kv ...interface{}) {
+	if logDebug {
+		logMsg(msg, append(kv, "level", "debug")...)
+	}
+}
+
+// logMsg logs message with key-value pairs attached, keys must be strings.
+// Common keys are zone_id, record_name, action and instance_id.
+func logMsg(msg string, kv ...interface{}) {
+	if len(kv)%2 != 0 {
+		kv = append(kv, "")
+	}
+	if logJSON {
+		m := make(map[string]interface{}, len(kv)/2+1)
+		for i := 0; i < len(kv); i += 2 {
+			v := kv[i+1]
+			if err, ok := v.(error); ok {
+				v = err.Error()
+			}
+			m[kv[i].(string)] = v
+		}
+		m["msg"] = msg
+		b, err := json.Marshal(m)
+		if err != nil {
+			log.Printf("%s (json encoding error: %v)", msg, err)
+			return
+		}
+		log.Print(string(b))
+		return
+	}
+	var b strings.Builder
+	b.WriteString(msg)
+	for i := 0; i < len(kv); i += 2 {
+		v := fmt.Sprint(kv[i+1])
+		if v == "" || strings.ContainsAny(v, " \t\n\"=") {
+			v = strconv.Quote(v)
+		}
+		fmt.Fprintf(&b, " %s=%s", kv[i], v)
+	}
+	log.Print(b.String())
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"testing"
+)
+
+func TestLogMsg(t *testing.T) {
+	defer log.SetOutput(log.Writer())
+	defer setLogFormat("text")
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	table := []struct {
+		format string
+		want   string
+	}{
+		{"text", `removing record zone_id=Z1 record_name=a.example.com error="no such record" count=2` + "\n"},
+		{"json", `{"count":2,"error":"no such record","msg":"removing record","record_name":"a.example.com","zone_id":"Z1"}` + "\n"},
+	}
+	for _, tc := range table {
+		buf.Reset()
+		if err := setLogFormat(tc.format); err != nil {
+			t.Fatal(err)
+		}
+		logMsg("removing record", "zone_id", "Z1", "record_name", "a.example.com",
+			"error", errors.New("no such record"), "count", 2)
+		if got := buf.String(); got != tc.want {
+			t.Errorf("%s format:\ngot:  %s\nwant: %s", tc.format, got, tc.want)
+		}
+	}
+	if err := setLogFormat("xml"); err == nil {
+		t.Error("setLogFormat accepted unsupported format")
+	}
+}
+
+func TestDebugMsg(t *testing.T) {
+	defer log.SetOutput(log.Writer())
+	defer func() { logDebug = false }()
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	debugMsg("skipping spot instance", "instance_id", "i-1")
+	if buf.Len() != 0 {
+		t.Fatalf("debug message logged with debug disabled: %s", buf.String())
+	}
+	logDebug = true
+	debugMsg("skipping spot instance", "instance_id", "i-1")
+	if got, want := buf.String(), "skipping spot instance instance_id=i-1 level=debug\n"; got != want {
+		t.Fatalf("got: %s\nwant: %s", got, want)
+	}
+}
@@ -11,241 +11,1223 @@
 // jenkins.foo.example.com. Zone ID must match either example.com or
 // foo.example.com zone in Route 53 console.
 //
+// Instances with names not valid as host names, i.e. containing characters
+// other than ASCII letters, digits and hyphens, are skipped. Valid names are
+// lowercased, as Route 53 lists record names in lower case, so "Jenkins" gets
+// jenkins.foo.example.com record. With -sanitize flag (SANITIZE=1 environment
+// variable for Lambda) invalid names are turned into valid ones instead:
+// lowercased, with underscores and spaces replaced by hyphens and other invalid
+// characters dropped, so "Build_Agent.2" becomes "build-agent2". If different
+// names map to the same one, only the instance with the lowest id gets a record
+// under it.
+//
+// With -idn flag (IDN=1) names with non-ASCII characters are converted to
+// punycode "xn--" labels, as are -suffix and -domain, so that instance named
+// "Bücher" gets "xn--bcher-kva" record. With -sanitize, non-ASCII letters and
+// digits are then kept.
+//
+// Instances without "Name" tag are skipped too. With -fallback-name=instance-id
+// (FALLBACK_NAME=instance-id environment variable for Lambda) such instances
+// get records named by their instance id, like "i-0123456789abcdef0", and with
+// -fallback-name=private-ip by their private IP address in EC2 style, like
+// "ip-10-0-1-2". These records are managed and removed just like others.
+//
+// With -eks-cluster flag (EKS_CLUSTER environment variable for Lambda) worker
+// nodes of the given EKS cluster, that is, instances with "eks:cluster-name"
+// tag set to cluster name or with "kubernetes.io/cluster/<cluster name>" tag,
+// are named after their Kubernetes node names instead of "Name" tag, so that
+// node names and DNS names stay aligned as node groups change. Node name is the
+// first label of the instance private DNS name, like "ip-10-0-1-2".
+//
+// Instance can have extra names listed in "dns:aliases" tag, separated by
+// commas, like "grafana,metrics": each of them gets the same record as the
+// instance name does, and all of them are removed with the instance.
+//
+// Instance with "dns:wildcard" tag set to true also gets wildcard record, like
+// "*.review.foo.example.com" next to "review.foo.example.com", pointing to the
+// same target, which suits hosts serving many virtual hosts, like review apps
+// or ingress nodes. Both records are removed with the instance. Route 53 lists
+// such names with "*" escaped as "\052", as it does with other characters
+// except letters, digits, "-", "_" and "."; the program matches and removes
+// records with escaped names like any others.
+//
+// With -srv flag (SRV=1 environment variable for Lambda) instances can list
+// services they provide in "dns:srv" tag, separated by commas, in
+// "_service._proto:port" or "_service._proto:priority:weight:port" form, like
+// "_prometheus._tcp:9090". Each service gets SRV record named like
+// "_prometheus._tcp" under suffix, listing host names of all instances
+// providing it, for tools supporting SRV lookups. Priority and weight are 0 if
+// not set. SRV records under suffix are then managed by the program just like
+// A/CNAME ones: values of removed instances are dropped, and records of
+// services no instance provides are removed.
+//
+// With -txt-metadata flag (TXT_METADATA=1 environment variable for Lambda)
+// each name with A records also gets TXT record with metadata of instances
+// backing it, so that "dig TXT jenkins.foo.example.com" tells which instance
+// it is:
+//
+//	"awsns instance-id=i-0123 az=us-east-1a ami=ami-0456 launch-time=2023-01-02T03:04:05Z"
+//
+// Name shared by several instances gets one such value per instance. Names
+// with CNAME records get no TXT records, as CNAME record cannot coexist with
+// other records. TXT records not created by the program, which are told apart
+// by the "awsns " value prefix, are left alone, and their names get no
+// metadata records.
+//
+// With -dualstack flag (DUALSTACK=1 environment variable for Lambda) instances
+// with IPv6 address get AAAA record next to their A record, of the same name,
+// TTL and routing policy. Such instances get A records instead of CNAME ones,
+// unless "dns:record-type" tag says otherwise, as CNAME record cannot coexist
+// with other records. With -all-addresses, AAAA records list IPv6 addresses of
+// all instance network interfaces. AAAA records under suffix are then managed
+// just like A ones, and are removed along with them.
+//
+// With -fqdn-tag flag (FQDN_TAG environment variable for Lambda) set to a tag
+// key, like "awsns:fqdn", instances are tagged with their DNS names after
+// successful update, like "jenkins.foo.example.com", so that other automation
+// and people looking at EC2 console can see them. Instances already having the
+// right tag value are left alone, and failures to tag are only logged. The tag
+// cannot be "Name" or a "dns:" one, and the flag cannot be used with instances
+// of other regions, accounts, or Lightsail ones. This requires ec2:CreateTags
+// permission.
+//
+// Instead of -zone, hosted zone can be set by its domain name with -domain flag
+// (DOMAIN environment variable for Lambda); the program then looks up zone id
+// by this name. If both public and private zones exist for this domain, public
+// one is used, unless -prefer-private flag (PREFER_PRIVATE=1) is set. This
+// requires route53:ListHostedZonesByName permission.
+//
+// With -create-zone flag (CREATE_ZONE=1 environment variable for Lambda), if
+// no hosted zone exists for -domain, the program creates a public one, or,
+// with -prefer-private, a private one associated with VPCs listed in -vpc-id
+// in the current region, then proceeds as usual. This is handy for ephemeral
+// environments, like one per branch. This requires route53:CreateHostedZone
+// permission, and for private zones also route53:AssociateVPCWithHostedZone
+// and ec2:DescribeVpcs.
+//
+// Records in a private zone only resolve in VPCs the zone is associated with.
+// With -vpc-check=warn (VPC_CHECK=warn environment variable for Lambda) the
+// program checks before each update that the private zone is associated with
+// VPCs of all managed instances, and logs the ones it is not associated with,
+// along with their instances. With -vpc-check=fail such update fails instead,
+// changing nothing. Public zones are not checked. This requires
+// route53:GetHostedZone permission.
+//
+// On start, the program looks up the hosted zone name and checks that the
+// suffix is within the zone, and that no part of it is delegated to another
+// zone by NS record, failing early with a clear message rather than with
+// InvalidChangeBatch errors in the middle of an update. Suffix equal to the
+// zone name, like ".example.com" for example.com zone, which puts records right
+// under the zone apex, is rejected unless -allow-apex flag (ALLOW_APEX=1
+// environment variable for Lambda) is set, or the suffix is not set, see below.
+// This requires route53:GetHostedZone permission; without it the check is
+// skipped with a warning.
+//
+// If suffix is not set, it defaults to the hosted zone name, i.e.
+// ".foo.example.com" for foo.example.com zone, so the common case of a zone per
+// subdomain only needs zone id or domain to be set. This requires
+// route53:GetHostedZone permission.
+//
 // The program may remove existing A/CNAME records matching given suffix if no
-// corresponding non-spot ec2 instances found running.
+// corresponding non-spot ec2 instances found running. Records which are already
+// up to date are left alone, so a run over a converged zone makes no changes.
+// If no instances eligible for records are found, existing records are kept,
+// as this is more likely a misconfiguration than an intentional shutdown of
+// the whole fleet. Either case is not an error, unless -expect-changes flag
+// (EXPECT_CHANGES=1 environment variable for Lambda) is set.
+//
+// With -wait flag (WAIT=1 environment variable for Lambda) the program waits
+// for each applied change batch to propagate to all Route 53 nameservers,
+// which requires route53:GetChange permission. With -verify flag (VERIFY=1)
+// it then queries authoritative nameservers of the zone for up to 10 of the
+// upserted A/CNAME records, and fails if they don't resolve to the expected
+// values. Record sets with routing policies are not checked, nor are records
+// of private zones, which have no public nameservers. This requires
+// route53:GetHostedZone permission and outbound DNS access; use it together
+// with -wait, as Route 53 nameservers may not serve changes right away.
+//
+// With -two-phase flag (TWO_PHASE=1 environment variable for Lambda) full
+// update applies its changes in two change batches: upserts go first, and
+// stale records are only deleted in the second batch, once upserts are
+// applied, so that a name being moved or renamed is never left without
+// records. Deletions of records replaced by ones of other types under the
+// same name stay in the first batch. With -wait the second batch is only
+// submitted after the first one propagates to all Route 53 nameservers. If
+// upserts fail, deletions still go out, and the update fails; with
+// -keep-on-error (KEEP_ON_ERROR=1) they are skipped until the next update.
+//
+// With -canary-zone flag (CANARY_ZONE environment variable for Lambda) set to
+// id of a staging hosted zone, each change batch is first rehearsed there, and
+// only applied to the production zone if that succeeds. Names are translated
+// from the production zone domain to the staging one, so web.example.com
+// becomes web.canary.example.net for canary.example.net zone. Upserts are
+// applied as is, and deletions remove the matching records, if the staging
+// zone has them. With -wait and -verify the rehearsed change is waited for
+// and verified too. This requires route53:GetHostedZone permission on both
+// zones, and route53:ChangeResourceRecordSets and
+// route53:ListResourceRecordSets on the staging one.
+//
+// With -mode=upsert (MODE=upsert environment variable for Lambda) the program
+// only creates and updates records and never deletes any, which is a safe way
+// to try it on an existing zone. With -mode=cleanup it does the opposite: only
+// deletes records not backed by running instances, leaving the rest as is.
+// Default -mode=full does both.
+//
+// With -deletion-grace flag (DELETION_GRACE environment variable for Lambda)
+// set to a duration, like 15m, records are only deleted once they have had no
+// instance or other resource for that long, so that instances briefly stopped
+// or replaced don't make their records flap. Times records became removal
+// candidates are kept in "_awsns-grace" TXT record under suffix, which is
+// removed once there are no pending deletions. Records are deleted by the first
+// update after the grace period, so it should run periodically; instance
+// state-change events only start the grace period of their records.
+//
+// With -filter flag set to "key=value" (FILTER environment variable for
+// Lambda) the program only manages instances having tag key with the given
+// value. Flag can be repeated to require several tags; in Lambda, separate
+// filters with commas. Records under suffix not backed by matching instances
+// are removed, so deployments with different filters should use different
+// suffixes.
+//
+// Instead of separate deployments per environment, a single one can place
+// instances into different suffixes by their environment tag with
+// -env-suffixes flag (ENV_SUFFIXES environment variable for Lambda), like:
+//
+//	awsns -env-suffixes prod=.example.com,staging=.stg.example.com
+//
+// Instances with Environment tag (set by -env-tag flag, ENV_TAG) "prod" then
+// get records under .example.com, and those with "staging" under
+// .stg.example.com, as if the program ran once per environment with the
+// matching -suffix and -filter. Instances without the tag, or with a value not
+// listed, are not managed. Unless -zone or -domain is set, each environment
+// uses the hosted zone of its suffix or of its closest parent domain, which
+// requires route53:ListHostedZonesByName permission; with -create-zone a
+// missing zone is created for the suffix domain. Different hosted zones are
+// updated concurrently, each applying its own change batches, with its own
+// retries, so that failure of one zone doesn't prevent updates of the others;
+// environments sharing a hosted zone are updated one after another. Suffix
+// which is the zone apex, like .example.com in example.com zone, needs
+// -allow-apex. Commands, -self, -reverse-zone, -lb-tag, -db-tag, -ecs-cluster
+// and -lightsail are not supported with -env-suffixes.
+//
+// In hybrid setups the same instances can also be kept on a DNS server
+// supporting dynamic updates (RFC 2136), like on-premises BIND, with
+// -rfc2136-server flag (RFC2136_SERVER environment variable for Lambda) set to
+// its host:port, like:
+//
+//	awsns -suffix .aws.corp.example.com -rfc2136-server ns1.corp.example.com:53 -rfc2136-key hmac-sha256:awsns:c2VjcmV0
+//
+// Records there point to private addresses of instances, or to their
+// dns:target tags, and are kept under the same suffix, in the zone set by
+// -rfc2136-zone flag (RFC2136_ZONE), which defaults to the suffix domain.
+// Updates are sent over TCP and signed with TSIG key set by -rfc2136-key flag
+// (RFC2136_KEY) as algorithm:name:base64 secret, where algorithm is
+// hmac-sha256, hmac-sha512 or hmac-sha1; server must allow the key both
+// updates and transfers of the zone, which are used to list its records.
+// Route 53 and the server are updated concurrently, and failure to update one
+// doesn't prevent updates of the other. Alias and PTR records, as well as
+// health checks, are only kept in Route 53, and only Route 53 changes are
+// audited, snapshotted and notified about. Instances with routing policy tags
+// sharing a name cannot be published on the server, so -group-policy is
+// rejected, as are commands, -self, -metrics-addr and -env-suffixes.
+//
+// Conversely, -exclude-filter flag (EXCLUDE_FILTER environment variable for
+// Lambda) of the same form keeps instances having tag key with the exact given
+// value out of DNS, as if they were not running: their records are removed, and
+// they don't prevent removal of records of other instances sharing their names.
+// Flag can be repeated to exclude instances matching any of the filters.
+//
+// Similarly, -vpc-id and -subnet-id flags (VPC_ID and SUBNET_ID environment
+// variables for Lambda) restrict the program to instances in the given
+// comma-separated lists of VPCs or subnets, which is handy when each VPC has
+// its own private hosted zone.
+//
+// With -regions flag (REGIONS environment variable for Lambda) set to a
+// comma-separated list of regions, running instances in these regions are
+// managed too, in addition to the ones in the current region. Filters apply to
+// all regions. Lambda only gets state change events of its own region, so
+// records of instances in other regions are only updated on full updates;
+// schedule these, or run the program with -watch.
+//
+// Instances of other accounts can be managed too, keeping their records in a
+// single central hosted zone. With -accounts flag (ACCOUNTS environment
+// variable for Lambda) set to a comma-separated list of role ARNs, the program
+// assumes each role and manages running instances of its account, in the
+// current region and in -regions. With -org flag (ORG=1 environment variable
+// for Lambda) it does the same for all active accounts of the organization,
+// assuming role named by -org-role flag (ORG_ROLE environment variable for
+// Lambda, "awsns" by default) in each account; the list of accounts is read on
+// start. This has to be run in the organization management account or in a
+// delegated administrator account, and requires organizations:ListAccounts
+// permission. Either way, the program needs sts:AssumeRole permission for the
+// roles, and the roles only need ec2:DescribeInstances permission. Lambda only
+// gets state change events of its own account, so records of instances in
+// other accounts are only updated on full updates.
+//
+// With -ecs-cluster flag (ECS_CLUSTER environment variable for Lambda) running
+// tasks of the given ECS cluster get records too, as lightweight service
+// discovery. Only tasks with their own network interface are supported, which
+// are tasks in awsvpc network mode, including all Fargate ones. Task is named
+// after its "Name" tag, or, failing that, after its service, or its task
+// definition family if it was not started by a service; other task tags work
+// the same way as instance tags. As tasks of a service share the name, use
+// this with -group-policy. Filters set by -filter, -vpc-id and -subnet-id flags
+// only apply to instances, while -exclude-filter applies to tasks too. Records
+// of stopped tasks are removed on the next full update. This requires
+// ecs:ListTasks, ecs:DescribeTasks and ec2:DescribeNetworkInterfaces
+// permissions.
+//
+// With -lightsail flag (LIGHTSAIL=1 environment variable for Lambda) running
+// Lightsail instances in the same region get records too, named after
+// Lightsail instance names. Lightsail static IP is treated as elastic IP, and
+// Lightsail instance tags work the same way as ec2 instance tags, except for
+// filters set by -filter, -vpc-id and -subnet-id flags, which only apply to
+// ec2 instances. Records of removed Lightsail instances are removed on the
+// next full update. This requires lightsail:GetInstances permission.
+//
+// Instances are discovered from sources: ec2 instances (of the current region,
+// and of other regions and accounts), and, when enabled by their flags, ECS
+// tasks and Lightsail instances. Set -sources flag (SOURCES environment
+// variable for Lambda) to a comma-separated list of them to choose explicitly,
+// like "ecs,lightsail" to only publish ECS tasks and Lightsail instances,
+// ignoring ec2 instances and their events; ecs and lightsail must be listed if
+// and only if -ecs-cluster and -lightsail are set. Hosts of all sources are
+// published the same way, and share names by the same rules.
+//
+// With -lb-tag flag (LB_TAG environment variable for Lambda) set to tag key,
+// like "dns:name", load balancers of all kinds having this tag get alias A
+// records named by the tag value, pointing to the load balancer. These records
+// are removed once the load balancer is gone. Instances take precedence over
+// load balancers with the same name. This requires
+// elasticloadbalancing:DescribeLoadBalancers and
+// elasticloadbalancing:DescribeTags permissions.
+//
+// Alias records under the suffix are usually maintained by other tooling, so
+// they are never deleted or overwritten, even when no instance claims their
+// name; with -lb-tag alias records pointing to load balancers are the
+// exception. Set -manage-aliases flag (MANAGE_ALIASES environment variable for
+// Lambda) to treat alias records like any other records.
+//
+// When other records legitimately live under the same suffix, like
+// _acme-challenge or autodiscover ones, -manage-pattern and -ignore-pattern
+// flags (MANAGE_PATTERN and IGNORE_PATTERN environment variables for Lambda)
+// restrict which names the program touches. Each is a regular expression
+// matched against the whole part of record name before suffix, like
+// "web-1" or "_acme-challenge.web-1": with -manage-pattern only matching
+// names are created, changed and deleted, and with -ignore-pattern matching
+// names never are, like:
+//
+//	awsns -suffix .example.com -manage-pattern '[a-z]+-[0-9]+' -ignore-pattern 'autodiscover|_.*'
+//
+// Instances with names not managed get no records. Derived records, like SRV
+// or TXT ones, are matched by their own names.
+//
+// When the zone is shared with external-dns, set -coexist=external-dns
+// (COEXIST=external-dns environment variable for Lambda) so that both tools can
+// manage disjoint names under the same suffix: names claimed by external-dns
+// ownership TXT records, which have "heritage=external-dns" value, are neither
+// created, changed nor deleted, and instances wanting them are logged as
+// conflicts instead. Both ownership record formats are recognized: the one
+// named as the claimed record, and the one with record type prefix, like
+// "cname-web.example.com". Such names are reported as ignored by "list" and
+// left alone by "orphans". With this flag FAST_LAUNCH always does full updates,
+// and -self and -self-deregister cannot be used.
+//
+// Similarly, with -db-tag flag (DB_TAG environment variable for Lambda) RDS
+// instances and clusters and ElastiCache clusters and replication groups having
+// this tag get CNAME records named by the tag value, pointing to their
+// endpoints, so that applications can use stable human-readable names. Cluster
+// records point to writer (primary) endpoint, or to configuration endpoint for
+// ElastiCache in cluster mode. This requires rds:DescribeDBInstances,
+// rds:DescribeDBClusters, elasticache:DescribeCacheClusters,
+// elasticache:DescribeReplicationGroups and elasticache:ListTagsForResource
+// permissions.
+//
+// With -manifest flag (MANIFEST environment variable for Lambda) set to a local
+// file or s3://bucket/key URL, the program also keeps static records listed in
+// this JSON manifest, so that a single tool owns the whole subdomain:
+//
+//	{"records": [
+//		{"name": "www", "type": "CNAME", "values": ["cdn.example.net"]},
+//		{"name": "_dmarc", "type": "TXT", "ttl": 3600, "values": ["\"v=DMARC1; p=none\""]}
+//	]}
+//
+// Names are relative to suffix; values are in Route 53 format, so TXT values
+// are quoted. Records of A, AAAA, CAA, CNAME, MX, NAPTR, NS, SPF, SRV and TXT
+// types are supported; records without "ttl" get the default TTL. The manifest
+// is read on every update: missing or changed records are upserted, and
+// records listed in it are never removed. Once removed from the manifest,
+// A/CNAME records are removed as records of gone instances are, while records
+// of other types are left alone. Instances, load balancers and datastores take
+// precedence over manifest records with the same name, unless these are of
+// different types, neither of which is CNAME. With s3:// manifest this
+// requires s3:GetObject permission on it.
+//
+// Instances of the current region and of other regions and accounts, ECS
+// tasks, Lightsail instances, load balancers and datastores are discovered
+// concurrently, as are records of hosted zone and reverse zone processed, with
+// at most 4 calls at a time, or as many as set with -parallelism flag
+// (PARALLELISM environment variable for Lambda). If some of them fail, the
+// update fails with errors of all of them.
+//
+// Unless -fallback-name or -eks-cluster is set, only instances having "Name"
+// tag are described, as the others could never get records, which saves time
+// and memory in accounts with many unnamed instances; such instances are then
+// not reported as skipped. Instances are described in pages of the EC2 API
+// default size, which can be set to 5-1000 instances with -describe-page-size
+// flag (DESCRIBE_PAGE_SIZE environment variable for Lambda).
+//
+// Instances with "awsns:ignore" tag set to true are left alone: their records
+// are neither updated nor removed, and neither are records of other instances
+// sharing their names. Tag key can be changed with -ignore-tag flag
+// (IGNORE_TAG environment variable for Lambda).
+//
+// If ec2 instance has elastic IP address, the program creates A record pointing
+// to it, as elastic IP, unlike public DNS name, survives instance stop/start.
+// Otherwise, if instance has public DNS name, the program creates CNAME record
+// pointing to such name; failing that, it creates A record pointing to the
+// public IP address. With -require-eip flag (REQUIRE_EIP=1 for Lambda)
+// instances without elastic IP get no records. With -all-addresses flag
+// (ALL_ADDRESSES=1) instances get A records listing public IP addresses of all
+// their network interfaces, including the ones associated with secondary
+// private addresses, so that clients round-robin between them. Instance can
+// force the record type with "dns:record-type" tag set to A or CNAME; instance
+// without address of the forced kind gets no record. The -prefer flag (PREFER
+// environment variable for Lambda) sets the record type of all instances
+// without such tag: A for public IP addresses even where public DNS name
+// exists, which suits resolvers and monitoring expecting direct A records,
+// CNAME for public DNS names even where elastic IP exists, or default auto for
+// the choice described above.
+//
+// Records of stopped instances are removed by default. With -keep-stopped flag
+// (KEEP_STOPPED=1 environment variable for Lambda) stopped instances are not
+// treated as gone: ones with elastic IP get A record pointing to it, and
+// records of others are left as they are, unless running instances take their
+// names. This avoids DNS churn for fleets where stop/start cycles are routine.
+//
+// With -min-age flag (MIN_AGE environment variable for Lambda) set to a
+// duration, like 90s, instances launched less than this long ago are skipped in
+// the current update, as their public DNS names and IP addresses are often not
+// populated yet when their state-change events fire. Such instances are logged,
+// and records of their names are left as they are, unless other instances take
+// them; they get records from the first update after they are old enough, so
+// this is best used with -watch or periodic invocations. Note that starting
+// stopped instance resets its launch time.
 //
-// If ec2 instance has public DNS name, the program creates CNAME record
-// pointing to such name; otherwise, it creates A record pointing to the public
-// IP address.
+// Instance "dns:target" tag overrides what its record points to: set it to a
+// host name to get CNAME record pointing there, or to an IPv4 address to get
+// A record with it, like for instances fronted by CloudFront distribution or
+// Global Accelerator. Record still exists only as long as the instance runs.
+// Target overrides "dns:record-type" tag and instance addresses.
+//
+// With -reverse-zone flag (REVERSE_ZONE environment variable for Lambda) set
+// to id of in-addr.arpa or ip6.arpa private hosted zone, the program also keeps
+// PTR records of instances private IPv4 and primary IPv6 addresses in it,
+// pointing to instance names under suffix. PTR records pointing under suffix
+// not backed by running instances are removed, as are records of removed
+// instances. Addresses outside of the reverse zone are ignored.
+//
+// Records have TTL of 60 seconds, unless set otherwise with -ttl flag (TTL
+// environment variable for Lambda); instance can override it with "dns:ttl"
+// tag set to number of seconds, up to 172800 (2 days). Invalid tag values are
+// ignored. Records with TTL different from the desired one are updated, so
+// changing TTL converges the zone on the next update.
+//
+// By default, if several instances have the same name, only one of them gets
+// the record: the most recently launched one, or, with -on-conflict=oldest
+// (ON_CONFLICT environment variable for Lambda), the earliest launched one.
+// Such conflicts are logged along with ids of conflicting instances, and the
+// other instances are reported as skipped. With -on-conflict=fail the update
+// fails instead, changing nothing. With -group-policy=weighted (GROUP_POLICY
+// environment variable for Lambda) such instances get weighted record sets of
+// equal weights, using instance ids as set identifiers. Record sets of the same
+// name must be of the same type, so if some of such instances have public DNS
+// names and some don't, all of them get A records. With
+// -group-policy=multivalue such instances get multivalue answer record sets
+// instead, which is handy for "give me any healthy node" lookups; these are
+// always A records, as multivalue answer routing does not support CNAME
+// records. With -group-policy=latency such instances get latency record sets
+// with regions of the instances, so Route 53 answers with the instance of the
+// lowest latency region; this is mostly useful with -regions.
+//
+// With -health-check flag (HEALTH_CHECK environment variable for Lambda) the
+// program creates Route 53 health check against public IP address of each
+// instance it publishes and associates it with the instance record. Flag value
+// is in "proto:port[/path]" form, like "tcp:22" or "https:443/healthz", where
+// proto is one of tcp, http, or https. Instance may override it with
+// "dns:healthcheck" tag of the same form, or opt out with "none" tag value.
+// Health checks are deleted once no longer used by records. Route 53 only uses
+// health checks to choose between record sets sharing the same name, so this
+// is mostly useful with -group-policy. This requires route53:ListHealthChecks,
+// route53:CreateHealthCheck and route53:DeleteHealthCheck permissions.
+//
+// With -probe flag (PROBE environment variable for Lambda) set to "tcp:port",
+// like "tcp:22", the program only creates records of an instance once the
+// record address accepts TCP connections on this port within -probe-timeout
+// (PROBE_TIMEOUT), 3 seconds by default. Instance may set its own port with
+// "dns:probe" tag of the same form, even without the flag, or opt out with
+// "none" tag value. Instances are probed in parallel, and only for records
+// which don't exist yet, so that names of instances still booting don't get
+// published before they can serve; records of instances which don't answer yet
+// are created by a later update, so this is best used with -watch or periodic
+// invocations. The program must be able to reach instance addresses.
+//
+// Instances sharing the same name can form a hot-standby pair with
+// "dns:failover" tag set to PRIMARY or SECONDARY: they get failover record
+// sets, using instance ids as set identifiers, regardless of -group-policy.
+// Only one instance of each role gets a record set; other instances of this
+// name are skipped. Route 53 needs health check of the primary instance to fail
+// over, so this is to be used together with -health-check.
+//
+// Instances sharing the same name can also get weighted record sets with
+// "dns:weight" tag set to a number from 0 to 255, regardless of -group-policy:
+// each instance of the name gets a record set of its tag weight (or weight 1 if
+// tag is not set), using instance id as set identifier. This allows shifting
+// traffic between old and new instances by re-tagging them, like setting
+// "dns:weight" to 90 on the new instance and to 10 on the old one. Failover
+// roles take precedence over weights.
+//
+// Similarly, instances sharing the same name can serve nearby users with
+// "dns:geo" tag: they get geolocation record sets, using instance ids as set
+// identifiers. Tag value is a continent code like "EU", a country code like
+// "US", a country and subdivision code like "US-CA", or "default" for queries
+// from all other locations. Only one instance of each location gets a record
+// set. Route 53 doesn't answer queries from locations no record set covers, so
+// one of the instances must have "default" location, otherwise none of them
+// get record sets. Geolocations take precedence over weights, but not over
+// failover roles.
+//
+// For full control, instance may set routing of its record sets with a single
+// "dns:policy" tag holding a JSON object, like
+// {"type":"weighted","weight":10,"set-id":"blue"}. Type is one of weighted,
+// latency, failover or multivalue; "set-id" sets the set identifier, instance
+// id by default; "weight", from 0 to 255, 1 by default, applies to weighted
+// records, "region", instance region by default, to latency ones, and required
+// "role", PRIMARY or SECONDARY, to failover ones. Record sets sharing a name
+// must have the same routing policy, so the type of the instance with the
+// lowest id and a valid tag applies to all instances of the name; instances
+// without valid tag, of other types, or reusing set identifiers or failover
+// roles are skipped. The tag takes precedence over all other routing tags and
+// -group-policy.
+//
+// With -watch flag the program keeps running, repeating the update every
+// -interval until interrupted with SIGINT or SIGTERM. On consecutive failures
+// delay between updates is doubled each time, up to an hour (or -interval, if
+// it is longer). This mode is suitable for running on a bastion host or as an
+// ECS service. If -metrics-addr is set in this mode, the program serves
+// Prometheus metrics on /metrics path at this address: counters of upserted and
+// deleted records and failed AWS API calls, duration of updates, and the number
+// of managed records.
+//
+// If -http-addr is set in -watch mode, the program serves /healthz at this
+// address, responding with JSON object with time of the last update and of the
+// last successful one, the last error, and the number of consecutive failures;
+// response status is 503 if the last update failed. POST request to /sync
+// triggers an update right away, or right after the running one completes,
+// without waiting for -interval. Both endpoints have no authentication, so
+// bind them to a private address, like localhost:8080. It can be the same as
+// -metrics-addr.
+//
+// With -metrics flag (METRICS=1 environment variable for Lambda) the program
+// publishes custom CloudWatch metrics in "awsns" namespace with ZoneId
+// dimension after each update: RecordsUpserted, RecordsDeleted,
+// InstancesSkipped, and ReconcileErrors. This requires
+// cloudwatch:PutMetricData permission.
+//
+// With -status-record flag (STATUS_RECORD=1 environment variable for Lambda)
+// each successful full update ends by upserting TXT record named _awsns under
+// suffix, like _awsns.example.com, with its time, program version and number
+// of changed records:
+//
+//	"time=2024-05-01T10:00:00Z" "version=v1.2.0" "changes=3"
+//
+// so that external monitoring can alert on stale updates by querying DNS
+// alone. Note that this makes a change batch on every update, even if there
+// is nothing else to change.
+//
+// With -statsd-addr flag (STATSD_ADDR environment variable for Lambda) set to
+// host:port of statsd or DogStatsD agent, like localhost:8125 for Datadog
+// agent or Lambda extension, the program sends metrics over UDP after each
+// update: awsns.reconcile.duration timer, awsns.records.upserted,
+// awsns.records.deleted, awsns.reconcile.errors and awsns.aws_api.errors
+// counters, and awsns.instances.skipped and awsns.records.managed gauges, all
+// tagged with zone_id and suffix (without leading dot) DogStatsD tags.
+//
+// With -notify-sns-arn flag (NOTIFY_SNS_ARN environment variable for Lambda)
+// the program publishes a message to the given SNS topic after each applied
+// change batch. Message is a JSON object with "zone_id" and "changes" keys,
+// the latter being a list of objects with "action" (create, update, or
+// delete), "name", "type", "value", and "instance_id" keys. This requires
+// sns:Publish permission.
+//
+// Similarly, with -notify-url flag (NOTIFY_URL environment variable for
+// Lambda) the program POSTs the same JSON object to the given URL. If
+// -notify-format=slack (NOTIFY_FORMAT=slack) is set, payload is instead a
+// Slack-compatible {"text": "..."} object with a human-readable summary like
+// "awsns created jenkins.foo.example.com → 54.1.2.3, deleted
+// old-box.foo.example.com", suitable for Slack incoming webhooks.
+//
+// With -notify-event-bus flag (NOTIFY_EVENT_BUS environment variable for
+// Lambda) set to the name or ARN of EventBridge event bus, like "default", the
+// program sends an event there after each applied change batch, so that other
+// automation can react to DNS changes with EventBridge rules. Event has
+// "awsns" source and "DNS Records Changed" detail type; its detail is a JSON
+// object with "zone_id", "upserted" and "deleted" keys, the latter two being
+// lists of changes like in SNS message. This requires events:PutEvents
+// permission.
+//
+// Concurrent updates of the same zone (e.g. overlapping Lambda invocations
+// when several instances launch at once) may race with each other. To prevent
+// this, set -lock-table flag (LOCK_TABLE environment variable for Lambda) to
+// the name of DynamoDB table with "LockID" string partition key. The program
+// then takes a lock on the zone before updating it; lock is a lease valid for
+// -lock-ttl (LOCK_TTL), 5 minutes by default, which should be longer than a
+// single update takes. If lock is held by another process, the program retries
+// for up to -lock-wait (LOCK_WAIT), 30 seconds by default. Then scheduled full
+// update is skipped, as the lock holder does the same work, while other updates
+// fail, so that Lambda or SQS retries the event and lifecycle action stays
+// pending. Lock items carry "Expires" attribute with unix timestamp which can
+// be used as the table TTL attribute. This requires dynamodb:PutItem and
+// dynamodb:DeleteItem permissions.
+//
+// Every applied change batch can be recorded for audit purposes as a JSON
+// object with "time", "zone_id", "change_id", "comment",
+// "invoker_instance_id", "lambda_request_id", and "changes" keys. Set
+// -audit-s3=s3://bucket/prefix (AUDIT_S3 environment variable for Lambda) to
+// save such records as S3 objects under "prefix/zone-id/yyyy/mm/dd/" keys;
+// this requires s3:PutObject permission. Set -audit-table (AUDIT_TABLE) to save
+// them in DynamoDB table with "ChangeID" string partition key; this requires
+// dynamodb:PutItem permission.
+//
+// With -audit-metadata flag (AUDIT_METADATA=1 environment variable for Lambda)
+// change batch comments get a structured suffix naming the AWS principal the
+// program runs as, program version and ids of instances the changes are for,
+// like "[principal=arn:aws:sts::123456789012:assumed-role/awsns/i-0123
+// version=v1.2.0 instances=i-0123]". With -comment template they are available
+// as .Principal, .Version and .InstanceIDs fields instead. Audit records then
+// also have "principal", "version" and "instance_ids" keys, and audit table
+// items "Principal", "Version" and "InstanceIDs" attributes. The principal is
+// looked up with sts:GetCallerIdentity, which needs no permission. Run the
+// program with "history" command after the flags to list change batches saved
+// in -audit-table for the zone, newest first, along with their current Route 53
+// status ("unknown" once Route 53 no longer keeps the change):
+//
+//	awsns -zone Z123 -audit-table awsns-audit history -format json -limit 20
+//
+// Format is "table" by default. This requires dynamodb:Scan and
+// route53:GetChange permissions.
+//
+// With -snapshot flag set to a directory or s3://bucket/prefix URL (SNAPSHOT
+// environment variable for Lambda, where only S3 makes sense), the program
+// saves prior state of every record set a change batch is about to change
+// before submitting it, as a JSON file named after the zone id and time, or
+// as an S3 object under "prefix/zone-id/yyyy/mm/dd/" key, which requires
+// s3:PutObject permission. Change batch is not submitted if snapshot can't be
+// saved. The location of each snapshot is logged. To undo the change, run
+// the program with "rollback" command followed by the snapshot file name or
+// s3://bucket/key URL after the flags: record sets created by the change are
+// deleted, and the ones it updated or deleted are restored, in a single
+// change batch. Reading snapshot from S3 requires s3:GetObject permission.
+//
+// Route 53 calls listing and changing records which fail due to throttling or
+// because of another change to the zone still in progress are retried with
+// jittered exponential backoff, up to -max-retries times (MAX_RETRIES
+// environment variable for Lambda), 5 by default.
+//
+// To protect Route 53 API rate limits, which are shared by the whole account,
+// from pathological configurations like huge zones or runaway retries, set
+// -max-api-calls flag (MAX_API_CALLS environment variable for Lambda) to the
+// number of EC2 and Route 53 API calls a single run may make, counting each
+// retry and page of a listing. Once the budget is spent, further calls fail,
+// and so does the run, without applying changes it has not applied yet. The
+// budget is renewed on each Lambda invocation and each -watch update.
+//
+// Records are listed starting from the suffix domain, and listing stops at the
+// first name past its subdomains, so that only the part of the zone under
+// suffix is read, however large the rest is. For zones with tens of thousands
+// of records, page size of listing can be set with -list-page-size flag
+// (LIST_PAGE_SIZE environment variable for Lambda), up to 300, and
+// -list-page-interval flag (LIST_PAGE_INTERVAL) spaces out page requests to
+// stay under Route 53 rate limit. With -list-checkpoint flag (LIST_CHECKPOINT)
+// set to a directory or s3://bucket/prefix URL, listing interrupted by
+// -max-api-calls or by approaching Lambda timeout is saved there, along with
+// records listed so far, and the run fails; the next run resumes listing where
+// it stopped, unless the checkpoint is older than 30 minutes, and removes the
+// checkpoint once listing completes. With S3 URL this requires s3:GetObject,
+// s3:PutObject and s3:DeleteObject permissions.
+//
+// Log messages carry key=value fields like zone_id, record_name, action and
+// instance_id. With -log-format=json (LOG_FORMAT=json environment variable for
+// Lambda) each message is logged as a JSON object instead, which is handy for
+// CloudWatch Logs Insights queries.
+//
+// With -debug flag (DEBUG=1 environment variable for Lambda) the program also
+// logs every AWS API request and response, including retries and their
+// bodies, and explains its decisions: why each instance got no record, and
+// why each record became a removal candidate or was kept. Such messages have
+// level=debug attached. This is verbose and meant for troubleshooting only.
+//
+// With -confirm flag the program prints changes it is about to make to stderr,
+// listing deletions first, and waits for "y" answer on stdin before applying
+// them; any other answer aborts the run with an error. The flag is meant for
+// manual runs and cannot be combined with -watch.
+//
+// With -self flag the program is meant to run on the instance itself, like
+// from cloud-init user data: it reads instance id, addresses and tags from
+// instance metadata (using IMDSv2) and only upserts records of this instance,
+// leaving other records alone. Tags are only available if access to tags in
+// instance metadata is enabled for the instance; without them instance has no
+// name, unless -fallback-name is set. As the program doesn't see other
+// instances, it doesn't resolve name collisions, and -group-policy has no
+// effect, while "dns:" tags still work. This mode doesn't need
+// ec2:DescribeInstances permission, so "iam-policy" command prints a much
+// narrower policy for it. It cannot be combined with -watch, -require-eip or
+// -mode=cleanup.
+//
+// Similarly, with -self-deregister flag the program deletes records of the
+// instance it runs on: record sets of its names with its id as set identifier,
+// and ones pointing only to its public addresses. This is meant for clean
+// shutdown, so records of intentionally stopped instances disappear right
+// away instead of on the next full update, like with this systemd unit:
+//
+//	[Unit]
+//	Description=Instance DNS records
+//	Wants=network-online.target
+//	After=network-online.target
+//
+//	[Service]
+//	Type=oneshot
+//	RemainAfterExit=yes
+//	ExecStart=/usr/local/bin/awsns -zone Z123 -self
+//	ExecStop=/usr/local/bin/awsns -zone Z123 -self-deregister
+//
+//	[Install]
+//	WantedBy=multi-user.target
+//
+// With -output=json (OUTPUT=json environment variable for Lambda) the program
+// prints a summary of each update to stdout as a single-line JSON object:
+// number of instances considered, records upserted and deleted, instances
+// skipped along with the reason, ids of applied change batches, and the error
+// if update failed. With -env-suffixes there is an object per environment,
+// with "environment" key set to its name. Logs still go to stderr, so the
+// summary can be piped to other tools.
+//
+// Route 53 change batches have comments describing the update, like
+// "automated removal of i-0123". With -comment flag (COMMENT environment
+// variable for Lambda) set to Go text/template, comments are rendered from it
+// instead, so that Route 53 change history carries more details. Template gets
+// .Comment (the default comment), .ZoneID, .InvokerID (id of the instance
+// which triggered the update, if any), .RequestID (Lambda request id, if
+// running as Lambda), and .Creates, .Updates and .Deletes (numbers of records
+// created, updated and deleted) fields, like:
+//
+//	awsns -zone Z123 -comment '{{.Comment}} (+{{.Creates}} ~{{.Updates}} -{{.Deletes}})'
+//
+// Rendered comments longer than 256 characters are truncated.
+//
+// AWS credentials and region are taken from environment and shared config
+// files, like with AWS CLI. For manual runs against different accounts,
+// -profile flag selects shared config profile and -region flag overrides the
+// region, like:
+//
+//	awsns -profile dns-admin -region eu-west-1 -zone Z1 -suffix .example.com
+//
+// With -endpoint-url flag AWS API calls go to the given URL instead of real
+// AWS endpoints, which allows running the program against LocalStack or moto
+// in integration tests and local development. Standard AWS_ENDPOINT_URL and
+// service-specific AWS_ENDPOINT_URL_EC2, AWS_ENDPOINT_URL_ROUTE_53, etc.
+// environment variables are honored too, the latter taking precedence.
+//
+// Endpoints are resolved in the AWS partition of the configured region, so
+// that the program works in GovCloud and China regions too; Route 53 API is
+// then reached at route53.us-gov.amazonaws.com or route53.amazonaws.com.cn
+// rather than at route53.amazonaws.com. To pin the partition, set -partition
+// flag (PARTITION environment variable for Lambda) to aws, aws-us-gov or
+// aws-cn: endpoints are then resolved in it even for regions not known to
+// the program, and regions of other partitions are rejected. Partition is
+// also used in resource ARNs printed by "iam-policy" command. With -fips flag
+// (AWS_USE_FIPS_ENDPOINT=true environment variable, which also works for
+// Lambda) FIPS endpoints are used.
+//
+// AWS API calls go through HTTPS proxy set in HTTPS_PROXY environment variable,
+// except for hosts listed in NO_PROXY. When running from a laptop behind a
+// TLS-intercepting corporate proxy, set -ca-bundle flag to a PEM file with the
+// proxy CA certificate: certificates from it are trusted in addition to the
+// system ones, while AWS_CA_BUNDLE environment variable, which is honored too,
+// replaces them. Errors caused by untrusted certificates say so.
 //
 // The program may also be run as AWS Lambda invoked by CloudWatch event
-// created as "EC2 Instance State-change Notification" for "running" state. It
-// then looks up suffix and zone id in SUFFIX and ZONE environment variables.
-// Lambda needs permissions to describe EC2 instances and list/update Route 53
-// records; required permissions can be satisfied by using the following AWS
-// managed policies: AmazonEC2ReadOnlyAccess, AmazonRoute53FullAccess,
-// AWSLambdaBasicExecutionRole.
+// created as "EC2 Instance State-change Notification" for "running",
+// "shutting-down", "stopped" and "terminated" states. It then looks up suffix
+// and zone id in SUFFIX and ZONE environment variables. On "running" event it
+// does a full update as described above; on other events it only removes the
+// record of the instance that generated the event, unless another running
+// non-spot instance has the same name.
+//
+// Which state changes maintain DNS can be set with -state-actions flag
+// (STATE_ACTIONS environment variable for Lambda) to comma-separated
+// state=action pairs overriding the defaults above, like:
+//
+//	STATE_ACTIONS=stopping=delete,stopped=ignore
+//
+// States are pending, running, stopping, stopped, shutting-down and
+// terminated; actions are upsert, creating records of the instance as on
+// "running" event, delete, removing them, and ignore. Rule for the "EC2
+// Instance State-change Notification" event must match the configured states.
+//
+// EventBridge may deliver events late, out of order or more than once, so
+// state-change events are checked against the current state of the instance:
+// "running" event of an instance which is not running anymore is discarded,
+// as are events of other states if the instance was started again after the
+// event time. Event of the same instance launch and state is handled only once
+// by a warm Lambda.
+//
+// Instead of environment variables, Lambda can read its settings from SSM
+// Parameter Store at cold start: set CONFIG_SSM_PATH either to a path holding
+// parameters named after environment variables, like /awsns/SUFFIX and
+// /awsns/ZONE, or to a single parameter with KEY=value lines, like
+// "SUFFIX=.foo.example.com". Settings from Parameter Store take precedence over
+// environment variables, and can be changed without redeploying the function;
+// they take effect on the next cold start. This requires ssm:GetParametersByPath
+// and ssm:GetParameter permissions, and kms:Decrypt for SecureString
+// parameters.
+//
+// When invoked by EventBridge scheduled rule (event source "aws.events" or
+// "aws.scheduler"), Lambda does a full update, cleaning up any drift.
+//
+// Lambda can also handle "Tag Change on Resource" events (source "aws.tag")
+// for ec2 instances: when instance "Name" tag changes, the record for the new
+// name is created and records under the old name pointing to this instance are
+// removed in a single change batch. When any of "dns:" tags changes, Lambda
+// does a full update.
+//
+// Lambda can also be invoked by EventBridge rule matching autoscaling
+// lifecycle hook events ("EC2 Instance-launch Lifecycle Action" and "EC2
+// Instance-terminate Lifecycle Action"). It then creates or removes instance
+// record and completes lifecycle action with CONTINUE result, so instance is
+// only put in service (or terminated) once its record is in place (or
+// removed). This requires autoscaling:CompleteLifecycleAction permission.
+//
+// With FAST_LAUNCH=1 environment variable, on "running" and instance-launch
+// lifecycle events Lambda only describes the launched instance and upserts its
+// own records (and PTR records, with REVERSE_ZONE), without listing the whole
+// zone and all instances, which saves time and API calls during scale-out. It
+// falls back to a full update if the instance names have records pointing
+// elsewhere, or if records depend on other instances: with GROUP_POLICY, SRV
+// or TXT_METADATA set, or if the instance has any of "dns:failover",
+// "dns:weight", "dns:geo" or "dns:policy" tags. Stale records are not cleaned
+// up on this path, so use it together with a scheduled rule doing full
+// updates.
+//
+// Public IP address and DNS name of a freshly launched instance are sometimes
+// not assigned yet when its "running" event fires, and the instance then gets
+// no record until a later update. With ADDRESS_WAIT environment variable
+// (-address-wait flag) set to a duration, like 30s, on "running" and
+// instance-launch lifecycle events Lambda describes the launched instance again
+// with exponential backoff until it gets an address its records can point to,
+// for up to this long, but no longer than Lambda timeout allows, then proceeds
+// as usual. Lambda timeout should account for this wait.
+//
+// To avoid a full update per event during scale-out storms, EventBridge rules
+// can target an SQS queue instead of the function, with the queue set as the
+// function event source, using a batching window of a few seconds. Lambda
+// then gets events in batches and does a single full update per batch, after
+// which it removes records of instances being terminated by autoscaling and
+// completes lifecycle actions of the batch. If anything fails, the whole
+// batch is retried. This requires sqs:ReceiveMessage, sqs:DeleteMessage and
+// sqs:GetQueueAttributes permissions on the queue.
+//
+// Before wiring the program into Lambda, run it with "check" command after the
+// flags to verify configuration and permissions: that hosted zone exists and
+// suffix belongs to it, and that instances and records can be listed. With
+// "check -write" it also creates and deletes throwaway "_awsns-check" TXT
+// record to verify that records can be changed. Each check is reported as
+// passed or failed, and the program exits with non-zero status if any fails.
+//
+// Changes can be reviewed, or approved in a pipeline, before they are made:
+// run the program with "plan -out changes.json" after the flags to save
+// changes a regular update would make to a file, without applying them, then
+// with "apply changes.json" to apply them exactly as planned, using the same
+// flags. Apply refuses to proceed if any record the plan changes was changed
+// after the plan was made. Plan cannot be used with -health-check, as
+// attaching health checks creates them.
+//
+// Run the program with "list" command after the flags to print A/CNAME records
+// under suffix without changing anything, each with the instance or other
+// resource it belongs to, instance state, and status: "managed" if it is up to
+// date, "outdated" if the next update will change it, "ignored" if it is under
+// name of an ignored instance, or "orphaned" if no running instance or other
+// resource has it, so that the next full update will remove it. Orphaned
+// records are matched by name to instances in other states, like stopped ones.
+// With "list -format json" or "list -format csv" output is JSON array or CSV
+// table instead of a text one:
+//
+//	awsns -zone Z123 list
+//	NAME                 TYPE   VALUES                             RESOURCE  STATE    STATUS
+//	web.foo.example.com  CNAME  ec2-1-2-3-4.compute.amazonaws.com  i-0123    running  managed
+//	ci.foo.example.com   A      5.6.7.8                            i-0456    stopped  orphaned
+//
+// Run the program with "status" command after the flags to check for drift
+// without changing anything, like from a monitoring cron job: it prints changes
+// a regular update would make, and exits with status 0 if records are in
+// sync, 2 if they are not, or 1 on error. Like plan, it cannot be used with
+// -health-check.
+//
+// Run the program with "orphans" command after the flags to list A/CNAME
+// records under suffix none of which values belong to a running non-spot
+// instance (including the ones not matching -filter), or to a load balancer
+// or datastore managed with -lb-tag or -db-tag. Unlike regular update, which
+// goes by record names, this catches records under names still in use, but
+// pointing to addresses of gone instances. Records under names of running
+// ignored instances, and records listed in -manifest, are left alone. With
+// "orphans -delete" such records are also deleted in a single change batch,
+// unless -mode=upsert is set; combine it with -confirm to review the
+// changes first.
+//
+// Run the program with "export" command after the flags to print records of all
+// types named by the suffix domain or located under it in zone file format,
+// with names relative to the suffix, to snapshot them, review their changes as
+// text, or move the subdomain to other tooling. Alias records, which zone files
+// cannot express, are printed as comments, and records with routing policies as
+// plain ones, with their set identifiers in comments. This requires
+// route53:ListResourceRecordSets permission.
+//
+// Conversely, "import zone.txt" command turns zone file into -manifest JSON
+// printed to stdout, without calling any AWS API. Names and domain names in
+// values not ending with a dot are relative to the suffix, or to $ORIGIN
+// directive; values of the same name and type are merged into one record, and
+// records named by the suffix domain itself, or of types manifest does not
+// support, like SOA, are skipped with a warning:
+//
+//	awsns -zone Z123 export > foo.zone
+//	awsns -suffix .foo.example.com import foo.zone > manifest.json
+//
+// Lambda needs permissions to describe EC2 instances, read the hosted zone and
+// list/update Route 53 records, plus the ones required by enabled optional
+// features. Run the program with "iam-policy" command after the flags, like
+//
+//	awsns -zone Z123 -health-check tcp:22 iam-policy
+//
+// to print least-privilege IAM policy for the given flags, scoped to the hosted
+// zone. Add autoscaling:CompleteLifecycleAction to it when using lifecycle
+// hooks, and attach AWSLambdaBasicExecutionRole managed policy for logging.
+//
+// Similarly, "package" command prints AWS SAM template deploying the program
+// as Lambda with the given flags turned into environment variables,
+// least-privilege IAM policy and EventBridge rule for instance state-change
+// events. Template expects awsns.zip with Linux binary named bootstrap next to
+// it:
+//
+//	GOOS=linux GOARCH=amd64 go build -o bootstrap && zip awsns.zip bootstrap
+//	awsns -zone Z123 -suffix .foo.example.com package > template.json
+//	sam deploy --template-file template.json --stack-name awsns --guided
 package main
 
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"flag"
 	"log"
+	"net/http"
 	"os"
-	"strings"
+	"os/signal"
+	"syscall"
 
 	"github.com/artyom/autoflags"
-	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/ssm"
 )
 
 func main() {
+	cfg := defaultConfig()
 	if os.Getenv("LAMBDA_TASK_ROOT") != "" && os.Getenv("AWS_EXECUTION_ENV") != "" {
-		lambda.Start(func(ctx context.Context, evt events.CloudWatchEvent) error {
-			if evt.Source != "aws.ec2" {
-				log.Printf("unsupported event source: %q", evt.Source)
-				return nil
-			}
-			det := struct {
-				ID    string `json:"instance-id"`
-				State string `json:"state"`
-			}{}
-			if err := json.Unmarshal(evt.Detail, &det); err != nil {
+		s, err := lambdaSetup(&cfg)
+		lambda.Start(func(ctx context.Context, payload json.RawMessage) error {
+			if err != nil {
 				return err
 			}
-			if det.State != "running" {
-				log.Printf("unsupported ec2 instance state: %q", det.State)
-				return nil
-			}
-			if det.ID == "" {
-				log.Println("empty instance id")
-				return nil
-			}
-			return run(ctx, os.Getenv("SUFFIX"), os.Getenv("ZONE"), det.ID)
+			return s.handleInvocation(ctx, payload)
 		})
 		return
 	}
-	args := struct {
-		Suffix string `flag:"suffix,dns zone suffix, i.e. .subdomain.example.com"`
-		Zone   string `flag:"zone,Route 53 hosted zone id"`
-	}{}
-	autoflags.Parse(&args)
-	if err := run(context.Background(), args.Suffix, args.Zone, ""); err != nil {
-		log.Fatal(err)
+	autoflags.Parse(&cfg)
+	switch cmd := flag.Arg(0); cmd {
+	case "", "check", "list", "status", "orphans", "plan", "apply", "rollback", "history", "export":
+	case "import":
+		if flag.NArg() != 2 {
+			log.Fatal("usage: awsns -suffix .example.com import zone.txt")
+		}
+		if cfg.Suffix == "" {
+			log.Fatal("import command requires -suffix")
+		}
+		f, err := os.Open(flag.Arg(1))
+		if err != nil {
+			log.Fatal(err)
+		}
+		records, err := readZoneFile(f, suffixOrigin(cfg.Suffix))
+		f.Close()
+		if err != nil {
+			log.Fatalf("%s: %v", flag.Arg(1), err)
+		}
+		if err := writeManifest(os.Stdout, records, cfg.Suffix); err != nil {
+			log.Fatal(err)
+		}
+		return
+	case "iam-policy", "package":
+		var doc interface{}
+		var err error
+		if cmd == "iam-policy" {
+			doc, err = iamPolicy(cfg)
+		} else {
+			doc, err = samTemplate(cfg)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(doc); err != nil {
+			log.Fatal(err)
+		}
+		return
+	default:
+		log.Fatalf("unknown command %q", cmd)
 	}
-}
-
-func run(ctx context.Context, suffix, zoneID, invokerID string) error {
-	if suffix == "." || !strings.HasPrefix(suffix, ".") {
-		return fmt.Errorf("invalid suffix %q, must start with dot, like '.example.com'", suffix)
+	if cfg.EnvSuffixes != "" {
+		switch {
+		case flag.Arg(0) != "":
+			log.Fatalf("%s command cannot be used with -env-suffixes", flag.Arg(0))
+		case cfg.Self || cfg.SelfDereg:
+			log.Fatal("-self and -self-deregister cannot be used with -env-suffixes")
+		}
 	}
-	if zoneID == "" {
-		return fmt.Errorf("hosted zone id cannot be empty")
+	if cfg.RFC2136Server != "" {
+		switch {
+		case flag.Arg(0) != "":
+			log.Fatalf("%s command cannot be used with -rfc2136-server", flag.Arg(0))
+		case cfg.Self || cfg.SelfDereg:
+			log.Fatal("-self and -self-deregister cannot be used with -rfc2136-server")
+		}
 	}
-	sess, err := session.NewSession()
+	sess, err := newSession(cfg, os.Getenv)
 	if err != nil {
-		return err
+		log.Fatal(err)
 	}
-	instances, err := runningInstances(ctx, ec2.New(sess))
-	if err != nil {
-		return err
-	}
-	if invokerID != "" {
-		var found bool
-		for _, inst := range instances {
-			if inst.InstanceId != nil && *inst.InstanceId == invokerID {
-				found = true
-				break
+	var md *ec2metadata.EC2Metadata
+	if cfg.Self || cfg.SelfDereg {
+		md = ec2metadata.New(sess)
+		if aws.StringValue(sess.Config.Region) == "" {
+			region, err := md.RegionWithContext(context.Background())
+			if err != nil {
+				log.Fatal(err)
 			}
+			sess.Config.Region = aws.String(region)
 		}
-		// return rigth away if invoked by spot instance launch
-		if !found {
-			return nil
+	}
+	s, err := setup(context.Background(), sess, cfg)
+	if err != nil {
+		log.Fatal(certHint(err))
+	}
+	if cfg.Self && flag.Arg(0) == "" {
+		if err := s.registerSelf(context.Background(), md); err != nil {
+			log.Fatal(err)
 		}
+		return
 	}
-	r53svc := route53.New(sess)
-	toRemove := make(map[string]*route53.Change)
-	fn := func(page *route53.ListResourceRecordSetsOutput, lastPage bool) bool {
-		suffix := suffix + "."
-		for _, rr := range page.ResourceRecordSets {
-			if rr.Name == nil || *rr.Name == suffix || !strings.HasSuffix(*rr.Name, suffix) {
-				continue
-			}
-			if rr.Type == nil || (*rr.Type != "A" && *rr.Type != "CNAME") {
-				continue
-			}
-			name := strings.TrimSuffix(*rr.Name, ".")
-			toRemove[name] = &route53.Change{
-				Action: aws.String("DELETE"),
-				ResourceRecordSet: &route53.ResourceRecordSet{
-					Name:            &name,
-					TTL:             rr.TTL,
-					Type:            rr.Type,
-					ResourceRecords: rr.ResourceRecords,
-				},
-			}
+	if cfg.SelfDereg && flag.Arg(0) == "" {
+		if err := s.deregisterSelf(context.Background(), md); err != nil {
+			log.Fatal(err)
 		}
-		return true
+		return
 	}
-	listInput := &route53.ListResourceRecordSetsInput{
-		HostedZoneId: &zoneID,
+	if flag.Arg(0) == "check" {
+		fs := flag.NewFlagSet("check", flag.ExitOnError)
+		write := fs.Bool("write", false, "also create and delete throwaway TXT record")
+		fs.Parse(flag.Args()[1:])
+		if !s.check(context.Background(), os.Stdout, *write) {
+			os.Exit(1)
+		}
+		return
 	}
-	if err := r53svc.ListResourceRecordSetsPagesWithContext(ctx, listInput, fn); err != nil {
-		return err
+	if flag.Arg(0) == "list" {
+		fs := flag.NewFlagSet("list", flag.ExitOnError)
+		format := fs.String("format", "table", "output `format`: table, json or csv")
+		fs.Parse(flag.Args()[1:])
+		records, err := s.listManaged(context.Background())
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := writeList(os.Stdout, records, *format); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
-	log.Println("removal candidates:", len(toRemove))
-	var changes []*route53.Change
-	for _, inst := range instances {
-		var name string
-		for _, tag := range inst.Tags {
-			if *tag.Key == "Name" {
-				name = *tag.Value
-				break
-			}
+	if flag.Arg(0) == "export" {
+		records, err := s.exportRecords(context.Background())
+		if err != nil {
+			log.Fatal(err)
 		}
-		if !valid(name) {
-			continue
+		if err := writeZoneFile(os.Stdout, suffixOrigin(s.suffix), records); err != nil {
+			log.Fatal(err)
 		}
-		ch := &route53.Change{
-			Action: aws.String("UPSERT"),
-			ResourceRecordSet: &route53.ResourceRecordSet{
-				Name: aws.String(name + suffix),
-				TTL:  aws.Int64(60),
-			},
+		return
+	}
+	if flag.Arg(0) == "status" {
+		err := s.reportStatus(context.Background(), os.Stdout)
+		if errors.Is(err, errOutOfSync) {
+			log.Print(err)
+			os.Exit(statusOutOfSync)
 		}
-		switch {
-		case inst.PublicDnsName != nil && *inst.PublicDnsName != "":
-			ch.ResourceRecordSet.Type = aws.String("CNAME")
-			ch.ResourceRecordSet.ResourceRecords = []*route53.ResourceRecord{{
-				Value: aws.String(*inst.PublicDnsName),
-			}}
-		case inst.PublicIpAddress != nil && *inst.PublicIpAddress != "":
-			ch.ResourceRecordSet.Type = aws.String("A")
-			ch.ResourceRecordSet.ResourceRecords = []*route53.ResourceRecord{{
-				Value: aws.String(*inst.PublicIpAddress),
-			}}
-		default:
-			continue
-		}
-		delete(toRemove, name+suffix)
-		changes = append(changes, ch)
-	}
-	if len(changes) == 0 {
-		return fmt.Errorf("no changes to apply")
-	}
-	log.Println("actually removing:", len(toRemove))
-	for name, ch := range toRemove {
-		log.Println("removing:", name)
-		changes = append(changes, ch)
-	}
-	// https://docs.aws.amazon.com/Route53/latest/DeveloperGuide/DNSLimitations.html?shortFooter=true#limits-api-requests
-	//
-	// ResourceRecord elements
-	// A request cannot contain more than 1,000 ResourceRecord elements.
-	// When the value of the Action element is UPSERT, each ResourceRecord
-	// element is counted twice.
-	//
-	// Maximum number of characters
-	// The sum of the number of characters (including spaces) in all Value
-	// elements in a request cannot exceed 32,000 characters. When the value
-	// of the Action element is UPSERT, each character in a Value element is
-	// counted twice.
-	//
-	// TODO: call API in batches of no more than 500 records
-	// see https://play.golang.org/p/KZEk2qhcA-F
-	input := &route53.ChangeResourceRecordSetsInput{
-		HostedZoneId: &zoneID,
-		ChangeBatch: &route53.ChangeBatch{
-			Changes: changes,
-			Comment: aws.String("automated update for running instances"),
-		},
-	}
-	_, err = r53svc.ChangeResourceRecordSetsWithContext(ctx, input)
-	return err
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if flag.Arg(0) == "orphans" {
+		fs := flag.NewFlagSet("orphans", flag.ExitOnError)
+		remove := fs.Bool("delete", false, "also delete orphaned records")
+		fs.Parse(flag.Args()[1:])
+		if err := s.reportOrphans(context.Background(), os.Stdout, *remove); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if flag.Arg(0) == "plan" {
+		fs := flag.NewFlagSet("plan", flag.ExitOnError)
+		out := fs.String("out", "", "`file` to write the plan to, instead of stdout")
+		fs.Parse(flag.Args()[1:])
+		p, err := s.makePlan(context.Background())
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *out == "" {
+			err = writePlan(os.Stdout, p)
+		} else {
+			err = writePlanFile(*out, p)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if flag.Arg(0) == "apply" {
+		if flag.NArg() != 2 {
+			log.Fatal("usage: awsns [flags] apply plan.json")
+		}
+		f, err := os.Open(flag.Arg(1))
+		if err != nil {
+			log.Fatal(err)
+		}
+		p, err := readPlan(f)
+		f.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := s.applyPlan(context.Background(), p); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if flag.Arg(0) == "rollback" {
+		if flag.NArg() != 2 {
+			log.Fatal("usage: awsns [flags] rollback snapshot.json")
+		}
+		snap, err := readSnapshot(context.Background(), s3.New(sess), flag.Arg(1))
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := s.rollback(context.Background(), snap); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if flag.Arg(0) == "history" {
+		fs := flag.NewFlagSet("history", flag.ExitOnError)
+		format := fs.String("format", "table", "output `format`: table or json")
+		limit := fs.Int("limit", 0, "show at most this many most recent change batches, 0 for all")
+		fs.Parse(flag.Args()[1:])
+		if cfg.AuditTable == "" {
+			log.Fatal("history command requires -audit-table")
+		}
+		entries, err := history(context.Background(), dynamodb.New(sess), route53.New(sess), cfg.AuditTable, s.zoneID, *limit)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := writeHistory(os.Stdout, entries, *format); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if !cfg.Watch {
+		if err := s.scheduledReconcile(context.Background()); err != nil {
+			log.Fatal(certHint(err))
+		}
+		return
+	}
+	if cfg.Interval <= 0 {
+		log.Fatal("-interval must be positive")
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	muxes := make(map[string]*http.ServeMux) // by address to serve on
+	handle := func(addr, pattern string, h http.Handler) {
+		if muxes[addr] == nil {
+			muxes[addr] = http.NewServeMux()
+		}
+		muxes[addr].Handle(pattern, h)
+	}
+	if s.metrics != nil {
+		handle(cfg.MetricsAddr, "/metrics", s.metrics)
+	}
+	var ws *watchStatus
+	if cfg.HTTPAddr != "" {
+		ws = newWatchStatus()
+		handle(cfg.HTTPAddr, "/healthz", http.HandlerFunc(ws.healthz))
+		handle(cfg.HTTPAddr, "/sync", http.HandlerFunc(ws.sync))
+	}
+	for addr, mux := range muxes {
+		srv := &http.Server{Addr: addr, Handler: mux}
+		go func() { log.Fatal(srv.ListenAndServe()) }()
+	}
+	if err := s.watch(ctx, cfg.Interval, ws); err != nil && err != context.Canceled {
+		log.Fatal(err)
+	}
 }
 
-func runningInstances(ctx context.Context, svc *ec2.EC2) ([]*ec2.Instance, error) {
-	resp, err := svc.DescribeInstancesWithContext(ctx, &ec2.DescribeInstancesInput{
-		Filters: []*ec2.Filter{{
-			Name:   aws.String("instance-state-name"),
-			Values: []*string{aws.String("running")},
-		}},
-	})
+// lambdaSetup returns syncer configured from environment variables and
+// settings stored in SSM Parameter Store, if CONFIG_SSM_PATH is set
+func lambdaSetup(cfg *config) (*syncer, error) {
+	// partition is needed to reach Parameter Store, so it is only taken
+	// from environment
+	sessCfg := *cfg
+	sessCfg.Partition = os.Getenv("PARTITION")
+	sess, err := newSession(sessCfg, os.Getenv)
 	if err != nil {
 		return nil, err
 	}
-	var out []*ec2.Instance
-	for _, r := range resp.Reservations {
-		for _, inst := range r.Instances {
-			if inst.InstanceLifecycle != nil {
-				continue // skip spot instances
+	getenv := os.Getenv
+	if name := os.Getenv("CONFIG_SSM_PATH"); name != "" {
+		params, err := loadSSMConfig(context.Background(), ssm.New(sess), name)
+		if err != nil {
+			return nil, err
+		}
+		getenv = func(key string) string {
+			if v, ok := params[key]; ok {
+				return v
 			}
-			out = append(out, inst)
+			return os.Getenv(key)
 		}
 	}
-	return out, nil
-}
-
-func valid(name string) bool {
-	if name == "" {
-		return false
-	}
-	for _, r := range name {
-		switch {
-		case 'a' <= r && r <= 'z':
-		case 'A' <= r && r <= 'Z':
-		case '0' <= r && r <= '9':
-		case r == '-':
-		default:
-			return false
-		}
+	if err := cfg.loadEnv(getenv); err != nil {
+		return nil, err
 	}
-	return true
+	return setup(context.Background(), sess, *cfg)
 }
 
 func init() { log.SetFlags(0) }
@@ -0,0 +1,1096 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+func TestReconcile(t *testing.T) {
+	const suffix = ".foo.example.com"
+	table := []struct {
+		name      string
+		instances []*ec2.Instance
+		records   []string // "name type value" triples
+		invoker   string
+		prefer    string
+		keep      bool     // keepStopped
+		want      []string // resulting zone state, same format as records
+		wantErr   bool
+	}{
+		{
+			name: "upsert",
+			instances: []*ec2.Instance{
+				testInstance("i-1", "jenkins", "ec2-1-2-3-4.compute.amazonaws.com", "1.2.3.4"),
+				testInstance("i-2", "db", "", "5.6.7.8"),
+			},
+			want: []string{
+				"db.foo.example.com. A 5.6.7.8",
+				"jenkins.foo.example.com. CNAME ec2-1-2-3-4.compute.amazonaws.com",
+			},
+		},
+		{
+			name: "delete stale",
+			instances: []*ec2.Instance{
+				testInstance("i-1", "jenkins", "", "1.2.3.4"),
+			},
+			records: []string{
+				"jenkins.foo.example.com. A 9.9.9.9",
+				"old.foo.example.com. A 1.1.1.1",
+				"older.foo.example.com. CNAME ec2-1-1-1-1.compute.amazonaws.com",
+			},
+			want: []string{
+				"jenkins.foo.example.com. A 1.2.3.4",
+			},
+		},
+		{
+			name: "suffix mismatch",
+			instances: []*ec2.Instance{
+				testInstance("i-1", "jenkins", "", "1.2.3.4"),
+			},
+			records: []string{
+				"foo.example.com. A 2.2.2.2",
+				"www.example.com. A 3.3.3.3",
+				"www.bar.example.com. CNAME example.org",
+				"mail.foo.example.com. MX 10 mx.example.com",
+			},
+			want: []string{
+				"foo.example.com. A 2.2.2.2",
+				"jenkins.foo.example.com. A 1.2.3.4",
+				"mail.foo.example.com. MX 10 mx.example.com",
+				"www.bar.example.com. CNAME example.org",
+				"www.example.com. A 3.3.3.3",
+			},
+		},
+		{
+			name: "record type tag",
+			instances: []*ec2.Instance{
+				withTag(testInstance("i-1", "jenkins", "ec2-1-2-3-4.compute.amazonaws.com", "1.2.3.4"), recordTypeTag, "a"),
+				withTag(testInstance("i-2", "db", "ec2-5-6-7-8.compute.amazonaws.com", "5.6.7.8"), recordTypeTag, "CNAME"),
+				withTag(testInstance("i-3", "noname", "", "9.9.9.9"), recordTypeTag, "CNAME"),
+				withTag(testInstance("i-4", "web", "ec2-4-4-4-4.compute.amazonaws.com", "4.4.4.4"), recordTypeTag, "AAAA"),
+			},
+			want: []string{
+				"db.foo.example.com. CNAME ec2-5-6-7-8.compute.amazonaws.com",
+				"jenkins.foo.example.com. A 1.2.3.4",
+				"web.foo.example.com. CNAME ec2-4-4-4-4.compute.amazonaws.com",
+			},
+		},
+		{
+			name: "target tag",
+			instances: []*ec2.Instance{
+				withTag(testInstance("i-1", "web", "ec2-1-2-3-4.compute.amazonaws.com", "1.2.3.4"),
+					targetTag, "D111.cloudfront.net."),
+				withTag(withTag(testInstance("i-2", "api", "", "5.6.7.8"), targetTag, "75.2.60.5"),
+					recordTypeTag, "CNAME"),
+				withTag(testInstance("i-3", "bad", "", "3.3.3.3"), targetTag, "not a host!"),
+				withTag(testInstance("i-4", "noaddr", "", ""), targetTag, "app.example.org"),
+			},
+			want: []string{
+				"api.foo.example.com. A 75.2.60.5",
+				"bad.foo.example.com. A 3.3.3.3",
+				"noaddr.foo.example.com. CNAME app.example.org",
+				"web.foo.example.com. CNAME d111.cloudfront.net",
+			},
+		},
+		{
+			name: "skip spot, stopped and invalid names",
+			instances: []*ec2.Instance{
+				testInstance("i-1", "jenkins", "", "1.2.3.4"),
+				spot(testInstance("i-2", "spot", "", "1.1.1.1")),
+				stopped(testInstance("i-3", "stopped", "", "2.2.2.2")),
+				testInstance("i-4", "bad_name", "", "3.3.3.3"),
+				testInstance("i-5", "noaddr", "", ""),
+			},
+			want: []string{
+				"jenkins.foo.example.com. A 1.2.3.4",
+			},
+		},
+		{
+			name: "invoked by spot instance",
+			instances: []*ec2.Instance{
+				testInstance("i-1", "jenkins", "", "1.2.3.4"),
+				spot(testInstance("i-2", "spot", "", "1.1.1.1")),
+			},
+			records: []string{"old.foo.example.com. A 1.1.1.1"},
+			invoker: "i-2",
+			want:    []string{"old.foo.example.com. A 1.1.1.1"},
+		},
+		{
+			name: "elastic IP",
+			instances: []*ec2.Instance{
+				withEIP(testInstance("i-1", "jenkins", "ec2-1-2-3-4.compute.amazonaws.com", ""), "1.2.3.4"),
+				withTag(withEIP(testInstance("i-2", "db", "ec2-5-6-7-8.compute.amazonaws.com", ""), "5.6.7.8"),
+					recordTypeTag, "CNAME"),
+			},
+			want: []string{
+				"db.foo.example.com. CNAME ec2-5-6-7-8.compute.amazonaws.com",
+				"jenkins.foo.example.com. A 1.2.3.4",
+			},
+		},
+		{
+			name: "ignored instances",
+			instances: []*ec2.Instance{
+				testInstance("i-1", "jenkins", "", "1.2.3.4"),
+				withTag(testInstance("i-2", "pet", "", "5.6.7.8"), defaultIgnoreTag, "true"),
+				testInstance("i-3", "pet", "", "9.9.9.9"),
+				withTag(testInstance("i-4", "other", "", "4.4.4.4"), defaultIgnoreTag, "false"),
+			},
+			records: []string{
+				"pet.foo.example.com. A 1.1.1.1",
+				"old.foo.example.com. A 2.2.2.2",
+			},
+			want: []string{
+				"jenkins.foo.example.com. A 1.2.3.4",
+				"other.foo.example.com. A 4.4.4.4",
+				"pet.foo.example.com. A 1.1.1.1",
+			},
+		},
+		{
+			name: "prefer A",
+			instances: []*ec2.Instance{
+				testInstance("i-1", "jenkins", "ec2-1-2-3-4.compute.amazonaws.com", "1.2.3.4"),
+				withTag(testInstance("i-2", "db", "ec2-5-6-7-8.compute.amazonaws.com", "5.6.7.8"),
+					recordTypeTag, "CNAME"),
+			},
+			prefer: "A",
+			want: []string{
+				"db.foo.example.com. CNAME ec2-5-6-7-8.compute.amazonaws.com",
+				"jenkins.foo.example.com. A 1.2.3.4",
+			},
+		},
+		{
+			name: "prefer CNAME",
+			instances: []*ec2.Instance{
+				withEIP(testInstance("i-1", "jenkins", "ec2-1-2-3-4.compute.amazonaws.com", ""), "1.2.3.4"),
+				testInstance("i-2", "db", "", "5.6.7.8"),
+			},
+			prefer: "CNAME",
+			want: []string{
+				"jenkins.foo.example.com. CNAME ec2-1-2-3-4.compute.amazonaws.com",
+			},
+		},
+		{
+			name: "keep stopped",
+			instances: []*ec2.Instance{
+				testInstance("i-1", "jenkins", "", "1.2.3.4"),
+				stopped(testInstance("i-2", "db", "", "")),
+				stopped(withEIP(testInstance("i-3", "ci", "", ""), "3.3.3.3")),
+				stopped(testInstance("i-4", "jenkins", "", "")),
+			},
+			records: []string{
+				"db.foo.example.com. A 5.6.7.8",
+				"ci.foo.example.com. CNAME ec2-9-9-9-9.compute.amazonaws.com",
+				"jenkins.foo.example.com. A 4.4.4.4",
+				"old.foo.example.com. A 1.1.1.1",
+			},
+			keep: true,
+			want: []string{
+				"ci.foo.example.com. A 3.3.3.3",
+				"db.foo.example.com. A 5.6.7.8",
+				"jenkins.foo.example.com. A 1.2.3.4",
+			},
+		},
+		{
+			name:    "no instances",
+			records: []string{"old.foo.example.com. A 1.1.1.1"},
+			want:    []string{"old.foo.example.com. A 1.1.1.1"},
+		},
+	}
+	for _, tc := range table {
+		t.Run(tc.name, func(t *testing.T) {
+			r53svc := newFakeRoute53(t, tc.records...)
+			s := &syncer{
+				ec2:         &fakeEC2{instances: tc.instances},
+				r53:         r53svc,
+				suffix:      suffix,
+				zoneID:      "Z1",
+				ignoreTag:   defaultIgnoreTag,
+				prefer:      tc.prefer,
+				keepStopped: tc.keep,
+			}
+			err := s.reconcile(context.Background(), tc.invoker)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("got error %v, wantErr=%v", err, tc.wantErr)
+			}
+			if got := r53svc.dump(); !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s",
+					strings.Join(got, "\n"), strings.Join(tc.want, "\n"))
+			}
+		})
+	}
+}
+
+func testInstance(id, name, dnsName, ip string) *ec2.Instance {
+	inst := &ec2.Instance{
+		InstanceId: aws.String(id),
+		State:      &ec2.InstanceState{Name: aws.String(ec2.InstanceStateNameRunning)},
+		Tags:       []*ec2.Tag{{Key: aws.String("Name"), Value: aws.String(name)}},
+	}
+	if dnsName != "" {
+		inst.PublicDnsName = aws.String(dnsName)
+	}
+	if ip != "" {
+		inst.PublicIpAddress = aws.String(ip)
+	}
+	return inst
+}
+
+// withTag adds tag to the instance
+func withTag(inst *ec2.Instance, key, value string) *ec2.Instance {
+	inst.Tags = append(inst.Tags, &ec2.Tag{Key: aws.String(key), Value: aws.String(value)})
+	return inst
+}
+
+// withEIP associates elastic IP with the primary network interface of the
+// instance
+func withEIP(inst *ec2.Instance, ip string) *ec2.Instance {
+	inst.PublicIpAddress = aws.String(ip)
+	inst.NetworkInterfaces = append(inst.NetworkInterfaces, &ec2.InstanceNetworkInterface{
+		Association: &ec2.InstanceNetworkInterfaceAssociation{
+			IpOwnerId: aws.String("123456789012"),
+			PublicIp:  aws.String(ip),
+		},
+		Attachment: &ec2.InstanceNetworkInterfaceAttachment{DeviceIndex: aws.Int64(0)},
+	})
+	return inst
+}
+
+func spot(inst *ec2.Instance) *ec2.Instance {
+	inst.InstanceLifecycle = aws.String(ec2.InstanceLifecycleTypeSpot)
+	return inst
+}
+
+func stopped(inst *ec2.Instance) *ec2.Instance {
+	inst.State.Name = aws.String(ec2.InstanceStateNameStopped)
+	return inst
+}
+
+// fakeEC2 is an in-memory implementation of ec2Client
+type fakeEC2 struct {
+	instances []*ec2.Instance
+}
+
+func (f *fakeEC2) DescribeInstancesWithContext(_ aws.Context, in *ec2.DescribeInstancesInput, _ ...request.Option) (*ec2.DescribeInstancesOutput, error) {
+	var out []*ec2.Instance
+	for _, id := range in.InstanceIds {
+		var found bool
+		for _, inst := range f.instances {
+			found = found || aws.StringValue(inst.InstanceId) == aws.StringValue(id)
+		}
+		if !found {
+			// like EC2 does for instances terminated a while ago
+			return nil, awserr.New("InvalidInstanceID.NotFound",
+				fmt.Sprintf("The instance ID '%s' does not exist", aws.StringValue(id)), nil)
+		}
+	}
+	for _, inst := range f.instances {
+		if len(in.InstanceIds) != 0 && !containsString(in.InstanceIds, aws.StringValue(inst.InstanceId)) {
+			continue
+		}
+		if matchFilters(inst, in.Filters) {
+			out = append(out, inst)
+		}
+	}
+	var next *string
+	if in.MaxResults != nil {
+		// page tokens are offsets into the filtered list
+		start, _ := strconv.Atoi(aws.StringValue(in.NextToken))
+		out = out[start:]
+		if n := int(*in.MaxResults); len(out) > n {
+			out, next = out[:n], aws.String(strconv.Itoa(start+n))
+		}
+	}
+	return &ec2.DescribeInstancesOutput{
+		Reservations: []*ec2.Reservation{{Instances: out}},
+		NextToken:    next,
+	}, nil
+}
+
+func matchFilters(inst *ec2.Instance, filters []*ec2.Filter) bool {
+	for _, f := range filters {
+		var val string
+		switch name := aws.StringValue(f.Name); {
+		case name == "instance-state-name":
+			val = aws.StringValue(inst.State.Name)
+		case name == "vpc-id":
+			val = aws.StringValue(inst.VpcId)
+		case name == "subnet-id":
+			val = aws.StringValue(inst.SubnetId)
+		case name == "tag-key":
+			for _, tag := range inst.Tags {
+				if containsString(f.Values, aws.StringValue(tag.Key)) {
+					val = aws.StringValue(tag.Key)
+				}
+			}
+		case strings.HasPrefix(name, "tag:"):
+			for _, tag := range inst.Tags {
+				if aws.StringValue(tag.Key) == name[len("tag:"):] {
+					val = aws.StringValue(tag.Value)
+				}
+			}
+		default:
+			panic("fakeEC2: unsupported filter " + name)
+		}
+		if !containsString(f.Values, val) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(list []*string, s string) bool {
+	for _, v := range list {
+		if aws.StringValue(v) == s {
+			return true
+		}
+	}
+	return false
+}
+
+// fakeRoute53 is an in-memory implementation of route53Client holding
+// records of a single zone
+type fakeRoute53 struct {
+	mu       sync.Mutex                            // guards records, batches and comments
+	records  map[string]*route53.ResourceRecordSet // keyed by recordKey
+	batches  [][]*route53.Change
+	comments []string // of change batches
+	zones    []*route53.HostedZone
+	waited   []string // ids of changes waited for
+	listed   int      // number of record sets served by listings
+
+	nameServers []string       // of delegation set returned by GetHostedZone
+	vpcs        []*route53.VPC // associated with private zones returned by GetHostedZone
+
+	healthChecks []*route53.HealthCheck
+	lastCheckID  int
+}
+
+// newFakeRoute53 returns fakeRoute53 populated with records, each in
+// "name type value" form
+func newFakeRoute53(t *testing.T, records ...string) *fakeRoute53 {
+	f := &fakeRoute53{records: make(map[string]*route53.ResourceRecordSet)}
+	for _, s := range records {
+		fields := strings.SplitN(s, " ", 3)
+		if len(fields) != 3 {
+			t.Fatalf("invalid record %q", s)
+		}
+		f.add(&route53.ResourceRecordSet{
+			Name:            aws.String(fields[0]),
+			Type:            aws.String(fields[1]),
+			TTL:             aws.Int64(60),
+			ResourceRecords: []*route53.ResourceRecord{{Value: aws.String(fields[2])}},
+		})
+	}
+	return f
+}
+
+// add adds record set to the zone
+func (f *fakeRoute53) add(rr *route53.ResourceRecordSet) {
+	f.records[recordKey(rr)] = rr
+}
+
+func (f *fakeRoute53) ListResourceRecordSetsPagesWithContext(_ aws.Context, in *route53.ListResourceRecordSetsInput, fn func(*route53.ListResourceRecordSetsOutput, bool) bool, _ ...request.Option) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	less := func(a, b *route53.ResourceRecordSet) bool {
+		if x, y := r53order(aws.StringValue(a.Name)), r53order(aws.StringValue(b.Name)); x != y {
+			return x < y
+		}
+		if x, y := aws.StringValue(a.Type), aws.StringValue(b.Type); x != y {
+			return x < y
+		}
+		return aws.StringValue(a.SetIdentifier) < aws.StringValue(b.SetIdentifier)
+	}
+	start := &route53.ResourceRecordSet{Name: in.StartRecordName, Type: in.StartRecordType, SetIdentifier: in.StartRecordIdentifier}
+	var keys []string
+	for k, rr := range f.records {
+		if in.StartRecordName != nil && less(rr, start) {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return less(f.records[keys[i]], f.records[keys[j]]) })
+	// serve one record per page to exercise pagination
+	for i, k := range keys {
+		rr := *f.records[k]
+		f.listed++
+		page := &route53.ListResourceRecordSetsOutput{
+			ResourceRecordSets: []*route53.ResourceRecordSet{&rr},
+		}
+		if i < len(keys)-1 {
+			next := f.records[keys[i+1]]
+			page.IsTruncated = aws.Bool(true)
+			page.NextRecordName, page.NextRecordType, page.NextRecordIdentifier = next.Name, next.Type, next.SetIdentifier
+		}
+		if !fn(page, i == len(keys)-1) {
+			break
+		}
+	}
+	return nil
+}
+
+func (f *fakeRoute53) ChangeResourceRecordSetsWithContext(_ aws.Context, in *route53.ChangeResourceRecordSetsInput, _ ...request.Option) (*route53.ChangeResourceRecordSetsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.batches = append(f.batches, in.ChangeBatch.Changes)
+	f.comments = append(f.comments, aws.StringValue(in.ChangeBatch.Comment))
+	for _, ch := range in.ChangeBatch.Changes {
+		rr := *ch.ResourceRecordSet
+		if name := aws.StringValue(rr.Name); !strings.HasSuffix(name, ".") {
+			rr.Name = aws.String(name + ".")
+		}
+		// like Route 53, return names with characters other than
+		// a-z, 0-9, "-", "_" and "." escaped
+		rr.Name = aws.String(r53escape(*rr.Name))
+		key := recordKey(&rr)
+		switch action := aws.StringValue(ch.Action); action {
+		case route53.ChangeActionUpsert:
+			f.records[key] = &rr
+		case route53.ChangeActionCreate:
+			if _, ok := f.records[key]; ok {
+				return nil, fmt.Errorf("fakeRoute53: creating already existing record %q", key)
+			}
+			f.records[key] = &rr
+		case route53.ChangeActionDelete:
+			if _, ok := f.records[key]; !ok {
+				return nil, fmt.Errorf("fakeRoute53: deleting non-existent record %q", key)
+			}
+			delete(f.records, key)
+		default:
+			return nil, fmt.Errorf("fakeRoute53: unsupported action %q", action)
+		}
+	}
+	return &route53.ChangeResourceRecordSetsOutput{
+		ChangeInfo: &route53.ChangeInfo{Id: aws.String(fmt.Sprintf("/change/C%d", len(f.batches)))},
+	}, nil
+}
+
+// r53escape returns name as listed by Route 53: lowercased, with characters
+// other than a-z, 0-9, "-", "_" and "." octal-escaped, whether they were
+// escaped in the request or not
+func r53escape(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c == '\\' && i+3 < len(name) {
+			n, err := strconv.ParseUint(name[i+1:i+4], 8, 8)
+			if err == nil && (n == '.' || n == '\\') {
+				// escaped dot or backslash are part of the label
+				b.WriteString(name[i : i+4])
+				i += 3
+				continue
+			}
+			if err == nil {
+				c, i = byte(n), i+3
+			}
+		}
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		switch {
+		case 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "\\%03o", c)
+		}
+	}
+	return b.String()
+}
+
+func (f *fakeRoute53) ListHostedZonesByNameWithContext(_ aws.Context, in *route53.ListHostedZonesByNameInput, _ ...request.Option) (*route53.ListHostedZonesByNameOutput, error) {
+	zones := append([]*route53.HostedZone(nil), f.zones...)
+	sort.SliceStable(zones, func(i, j int) bool {
+		return r53order(aws.StringValue(zones[i].Name)) < r53order(aws.StringValue(zones[j].Name))
+	})
+	// serve one zone per page to exercise pagination
+	for i, z := range zones {
+		if in.DNSName != nil && r53order(aws.StringValue(z.Name)) < r53order(*in.DNSName) {
+			continue
+		}
+		if in.HostedZoneId != nil && aws.StringValue(z.Id) != *in.HostedZoneId {
+			continue
+		}
+		out := &route53.ListHostedZonesByNameOutput{HostedZones: []*route53.HostedZone{z}}
+		if i < len(zones)-1 {
+			out.IsTruncated = aws.Bool(true)
+			out.NextDNSName, out.NextHostedZoneId = zones[i+1].Name, zones[i+1].Id
+		}
+		return out, nil
+	}
+	return &route53.ListHostedZonesByNameOutput{}, nil
+}
+
+func (f *fakeRoute53) GetHostedZoneWithContext(_ aws.Context, in *route53.GetHostedZoneInput, _ ...request.Option) (*route53.GetHostedZoneOutput, error) {
+	for _, z := range f.zones {
+		if strings.TrimPrefix(aws.StringValue(z.Id), "/hostedzone/") == strings.TrimPrefix(aws.StringValue(in.Id), "/hostedzone/") {
+			out := &route53.GetHostedZoneOutput{HostedZone: z}
+			if len(f.nameServers) != 0 {
+				out.DelegationSet = &route53.DelegationSet{NameServers: aws.StringSlice(f.nameServers)}
+			}
+			if z.Config != nil && aws.BoolValue(z.Config.PrivateZone) {
+				out.VPCs = f.vpcs
+			}
+			return out, nil
+		}
+	}
+	return nil, awserr.New(route53.ErrCodeNoSuchHostedZone, "no such hosted zone", nil)
+}
+
+func (f *fakeRoute53) WaitUntilResourceRecordSetsChangedWithContext(_ aws.Context, in *route53.GetChangeInput, _ ...request.WaiterOption) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.waited = append(f.waited, aws.StringValue(in.Id))
+	return nil
+}
+
+func (f *fakeRoute53) ListHealthChecksPagesWithContext(_ aws.Context, _ *route53.ListHealthChecksInput, fn func(*route53.ListHealthChecksOutput, bool) bool, _ ...request.Option) error {
+	// serve one health check per page to exercise pagination
+	for i, hc := range f.healthChecks {
+		if !fn(&route53.ListHealthChecksOutput{HealthChecks: []*route53.HealthCheck{hc}}, i == len(f.healthChecks)-1) {
+			break
+		}
+	}
+	return nil
+}
+
+func (f *fakeRoute53) CreateHealthCheckWithContext(_ aws.Context, in *route53.CreateHealthCheckInput, _ ...request.Option) (*route53.CreateHealthCheckOutput, error) {
+	f.lastCheckID++
+	hc := &route53.HealthCheck{
+		Id:                aws.String(fmt.Sprintf("hc-%d", f.lastCheckID)),
+		CallerReference:   in.CallerReference,
+		HealthCheckConfig: in.HealthCheckConfig,
+	}
+	f.healthChecks = append(f.healthChecks, hc)
+	return &route53.CreateHealthCheckOutput{HealthCheck: hc}, nil
+}
+
+func (f *fakeRoute53) DeleteHealthCheckWithContext(_ aws.Context, in *route53.DeleteHealthCheckInput, _ ...request.Option) (*route53.DeleteHealthCheckOutput, error) {
+	id := aws.StringValue(in.HealthCheckId)
+	for _, rr := range f.records {
+		if aws.StringValue(rr.HealthCheckId) == id {
+			return nil, awserr.New(route53.ErrCodeHealthCheckInUse, "health check is in use", nil)
+		}
+	}
+	for i, hc := range f.healthChecks {
+		if aws.StringValue(hc.Id) == id {
+			f.healthChecks = append(f.healthChecks[:i], f.healthChecks[i+1:]...)
+			return &route53.DeleteHealthCheckOutput{}, nil
+		}
+	}
+	return nil, awserr.New(route53.ErrCodeNoSuchHealthCheck, "no such health check", nil)
+}
+
+// r53order returns key to sort record names the way Route 53 does: by labels
+// in reverse order
+func r53order(name string) string {
+	labels := strings.Split(strings.TrimSuffix(name, "."), ".")
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+	return strings.Join(labels, "\x00")
+}
+
+// dump returns sorted zone records in "name type value" form; records of
+// record sets with set identifier have " set=id" appended, followed by
+// routing policy attributes, if any
+func (f *fakeRoute53) dump() []string {
+	var out []string
+	for _, rr := range f.records {
+		var extra string
+		if rr.SetIdentifier != nil {
+			extra += " set=" + *rr.SetIdentifier
+		}
+		if rr.Weight != nil {
+			extra += fmt.Sprintf(" weight=%d", *rr.Weight)
+		}
+		if aws.BoolValue(rr.MultiValueAnswer) {
+			extra += " multivalue"
+		}
+		if rr.Failover != nil {
+			extra += " failover=" + *rr.Failover
+		}
+		if rr.Region != nil {
+			extra += " region=" + *rr.Region
+		}
+		if rr.GeoLocation != nil {
+			extra += " geo=" + geoLocationString(rr.GeoLocation)
+		}
+		if rr.HealthCheckId != nil {
+			extra += " hc=" + *rr.HealthCheckId
+		}
+		for _, v := range rr.ResourceRecords {
+			out = append(out, fmt.Sprintf("%s %s %s%s", aws.StringValue(rr.Name), aws.StringValue(rr.Type),
+				aws.StringValue(v.Value), extra))
+		}
+		if at := rr.AliasTarget; at != nil {
+			out = append(out, fmt.Sprintf("%s %s alias=%s/%s%s", aws.StringValue(rr.Name), aws.StringValue(rr.Type),
+				aws.StringValue(at.HostedZoneId), aws.StringValue(at.DNSName), extra))
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestReconcile_weighted(t *testing.T) {
+	r53svc := newFakeRoute53(t, "web.foo.example.com. A 9.9.9.9")
+	ec2svc := &fakeEC2{instances: []*ec2.Instance{
+		testInstance("i-2", "web", "ec2-5-6-7-8.compute.amazonaws.com", "5.6.7.8"),
+		testInstance("i-1", "web", "", "1.2.3.4"),
+		testInstance("i-3", "db", "", "3.3.3.3"),
+	}}
+	s := &syncer{
+		ec2:         ec2svc,
+		r53:         r53svc,
+		suffix:      ".foo.example.com",
+		zoneID:      "Z1",
+		groupPolicy: groupWeighted,
+	}
+	if err := s.reconcile(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"db.foo.example.com. A 3.3.3.3",
+		"web.foo.example.com. A 1.2.3.4 set=i-1 weight=1",
+		"web.foo.example.com. A 5.6.7.8 set=i-2 weight=1",
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// terminated group member only loses its own record set
+	ec2svc.instances[1] = stateOf(ec2svc.instances[1], ec2.InstanceStateNameTerminated)
+	if err := s.removeInstance(context.Background(), "i-1"); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{
+		"db.foo.example.com. A 3.3.3.3",
+		"web.foo.example.com. A 5.6.7.8 set=i-2 weight=1",
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// single instance left gets a regular record
+	if err := s.reconcile(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{
+		"db.foo.example.com. A 3.3.3.3",
+		"web.foo.example.com. CNAME ec2-5-6-7-8.compute.amazonaws.com",
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestReconcile_multivalue(t *testing.T) {
+	r53svc := newFakeRoute53(t)
+	s := &syncer{
+		ec2: &fakeEC2{instances: []*ec2.Instance{
+			testInstance("i-1", "web", "ec2-1-2-3-4.compute.amazonaws.com", "1.2.3.4"),
+			testInstance("i-2", "web", "ec2-5-6-7-8.compute.amazonaws.com", "5.6.7.8"),
+			testInstance("i-3", "web", "ec2-9-9-9-9.compute.amazonaws.com", ""),
+			testInstance("i-4", "db", "ec2-3-3-3-3.compute.amazonaws.com", "3.3.3.3"),
+		}},
+		r53:         r53svc,
+		suffix:      ".foo.example.com",
+		zoneID:      "Z1",
+		groupPolicy: groupMultivalue,
+	}
+	if err := s.reconcile(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"db.foo.example.com. CNAME ec2-3-3-3-3.compute.amazonaws.com",
+		"web.foo.example.com. A 1.2.3.4 set=i-1 multivalue",
+		"web.foo.example.com. A 5.6.7.8 set=i-2 multivalue",
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestListRecords_scoped(t *testing.T) {
+	r53svc := newFakeRoute53(t,
+		"a.example.com. A 1.1.1.1",
+		"web.foo.example.com. A 1.2.3.4",
+		"x.y.foo.example.com. A 5.6.7.8",
+		"foo-bar.example.com. A 2.2.2.2",
+		"zz.example.com. A 3.3.3.3",
+	)
+	s := &syncer{r53: r53svc, suffix: ".foo.example.com", zoneID: "Z1"}
+	records, err := s.listRecords(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+	// listing starts at suffix and stops at the first name past it
+	if r53svc.listed != 3 {
+		t.Fatalf("listing served %d record sets, want 3", r53svc.listed)
+	}
+}
+
+func TestInstanceTTL(t *testing.T) {
+	table := []struct {
+		tag  string
+		want int64
+	}{
+		{tag: "", want: defaultTTL},
+		{tag: "3600", want: 3600},
+		{tag: "0", want: 0},
+		{tag: "172801", want: defaultTTL},
+		{tag: "-1", want: defaultTTL},
+		{tag: "1h", want: defaultTTL},
+	}
+	for _, tc := range table {
+		inst := testInstance("i-1", "web", "", "1.2.3.4")
+		if tc.tag != "" {
+			withTag(inst, ttlTag, tc.tag)
+		}
+		s := &syncer{ttl: defaultTTL}
+		if got := s.instanceTTL(inst); got != tc.want {
+			t.Errorf("tag %q: got TTL %d, want %d", tc.tag, got, tc.want)
+		}
+	}
+}
+
+func TestReconcile_ttlDrift(t *testing.T) {
+	r53svc := newFakeRoute53(t, "web.foo.example.com. A 1.2.3.4", "db.foo.example.com. A 5.6.7.8")
+	s := &syncer{
+		ec2: &fakeEC2{instances: []*ec2.Instance{
+			testInstance("i-1", "web", "", "1.2.3.4"),
+			withTag(testInstance("i-2", "db", "", "5.6.7.8"), ttlTag, "60"),
+		}},
+		r53:    r53svc,
+		suffix: ".foo.example.com",
+		zoneID: "Z1",
+		ttl:    300,
+	}
+	if err := s.reconcile(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]int64)
+	for _, rr := range r53svc.records {
+		got[aws.StringValue(rr.Name)] = aws.Int64Value(rr.TTL)
+	}
+	want := map[string]int64{"web.foo.example.com.": 300, "db.foo.example.com.": 60}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got TTLs %v, want %v", got, want)
+	}
+}
+
+func TestReconcile_requireEIP(t *testing.T) {
+	auto := testInstance("i-2", "db", "ec2-5-6-7-8.compute.amazonaws.com", "5.6.7.8")
+	auto.NetworkInterfaces = []*ec2.InstanceNetworkInterface{{
+		Association: &ec2.InstanceNetworkInterfaceAssociation{
+			IpOwnerId: aws.String("amazon"),
+			PublicIp:  aws.String("5.6.7.8"),
+		},
+	}}
+	r53svc := newFakeRoute53(t, "db.foo.example.com. CNAME ec2-5-6-7-8.compute.amazonaws.com")
+	s := &syncer{
+		ec2: &fakeEC2{instances: []*ec2.Instance{
+			withEIP(testInstance("i-1", "web", "", ""), "1.2.3.4"),
+			auto,
+		}},
+		r53:        r53svc,
+		suffix:     ".foo.example.com",
+		zoneID:     "Z1",
+		requireEIP: true,
+	}
+	var st runStats
+	if err := s.update(context.Background(), "", &st); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"web.foo.example.com. A 1.2.3.4"}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if st.Skipped != 1 {
+		t.Fatalf("got %d skipped instances, want 1", st.Skipped)
+	}
+}
+
+func TestReconcile_minAge(t *testing.T) {
+	launched := func(inst *ec2.Instance, ago time.Duration) *ec2.Instance {
+		inst.LaunchTime = aws.Time(time.Now().Add(-ago))
+		return inst
+	}
+	r53svc := newFakeRoute53(t,
+		"ci.foo.example.com. A 3.3.3.3",
+		"gone.foo.example.com. A 4.4.4.4",
+	)
+	s := &syncer{
+		ec2: &fakeEC2{instances: []*ec2.Instance{
+			launched(testInstance("i-1", "web", "", "1.2.3.4"), time.Hour),
+			launched(testInstance("i-2", "db", "", ""), 10*time.Second),
+			launched(testInstance("i-3", "ci", "", ""), 10*time.Second),
+		}},
+		r53:    r53svc,
+		suffix: ".foo.example.com",
+		zoneID: "Z1",
+		minAge: 90 * time.Second,
+	}
+	if err := s.update(context.Background(), "", new(runStats)); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"ci.foo.example.com. A 3.3.3.3",
+		"web.foo.example.com. A 1.2.3.4",
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestReconcile_summary(t *testing.T) {
+	r53svc := newFakeRoute53(t, "old.foo.example.com. A 9.9.9.9")
+	var buf bytes.Buffer
+	s := &syncer{
+		ec2: &fakeEC2{instances: []*ec2.Instance{
+			testInstance("i-1", "web", "", "1.2.3.4"),
+			testInstance("i-2", "db", "", ""),
+			testInstance("i-3", "bad name", "", "5.6.7.8"),
+		}},
+		r53:     r53svc,
+		suffix:  ".foo.example.com",
+		zoneID:  "Z1",
+		summary: &buf,
+	}
+	var st runStats
+	err := s.update(context.Background(), "", &st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Duration = 1500 * time.Millisecond
+	s.report(context.Background(), st, err)
+	want := `{"zone_id":"Z1","instances":3,"upserted":1,"deleted":1,"skipped":[` +
+		`{"instance_id":"i-2","name":"db","reason":"no public address"},` +
+		`{"instance_id":"i-3","name":"bad name","reason":"invalid name"}],` +
+		`"change_ids":["/change/C1"],"duration_seconds":1.5}` + "\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("got summary\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestReconcile_allAddresses(t *testing.T) {
+	multi := testInstance("i-1", "web", "ec2-1-2-3-4.compute.amazonaws.com", "1.2.3.4")
+	multi.NetworkInterfaces = []*ec2.InstanceNetworkInterface{
+		{
+			Association: &ec2.InstanceNetworkInterfaceAssociation{PublicIp: aws.String("1.2.3.4")},
+			PrivateIpAddresses: []*ec2.InstancePrivateIpAddress{
+				{Association: &ec2.InstanceNetworkInterfaceAssociation{PublicIp: aws.String("1.2.3.4")}},
+				{Association: &ec2.InstanceNetworkInterfaceAssociation{PublicIp: aws.String("1.2.3.5")}},
+				{PrivateIpAddress: aws.String("10.0.0.2")},
+			},
+		},
+		{Association: &ec2.InstanceNetworkInterfaceAssociation{PublicIp: aws.String("5.6.7.8")}},
+		{PrivateIpAddress: aws.String("10.0.1.1")},
+	}
+	ec2svc := &fakeEC2{instances: []*ec2.Instance{
+		multi,
+		testInstance("i-2", "db", "ec2-9-9-9-9.compute.amazonaws.com", "9.9.9.9"),
+	}}
+	r53svc := newFakeRoute53(t)
+	s := &syncer{
+		ec2:          ec2svc,
+		r53:          r53svc,
+		suffix:       ".foo.example.com",
+		zoneID:       "Z1",
+		allAddresses: true,
+	}
+	ctx := context.Background()
+	if err := s.reconcile(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"db.foo.example.com. CNAME ec2-9-9-9-9.compute.amazonaws.com",
+		"web.foo.example.com. A 1.2.3.4",
+		"web.foo.example.com. A 1.2.3.5",
+		"web.foo.example.com. A 5.6.7.8",
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	// after rename, multi-value record under the old name is removed
+	multi.Tags[0].Value = aws.String("www")
+	if err := s.renameInstance(ctx, "i-1"); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{
+		"db.foo.example.com. CNAME ec2-9-9-9-9.compute.amazonaws.com",
+		"www.foo.example.com. A 1.2.3.4",
+		"www.foo.example.com. A 1.2.3.5",
+		"www.foo.example.com. A 5.6.7.8",
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestRenameInstance_ignored(t *testing.T) {
+	// ignored instance took over the address of the renamed one
+	r53svc := newFakeRoute53(t,
+		"web.foo.example.com. A 1.2.3.4",
+		"legacy.foo.example.com. A 1.2.3.4",
+	)
+	s := &syncer{
+		ec2: &fakeEC2{instances: []*ec2.Instance{
+			testInstance("i-1", "www", "", "1.2.3.4"),
+			withTag(testInstance("i-2", "legacy", "", "5.6.7.8"), defaultIgnoreTag, "true"),
+		}},
+		r53:       r53svc,
+		suffix:    ".foo.example.com",
+		zoneID:    "Z1",
+		ignoreTag: defaultIgnoreTag,
+	}
+	if err := s.renameInstance(context.Background(), "i-1"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"legacy.foo.example.com. A 1.2.3.4",
+		"www.foo.example.com. A 1.2.3.4",
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestReconcile_mode(t *testing.T) {
+	table := []struct {
+		mode string
+		want []string
+	}{
+		{modeFull, []string{
+			"db.foo.example.com. A 2.2.2.2",
+			"web.foo.example.com. A 1.2.3.4",
+		}},
+		{modeUpsert, []string{
+			"db.foo.example.com. A 2.2.2.2",
+			"old.foo.example.com. A 5.5.5.5",
+			"web.foo.example.com. A 1.2.3.4",
+		}},
+		{modeCleanup, []string{
+			"web.foo.example.com. A 9.9.9.9",
+		}},
+	}
+	for _, tc := range table {
+		t.Run(tc.mode, func(t *testing.T) {
+			r53svc := newFakeRoute53(t,
+				"web.foo.example.com. A 9.9.9.9",
+				"old.foo.example.com. A 5.5.5.5",
+			)
+			s := &syncer{
+				ec2: &fakeEC2{instances: []*ec2.Instance{
+					testInstance("i-1", "web", "", "1.2.3.4"),
+					testInstance("i-2", "db", "", "2.2.2.2"),
+				}},
+				r53:    r53svc,
+				suffix: ".foo.example.com",
+				zoneID: "Z1",
+				mode:   tc.mode,
+			}
+			if err := s.update(context.Background(), "", new(runStats)); err != nil {
+				t.Fatal(err)
+			}
+			if got := r53svc.dump(); !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tc.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestReconcile_noop(t *testing.T) {
+	r53svc := newFakeRoute53(t,
+		"jenkins.foo.example.com. A 1.2.3.4",
+		"db.foo.example.com. A 5.6.7.8",
+	)
+	ec2svc := &fakeEC2{instances: []*ec2.Instance{
+		testInstance("i-1", "jenkins", "", "1.2.3.4"),
+		testInstance("i-2", "db", "", "5.6.7.8"),
+	}}
+	s := &syncer{
+		ec2:    ec2svc,
+		r53:    r53svc,
+		suffix: ".foo.example.com",
+		zoneID: "Z1",
+		ttl:    defaultTTL,
+	}
+	ctx := context.Background()
+	if err := s.reconcile(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+	if l := len(r53svc.batches); l != 0 {
+		t.Fatalf("got %d change batches for up to date zone, want 0", l)
+	}
+	s.expectChanges = true
+	if err := s.reconcile(ctx, ""); err != errNoChanges {
+		t.Fatalf("got error %v, want %v", err, errNoChanges)
+	}
+	s.expectChanges = false
+	// only changed record is included in the batch
+	ec2svc.instances[1].PublicIpAddress = aws.String("9.9.9.9")
+	if err := s.reconcile(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+	if l := len(r53svc.batches); l != 1 {
+		t.Fatalf("got %d change batches, want 1", l)
+	}
+	if l := len(r53svc.batches[0]); l != 1 {
+		t.Fatalf("got %d changes in batch, want 1", l)
+	}
+}
+
+func TestManagedInstances_pages(t *testing.T) {
+	var instances []*ec2.Instance
+	for i := 0; i < 12; i++ {
+		instances = append(instances, testInstance(fmt.Sprintf("i-%d", i), fmt.Sprintf("web%d", i), "", "1.2.3.4"))
+	}
+	unnamed := testInstance("i-unnamed", "", "", "1.2.3.5")
+	unnamed.Tags = nil
+	svc := &countingEC2{ec2Client: &fakeEC2{instances: append(instances, unnamed)}}
+	s := &syncer{ec2: svc, pageSize: 5}
+	got, err := s.managedInstances(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 12 || svc.calls != 3 {
+		t.Fatalf("got %d instances in %d calls, want 12 named ones in 3 pages", len(got), svc.calls)
+	}
+	// instances without Name tag may get fallback names, so they are
+	// fetched too
+	s.fallbackName = fallbackInstanceID
+	if got, err = s.managedInstances(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 13 {
+		t.Fatalf("got %d instances with fallback names, want 13", len(got))
+	}
+}
+
+// countingEC2 counts DescribeInstances calls
+type countingEC2 struct {
+	ec2Client
+	calls int
+}
+
+func (c *countingEC2) DescribeInstancesWithContext(ctx aws.Context, in *ec2.DescribeInstancesInput, opts ...request.Option) (*ec2.DescribeInstancesOutput, error) {
+	c.calls++
+	return c.ec2Client.DescribeInstancesWithContext(ctx, in, opts...)
+}
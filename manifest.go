@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// manifestResource is the resource id of manifest records in logs and change
+// summaries
+const manifestResource = "manifest"
+
+// manifestSource reads manifest of static records to keep under suffix along
+// with records of instances, see parseManifest. Methods of nil
+// *manifestSource are no-ops.
+type manifestSource struct {
+	s3    s3Getter // used for s3:// locations
+	where string   // local file name or s3://bucket/key URL
+
+	mu   sync.Mutex
+	keys map[string]bool // recordKey of records of the last loaded manifest
+}
+
+// manifestTypes are types of records manifest may list
+var manifestTypes = map[string]bool{
+	"A": true, "AAAA": true, "CAA": true, "CNAME": true, "MX": true,
+	"NAPTR": true, "NS": true, "SPF": true, "SRV": true, "TXT": true,
+}
+
+// manifestRecord is a record set listed in manifest
+type manifestRecord struct {
+	Name   string   `json:"name"` // relative to suffix, like "www"
+	Type   string   `json:"type"`
+	TTL    int64    `json:"ttl,omitempty"`
+	Values []string `json:"values"` // in Route 53 format, TXT ones quoted
+}
+
+// load reads the manifest and returns its record sets, remembering them for
+// has
+func (m *manifestSource) load(ctx context.Context, suffix string, ttl int64) ([]*route53.ResourceRecordSet, error) {
+	if m == nil {
+		return nil, nil
+	}
+	r, err := openLocation(ctx, m.s3, m.where)
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+	defer r.Close()
+	records, err := parseManifest(r, suffix, ttl)
+	if err != nil {
+		return nil, fmt.Errorf("manifest %s: %w", m.where, err)
+	}
+	keys := make(map[string]bool, len(records))
+	for _, rr := range records {
+		keys[recordKey(rr)] = true
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys = keys
+	return records, nil
+}
+
+// has reports whether record set is listed in the last loaded manifest
+func (m *manifestSource) has(rr *route53.ResourceRecordSet) bool {
+	return m.hasKey(recordKey(rr))
+}
+
+// hasKey is like has, but takes recordKey of the record set
+func (m *manifestSource) hasKey(key string) bool {
+	if m == nil {
+		return false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.keys[key]
+}
+
+// parseManifest parses JSON manifest of static records, like:
+//
+//	{"records": [
+//		{"name": "www", "type": "CNAME", "values": ["cdn.example.net"]},
+//		{"name": "_dmarc", "type": "TXT", "ttl": 3600, "values": ["\"v=DMARC1; p=none\""]}
+//	]}
+//
+// and returns record sets named by names with suffix appended, without
+// trailing dot. Records without TTL get the default one.
+func parseManifest(r io.Reader, suffix string, ttl int64) ([]*route53.ResourceRecordSet, error) {
+	var doc struct {
+		Records []manifestRecord `json:"records"`
+	}
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	var out []*route53.ResourceRecordSet
+	types := make(map[string][]string) // names to types of their records
+	for _, mr := range doc.Records {
+		name := strings.ToLower(strings.TrimSuffix(mr.Name, "."))
+		typ := strings.ToUpper(mr.Type)
+		if name == "" || strings.ContainsAny(name, " \t*@") {
+			return nil, fmt.Errorf("invalid record name %q", mr.Name)
+		}
+		if !manifestTypes[typ] {
+			return nil, fmt.Errorf("%s: unsupported record type %q", name, mr.Type)
+		}
+		if len(mr.Values) == 0 {
+			return nil, fmt.Errorf("%s %s: no values", name, typ)
+		}
+		if typ == "CNAME" && len(mr.Values) != 1 {
+			return nil, fmt.Errorf("%s CNAME: must have a single value", name)
+		}
+		for _, t := range types[name] {
+			if t == typ {
+				return nil, fmt.Errorf("%s %s: listed more than once", name, typ)
+			}
+			if t == "CNAME" || typ == "CNAME" {
+				return nil, fmt.Errorf("%s: CNAME record cannot coexist with other records", name)
+			}
+		}
+		types[name] = append(types[name], typ)
+		rr := &route53.ResourceRecordSet{
+			Name: aws.String(name + suffix),
+			Type: aws.String(typ),
+			TTL:  aws.Int64(ttl),
+		}
+		if mr.TTL != 0 {
+			if !validTTL(mr.TTL) {
+				return nil, fmt.Errorf("%s %s: invalid TTL %d", name, typ, mr.TTL)
+			}
+			rr.TTL = aws.Int64(mr.TTL)
+		}
+		for _, v := range mr.Values {
+			rr.ResourceRecords = append(rr.ResourceRecords, &route53.ResourceRecord{Value: aws.String(v)})
+		}
+		out = append(out, rr)
+	}
+	return out, nil
+}
+
+// openLocation opens local file or s3://bucket/key URL for reading
+func openLocation(ctx context.Context, svc s3Getter, where string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(where, "s3://") {
+		return os.Open(where)
+	}
+	bucket, key, err := parseS3URL(where)
+	if err != nil {
+		return nil, err
+	}
+	out, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{Bucket: &bucket, Key: &key})
+	if err != nil {
+		return nil, err
+	}
+	return out.Body, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func TestParseManifest(t *testing.T) {
+	const doc = `{"records": [
+		{"name": "WWW", "type": "cname", "values": ["cdn.example.net"]},
+		{"name": "_dmarc", "type": "TXT", "ttl": 3600, "values": ["\"v=DMARC1; p=none\""]}
+	]}`
+	records, err := parseManifest(strings.NewReader(doc), ".foo.example.com", 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || *records[0].Name != "www.foo.example.com" || *records[0].Type != "CNAME" ||
+		*records[0].TTL != 60 || *records[1].TTL != 3600 ||
+		*records[1].ResourceRecords[0].Value != `"v=DMARC1; p=none"` {
+		t.Fatalf("unexpected records: %v", records)
+	}
+	for _, doc := range []string{
+		`{"records": [{"name": "", "type": "A", "values": ["1.2.3.4"]}]}`,
+		`{"records": [{"name": "*", "type": "A", "values": ["1.2.3.4"]}]}`,
+		`{"records": [{"name": "a", "type": "SOA", "values": ["x"]}]}`,
+		`{"records": [{"name": "a", "type": "A"}]}`,
+		`{"records": [{"name": "a", "type": "CNAME", "values": ["b.example.com", "c.example.com"]}]}`,
+		`{"records": [{"name": "a", "type": "A", "values": ["1.2.3.4"]}, {"name": "a", "type": "A", "values": ["5.6.7.8"]}]}`,
+		`{"records": [{"name": "a", "type": "TXT", "values": ["\"x\""]}, {"name": "a", "type": "CNAME", "values": ["b.example.com"]}]}`,
+		`{"records": [{"name": "a", "type": "A", "ttl": -1, "values": ["1.2.3.4"]}]}`,
+		`{"records": [{"name": "a", "kind": "A", "values": ["1.2.3.4"]}]}`,
+	} {
+		if _, err := parseManifest(strings.NewReader(doc), ".foo.example.com", 60); err == nil {
+			t.Errorf("parseManifest(%s) succeeded", doc)
+		}
+	}
+}
+
+func TestReconcile_manifest(t *testing.T) {
+	const doc = `{"records": [
+		{"name": "www", "type": "CNAME", "values": ["cdn.example.net"]},
+		{"name": "web", "type": "MX", "values": ["10 mx.example.com"]},
+		{"name": "web", "type": "A", "values": ["9.9.9.9"]},
+		{"name": "_dmarc", "type": "TXT", "values": ["\"v=DMARC1; p=none\""]}
+	]}`
+	name := filepath.Join(t.TempDir(), "manifest.json")
+	if err := os.WriteFile(name, []byte(doc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r53svc := newFakeRoute53(t,
+		"old.foo.example.com. A 1.1.1.1",
+		"mail.foo.example.com. MX 10 mx.example.org",
+		"web.foo.example.com. MX 20 old.example.com",
+	)
+	s := &syncer{
+		ec2:       &fakeEC2{instances: []*ec2.Instance{testInstance("i-1", "web", "", "1.2.3.4")}},
+		r53:       r53svc,
+		suffix:    ".foo.example.com",
+		zoneID:    "Z1",
+		ttl:       60,
+		ignoreTag: defaultIgnoreTag,
+		manifest:  &manifestSource{where: name},
+	}
+	if err := s.reconcile(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`_dmarc.foo.example.com. TXT "v=DMARC1; p=none"`,
+		"mail.foo.example.com. MX 10 mx.example.org",
+		"web.foo.example.com. A 1.2.3.4",
+		"web.foo.example.com. MX 10 mx.example.com",
+		"www.foo.example.com. CNAME cdn.example.net",
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	orphans, err := s.orphans(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orphans) != 0 {
+		t.Fatalf("manifest records reported as orphans: %v", orphans)
+	}
+}
+
+func TestRenameInstance_manifest(t *testing.T) {
+	const doc = `{"records": [{"name": "static", "type": "A", "values": ["1.2.3.4"]}]}`
+	name := filepath.Join(t.TempDir(), "manifest.json")
+	if err := os.WriteFile(name, []byte(doc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r53svc := newFakeRoute53(t,
+		"web.foo.example.com. A 1.2.3.4",
+		"static.foo.example.com. A 1.2.3.4",
+	)
+	s := &syncer{
+		ec2:      &fakeEC2{instances: []*ec2.Instance{testInstance("i-1", "www", "", "1.2.3.4")}},
+		r53:      r53svc,
+		suffix:   ".foo.example.com",
+		zoneID:   "Z1",
+		ttl:      60,
+		manifest: &manifestSource{where: name},
+	}
+	if err := s.renameInstance(context.Background(), "i-1"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"static.foo.example.com. A 1.2.3.4",
+		"www.foo.example.com. A 1.2.3.4",
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
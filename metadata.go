@@ -0,0 +1,80 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+// metadataPrefix starts values of TXT records with instance metadata, telling
+// them from TXT records not created by the program
+const metadataPrefix = `"awsns `
+
+// metadataValue returns TXT record value with metadata of the instance, like
+// "awsns instance-id=i-1 az=us-east-1a ami=ami-1 launch-time=2023-01-02T03:04:05Z",
+// quoted
+func metadataValue(d desiredRecord) string {
+	fields := []string{"instance-id=" + aws.StringValue(d.inst.InstanceId)}
+	if d.inst.Placement != nil && aws.StringValue(d.inst.Placement.AvailabilityZone) != "" {
+		fields = append(fields, "az="+aws.StringValue(d.inst.Placement.AvailabilityZone))
+	}
+	if d.inst.ImageId != nil {
+		fields = append(fields, "ami="+aws.StringValue(d.inst.ImageId))
+	}
+	if d.inst.LaunchTime != nil {
+		fields = append(fields, "launch-time="+d.inst.LaunchTime.UTC().Format(time.RFC3339))
+	}
+	return metadataPrefix + strings.Join(fields, " ") + `"`
+}
+
+// isMetadataRecord reports whether record set is TXT record with instance
+// metadata
+func isMetadataRecord(rr *route53.ResourceRecordSet) bool {
+	if aws.StringValue(rr.Type) != route53.RRTypeTxt || len(rr.ResourceRecords) == 0 {
+		return false
+	}
+	for _, r := range rr.ResourceRecords {
+		if !strings.HasPrefix(aws.StringValue(r.Value), metadataPrefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// metadataRecords returns TXT record sets with metadata of instances, one per
+// name having A records, listing all instances of this name. Names with CNAME
+// records get none, as CNAME record cannot coexist with other records.
+func (s *syncer) metadataRecords(records []desiredRecord) []desiredRecord {
+	var names []string
+	values := make(map[string][]string)
+	first := make(map[string]desiredRecord) // records to take instance from
+	for _, d := range records {
+		if aws.StringValue(d.rr.Type) != route53.RRTypeA {
+			continue
+		}
+		name := *d.rr.Name
+		if _, ok := values[name]; !ok {
+			names = append(names, name)
+			first[name] = d
+		}
+		values[name] = append(values[name], metadataValue(d))
+	}
+	var out []desiredRecord
+	for _, name := range names {
+		rr := &route53.ResourceRecordSet{
+			Name: aws.String(name),
+			Type: aws.String(route53.RRTypeTxt),
+			TTL:  aws.Int64(s.ttl),
+		}
+		list := values[name]
+		sort.Strings(list)
+		for _, v := range list {
+			rr.ResourceRecords = append(rr.ResourceRecords, &route53.ResourceRecord{Value: aws.String(v)})
+		}
+		out = append(out, desiredRecord{rr: rr, inst: first[name].inst})
+	}
+	return out
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func TestReconcile_txtMetadata(t *testing.T) {
+	r53svc := newFakeRoute53(t,
+		`gone.foo.example.com. TXT "awsns instance-id=i-9"`,
+		`mail.foo.example.com. TXT "v=spf1 -all"`,
+	)
+	launched := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	web := testInstance("i-1", "web", "", "1.2.3.4")
+	web.Placement = &ec2.Placement{AvailabilityZone: aws.String("us-east-1a")}
+	web.ImageId, web.LaunchTime = aws.String("ami-1"), &launched
+	s := &syncer{
+		ec2: &fakeEC2{instances: []*ec2.Instance{
+			web,
+			testInstance("i-2", "ci", "ec2-5-6-7-8.compute.amazonaws.com", "5.6.7.8"),
+			testInstance("i-3", "mail", "", "9.9.9.9"),
+		}},
+		r53:         r53svc,
+		suffix:      ".foo.example.com",
+		zoneID:      "Z1",
+		txtMetadata: true,
+	}
+	if err := s.update(context.Background(), "", &runStats{}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"ci.foo.example.com. CNAME ec2-5-6-7-8.compute.amazonaws.com",
+		"mail.foo.example.com. A 9.9.9.9",
+		`mail.foo.example.com. TXT "v=spf1 -all"`,
+		"web.foo.example.com. A 1.2.3.4",
+		`web.foo.example.com. TXT "awsns instance-id=i-1 az=us-east-1a ami=ami-1 launch-time=2023-01-02T03:04:05Z"`,
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
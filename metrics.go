@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// metrics collects reconciliation statistics and exposes them in Prometheus
+// text format. Methods of nil *metrics are no-ops.
+type metrics struct {
+	mu        sync.Mutex
+	upserted  int64
+	deleted   int64
+	apiErrors int64
+	managed   int64
+	runs      int64
+	duration  time.Duration // total duration of all runs
+}
+
+// observe records statistics of a reconciliation run
+func (m *metrics) observe(st runStats, err error) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.runs++
+	m.duration += st.Duration
+	m.upserted += int64(st.Upserted)
+	m.deleted += int64(st.Deleted)
+	if err == nil {
+		m.managed = int64(st.Managed)
+	}
+}
+
+// countAPIErrors is a request handler that counts failed AWS API calls; it
+// should be attached to session Complete handlers list
+func (m *metrics) countAPIErrors(r *request.Request) {
+	if m == nil || r.Error == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.apiErrors++
+}
+
+func (m *metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintf(w, "# HELP awsns_records_upserted_total Records upserted.\n"+
+		"# TYPE awsns_records_upserted_total counter\n"+
+		"awsns_records_upserted_total %d\n", m.upserted)
+	fmt.Fprintf(w, "# HELP awsns_records_deleted_total Records deleted.\n"+
+		"# TYPE awsns_records_deleted_total counter\n"+
+		"awsns_records_deleted_total %d\n", m.deleted)
+	fmt.Fprintf(w, "# HELP awsns_aws_api_errors_total Failed AWS API calls.\n"+
+		"# TYPE awsns_aws_api_errors_total counter\n"+
+		"awsns_aws_api_errors_total %d\n", m.apiErrors)
+	fmt.Fprintf(w, "# HELP awsns_managed_records Records managed after the last successful update.\n"+
+		"# TYPE awsns_managed_records gauge\n"+
+		"awsns_managed_records %d\n", m.managed)
+	fmt.Fprintf(w, "# HELP awsns_reconcile_duration_seconds Duration of reconciliation runs.\n"+
+		"# TYPE awsns_reconcile_duration_seconds summary\n"+
+		"awsns_reconcile_duration_seconds_sum %g\n"+
+		"awsns_reconcile_duration_seconds_count %d\n", m.duration.Seconds(), m.runs)
+}
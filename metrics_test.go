@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func TestMetrics(t *testing.T) {
+	m := new(metrics)
+	s := &syncer{
+		ec2: &fakeEC2{instances: []*ec2.Instance{
+			testInstance("i-1", "jenkins", "", "1.2.3.4"),
+			testInstance("i-2", "db", "", "5.6.7.8"),
+		}},
+		r53:     newFakeRoute53(t, "old.foo.example.com. A 1.1.1.1"),
+		suffix:  ".foo.example.com",
+		zoneID:  "Z1",
+		metrics: m,
+	}
+	if err := s.reconcile(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		"awsns_records_upserted_total 2\n",
+		"awsns_records_deleted_total 1\n",
+		"awsns_managed_records 2\n",
+		"awsns_aws_api_errors_total 0\n",
+		"awsns_reconcile_duration_seconds_count 1\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics output lacks %q:\n%s", want, body)
+		}
+	}
+}
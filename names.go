@@ -0,0 +1,184 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// hostName returns host name of the instance derived from its "Name" tag, see
+// normalize
+func (s *syncer) hostName(inst *ec2.Instance) string { return s.normalize(s.rawName(inst)) }
+
+// fallback names of instances without "Name" tag, see syncer.fallbackName
+const (
+	fallbackInstanceID = "instance-id" // instance id, like i-0123456789abcdef0
+	fallbackPrivateIP  = "private-ip"  // EC2-style name, like ip-10-0-1-2
+)
+
+func validFallbackName(kind string) bool {
+	switch kind {
+	case "", fallbackInstanceID, fallbackPrivateIP:
+		return true
+	}
+	return false
+}
+
+// rawName returns value of the instance "Name" tag, or its Kubernetes node
+// name if it is a node of s.eksCluster, see eksNodeName. If instance has no
+// "Name" tag, it returns name derived according to s.fallbackName, if set.
+func (s *syncer) rawName(inst *ec2.Instance) string {
+	if name := s.eksNodeName(inst); name != "" {
+		return name
+	}
+	if name := nameTag(inst); name != "" {
+		return name
+	}
+	switch s.fallbackName {
+	case fallbackInstanceID:
+		return aws.StringValue(inst.InstanceId)
+	case fallbackPrivateIP:
+		if ip := aws.StringValue(inst.PrivateIpAddress); ip != "" {
+			return "ip-" + strings.ReplaceAll(ip, ".", "-")
+		}
+	}
+	return ""
+}
+
+// normalize returns name lowercased, sanitized if s.sanitize is set, and
+// converted to ASCII form if s.idn is set. It returns empty string if the name
+// is not valid. Lowercasing matches names Route 53 lists, so that records of
+// mixed-case names are not replaced on each update.
+func (s *syncer) normalize(name string) string {
+	name = strings.ToLower(name)
+	if s.sanitize {
+		name = sanitize(name, s.idn)
+	}
+	if s.idn {
+		name = toASCII(name)
+	}
+	if !valid(name) {
+		return ""
+	}
+	return name
+}
+
+// eksNodeName returns Kubernetes node name of the instance if it is a worker
+// node of s.eksCluster EKS cluster, that is, if it has "eks:cluster-name" tag
+// set to cluster name, or "kubernetes.io/cluster/<cluster name>" tag. Default
+// node name on EKS is the instance private DNS name, like
+// ip-10-0-1-2.ec2.internal, only its first label is returned.
+func (s *syncer) eksNodeName(inst *ec2.Instance) string {
+	if s.eksCluster == "" {
+		return ""
+	}
+	if tagValue(inst, "eks:cluster-name") != s.eksCluster && !hasTag(inst, "kubernetes.io/cluster/"+s.eksCluster) {
+		return ""
+	}
+	name, _, _ := strings.Cut(aws.StringValue(inst.PrivateDnsName), ".")
+	return name
+}
+
+// hasTag reports whether instance has tag with the given key
+func hasTag(inst *ec2.Instance, key string) bool {
+	for _, tag := range inst.Tags {
+		if aws.StringValue(tag.Key) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// aliasesTag is the instance tag with comma-separated list of extra host names
+const aliasesTag = "dns:aliases"
+
+// hostNames returns host name of the instance followed by its wildcard name,
+// if set by wildcardTag, and its valid aliases set by aliasesTag. It returns
+// nil if instance has no valid host name.
+func (s *syncer) hostNames(inst *ec2.Instance) []string {
+	name := s.hostName(inst)
+	if name == "" {
+		return nil
+	}
+	out := []string{name}
+	if wildcard(inst) {
+		out = append(out, "*."+name)
+	}
+	seen := map[string]bool{name: true}
+	for _, alias := range strings.Split(tagValue(inst, aliasesTag), ",") {
+		orig := strings.TrimSpace(alias)
+		if orig == "" {
+			continue
+		}
+		if alias = s.normalize(orig); alias == "" {
+			logMsg("ignoring invalid alias", "instance_id", aws.StringValue(inst.InstanceId), "alias", orig)
+			continue
+		}
+		if !seen[alias] {
+			seen[alias] = true
+			out = append(out, alias)
+		}
+	}
+	return out
+}
+
+// sanitize turns name into a valid host name, if possible: it lowercases it,
+// replaces underscores and spaces with hyphens and drops other characters not
+// allowed in host names. If keepUnicode is true, non-ASCII letters and digits
+// are kept for later conversion to punycode.
+func sanitize(name string, keepUnicode bool) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case 'a' <= r && r <= 'z', '0' <= r && r <= '9', r == '-':
+			b.WriteRune(r)
+		case keepUnicode && r >= utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			b.WriteRune(r)
+		case r == '_', r == ' ':
+			b.WriteByte('-')
+		}
+	}
+	return strings.Trim(b.String(), "-")
+}
+
+// dropCollisions returns instances without the ones which sanitized names
+// collide with names of other instances: of several different names mapped to
+// the same host name, the one of the instance with the lowest id wins.
+// It also logs names changed by sanitization.
+func (s *syncer) dropCollisions(instances []*ec2.Instance) []*ec2.Instance {
+	if !s.sanitize {
+		return instances
+	}
+	sorted := append([]*ec2.Instance(nil), instances...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return aws.StringValue(sorted[i].InstanceId) < aws.StringValue(sorted[j].InstanceId)
+	})
+	owners := make(map[string]string) // host name to original name
+	for _, inst := range sorted {
+		orig, name := s.rawName(inst), s.hostName(inst)
+		if name == "" {
+			continue
+		}
+		if _, ok := owners[name]; !ok {
+			owners[name] = orig
+		}
+	}
+	var out []*ec2.Instance
+	for _, inst := range instances {
+		orig, name := s.rawName(inst), s.hostName(inst)
+		if name != "" && owners[name] != orig {
+			logMsg("sanitized name collides with another one, skipping", "instance_id",
+				aws.StringValue(inst.InstanceId), "name", orig, "sanitized", name, "other_name", owners[name])
+			continue
+		}
+		if name != "" && name != orig {
+			logMsg("sanitized name", "instance_id", aws.StringValue(inst.InstanceId), "name", orig, "sanitized", name)
+		}
+		out = append(out, inst)
+	}
+	return out
+}
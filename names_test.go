@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func TestSanitize(t *testing.T) {
+	table := []struct {
+		in          string
+		keepUnicode bool
+		want        string
+	}{
+		{in: "jenkins", want: "jenkins"},
+		{in: "Build_Agent.2", want: "build-agent2"},
+		{in: "web server 1", want: "web-server-1"},
+		{in: "_tmp_", want: "tmp"},
+		{in: "!!!", want: ""},
+		{in: "Café Bar", want: "caf-bar"},
+		{in: "Café Bar!", keepUnicode: true, want: "café-bar"},
+	}
+	for _, tc := range table {
+		if got := sanitize(tc.in, tc.keepUnicode); got != tc.want {
+			t.Errorf("sanitize(%q, %t) = %q, want %q", tc.in, tc.keepUnicode, got, tc.want)
+		}
+	}
+}
+
+func TestReconcile_sanitize(t *testing.T) {
+	ec2svc := &fakeEC2{instances: []*ec2.Instance{
+		testInstance("i-1", "Build_Agent", "", "1.2.3.4"),
+		testInstance("i-2", "build agent", "", "5.6.7.8"),
+		testInstance("i-3", "Web.Server", "", "9.9.9.9"),
+		testInstance("i-4", "Build_Agent", "", "4.4.4.4"),
+	}}
+	r53svc := newFakeRoute53(t)
+	s := &syncer{
+		ec2:         ec2svc,
+		r53:         r53svc,
+		suffix:      ".foo.example.com",
+		zoneID:      "Z1",
+		sanitize:    true,
+		groupPolicy: groupMultivalue,
+	}
+	ctx := context.Background()
+	if err := s.reconcile(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"build-agent.foo.example.com. A 1.2.3.4 set=i-1 multivalue",
+		"build-agent.foo.example.com. A 4.4.4.4 set=i-4 multivalue",
+		"webserver.foo.example.com. A 9.9.9.9",
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	// removal of an instance with sanitized name only removes its own
+	// record set
+	ec2svc.instances[0] = stopped(ec2svc.instances[0])
+	if err := s.removeInstance(ctx, "i-1"); err != nil {
+		t.Fatal(err)
+	}
+	want = want[1:]
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestHostName_idn(t *testing.T) {
+	table := []struct {
+		name     string
+		sanitize bool
+		want     string
+	}{
+		{name: "jenkins", want: "jenkins"},
+		{name: "Bücher", want: "xn--bcher-kva"},
+		{name: "Café Bar", want: ""},
+		{name: "Café Bar", sanitize: true, want: "xn--caf-bar-dya"},
+	}
+	for _, tc := range table {
+		s := &syncer{idn: true, sanitize: tc.sanitize}
+		if got := s.hostName(testInstance("i-1", tc.name, "", "")); got != tc.want {
+			t.Errorf("hostName(%q), sanitize=%t: got %q, want %q", tc.name, tc.sanitize, got, tc.want)
+		}
+	}
+}
+
+func TestReconcile_aliases(t *testing.T) {
+	ec2svc := &fakeEC2{instances: []*ec2.Instance{
+		withTag(testInstance("i-1", "monitor", "", "1.2.3.4"), aliasesTag, "grafana, metrics,bad_alias,monitor,db"),
+		testInstance("i-2", "db", "", "5.6.7.8"),
+	}}
+	r53svc := newFakeRoute53(t)
+	s := &syncer{
+		ec2:         ec2svc,
+		r53:         r53svc,
+		suffix:      ".foo.example.com",
+		zoneID:      "Z1",
+		groupPolicy: groupMultivalue,
+	}
+	ctx := context.Background()
+	if err := s.reconcile(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"db.foo.example.com. A 1.2.3.4 set=i-1 multivalue",
+		"db.foo.example.com. A 5.6.7.8 set=i-2 multivalue",
+		"grafana.foo.example.com. A 1.2.3.4",
+		"metrics.foo.example.com. A 1.2.3.4",
+		"monitor.foo.example.com. A 1.2.3.4",
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	// removal of an instance removes records of all its names, except for
+	// the ones shared with other instances
+	ec2svc.instances[0] = stopped(ec2svc.instances[0])
+	if err := s.removeInstance(ctx, "i-1"); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"db.foo.example.com. A 5.6.7.8 set=i-2 multivalue"}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestReconcile_mixedCase(t *testing.T) {
+	r53svc := newFakeRoute53(t, "jenkins.foo.example.com. A 1.2.3.4")
+	s := &syncer{
+		ec2:    &fakeEC2{instances: []*ec2.Instance{withTag(testInstance("i-1", "Jenkins", "", "1.2.3.4"), aliasesTag, "CI")}},
+		r53:    r53svc,
+		suffix: ".foo.example.com",
+		zoneID: "Z1",
+		ttl:    defaultTTL,
+	}
+	ctx := context.Background()
+	if err := s.reconcile(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"ci.foo.example.com. A 1.2.3.4",
+		"jenkins.foo.example.com. A 1.2.3.4",
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if err := s.reconcile(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+	if l := len(r53svc.batches); l != 1 {
+		t.Fatalf("got %d change batches, want 1 creating the alias only", l)
+	}
+	if l := len(r53svc.batches[0]); l != 1 {
+		t.Fatalf("got %d changes in batch, want 1", l)
+	}
+}
+
+func TestReconcile_fallbackName(t *testing.T) {
+	unnamed := testInstance("i-2", "", "", "5.6.7.8")
+	unnamed.Tags = nil
+	unnamed.PrivateIpAddress = aws.String("10.0.1.2")
+	for _, tc := range []struct {
+		kind string
+		want []string
+	}{
+		{"", []string{"web.foo.example.com. A 1.2.3.4"}},
+		{fallbackInstanceID, []string{
+			"i-2.foo.example.com. A 5.6.7.8",
+			"web.foo.example.com. A 1.2.3.4",
+		}},
+		{fallbackPrivateIP, []string{
+			"ip-10-0-1-2.foo.example.com. A 5.6.7.8",
+			"web.foo.example.com. A 1.2.3.4",
+		}},
+	} {
+		r53svc := newFakeRoute53(t)
+		s := &syncer{
+			ec2: &fakeEC2{instances: []*ec2.Instance{
+				testInstance("i-1", "web", "", "1.2.3.4"),
+				unnamed,
+			}},
+			r53:          r53svc,
+			suffix:       ".foo.example.com",
+			zoneID:       "Z1",
+			fallbackName: tc.kind,
+		}
+		if err := s.update(context.Background(), "", new(runStats)); err != nil {
+			t.Fatal(err)
+		}
+		if got := r53svc.dump(); !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("fallback %q: zone state mismatch\ngot:\n%s\nwant:\n%s", tc.kind, strings.Join(got, "\n"), strings.Join(tc.want, "\n"))
+		}
+	}
+}
+
+func TestHostName_eks(t *testing.T) {
+	node := func(id, dns string, tags ...string) *ec2.Instance {
+		inst := testInstance(id, "prod-nodes", "", "")
+		inst.PrivateDnsName = aws.String(dns)
+		for i := 0; i+1 < len(tags); i += 2 {
+			withTag(inst, tags[i], tags[i+1])
+		}
+		return inst
+	}
+	s := &syncer{eksCluster: "prod"}
+	for _, tc := range []struct {
+		inst *ec2.Instance
+		want string
+	}{
+		{node("i-1", "ip-10-0-1-2.ec2.internal", "eks:cluster-name", "prod"), "ip-10-0-1-2"},
+		{node("i-2", "ip-10-0-1-3.us-west-2.compute.internal", "kubernetes.io/cluster/prod", "owned"), "ip-10-0-1-3"},
+		{node("i-3", "ip-10-0-1-4.ec2.internal", "eks:cluster-name", "staging"), "prod-nodes"},
+		{node("i-4", "ip-10-0-1-5.ec2.internal"), "prod-nodes"},
+	} {
+		if got := s.hostName(tc.inst); got != tc.want {
+			t.Errorf("%s: got host name %q, want %q", *tc.inst.InstanceId, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+// orphans returns A/CNAME records under suffix none of which values belong to
+// running non-spot instances or to resources managed with lbTag and dbTag.
+// Unlike update, it looks at record values, not names, so it finds records
+// which names are still in use, but point to addresses of gone instances.
+// Addresses of all running instances are considered, including the ones not
+// matching s.filters or matching s.exclude. Records of ignored instances and
+// manifest records are never returned.
+func (s *syncer) orphans(ctx context.Context) ([]*route53.ResourceRecordSet, error) {
+	all := *s
+	all.filters, all.exclude = nil, nil
+	instances, err := all.managedInstances(ctx)
+	if err != nil {
+		return nil, err
+	}
+	_, protected := s.excludeIgnored(instances)
+	targets := make(map[string]struct{})
+	for _, inst := range instances {
+		for v := range instanceTargets(inst) {
+			targets[v] = struct{}{}
+		}
+		for _, v := range []*string{inst.PrivateIpAddress, inst.Ipv6Address} {
+			if aws.StringValue(v) != "" {
+				targets[*v] = struct{}{}
+			}
+		}
+	}
+	extra, err := s.extraRecords(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range extra {
+		for _, r := range d.rr.ResourceRecords {
+			targets[aws.StringValue(r.Value)] = struct{}{}
+		}
+	}
+	if _, err := s.manifest.load(ctx, s.suffix, s.ttl); err != nil {
+		return nil, err
+	}
+	records, err := s.listRecords(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for name := range s.foreignNames(records) {
+		protected[name] = true
+	}
+	var out []*route53.ResourceRecordSet
+	for _, r := range records {
+		rr := r.recordSet()
+		if r.typ != "A" && r.typ != "CNAME" || rr.AliasTarget != nil ||
+			protected[strings.TrimSuffix(r.name, ".")] || s.manifest.has(rr) {
+			continue
+		}
+		orphan := len(rr.ResourceRecords) != 0
+		for _, r := range rr.ResourceRecords {
+			if _, ok := targets[strings.TrimSuffix(aws.StringValue(r.Value), ".")]; ok {
+				orphan = false
+				break
+			}
+		}
+		if orphan {
+			out = append(out, rr)
+		}
+	}
+	return out, nil
+}
+
+// reportOrphans writes records returned by orphans to w, one per line. If
+// remove is set, it also deletes them in a single change batch.
+func (s *syncer) reportOrphans(ctx context.Context, w io.Writer, remove bool) error {
+	return s.locked(ctx, func() error {
+		orphans, err := s.orphans(ctx)
+		if err != nil {
+			return err
+		}
+		var changes []*route53.Change
+		var summary []recordChange
+		for _, rr := range orphans {
+			var values []string
+			for _, r := range rr.ResourceRecords {
+				values = append(values, aws.StringValue(r.Value))
+			}
+			name := strings.TrimSuffix(*rr.Name, ".")
+			if set := aws.StringValue(rr.SetIdentifier); set != "" {
+				name += " (" + set + ")"
+			}
+			fmt.Fprintf(w, "%s %s %s\n", name, aws.StringValue(rr.Type), strings.Join(values, ","))
+			ch := &route53.Change{
+				Action:            aws.String("DELETE"),
+				ResourceRecordSet: rr,
+			}
+			changes = append(changes, ch)
+			summary = append(summary, newRecordChange(ch, aws.StringValue(rr.SetIdentifier), true))
+		}
+		logMsg("found orphaned records", "zone_id", s.zoneID, "count", len(orphans))
+		if !remove || len(changes) == 0 {
+			return nil
+		}
+		if !s.mayDelete() {
+			logMsg("not removing records in upsert mode", "zone_id", s.zoneID, "count", len(changes))
+			return nil
+		}
+		_, err = s.apply(ctx, "", "automated removal of orphaned records", changes, summary)
+		return err
+	})
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func TestReportOrphans(t *testing.T) {
+	records := []string{
+		"web.foo.example.com. A 1.2.3.4",
+		"db.foo.example.com. A 5.6.7.8",            // name reused, address is stale
+		"old.foo.example.com. CNAME ec2-9.example", // gone instance
+		"intra.foo.example.com. A 10.0.0.1",        // private address
+		"other.foo.example.com. A 7.7.7.7",         // instance not matching filter
+		"legacy.foo.example.com. A 8.8.8.8",        // ignored instance
+	}
+	instances := []*ec2.Instance{
+		testInstance("i-1", "web", "", "1.2.3.4"),
+		testInstance("i-2", "db", "", "5.5.5.5"),
+		func() *ec2.Instance {
+			inst := testInstance("i-3", "intra", "", "")
+			inst.PrivateIpAddress = aws.String("10.0.0.1")
+			return inst
+		}(),
+		withTag(testInstance("i-4", "other", "", "7.7.7.7"), "team", "b"),
+		withTag(testInstance("i-5", "legacy", "", "9.9.9.9"), defaultIgnoreTag, "true"),
+	}
+	for _, remove := range []bool{false, true} {
+		r53svc := newFakeRoute53(t, records...)
+		s := &syncer{
+			ec2:       &fakeEC2{instances: instances},
+			r53:       r53svc,
+			suffix:    ".foo.example.com",
+			zoneID:    "Z1",
+			ignoreTag: defaultIgnoreTag,
+			filters:   []*ec2.Filter{{Name: aws.String("tag:team"), Values: []*string{aws.String("a")}}},
+		}
+		var buf bytes.Buffer
+		if err := s.reportOrphans(context.Background(), &buf, remove); err != nil {
+			t.Fatal(err)
+		}
+		wantReport := "db.foo.example.com A 5.6.7.8\nold.foo.example.com CNAME ec2-9.example\n"
+		if got := buf.String(); got != wantReport {
+			t.Fatalf("remove=%v: got report:\n%s\nwant:\n%s", remove, got, wantReport)
+		}
+		want := []string{
+			"db.foo.example.com. A 5.6.7.8",
+			"intra.foo.example.com. A 10.0.0.1",
+			"legacy.foo.example.com. A 8.8.8.8",
+			"old.foo.example.com. CNAME ec2-9.example",
+			"other.foo.example.com. A 7.7.7.7",
+			"web.foo.example.com. A 1.2.3.4",
+		}
+		if remove {
+			want = append(want[1:3], want[4:]...)
+		}
+		if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+			t.Fatalf("remove=%v: zone state mismatch\ngot:\n%s\nwant:\n%s", remove,
+				strings.Join(got, "\n"), strings.Join(want, "\n"))
+		}
+	}
+}
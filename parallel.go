@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// defaultParallelism is the default limit of units of work parallel runs
+// concurrently
+const defaultParallelism = 4
+
+// unitError is an error of a named unit of work run by parallel
+type unitError struct {
+	unit string
+	err  error
+}
+
+func (e unitError) Error() string { return e.unit + ": " + e.err.Error() }
+func (e unitError) Unwrap() error { return e.err }
+
+// unitErrors are errors of failed units of work run by parallel
+type unitErrors []unitError
+
+func (e unitErrors) Error() string {
+	parts := make([]string, len(e))
+	for i, err := range e {
+		parts[i] = err.Error()
+	}
+	return strings.Join(parts, "; ")
+}
+
+// parallel calls fn for each of named units of work, with at most limit calls
+// running concurrently (defaultParallelism if limit is not positive), and
+// waits for all of them to complete. Failure of one unit doesn't cancel the
+// others. If there are several units, errors of failed ones are returned
+// together as unitErrors; error of a single unit is returned as is.
+func parallel(ctx context.Context, limit int, units []string, fn func(ctx context.Context, i int) error) error {
+	if len(units) == 1 {
+		return fn(ctx, 0)
+	}
+	if limit <= 0 {
+		limit = defaultParallelism
+	}
+	errs := make([]error, len(units))
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i := range units {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = fn(ctx, i)
+		}(i)
+	}
+	wg.Wait()
+	var out unitErrors
+	for i, err := range errs {
+		if err != nil {
+			out = append(out, unitError{unit: units[i], err: err})
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
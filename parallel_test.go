@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParallel(t *testing.T) {
+	var running, peak int32
+	errBoom := errors.New("boom")
+	units := []string{"a", "b", "c", "d", "e"}
+	err := parallel(context.Background(), 2, units, func(_ context.Context, i int) error {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		if units[i] == "b" || units[i] == "d" {
+			return errBoom
+		}
+		return nil
+	})
+	if peak > 2 {
+		t.Fatalf("got %d concurrent calls, want at most 2", peak)
+	}
+	var ue unitErrors
+	if !errors.As(err, &ue) || len(ue) != 2 {
+		t.Fatalf("got error %v, want errors of two units", err)
+	}
+	if want := "b: boom; d: boom"; err.Error() != want {
+		t.Fatalf("got error %q, want %q", err, want)
+	}
+	if !errors.Is(ue[0], errBoom) {
+		t.Fatal("unit error does not wrap the original one")
+	}
+	// error of the only unit is returned as is
+	if err := parallel(context.Background(), 0, []string{"a"}, func(context.Context, int) error {
+		return errBoom
+	}); err != errBoom {
+		t.Fatalf("got error %v, want %v", err, errBoom)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// compileNamePattern compiles regular expression matching whole names
+// relative to suffix, like "web" or "_acme-challenge.web". Empty pattern
+// compiles to nil.
+func compileNamePattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	return re, nil
+}
+
+// managedName reports whether record with the given name, with or without
+// trailing dot, may be created, changed or deleted: its part before suffix
+// must match s.managePattern, if set, and must not match s.ignorePattern, if
+// set. Names outside of suffix are always managed.
+func (s *syncer) managedName(name string) bool {
+	name = strings.TrimSuffix(name, ".")
+	if !strings.HasSuffix(name, s.suffix) {
+		return true
+	}
+	rel := strings.TrimSuffix(name, s.suffix)
+	if s.managePattern != nil && !s.managePattern.MatchString(rel) {
+		return false
+	}
+	return s.ignorePattern == nil || !s.ignorePattern.MatchString(rel)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func TestReconcile_namePatterns(t *testing.T) {
+	r53svc := newFakeRoute53(t,
+		"autodiscover.foo.example.com. CNAME autodiscover.outlook.com",
+		"mail.foo.example.com. A 9.9.9.9",
+		"web-9.foo.example.com. A 9.9.9.9",
+	)
+	managePattern, err := compileNamePattern(`[a-z]+-\d+|mail`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ignorePattern, err := compileNamePattern(`autodiscover|mail`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &syncer{
+		ec2: &fakeEC2{instances: []*ec2.Instance{
+			testInstance("i-1", "web-1", "", "1.2.3.4"),
+			testInstance("i-2", "db", "", "1.2.3.5"),
+			testInstance("i-3", "mail", "", "1.2.3.6"),
+		}},
+		r53:           r53svc,
+		suffix:        ".foo.example.com",
+		zoneID:        "Z1",
+		managePattern: managePattern,
+		ignorePattern: ignorePattern,
+	}
+	st := new(runStats)
+	if err := s.update(context.Background(), "", st); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"autodiscover.foo.example.com. CNAME autodiscover.outlook.com",
+		"mail.foo.example.com. A 9.9.9.9",
+		"web-1.foo.example.com. A 1.2.3.4",
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if st.Skipped != 2 {
+		t.Fatalf("got %d skipped instances, want 2", st.Skipped)
+	}
+	if _, err := compileNamePattern("web("); err == nil {
+		t.Fatal("invalid pattern accepted")
+	}
+}
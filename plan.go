@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+// planVersion is the version of changePlan format
+const planVersion = 1
+
+// changePlan is a set of change batches computed by "plan" command, to be
+// applied later exactly as planned by "apply" command
+type changePlan struct {
+	Version int         `json:"version"`
+	Created time.Time   `json:"created"`
+	Batches []planBatch `json:"batches"`
+}
+
+// planBatch is a single change batch of changePlan
+type planBatch struct {
+	ZoneID    string          `json:"zone_id"`
+	InvokerID string          `json:"invoker_id,omitempty"`
+	Comment   string          `json:"comment"` // not rendered from template yet
+	Changes   []plannedChange `json:"changes"`
+	Summary   []recordChange  `json:"summary"`
+}
+
+// plannedChange is a change along with the record set it replaces, as seen
+// when the plan was made
+type plannedChange struct {
+	Change *route53.Change            `json:"change"`
+	Before *route53.ResourceRecordSet `json:"before,omitempty"` // only for UPSERT
+}
+
+// errDrifted is returned when the zone was changed after the plan was made
+var errDrifted = errors.New("zone has changed since the plan was made")
+
+// makePlan computes changes a full update would make, without applying them
+func (s *syncer) makePlan(ctx context.Context) (*changePlan, error) {
+	if s.healthCheck != nil {
+		// attaching health checks creates them, planning must not
+		// change anything
+		return nil, errors.New("health checks are not supported with plan")
+	}
+	p := &changePlan{Version: planVersion, Created: time.Now().UTC()}
+	planner := *s
+	planner.plan = p
+	planner.expectChanges = false
+	if err := planner.locked(ctx, func() error { return planner.update(ctx, "", new(runStats)) }); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// addToPlan adds change batch to s.plan, along with the current state of
+// record sets UPSERT changes replace
+func (s *syncer) addToPlan(ctx context.Context, zoneID, invokerID, comment string, changes []*route53.Change, summary []recordChange) error {
+	b := planBatch{ZoneID: zoneID, InvokerID: invokerID, Comment: comment, Summary: summary}
+	for _, ch := range changes {
+		pc := plannedChange{Change: ch}
+		if aws.StringValue(ch.Action) == route53.ChangeActionUpsert {
+			var err error
+			if pc.Before, err = s.lookupRecord(ctx, zoneID, ch.ResourceRecordSet); err != nil {
+				return err
+			}
+		}
+		b.Changes = append(b.Changes, pc)
+	}
+	s.plan.Batches = append(s.plan.Batches, b)
+	return nil
+}
+
+// writePlan writes the plan to w as JSON
+func writePlan(w io.Writer, p *changePlan) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p)
+}
+
+// writePlanFile writes the plan to the named file as JSON
+func writePlanFile(name string, p *changePlan) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := writePlan(f, p); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readPlan reads the plan written by writePlan
+func readPlan(r io.Reader) (*changePlan, error) {
+	var p changePlan
+	if err := json.NewDecoder(r).Decode(&p); err != nil {
+		return nil, fmt.Errorf("reading plan: %w", err)
+	}
+	if p.Version != planVersion {
+		return nil, fmt.Errorf("unsupported plan version %d", p.Version)
+	}
+	return &p, nil
+}
+
+// applyPlan applies change batches of the plan. It refuses to apply anything
+// if any record set the plan changes differs from what it was when the plan
+// was made. To also catch changes made between this check and applying,
+// UPSERT changes are submitted as DELETE of the old record set and CREATE of
+// the new one, and Route 53 rejects the whole batch if the old record set
+// doesn't match exactly, or the new one already exists.
+func (s *syncer) applyPlan(ctx context.Context, p *changePlan) error {
+	return s.locked(ctx, func() error {
+		for _, b := range p.Batches {
+			if b.ZoneID != s.zoneID && (b.ZoneID != s.reverseZoneID || s.reverseZoneID == "") {
+				return fmt.Errorf("plan has changes for zone %s, which is not managed", b.ZoneID)
+			}
+			for _, pc := range b.Changes {
+				if err := s.checkPlanned(ctx, b.ZoneID, pc); err != nil {
+					return err
+				}
+			}
+		}
+		if len(p.Batches) == 0 {
+			logMsg("plan has no changes", "zone_id", s.zoneID)
+			return s.noChanges()
+		}
+		for _, b := range p.Batches {
+			var changes []*route53.Change
+			for _, pc := range b.Changes {
+				rr := pc.Change.ResourceRecordSet
+				switch {
+				case aws.StringValue(pc.Change.Action) != route53.ChangeActionUpsert:
+					changes = append(changes, pc.Change)
+					continue
+				case pc.Before != nil:
+					changes = append(changes, &route53.Change{
+						Action:            aws.String(route53.ChangeActionDelete),
+						ResourceRecordSet: pc.Before,
+					})
+				}
+				changes = append(changes, &route53.Change{
+					Action:            aws.String(route53.ChangeActionCreate),
+					ResourceRecordSet: rr,
+				})
+			}
+			if _, err := s.applyZone(ctx, b.ZoneID, b.InvokerID, b.Comment, changes, b.Summary); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// checkPlanned returns errDrifted if the record set the planned change applies
+// to differs from what it was when the plan was made
+func (s *syncer) checkPlanned(ctx context.Context, zoneID string, pc plannedChange) error {
+	if pc.Change == nil || pc.Change.ResourceRecordSet == nil {
+		return errors.New("plan has an empty change")
+	}
+	rr := pc.Change.ResourceRecordSet
+	want := pc.Before
+	if aws.StringValue(pc.Change.Action) == route53.ChangeActionDelete {
+		want = rr
+	}
+	cur, err := s.lookupRecord(ctx, zoneID, rr)
+	if err != nil {
+		return err
+	}
+	if (cur == nil) != (want == nil) || cur != nil && !sameRecord(cur, want) {
+		return fmt.Errorf("%w: %s %s", errDrifted, strings.TrimSuffix(aws.StringValue(rr.Name), "."),
+			aws.StringValue(rr.Type))
+	}
+	return nil
+}
+
+// lookupRecord returns record set of the zone with the same name, type and
+// set identifier as rr, or nil if there is none
+func (s *syncer) lookupRecord(ctx context.Context, zoneID string, rr *route53.ResourceRecordSet) (*route53.ResourceRecordSet, error) {
+	fqdn := strings.TrimSuffix(aws.StringValue(rr.Name), ".") + "."
+	var out *route53.ResourceRecordSet
+	fn := func(r *route53.ResourceRecordSet) bool {
+		if aws.StringValue(r.Name) != fqdn {
+			return false
+		}
+		if recordKey(r) == recordKey(rr) {
+			out = r
+			return false
+		}
+		return true
+	}
+	if err := s.provider().list(ctx, zoneID, fqdn, aws.StringValue(rr.Type), fn); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
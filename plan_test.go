@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+func TestPlanApply(t *testing.T) {
+	records := []string{
+		"web.foo.example.com. A 9.9.9.9",
+		"old.foo.example.com. A 1.1.1.1",
+	}
+	for _, drift := range []bool{false, true} {
+		r53svc := newFakeRoute53(t, records...)
+		s := &syncer{
+			ec2: &fakeEC2{instances: []*ec2.Instance{
+				testInstance("i-1", "web", "", "1.2.3.4"),
+				testInstance("i-2", "db", "", "5.6.7.8"),
+			}},
+			r53:    r53svc,
+			suffix: ".foo.example.com",
+			zoneID: "Z1",
+			ttl:    defaultTTL,
+		}
+		p, err := s.makePlan(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(r53svc.batches) != 0 {
+			t.Fatalf("plan applied %d change batches", len(r53svc.batches))
+		}
+		var buf bytes.Buffer
+		if err := writePlan(&buf, p); err != nil {
+			t.Fatal(err)
+		}
+		if p, err = readPlan(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if len(p.Batches) != 1 || len(p.Batches[0].Changes) != 3 {
+			t.Fatalf("unexpected plan: %+v", p)
+		}
+		want := []string{
+			"db.foo.example.com. A 5.6.7.8",
+			"web.foo.example.com. A 1.2.3.4",
+		}
+		if drift {
+			r53svc.add(&route53.ResourceRecordSet{
+				Name:            aws.String("web.foo.example.com."),
+				Type:            aws.String("A"),
+				TTL:             aws.Int64(60),
+				ResourceRecords: []*route53.ResourceRecord{{Value: aws.String("7.7.7.7")}},
+			})
+			want = []string{
+				"old.foo.example.com. A 1.1.1.1",
+				"web.foo.example.com. A 7.7.7.7",
+			}
+		}
+		err = s.applyPlan(context.Background(), p)
+		if drift != errors.Is(err, errDrifted) {
+			t.Fatalf("drift=%v: got error %v", drift, err)
+		}
+		if !drift && err != nil {
+			t.Fatal(err)
+		}
+		if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+			t.Fatalf("drift=%v: zone state mismatch\ngot:\n%s\nwant:\n%s", drift,
+				strings.Join(got, "\n"), strings.Join(want, "\n"))
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+// policyTag is the instance tag setting routing policy of its record sets
+// with a single JSON object, see parsePolicy
+const policyTag = "dns:policy"
+
+// policyFailover is the routingPolicy type of failover record sets; other
+// types are named as -group-policy values
+const policyFailover = "failover"
+
+// maxSetIDLen is the maximum length of Route 53 record set identifier
+const maxSetIDLen = 128
+
+// routingPolicy is the routing configuration of instance record sets set by
+// policyTag
+type routingPolicy struct {
+	Type   string `json:"type"`             // weighted, latency, failover or multivalue
+	SetID  string `json:"set-id,omitempty"` // instance id if empty
+	Weight *int64 `json:"weight,omitempty"` // for weighted, defaultWeight if unset
+	Region string `json:"region,omitempty"` // for latency, instance region if empty
+	Role   string `json:"role,omitempty"`   // for failover, PRIMARY or SECONDARY
+}
+
+// parsePolicy parses policyTag value, like
+//
+//	{"type":"weighted","weight":10,"set-id":"blue"}
+//
+// Type is required, other fields only apply to some types: "weight" to
+// weighted, "region" to latency, and "role" to failover policy.
+func parsePolicy(s string) (*routingPolicy, error) {
+	var p routingPolicy
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("invalid policy %q: %w", s, err)
+	}
+	p.Type = strings.ToLower(p.Type)
+	p.Role = strings.ToUpper(p.Role)
+	if len(p.SetID) > maxSetIDLen {
+		return nil, fmt.Errorf("set-id is longer than %d characters", maxSetIDLen)
+	}
+	if p.Weight != nil && p.Type != groupWeighted {
+		return nil, fmt.Errorf("weight cannot be set for %q policy", p.Type)
+	}
+	if p.Region != "" && p.Type != groupLatency {
+		return nil, fmt.Errorf("region cannot be set for %q policy", p.Type)
+	}
+	if p.Role != "" && p.Type != policyFailover {
+		return nil, fmt.Errorf("role cannot be set for %q policy", p.Type)
+	}
+	switch p.Type {
+	case groupWeighted:
+		if p.Weight != nil && (*p.Weight < 0 || *p.Weight > maxWeight) {
+			return nil, fmt.Errorf("invalid weight %d, must be between 0 and %d", *p.Weight, maxWeight)
+		}
+	case groupLatency, groupMultivalue:
+	case policyFailover:
+		switch p.Role {
+		case route53.ResourceRecordSetFailoverPrimary, route53.ResourceRecordSetFailoverSecondary:
+		default:
+			return nil, fmt.Errorf("invalid failover role %q, must be PRIMARY or SECONDARY", p.Role)
+		}
+	case "":
+		return nil, errors.New("policy type is not set")
+	default:
+		return nil, fmt.Errorf("unsupported policy type %q", p.Type)
+	}
+	return &p, nil
+}
+
+// hasPolicy reports whether any instance of the group has policyTag set
+func hasPolicy(group []desiredRecord) bool {
+	for _, d := range group {
+		if tagValue(d.inst, policyTag) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// policyRecords returns record sets for the group of instances sharing the
+// same name, sorted by instance id, routed as set by their policyTag. Route 53
+// requires record sets of the same name to share routing policy, so the
+// policy type of the first instance with a valid tag applies to the whole
+// group, and instances without valid tag or of other policy types are
+// skipped, as are instances reusing set identifiers or failover roles already
+// taken. Skipped instances are counted in st.Skipped.
+func (s *syncer) policyRecords(group []desiredRecord, st *runStats) []desiredRecord {
+	policies := make(map[*ec2.Instance]*routingPolicy, len(group))
+	var typ string
+	var valid []desiredRecord
+	for _, d := range group {
+		p, err := parsePolicy(tagValue(d.inst, policyTag))
+		if err != nil {
+			logMsg("skipping instance without valid routing policy", "record_name", *d.rr.Name,
+				"instance_id", aws.StringValue(d.inst.InstanceId), "error", err)
+			st.skip(d.inst, "no valid routing policy")
+			continue
+		}
+		if typ == "" {
+			typ = p.Type
+		}
+		if p.Type != typ {
+			logMsg("skipping instance with routing policy of other type", "record_name", *d.rr.Name,
+				"instance_id", aws.StringValue(d.inst.InstanceId), "policy", p.Type, "group_policy", typ)
+			st.skip(d.inst, "routing policy differs from "+typ)
+			continue
+		}
+		policies[d.inst] = p
+		valid = append(valid, d)
+	}
+	if len(valid) == 0 {
+		return nil
+	}
+	// multivalue answer routing does not support CNAME records
+	members := homogenize(valid, typ == groupMultivalue)
+	skipDropped(st, valid, members)
+	var out []desiredRecord
+	setIDs := make(map[string]string) // record type and set identifier to instance id
+	roles := make(map[string]string)  // record type and failover role to instance id
+	for _, d := range members {
+		id, p := aws.StringValue(d.inst.InstanceId), policies[d.inst]
+		setID := p.SetID
+		if setID == "" {
+			setID = id
+		}
+		if other, ok := setIDs[*d.rr.Type+" "+setID]; ok {
+			logMsg("skipping instance with already taken set identifier", "record_name", *d.rr.Name,
+				"instance_id", id, "set_identifier", setID, "other_instance_id", other)
+			st.skip(d.inst, "set identifier taken by "+other)
+			continue
+		}
+		switch typ {
+		case groupWeighted:
+			d.rr.Weight = aws.Int64(defaultWeight)
+			if p.Weight != nil {
+				d.rr.Weight = aws.Int64(*p.Weight)
+			}
+		case groupLatency:
+			region := p.Region
+			if region == "" {
+				region = instanceRegion(d.inst)
+			}
+			if region == "" {
+				logMsg("skipping instance of unknown region", "record_name", *d.rr.Name, "instance_id", id)
+				st.skip(d.inst, "unknown region")
+				continue
+			}
+			d.rr.Region = aws.String(region)
+		case groupMultivalue:
+			d.rr.MultiValueAnswer = aws.Bool(true)
+		case policyFailover:
+			if other, ok := roles[*d.rr.Type+" "+p.Role]; ok {
+				logMsg("skipping instance with already taken failover role", "record_name", *d.rr.Name,
+					"instance_id", id, "role", p.Role, "other_instance_id", other)
+				st.skip(d.inst, "failover role taken by "+other)
+				continue
+			}
+			roles[*d.rr.Type+" "+p.Role] = id
+			d.rr.Failover = aws.String(p.Role)
+		}
+		setIDs[*d.rr.Type+" "+setID] = id
+		d.rr.SetIdentifier = aws.String(setID)
+		out = append(out, d)
+	}
+	return out
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func TestParsePolicy(t *testing.T) {
+	p, err := parsePolicy(`{"type":"Weighted","weight":10,"set-id":"blue"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Type != groupWeighted || p.SetID != "blue" || p.Weight == nil || *p.Weight != 10 {
+		t.Fatalf("got %+v", p)
+	}
+	for _, s := range []string{
+		``,
+		`weighted`,
+		`{}`,
+		`{"type":"geo"}`,
+		`{"type":"weighted","weight":256}`,
+		`{"type":"latency","weight":1}`,
+		`{"type":"failover"}`,
+		`{"type":"failover","role":"tertiary"}`,
+		`{"type":"multivalue","region":"us-east-1"}`,
+		`{"type":"weighted","set_id":"blue"}`,
+		`{"type":"weighted","set-id":"` + strings.Repeat("x", maxSetIDLen+1) + `"}`,
+	} {
+		if _, err := parsePolicy(s); err == nil {
+			t.Errorf("policy %q accepted", s)
+		}
+	}
+}
+
+func TestReconcile_policy(t *testing.T) {
+	r53svc := newFakeRoute53(t)
+	s := &syncer{
+		ec2: &fakeEC2{instances: []*ec2.Instance{
+			withTag(withTag(testInstance("i-1", "web", "", "1.2.3.4"), policyTag,
+				`{"type":"weighted","weight":90,"set-id":"blue"}`), weightTag, "5"),
+			withTag(testInstance("i-2", "web", "", "5.6.7.8"), policyTag, `{"type":"weighted","set-id":"green"}`),
+			withTag(testInstance("i-3", "web", "", "9.9.9.9"), policyTag, `{"type":"weighted","set-id":"blue"}`),
+			withTag(testInstance("i-4", "web", "", "4.4.4.4"), policyTag, `{"type":"latency"}`),
+			testInstance("i-5", "web", "", "5.5.5.5"),
+			withTag(testInstance("i-6", "db", "", "3.3.3.3"), policyTag, `{"type":"failover","role":"primary"}`),
+			withTag(testInstance("i-7", "db", "", "7.7.7.7"), policyTag, `{"type":"failover","role":"SECONDARY"}`),
+			withTag(testInstance("i-8", "api", "ec2-8-8-8-8.compute.amazonaws.com", "8.8.8.8"), policyTag,
+				`{"type":"multivalue"}`),
+			withTag(testInstance("i-9", "ci", "", "2.2.2.2"), policyTag, `{"type":"latency","region":"eu-west-1"}`),
+		}},
+		r53:    r53svc,
+		suffix: ".foo.example.com",
+		zoneID: "Z1",
+	}
+	var st runStats
+	if err := s.update(context.Background(), "", &st); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"api.foo.example.com. A 8.8.8.8 set=i-8 multivalue",
+		"ci.foo.example.com. A 2.2.2.2 set=i-9 region=eu-west-1",
+		"db.foo.example.com. A 3.3.3.3 set=i-6 failover=PRIMARY",
+		"db.foo.example.com. A 7.7.7.7 set=i-7 failover=SECONDARY",
+		"web.foo.example.com. A 1.2.3.4 set=blue weight=90",
+		"web.foo.example.com. A 5.6.7.8 set=green weight=1",
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if st.Skipped != 3 {
+		t.Fatalf("got %d skipped instances, want 3", st.Skipped)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+// probeTag is the instance tag overriding default probe spec
+const probeTag = "dns:probe"
+
+// defaultProbeTimeout is how long to wait for probed port to accept connection
+const defaultProbeTimeout = 3 * time.Second
+
+// probeParallelism is how many instances are probed concurrently
+const probeParallelism = 16
+
+// parseProbe parses probe spec in "tcp:port" format, like "tcp:22", returning
+// the port. It returns zero port for "none".
+func parseProbe(s string) (int, error) {
+	if s == "none" {
+		return 0, nil
+	}
+	proto, port, ok := strings.Cut(s, ":")
+	if !ok || proto != "tcp" {
+		return 0, fmt.Errorf("invalid probe %q, want tcp:port", s)
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return 0, fmt.Errorf("invalid probe %q: bad port", s)
+	}
+	return n, nil
+}
+
+// instanceProbe returns port to probe the instance on: the one set by its
+// probeTag, or the default one. It returns zero if the instance is not to be
+// probed.
+func (s *syncer) instanceProbe(inst *ec2.Instance) int {
+	v := tagValue(inst, probeTag)
+	if v == "" {
+		return s.probePort
+	}
+	port, err := parseProbe(v)
+	if err != nil {
+		logMsg("ignoring instance tag", "instance_id", aws.StringValue(inst.InstanceId), "tag", probeTag, "error", err)
+		return s.probePort
+	}
+	return port
+}
+
+// probeNew probes addresses of desired records which don't exist yet, and
+// returns keys of the ones which don't answer on their instance probe port
+// within s.probeTimeout. Such records are not created until the next update,
+// so that names of instances still booting don't get published.
+func (s *syncer) probeNew(ctx context.Context, desired []desiredRecord, existing map[string]*record, st *runStats) map[string]bool {
+	type target struct {
+		addr string
+		inst *ec2.Instance
+		keys []string
+	}
+	var targets []*target
+	byAddr := make(map[string]*target)
+	for _, d := range desired {
+		rr := d.rr
+		if existing[recordKey(rr)] != nil || rr.AliasTarget != nil || len(rr.ResourceRecords) == 0 {
+			continue
+		}
+		switch aws.StringValue(rr.Type) {
+		case route53.RRTypeA, route53.RRTypeAaaa, route53.RRTypeCname:
+		default:
+			continue
+		}
+		port := s.instanceProbe(d.inst)
+		if port == 0 {
+			continue
+		}
+		addr := net.JoinHostPort(aws.StringValue(rr.ResourceRecords[0].Value), strconv.Itoa(port))
+		t := byAddr[addr]
+		if t == nil {
+			t = &target{addr: addr, inst: d.inst}
+			byAddr[addr] = t
+			targets = append(targets, t)
+		}
+		t.keys = append(t.keys, recordKey(rr))
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+	units := make([]string, len(targets))
+	for i, t := range targets {
+		units[i] = t.addr
+	}
+	timeout := s.probeTimeout
+	if timeout <= 0 {
+		timeout = defaultProbeTimeout
+	}
+	var mu sync.Mutex
+	unready, skipped := make(map[string]bool), make(map[*ec2.Instance]bool)
+	_ = parallel(ctx, probeParallelism, units, func(ctx context.Context, i int) error {
+		t := targets[i]
+		d := net.Dialer{Timeout: timeout}
+		conn, err := d.DialContext(ctx, "tcp", t.addr)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		logMsg("instance does not answer probe yet, deferring its record", "instance_id",
+			aws.StringValue(t.inst.InstanceId), "address", t.addr, "error", err)
+		mu.Lock()
+		defer mu.Unlock()
+		if !skipped[t.inst] {
+			skipped[t.inst] = true
+			st.skip(t.inst, "not answering probe on "+t.addr)
+		}
+		for _, k := range t.keys {
+			unready[k] = true
+		}
+		return nil
+	})
+	return unready
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func TestProbe(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+	optOut := testInstance("i-4", "batch", "", "127.0.0.4")
+	optOut.Tags = append(optOut.Tags, &ec2.Tag{Key: aws.String(probeTag), Value: aws.String("none")})
+	r53svc := newFakeRoute53(t, "ci.foo.example.com. A 127.0.0.3")
+	s := &syncer{
+		ec2: &fakeEC2{instances: []*ec2.Instance{
+			testInstance("i-1", "web", "", "127.0.0.1"),
+			testInstance("i-2", "db", "", "127.0.0.2"),
+			testInstance("i-3", "ci", "", "127.0.0.3"),
+			optOut,
+		}},
+		r53:       r53svc,
+		suffix:    ".foo.example.com",
+		zoneID:    "Z1",
+		probePort: port,
+	}
+	st := new(runStats)
+	if err := s.update(context.Background(), "", st); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"batch.foo.example.com. A 127.0.0.4",
+		"ci.foo.example.com. A 127.0.0.3",
+		"web.foo.example.com. A 127.0.0.1",
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if st.Skipped != 1 || st.SkippedInstances[0].InstanceID != "i-2" ||
+		!strings.Contains(st.SkippedInstances[0].Reason, "127.0.0.2:"+strconv.Itoa(port)) {
+		t.Fatalf("unexpected skipped instances: %+v", st.SkippedInstances)
+	}
+}
+
+func TestParseProbe(t *testing.T) {
+	for s, want := range map[string]int{"tcp:22": 22, "none": 0} {
+		if got, err := parseProbe(s); err != nil || got != want {
+			t.Errorf("parseProbe(%q) = %d, %v, want %d", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"22", "udp:53", "tcp:0", "tcp:ssh", "http:80/healthz"} {
+		if _, err := parseProbe(s); err == nil {
+			t.Errorf("parseProbe(%q) accepted", s)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+// provider is a DNS backend keeping records of hosted zones. Records and
+// changes are described with Route 53 types, other backends translate them to
+// and from their own representation. Reconciliation only reads and writes
+// records through provider, so that instance discovery doesn't depend on the
+// backend.
+type provider interface {
+	// list calls fn for record sets of the zone in Route 53 order, starting
+	// from record sets with the given name and type, if set, until fn
+	// returns false. Names of record sets are unescaped, see unescapeName.
+	list(ctx context.Context, zoneID, startName, startType string, fn func(*route53.ResourceRecordSet) bool) error
+	// apply applies changes to the zone as a single atomic batch with the
+	// given comment, and returns id of the change, if backend has one
+	apply(ctx context.Context, zoneID, comment string, changes []*route53.Change) (string, error)
+	// zoneInfo returns details of the zone
+	zoneInfo(ctx context.Context, zoneID string) (zoneInfo, error)
+}
+
+// zoneInfo describes a hosted zone
+type zoneInfo struct {
+	Name        string   // domain name, without trailing dot
+	Private     bool     // if set, zone is only resolvable from associated VPCs
+	VPCs        []string // ids of VPCs private zone is associated with
+	NameServers []string // authoritative nameservers of public zone
+}
+
+// provider returns backend records are kept in: s.dns if set, or Route 53
+// accessed through s.r53
+func (s *syncer) provider() provider {
+	if s.dns != nil {
+		return s.dns
+	}
+	return route53Provider{svc: s.r53, pageSize: s.listPageSize, interval: s.listPageInterval}
+}
+
+// route53Provider is provider keeping records in Route 53 hosted zones
+type route53Provider struct {
+	svc      route53Client
+	pageSize int           // if set, record sets are listed in pages of this size
+	interval time.Duration // if set, minimum interval between listing page requests
+}
+
+func (p route53Provider) list(ctx context.Context, zoneID, startName, startType string, fn func(*route53.ResourceRecordSet) bool) error {
+	in := &route53.ListResourceRecordSetsInput{HostedZoneId: &zoneID}
+	if startName != "" {
+		in.StartRecordName = aws.String(escapeName(startName))
+	}
+	if startType != "" {
+		in.StartRecordType = &startType
+	}
+	if p.pageSize > 0 {
+		in.MaxItems = aws.String(strconv.Itoa(p.pageSize))
+	}
+	next, cancelled := time.Now(), false
+	err := p.svc.ListResourceRecordSetsPagesWithContext(ctx, in, func(page *route53.ListResourceRecordSetsOutput, lastPage bool) bool {
+		for _, rr := range page.ResourceRecordSets {
+			if !fn(unescapeName(rr)) {
+				return false
+			}
+		}
+		if next = next.Add(p.interval); lastPage || p.interval <= 0 {
+			return true
+		}
+		t := time.NewTimer(time.Until(next))
+		defer t.Stop()
+		select {
+		case <-ctx.Done():
+			cancelled = true
+			return false
+		case <-t.C:
+			return true
+		}
+	})
+	if err == nil && cancelled {
+		err = ctx.Err()
+	}
+	return err
+}
+
+func (p route53Provider) apply(ctx context.Context, zoneID, comment string, changes []*route53.Change) (string, error) {
+	out, err := p.svc.ChangeResourceRecordSetsWithContext(ctx, &route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: &zoneID,
+		ChangeBatch: &route53.ChangeBatch{
+			Changes: escapeNames(changes),
+			Comment: &comment,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	if out.ChangeInfo == nil {
+		return "", nil
+	}
+	return aws.StringValue(out.ChangeInfo.Id), nil
+}
+
+func (p route53Provider) zoneInfo(ctx context.Context, zoneID string) (zoneInfo, error) {
+	out, err := p.svc.GetHostedZoneWithContext(ctx, &route53.GetHostedZoneInput{Id: &zoneID})
+	if err != nil {
+		return zoneInfo{}, err
+	}
+	if out.HostedZone == nil || aws.StringValue(out.HostedZone.Name) == "" {
+		return zoneInfo{}, fmt.Errorf("hosted zone %s has no name", zoneID)
+	}
+	info := zoneInfo{Name: strings.TrimSuffix(*out.HostedZone.Name, ".")}
+	if out.HostedZone.Config != nil {
+		info.Private = aws.BoolValue(out.HostedZone.Config.PrivateZone)
+	}
+	for _, vpc := range out.VPCs {
+		info.VPCs = append(info.VPCs, aws.StringValue(vpc.VPCId))
+	}
+	if out.DelegationSet != nil {
+		info.NameServers = aws.StringValueSlice(out.DelegationSet.NameServers)
+	}
+	return info, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+func TestReconcile_provider(t *testing.T) {
+	p := &memProvider{records: map[string]*route53.ResourceRecordSet{}}
+	p.apply(context.Background(), "Z1", "", []*route53.Change{{
+		Action: aws.String(route53.ChangeActionUpsert),
+		ResourceRecordSet: &route53.ResourceRecordSet{Name: aws.String("old.foo.example.com."), Type: aws.String("A"),
+			TTL: aws.Int64(60), ResourceRecords: []*route53.ResourceRecord{{Value: aws.String("9.9.9.9")}}},
+	}})
+	ec2svc := &fakeEC2{instances: []*ec2.Instance{
+		testInstance("i-1", "web", "", "1.2.3.4"),
+		testInstance("i-2", "db", "", "5.6.7.8"),
+	}}
+	// no Route 53 client at all
+	s := &syncer{ec2: ec2svc, dns: p, suffix: ".foo.example.com", zoneID: "Z1", ttl: defaultTTL}
+	ctx := context.Background()
+	if err := s.update(ctx, "", new(runStats)); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := p.dump(), []string{"db.foo.example.com. A", "web.foo.example.com. A"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	ec2svc.instances[1] = stopped(ec2svc.instances[1])
+	if err := s.removeInstance(ctx, "i-2"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := p.dump(), []string{"web.foo.example.com. A"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q after removal, want %q", got, want)
+	}
+}
+
+func TestRoute53Provider_zoneInfo(t *testing.T) {
+	svc := newFakeRoute53(t)
+	svc.zones = []*route53.HostedZone{{Id: aws.String("/hostedzone/Z1"), Name: aws.String("example.com."),
+		Config: &route53.HostedZoneConfig{PrivateZone: aws.Bool(true)}}}
+	svc.vpcs = []*route53.VPC{{VPCId: aws.String("vpc-1")}}
+	got, err := route53Provider{svc: svc}.zoneInfo(context.Background(), "Z1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (zoneInfo{Name: "example.com", Private: true, VPCs: []string{"vpc-1"}}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+// memProvider is provider keeping records of a single zone in memory
+type memProvider struct {
+	records map[string]*route53.ResourceRecordSet // by recordKey
+}
+
+func (p *memProvider) list(_ context.Context, _, startName, _ string, fn func(*route53.ResourceRecordSet) bool) error {
+	var sets []*route53.ResourceRecordSet
+	for _, rr := range p.records {
+		if startName == "" || r53order(*rr.Name) >= r53order(startName) {
+			sets = append(sets, rr)
+		}
+	}
+	sort.Slice(sets, func(i, j int) bool { return r53order(*sets[i].Name) < r53order(*sets[j].Name) })
+	for _, rr := range sets {
+		if !fn(rr) {
+			break
+		}
+	}
+	return nil
+}
+
+func (p *memProvider) apply(_ context.Context, _, _ string, changes []*route53.Change) (string, error) {
+	for _, ch := range changes {
+		rr := *ch.ResourceRecordSet
+		rr.Name = aws.String(strings.TrimSuffix(*rr.Name, ".") + ".")
+		switch key := recordKey(&rr); aws.StringValue(ch.Action) {
+		case route53.ChangeActionDelete:
+			delete(p.records, key)
+		default:
+			p.records[key] = &rr
+		}
+	}
+	return "", nil
+}
+
+func (p *memProvider) zoneInfo(context.Context, string) (zoneInfo, error) {
+	return zoneInfo{Name: "foo.example.com"}, nil
+}
+
+// dump returns sorted names and types of records
+func (p *memProvider) dump() []string {
+	var out []string
+	for _, rr := range p.records {
+		out = append(out, fmt.Sprintf("%s %s", aws.StringValue(rr.Name), aws.StringValue(rr.Type)))
+	}
+	sort.Strings(out)
+	return out
+}
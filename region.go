@@ -0,0 +1,32 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// instanceRegion returns region of the instance derived from its availability
+// zone, like "us-east-1" for "us-east-1a" or "us-west-2" for local zone
+// "us-west-2-lax-1a". It returns empty string if region is unknown.
+func instanceRegion(inst *ec2.Instance) string {
+	if inst.Placement == nil {
+		return ""
+	}
+	// region name ends with the first element starting with a digit,
+	// availability zone adds a letter to it, or more elements for local
+	// and wavelength zones
+	parts := strings.Split(aws.StringValue(inst.Placement.AvailabilityZone), "-")
+	for i, p := range parts {
+		if i == 0 || p == "" || p[0] < '0' || p[0] > '9' {
+			continue
+		}
+		n := 0
+		for n < len(p) && p[n] >= '0' && p[n] <= '9' {
+			n++
+		}
+		return strings.Join(parts[:i], "-") + "-" + p[:n]
+	}
+	return ""
+}
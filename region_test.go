@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func TestInstanceRegion(t *testing.T) {
+	for az, want := range map[string]string{
+		"us-east-1a":              "us-east-1",
+		"eu-central-1c":           "eu-central-1",
+		"us-gov-west-1b":          "us-gov-west-1",
+		"us-west-2-lax-1a":        "us-west-2",
+		"us-east-1-wl1-bos-wlz-1": "us-east-1",
+		"":                        "",
+	} {
+		inst := &ec2.Instance{Placement: &ec2.Placement{AvailabilityZone: aws.String(az)}}
+		if got := instanceRegion(inst); got != want {
+			t.Errorf("%q: got %q, want %q", az, got, want)
+		}
+	}
+	if got := instanceRegion(&ec2.Instance{}); got != "" {
+		t.Errorf("got %q for instance without placement", got)
+	}
+}
+
+func TestReconcile_latency(t *testing.T) {
+	inRegion := func(inst *ec2.Instance, az string) *ec2.Instance {
+		inst.Placement = &ec2.Placement{AvailabilityZone: aws.String(az)}
+		return inst
+	}
+	r53svc := newFakeRoute53(t, "web.foo.example.com. A 1.2.3.4")
+	s := &syncer{
+		ec2: &fakeEC2{instances: []*ec2.Instance{
+			inRegion(testInstance("i-1", "web", "", "1.2.3.4"), "us-east-1a"),
+			inRegion(testInstance("i-3", "db", "", "3.3.3.3"), "us-east-1b"),
+		}},
+		remotes: []remoteEC2{{name: "eu-west-1", ec2: &fakeEC2{instances: []*ec2.Instance{
+			inRegion(testInstance("i-2", "web", "", "5.6.7.8"), "eu-west-1c"),
+			testInstance("i-4", "web", "", "9.9.9.9"),
+		}}}},
+		r53:         r53svc,
+		suffix:      ".foo.example.com",
+		zoneID:      "Z1",
+		groupPolicy: groupLatency,
+	}
+	var st runStats
+	if err := s.update(context.Background(), "", &st); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"db.foo.example.com. A 3.3.3.3",
+		"web.foo.example.com. A 1.2.3.4 set=i-1 region=us-east-1",
+		"web.foo.example.com. A 5.6.7.8 set=i-2 region=eu-west-1",
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if st.Skipped != 1 {
+		t.Fatalf("got %d skipped instances, want 1", st.Skipped)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/organizations"
+)
+
+// remoteEC2 is ec2 client of an additional region or account instances are
+// discovered in
+type remoteEC2 struct {
+	name string // region, or account id and region, like "123456789012/us-east-1"
+	ec2  ec2Client
+}
+
+// remoteClients returns ec2 clients of additional regions in the session
+// account, and of the session region and additional regions in accounts of
+// roles, using credentials of these roles
+func remoteClients(sess *session.Session, regions, roles []string) ([]remoteEC2, error) {
+	all := []string{aws.StringValue(sess.Config.Region)}
+	for _, region := range regions {
+		if region != all[0] {
+			all = append(all, region)
+		}
+	}
+	var out []remoteEC2
+	for _, region := range all[1:] {
+		out = append(out, remoteEC2{name: region, ec2: ec2.New(sess, aws.NewConfig().WithRegion(region))})
+	}
+	for _, role := range roles {
+		a, err := arn.Parse(role)
+		if err != nil {
+			return nil, fmt.Errorf("invalid role ARN %q: %w", role, err)
+		}
+		creds := stscreds.NewCredentials(sess, role)
+		for _, region := range all {
+			out = append(out, remoteEC2{
+				name: a.AccountID + "/" + region,
+				ec2:  ec2.New(sess, aws.NewConfig().WithCredentials(creds).WithRegion(region)),
+			})
+		}
+	}
+	return out, nil
+}
+
+// organizationsClient is a subset of Organizations API used by the program
+type organizationsClient interface {
+	ListAccountsPagesWithContext(aws.Context, *organizations.ListAccountsInput, func(*organizations.ListAccountsOutput, bool) bool, ...request.Option) error
+}
+
+// orgRoles returns ARNs of role with the given name in active accounts of the
+// organization, except for the account with skip id
+func orgRoles(ctx context.Context, svc organizationsClient, role, skip string) ([]string, error) {
+	var out []string
+	fn := func(page *organizations.ListAccountsOutput, lastPage bool) bool {
+		for _, acc := range page.Accounts {
+			id := aws.StringValue(acc.Id)
+			if id == skip || aws.StringValue(acc.Status) != organizations.AccountStatusActive {
+				continue
+			}
+			partition := "aws"
+			if a, err := arn.Parse(aws.StringValue(acc.Arn)); err == nil {
+				partition = a.Partition
+			}
+			out = append(out, "arn:"+partition+":iam::"+id+":role/"+role)
+		}
+		return true
+	}
+	if err := svc.ListAccountsPagesWithContext(ctx, &organizations.ListAccountsInput{}, fn); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// splitList returns non-empty elements of comma-separated list
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
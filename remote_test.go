@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/organizations"
+)
+
+func TestRemoteClients(t *testing.T) {
+	sess, err := session.NewSession(aws.NewConfig().WithRegion("us-east-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	remotes, err := remoteClients(sess, []string{"eu-west-1", "us-east-1"},
+		[]string{"arn:aws:iam::111111111111:role/awsns"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, rc := range remotes {
+		got = append(got, rc.name)
+	}
+	want := []string{"eu-west-1", "111111111111/us-east-1", "111111111111/eu-west-1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got clients %q, want %q", got, want)
+	}
+	if _, err := remoteClients(sess, nil, []string{"awsns"}); err == nil {
+		t.Fatal("invalid role ARN accepted")
+	}
+}
+
+type fakeOrganizations struct {
+	accounts []*organizations.Account
+}
+
+func (f *fakeOrganizations) ListAccountsPagesWithContext(_ aws.Context, _ *organizations.ListAccountsInput, fn func(*organizations.ListAccountsOutput, bool) bool, _ ...request.Option) error {
+	for i, acc := range f.accounts {
+		if !fn(&organizations.ListAccountsOutput{Accounts: []*organizations.Account{acc}}, i == len(f.accounts)-1) {
+			break
+		}
+	}
+	return nil
+}
+
+func TestOrgRoles(t *testing.T) {
+	account := func(id, status string) *organizations.Account {
+		return &organizations.Account{
+			Id:     aws.String(id),
+			Arn:    aws.String("arn:aws-cn:organizations::111111111111:account/o-1/" + id),
+			Status: aws.String(status),
+		}
+	}
+	svc := &fakeOrganizations{accounts: []*organizations.Account{
+		account("111111111111", organizations.AccountStatusActive),
+		account("222222222222", organizations.AccountStatusActive),
+		account("333333333333", organizations.AccountStatusSuspended),
+		account("444444444444", organizations.AccountStatusActive),
+	}}
+	got, err := orgRoles(context.Background(), svc, "dns-reader", "111111111111")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"arn:aws-cn:iam::222222222222:role/dns-reader",
+		"arn:aws-cn:iam::444444444444:role/dns-reader",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got roles %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+// runStats describes outcome of a single reconciliation run
+type runStats struct {
+	Instances int // managed running instances considered
+	Managed   int // records that should exist
+	Upserted  int // records upserted
+	Deleted   int // records deleted
+	Skipped   int // running instances without valid name or public address, or not answering probe
+	Conflicts int // names shared by several instances without group policy
+	Duration  time.Duration
+
+	SkippedInstances []skippedInstance // details of Skipped
+	ChangeIDs        []string          // ids of applied change batches
+}
+
+// skippedInstance describes instance which got no record
+type skippedInstance struct {
+	InstanceID string `json:"instance_id"`
+	Name       string `json:"name"`
+	Reason     string `json:"reason"`
+}
+
+// skip records that instance got no record for the given reason
+func (st *runStats) skip(inst *ec2.Instance, reason string) {
+	debugMsg("instance gets no record", "instance_id", aws.StringValue(inst.InstanceId), "name", nameTag(inst),
+		"reason", reason)
+	st.Skipped++
+	st.SkippedInstances = append(st.SkippedInstances, skippedInstance{
+		InstanceID: aws.StringValue(inst.InstanceId),
+		Name:       nameTag(inst),
+		Reason:     reason,
+	})
+}
+
+// report passes statistics of a finished reconciliation run to configured
+// metrics sinks; err is the run result
+func (s *syncer) report(ctx context.Context, st runStats, err error) {
+	s.metrics.observe(st, err)
+	if s.cw != nil {
+		if err := publishCloudWatch(ctx, s.cw, s.zoneID, st, err); err != nil {
+			logMsg("publishing CloudWatch metrics", "zone_id", s.zoneID, "error", err)
+		}
+	}
+	if s.statsd != nil {
+		if err := s.statsd.publish(st, err); err != nil {
+			logMsg("sending statsd metrics", "zone_id", s.zoneID, "error", err)
+		}
+	}
+	if s.summary != nil {
+		if err := writeSummary(s.summary, s.zoneID, s.env, st, err); err != nil {
+			logMsg("writing run summary", "zone_id", s.zoneID, "error", err)
+		}
+	}
+}
+
+// writeSummary writes run statistics to w as a single-line JSON object; env
+// is the environment name of per-environment syncer, err is the run result
+func writeSummary(w io.Writer, zoneID, env string, st runStats, err error) error {
+	out := struct {
+		ZoneID      string            `json:"zone_id"`
+		Environment string            `json:"environment,omitempty"`
+		Instances   int               `json:"instances"`
+		Upserted    int               `json:"upserted"`
+		Deleted     int               `json:"deleted"`
+		Skipped     []skippedInstance `json:"skipped"`
+		ChangeIDs   []string          `json:"change_ids"`
+		Duration    float64           `json:"duration_seconds"`
+		Error       string            `json:"error,omitempty"`
+	}{
+		ZoneID:      zoneID,
+		Environment: env,
+		Instances:   st.Instances,
+		Upserted:    st.Upserted,
+		Deleted:     st.Deleted,
+		Skipped:     st.SkippedInstances,
+		ChangeIDs:   st.ChangeIDs,
+		Duration:    st.Duration.Seconds(),
+	}
+	if out.Skipped == nil {
+		out.Skipped = []skippedInstance{}
+	}
+	if out.ChangeIDs == nil {
+		out.ChangeIDs = []string{}
+	}
+	if err != nil {
+		out.Error = err.Error()
+	}
+	return json.NewEncoder(w).Encode(out)
+}
+
+// recordChange describes a single applied record change
+type recordChange struct {
+	Action     string `json:"action"` // one of: create, update, delete
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Value      string `json:"value,omitempty"`
+	InstanceID string `json:"instance_id,omitempty"`
+}
+
+// newRecordChange returns description of a Route 53 change; instanceID is the
+// instance the record belongs to, if known; existed reports whether the
+// record existed before the change.
+func newRecordChange(ch *route53.Change, instanceID string, existed bool) recordChange {
+	rr := ch.ResourceRecordSet
+	c := recordChange{
+		Action:     "create",
+		Name:       strings.TrimSuffix(aws.StringValue(rr.Name), "."),
+		Type:       aws.StringValue(rr.Type),
+		InstanceID: instanceID,
+	}
+	switch {
+	case aws.StringValue(ch.Action) == route53.ChangeActionDelete:
+		c.Action = "delete"
+	case existed:
+		c.Action = "update"
+	}
+	var values []string
+	for _, r := range rr.ResourceRecords {
+		values = append(values, aws.StringValue(r.Value))
+	}
+	c.Value = strings.Join(values, ",")
+	return c
+}
+
+// notify sends information about changes applied to the zone to configured
+// destinations
+func (s *syncer) notify(ctx context.Context, zoneID string, changes []recordChange) {
+	if len(changes) == 0 {
+		return
+	}
+	if s.sns != nil && s.snsTopic != "" {
+		if err := publishSNS(ctx, s.sns, s.snsTopic, zoneID, changes); err != nil {
+			logMsg("publishing SNS notification", "zone_id", zoneID, "error", err)
+		}
+	}
+	if s.webhook != nil {
+		if err := s.webhook.post(ctx, zoneID, changes); err != nil {
+			logMsg("posting webhook notification", "zone_id", zoneID, "error", err)
+		}
+	}
+	if s.events != nil && s.eventBus != "" {
+		if err := putEvent(ctx, s.events, s.eventBus, zoneID, changes); err != nil {
+			logMsg("sending EventBridge event", "zone_id", zoneID, "error", err)
+		}
+	}
+}
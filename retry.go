@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+const (
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 30 * time.Second
+)
+
+// retryingRoute53 wraps route53Client, retrying record listing and change
+// calls failed due to throttling with jittered exponential backoff
+type retryingRoute53 struct {
+	route53Client
+	maxRetries int
+	baseDelay  time.Duration
+}
+
+func newRetryingRoute53(svc route53Client, maxRetries int) *retryingRoute53 {
+	return &retryingRoute53{route53Client: svc, maxRetries: maxRetries, baseDelay: retryBaseDelay}
+}
+
+func (r *retryingRoute53) ListResourceRecordSetsPagesWithContext(ctx aws.Context, in *route53.ListResourceRecordSetsInput, fn func(*route53.ListResourceRecordSetsOutput, bool) bool, opts ...request.Option) error {
+	// retry resumes listing from the page that failed, right after the
+	// last page passed to fn
+	next := *in
+	return r.retry(ctx, "ListResourceRecordSets", func() error {
+		start := next
+		return r.route53Client.ListResourceRecordSetsPagesWithContext(ctx, &start, func(out *route53.ListResourceRecordSetsOutput, lastPage bool) bool {
+			next.StartRecordName, next.StartRecordType = out.NextRecordName, out.NextRecordType
+			next.StartRecordIdentifier = out.NextRecordIdentifier
+			return fn(out, lastPage)
+		}, opts...)
+	})
+}
+
+func (r *retryingRoute53) ChangeResourceRecordSetsWithContext(ctx aws.Context, in *route53.ChangeResourceRecordSetsInput, opts ...request.Option) (*route53.ChangeResourceRecordSetsOutput, error) {
+	var out *route53.ChangeResourceRecordSetsOutput
+	err := r.retry(ctx, "ChangeResourceRecordSets", func() error {
+		var err error
+		out, err = r.route53Client.ChangeResourceRecordSetsWithContext(ctx, in, opts...)
+		return err
+	})
+	return out, err
+}
+
+// retry calls fn until it succeeds, fails with non-retryable error, or
+// maxRetries retries are done
+func (r *retryingRoute53) retry(ctx context.Context, op string, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= r.maxRetries || !retryable(err) {
+			return err
+		}
+		delay := retryDelay(r.baseDelay, attempt)
+		logMsg("retrying throttled call", "operation", op, "attempt", attempt+1, "delay", delay, "error", err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// retryDelay returns random delay before retry after given number of previous
+// attempts: between half and full of base delay doubled for each attempt,
+// capped at retryMaxDelay
+func retryDelay(base time.Duration, attempt int) time.Duration {
+	limit := base
+	for i := 0; i < attempt && limit < retryMaxDelay; i++ {
+		limit *= 2
+	}
+	if limit > retryMaxDelay {
+		limit = retryMaxDelay
+	}
+	return limit/2 + time.Duration(rand.Int63n(int64(limit/2)+1))
+}
+
+// retryable reports whether err is caused by throttling or concurrent change
+// of the same zone, so the call may be retried
+func retryable(err error) bool {
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		switch aerr.Code() {
+		case route53.ErrCodePriorRequestNotComplete, route53.ErrCodeThrottlingException,
+			"Throttling", "RequestLimitExceeded":
+			return true
+		}
+	}
+	return request.IsErrorThrottle(err)
+}
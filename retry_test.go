@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+func TestRetryingRoute53(t *testing.T) {
+	throttled := awserr.New("Throttling", "Rate exceeded", nil)
+	fake := &flakyRoute53{
+		fakeRoute53: newFakeRoute53(t,
+			"a.foo.example.com. A 1.1.1.1",
+			"b.foo.example.com. A 2.2.2.2",
+			"c.foo.example.com. A 3.3.3.3",
+		),
+		listErrs:   []error{throttled, awserr.New(route53.ErrCodeThrottlingException, "slow down", nil)},
+		changeErrs: []error{awserr.New(route53.ErrCodePriorRequestNotComplete, "busy", nil)},
+	}
+	r := &retryingRoute53{route53Client: fake, maxRetries: 3, baseDelay: time.Millisecond}
+	ctx := context.Background()
+	var names []string
+	err := r.ListResourceRecordSetsPagesWithContext(ctx, &route53.ListResourceRecordSetsInput{},
+		func(page *route53.ListResourceRecordSetsOutput, _ bool) bool {
+			for _, rr := range page.ResourceRecordSets {
+				names = append(names, aws.StringValue(rr.Name))
+			}
+			return true
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a.foo.example.com.", "b.foo.example.com.", "c.foo.example.com."}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("got records %q, want %q", names, want)
+	}
+	// each retry resumes from the page that failed
+	if fake.listed != 3 {
+		t.Fatalf("listing served %d record sets, want 3", fake.listed)
+	}
+	_, err = r.ChangeResourceRecordSetsWithContext(ctx, &route53.ChangeResourceRecordSetsInput{
+		ChangeBatch: &route53.ChangeBatch{Changes: []*route53.Change{{
+			Action: aws.String("DELETE"),
+			ResourceRecordSet: &route53.ResourceRecordSet{
+				Name: aws.String("a.foo.example.com."), Type: aws.String("A"),
+			},
+		}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// non-retryable errors and exhausted retries are returned as is
+	fake.changeErrs = []error{errors.New("boom")}
+	if _, err := r.ChangeResourceRecordSetsWithContext(ctx, &route53.ChangeResourceRecordSetsInput{}); err == nil || err.Error() != "boom" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	fake.changeErrs = []error{throttled, throttled, throttled, throttled}
+	if _, err := r.ChangeResourceRecordSetsWithContext(ctx, &route53.ChangeResourceRecordSetsInput{}); err != throttled {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	for attempt, max := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		for i := 0; i < 100; i++ {
+			if d := retryDelay(time.Second, attempt); d < max/2 || d > max {
+				t.Fatalf("attempt %d: delay %v is out of [%v, %v] range", attempt, d, max/2, max)
+			}
+		}
+	}
+	if d := retryDelay(time.Second, 100); d > retryMaxDelay {
+		t.Fatalf("delay %v exceeds %v", d, retryMaxDelay)
+	}
+}
+
+// flakyRoute53 is a fakeRoute53 which calls fail with queued errors. List
+// errors are returned after delivering the first page, to exercise resumption.
+type flakyRoute53 struct {
+	*fakeRoute53
+	listErrs   []error
+	changeErrs []error
+}
+
+func (f *flakyRoute53) ListResourceRecordSetsPagesWithContext(ctx aws.Context, in *route53.ListResourceRecordSetsInput, fn func(*route53.ListResourceRecordSetsOutput, bool) bool, opts ...request.Option) error {
+	var err error
+	if len(f.listErrs) != 0 {
+		err, f.listErrs = f.listErrs[0], f.listErrs[1:]
+	}
+	if err == nil {
+		return f.fakeRoute53.ListResourceRecordSetsPagesWithContext(ctx, in, fn, opts...)
+	}
+	f.fakeRoute53.ListResourceRecordSetsPagesWithContext(ctx, in, func(page *route53.ListResourceRecordSetsOutput, lastPage bool) bool {
+		fn(page, lastPage)
+		return false
+	}, opts...)
+	return err
+}
+
+func (f *flakyRoute53) ChangeResourceRecordSetsWithContext(ctx aws.Context, in *route53.ChangeResourceRecordSetsInput, opts ...request.Option) (*route53.ChangeResourceRecordSetsOutput, error) {
+	if len(f.changeErrs) != 0 {
+		err := f.changeErrs[0]
+		if f.changeErrs = f.changeErrs[1:]; err != nil {
+			return nil, err
+		}
+	}
+	return f.fakeRoute53.ChangeResourceRecordSetsWithContext(ctx, in, opts...)
+}
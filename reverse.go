@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+// reverseName returns name of PTR record for the IP address without trailing
+// dot, like "4.3.2.1.in-addr.arpa" for 1.2.3.4, or nibble-format name under
+// ip6.arpa for IPv6 address. It returns empty string for invalid address.
+func reverseName(addr string) string {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return ""
+	}
+	var b strings.Builder
+	if v4 := ip.To4(); v4 != nil {
+		for i := len(v4) - 1; i >= 0; i-- {
+			b.WriteString(strconv.Itoa(int(v4[i])))
+			b.WriteByte('.')
+		}
+		b.WriteString("in-addr.arpa")
+		return b.String()
+	}
+	const hex = "0123456789abcdef"
+	for i := len(ip) - 1; i >= 0; i-- {
+		b.WriteByte(hex[ip[i]&0xf])
+		b.WriteByte('.')
+		b.WriteByte(hex[ip[i]>>4])
+		b.WriteByte('.')
+	}
+	b.WriteString("ip6.arpa")
+	return b.String()
+}
+
+// reverseRecords returns PTR records pointing private IPv4 and primary IPv6
+// addresses of the instances to their host names, skipping addresses outside
+// of s.reverseZone. If several instances have the same address, the one with
+// the lowest id wins.
+func (s *syncer) reverseRecords(instances []*ec2.Instance) map[string]*route53.ResourceRecordSet {
+	sorted := append([]*ec2.Instance(nil), instances...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return aws.StringValue(sorted[i].InstanceId) < aws.StringValue(sorted[j].InstanceId)
+	})
+	out := make(map[string]*route53.ResourceRecordSet)
+	for _, inst := range sorted {
+		name := s.hostName(inst)
+		if name == "" {
+			continue
+		}
+		for _, addr := range []*string{inst.PrivateIpAddress, inst.Ipv6Address} {
+			rev := reverseName(aws.StringValue(addr))
+			if rev == "" || !strings.HasSuffix(rev, s.reverseZone) {
+				continue
+			}
+			rr := &route53.ResourceRecordSet{
+				Name:            aws.String(rev + "."),
+				Type:            aws.String(route53.RRTypePtr),
+				TTL:             aws.Int64(s.instanceTTL(inst)),
+				ResourceRecords: []*route53.ResourceRecord{{Value: aws.String(name + s.suffix + ".")}},
+			}
+			if _, ok := out[recordKey(rr)]; !ok {
+				out[recordKey(rr)] = rr
+			}
+		}
+	}
+	return out
+}
+
+// listReverse returns PTR records in the reverse zone pointing to names under
+// s.suffix
+func (s *syncer) listReverse(ctx context.Context) ([]*route53.ResourceRecordSet, error) {
+	var out []*route53.ResourceRecordSet
+	fn := func(rr *route53.ResourceRecordSet) bool {
+		if aws.StringValue(rr.Type) != route53.RRTypePtr || len(rr.ResourceRecords) == 0 {
+			return true
+		}
+		if strings.HasSuffix(aws.StringValue(rr.ResourceRecords[0].Value), s.suffix+".") {
+			out = append(out, rr)
+		}
+		return true
+	}
+	if err := s.provider().list(ctx, s.reverseZoneID, "", "", fn); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// syncReverse makes PTR records in the reverse zone match instances, see
+// reverseRecords, removing records pointing under s.suffix that are not backed
+// by instances. PTR records pointing to protected names are left intact. It
+// does nothing if reverse zone is not configured.
+func (s *syncer) syncReverse(ctx context.Context, invokerID string, instances []*ec2.Instance, protected map[string]bool, st *runStats) error {
+	if s.reverseZoneID == "" {
+		return nil
+	}
+	desired := s.reverseRecords(instances)
+	if len(desired) == 0 {
+		logMsg("no instances to create PTR records for, not removing any", "zone_id", s.reverseZoneID)
+		return nil
+	}
+	records, err := s.listReverse(ctx)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]*route53.ResourceRecordSet)
+	for _, rr := range records {
+		existing[recordKey(rr)] = rr
+	}
+	keys := make([]string, 0, len(desired)+len(existing))
+	for k := range desired {
+		keys = append(keys, k)
+	}
+	for k := range existing {
+		if desired[k] == nil {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var changes []*route53.Change
+	var summary []recordChange
+	for _, k := range keys {
+		rr, old := desired[k], existing[k]
+		var ch *route53.Change
+		switch {
+		case rr == nil:
+			target := strings.TrimSuffix(aws.StringValue(old.ResourceRecords[0].Value), s.suffix+".")
+			if !s.mayDelete() || protected[target] {
+				continue
+			}
+			ch = &route53.Change{Action: aws.String("DELETE"), ResourceRecordSet: old}
+		case old == nil || !sameRecord(old, rr):
+			if !s.mayUpsert() {
+				continue
+			}
+			ch = &route53.Change{Action: aws.String("UPSERT"), ResourceRecordSet: rr}
+		default:
+			continue
+		}
+		logMsg("changing PTR record", "zone_id", s.reverseZoneID,
+			"record_name", strings.TrimSuffix(*ch.ResourceRecordSet.Name, "."), "action", *ch.Action)
+		changes = append(changes, ch)
+		summary = append(summary, newRecordChange(ch, "", old != nil))
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	changeID, err := s.applyZone(ctx, s.reverseZoneID, invokerID, "automated update of PTR records", changes, summary)
+	if err != nil {
+		return err
+	}
+	st.ChangeIDs = append(st.ChangeIDs, changeID)
+	for _, ch := range changes {
+		if *ch.Action == "DELETE" {
+			st.Deleted++
+		} else {
+			st.Upserted++
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func TestReverseName(t *testing.T) {
+	for _, tc := range []struct{ ip, want string }{
+		{"10.0.1.2", "2.1.0.10.in-addr.arpa"},
+		{"2001:db8::567:89ab", "b.a.9.8.7.6.5.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa"},
+		{"", ""},
+		{"bogus", ""},
+	} {
+		if got := reverseName(tc.ip); got != tc.want {
+			t.Errorf("reverseName(%q) = %q, want %q", tc.ip, got, tc.want)
+		}
+	}
+}
+
+func TestReconcile_reverse(t *testing.T) {
+	withPrivateIP := func(inst *ec2.Instance, ip string) *ec2.Instance {
+		inst.PrivateIpAddress = aws.String(ip)
+		return inst
+	}
+	ec2svc := &fakeEC2{instances: []*ec2.Instance{
+		withPrivateIP(testInstance("i-1", "web", "", "1.2.3.4"), "10.0.1.2"),
+		withPrivateIP(testInstance("i-2", "db", "", "5.6.7.8"), "10.0.1.3"),
+		withPrivateIP(testInstance("i-3", "vpn", "", "9.9.9.9"), "192.168.0.1"),
+	}}
+	// fake serves both zones
+	r53svc := newFakeRoute53(t,
+		"3.1.0.10.in-addr.arpa. PTR old.foo.example.com.",
+		"4.1.0.10.in-addr.arpa. PTR gone.foo.example.com.",
+		"5.1.0.10.in-addr.arpa. PTR printer.corp.example.com.",
+	)
+	s := &syncer{
+		ec2:           ec2svc,
+		r53:           r53svc,
+		suffix:        ".foo.example.com",
+		zoneID:        "Z1",
+		reverseZoneID: "Z2",
+		reverseZone:   ".10.in-addr.arpa",
+	}
+	ctx := context.Background()
+	if err := s.reconcile(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"2.1.0.10.in-addr.arpa. PTR web.foo.example.com.",
+		"3.1.0.10.in-addr.arpa. PTR db.foo.example.com.",
+		"5.1.0.10.in-addr.arpa. PTR printer.corp.example.com.",
+		"db.foo.example.com. A 5.6.7.8",
+		"vpn.foo.example.com. A 9.9.9.9",
+		"web.foo.example.com. A 1.2.3.4",
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	ec2svc.instances[1] = stopped(ec2svc.instances[1])
+	if err := s.removeInstance(ctx, "i-2"); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{
+		"2.1.0.10.in-addr.arpa. PTR web.foo.example.com.",
+		"5.1.0.10.in-addr.arpa. PTR printer.corp.example.com.",
+		"vpn.foo.example.com. A 9.9.9.9",
+		"web.foo.example.com. A 1.2.3.4",
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch after removal\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,749 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+// rfc2136Timeout limits a single exchange with DNS server, unless context
+// deadline is sooner
+const rfc2136Timeout = 30 * time.Second
+
+// rfc2136Provider is provider keeping records in a zone of DNS server
+// supporting dynamic updates (RFC 2136), like BIND. Records are listed with
+// zone transfer (AXFR). Requests are sent over TCP and signed with TSIG key,
+// if set; responses are not verified. Alias records and record sets with
+// routing policies have no equivalent there and are rejected.
+type rfc2136Provider struct {
+	server string   // host:port
+	zone   string   // zone name, without trailing dot
+	key    *tsigKey // optional
+}
+
+// withRFC2136 returns syncer updating records both with s and with another
+// syncer keeping records with private addresses of the same instances on
+// cfg.RFC2136Server, under the same suffix. Alias records, PTR records and
+// health checks are only kept with s.
+func withRFC2136(s *syncer, cfg config) (*syncer, error) {
+	switch {
+	case cfg.MetricsAddr != "":
+		return nil, errors.New("-metrics-addr cannot be used with -rfc2136-server")
+	case s.groupPolicy != "":
+		return nil, errors.New("-group-policy cannot be used with -rfc2136-server")
+	}
+	if _, _, err := net.SplitHostPort(cfg.RFC2136Server); err != nil {
+		return nil, fmt.Errorf("invalid -rfc2136-server: %w", err)
+	}
+	zone := strings.ToLower(strings.Trim(cfg.RFC2136Zone, "."))
+	if zone == "" {
+		zone = strings.Trim(s.suffix, ".")
+	}
+	if !strings.HasSuffix("."+strings.Trim(s.suffix, ".")+".", "."+zone+".") {
+		return nil, fmt.Errorf("suffix %q is not within -rfc2136-zone %q", s.suffix, zone)
+	}
+	key, err := parseTSIGKey(cfg.RFC2136Key)
+	if err != nil {
+		return nil, err
+	}
+	// m only shares with s the settings selecting instances and their
+	// records; notifications, audit trail, snapshots, locks and other side
+	// effects of updates are only done for Route 53
+	m := &syncer{
+		ec2:    s.ec2,
+		dns:    &rfc2136Provider{server: cfg.RFC2136Server, zone: zone, key: key},
+		suffix: s.suffix,
+		zoneID: zone,
+		ttl:    s.ttl,
+
+		ignoreTag: s.ignoreTag,
+		filters:   s.filters,
+		exclude:   s.exclude,
+
+		managePattern: s.managePattern,
+		ignorePattern: s.ignorePattern,
+
+		sanitize:     s.sanitize,
+		idn:          s.idn,
+		keepStopped:  s.keepStopped,
+		fallbackName: s.fallbackName,
+		eksCluster:   s.eksCluster,
+
+		budget: s.budget,
+
+		onConflict:    s.onConflict,
+		mode:          s.mode,
+		prefer:        s.prefer,
+		fastLaunch:    s.fastLaunch,
+		deletionGrace: s.deletionGrace,
+
+		expectChanges: s.expectChanges,
+		summary:       s.summary,
+		confirm:       s.confirm,
+		comment:       s.comment,
+
+		probePort:    s.probePort,
+		probeTimeout: s.probeTimeout,
+
+		minAge: s.minAge,
+
+		addressWait:       s.addressWait,
+		addressRetryDelay: s.addressRetryDelay,
+
+		noEC2:   s.noEC2,
+		sources: s.sources,
+
+		twoPhase:    s.twoPhase,
+		keepOnError: s.keepOnError,
+
+		coexist: s.coexist,
+
+		env: "rfc2136",
+
+		privateAddresses: true,
+
+		rds:         s.rds,
+		elasticache: s.elasticache,
+		dbTag:       s.dbTag,
+
+		ecs:        s.ecs,
+		enis:       s.enis,
+		ecsCluster: s.ecsCluster,
+
+		lightsail: s.lightsail,
+
+		manifest: s.manifest,
+
+		remotes:     s.remotes,
+		parallelism: s.parallelism,
+		pageSize:    s.pageSize,
+
+		srv:         s.srv,
+		txtMetadata: s.txtMetadata,
+		dualstack:   s.dualstack,
+	}
+	s.env = "route53"
+	return &syncer{
+		parallelism: s.parallelism,
+		envs:        []envSyncer{{env: s.env, syncer: s}, {env: m.env, syncer: m}},
+		// state-change events are dispatched by router
+		asg:          s.asg,
+		keepStopped:  s.keepStopped,
+		stateActions: s.stateActions,
+	}, nil
+}
+
+// DNS protocol constants used by rfc2136Provider
+const (
+	dnsClassIN  = 1
+	dnsClassAny = 255
+
+	dnsTypeSOA  = 6
+	dnsTypeTSIG = 250
+	dnsTypeAXFR = 252
+
+	dnsOpcodeUpdate = 5
+)
+
+// dnsTypes maps names of record types rfc2136Provider supports to their codes
+var dnsTypes = map[string]uint16{
+	"A":     1,
+	"NS":    2,
+	"CNAME": 5,
+	"PTR":   12,
+	"MX":    15,
+	"TXT":   16,
+	"AAAA":  28,
+	"SRV":   33,
+}
+
+// dnsRcodes are names of DNS response codes, by code
+var dnsRcodes = []string{"NOERROR", "FORMERR", "SERVFAIL", "NXDOMAIN", "NOTIMP", "REFUSED", "YXDOMAIN", "YXRRSET",
+	"NXRRSET", "NOTAUTH", "NOTZONE"}
+
+func (p *rfc2136Provider) list(ctx context.Context, _, startName, startType string, fn func(*route53.ResourceRecordSet) bool) error {
+	sets, err := p.transfer(ctx)
+	if err != nil {
+		return err
+	}
+	start := dnsOrder(startName)
+	for _, rr := range sets {
+		if startName != "" {
+			if o := dnsOrder(*rr.Name); o < start || o == start && *rr.Type < startType {
+				continue
+			}
+		}
+		if !fn(rr) {
+			break
+		}
+	}
+	return nil
+}
+
+func (p *rfc2136Provider) apply(ctx context.Context, _, _ string, changes []*route53.Change) (string, error) {
+	msg, err := p.updateMessage(changes)
+	if err != nil {
+		return "", err
+	}
+	conn, err := p.dial(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if err := writeDNSMessage(conn, msg); err != nil {
+		return "", err
+	}
+	resp, err := readDNSMessage(conn)
+	if err != nil {
+		return "", err
+	}
+	return "", checkRcode(resp)
+}
+
+func (p *rfc2136Provider) zoneInfo(context.Context, string) (zoneInfo, error) {
+	// records are served by the server itself, which is not necessarily
+	// reachable for verification, so no nameservers are reported
+	return zoneInfo{Name: p.zone}, nil
+}
+
+// dial connects to p.server, with connection deadline set by ctx or
+// rfc2136Timeout, whichever is sooner
+func (p *rfc2136Provider) dial(ctx context.Context) (net.Conn, error) {
+	deadline := time.Now().Add(rfc2136Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", p.server)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// updateMessage returns signed UPDATE message applying changes to p.zone:
+// upserted record sets replace all records of their name and type, deleted
+// ones remove them
+func (p *rfc2136Provider) updateMessage(changes []*route53.Change) ([]byte, error) {
+	msg := dnsHeader(dnsOpcodeUpdate << 11)
+	binary.BigEndian.PutUint16(msg[4:], 1) // zone section
+	msg, err := appendQuestion(msg, p.zone, dnsTypeSOA)
+	if err != nil {
+		return nil, err
+	}
+	var updates int
+	for _, ch := range changes {
+		rr := ch.ResourceRecordSet
+		if rr.AliasTarget != nil || rr.SetIdentifier != nil {
+			return nil, fmt.Errorf("record %s %s: alias records and routing policies are not supported by %s",
+				aws.StringValue(rr.Name), aws.StringValue(rr.Type), p.server)
+		}
+		typ, ok := dnsTypes[aws.StringValue(rr.Type)]
+		if !ok {
+			return nil, fmt.Errorf("record %s: unsupported type %q", aws.StringValue(rr.Name), aws.StringValue(rr.Type))
+		}
+		// delete RRset, see RFC 2136, section 2.5.2
+		if msg, err = appendRR(msg, *rr.Name, typ, dnsClassAny, 0, nil); err != nil {
+			return nil, err
+		}
+		updates++
+		if aws.StringValue(ch.Action) == route53.ChangeActionDelete {
+			continue
+		}
+		for _, r := range rr.ResourceRecords {
+			rdata, err := encodeRData(*rr.Type, aws.StringValue(r.Value))
+			if err != nil {
+				return nil, fmt.Errorf("record %s %s: %w", *rr.Name, *rr.Type, err)
+			}
+			if msg, err = appendRR(msg, *rr.Name, typ, dnsClassIN, uint32(aws.Int64Value(rr.TTL)), rdata); err != nil {
+				return nil, err
+			}
+			updates++
+		}
+	}
+	if updates > 0xffff {
+		return nil, fmt.Errorf("too many records in a single update: %d", updates)
+	}
+	binary.BigEndian.PutUint16(msg[8:], uint16(updates))
+	return p.key.sign(msg, time.Now())
+}
+
+// transfer returns all record sets of p.zone of supported types, see
+// dnsTypes, sorted by name, see dnsOrder, and type
+func (p *rfc2136Provider) transfer(ctx context.Context) ([]*route53.ResourceRecordSet, error) {
+	msg := dnsHeader(0)
+	binary.BigEndian.PutUint16(msg[4:], 1)
+	msg, err := appendQuestion(msg, p.zone, dnsTypeAXFR)
+	if err != nil {
+		return nil, err
+	}
+	if msg, err = p.key.sign(msg, time.Now()); err != nil {
+		return nil, err
+	}
+	conn, err := p.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err := writeDNSMessage(conn, msg); err != nil {
+		return nil, err
+	}
+	sets := make(map[string]*route53.ResourceRecordSet)
+	var soas int
+	// transfer starts and ends with SOA record, and may span several
+	// messages
+	for soas < 2 {
+		resp, err := readDNSMessage(conn)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkRcode(resp); err != nil {
+			return nil, err
+		}
+		off := 12
+		for i := 0; i < int(binary.BigEndian.Uint16(resp[4:])); i++ {
+			if _, off, err = readName(resp, off); err != nil {
+				return nil, err
+			}
+			off += 4
+		}
+		for i := 0; i < int(binary.BigEndian.Uint16(resp[6:])); i++ {
+			var rec dnsRecord
+			if rec, off, err = readRR(resp, off); err != nil {
+				return nil, err
+			}
+			if rec.typ == dnsTypeSOA {
+				soas++
+				continue
+			}
+			typ, value, ok, err := decodeRData(resp, rec)
+			if err != nil {
+				return nil, fmt.Errorf("record %s: %w", rec.name, err)
+			}
+			if !ok {
+				continue
+			}
+			name := rec.name + "."
+			key := name + " " + typ
+			rr := sets[key]
+			if rr == nil {
+				rr = &route53.ResourceRecordSet{Name: aws.String(name), Type: aws.String(typ),
+					TTL: aws.Int64(int64(rec.ttl))}
+				sets[key] = rr
+			}
+			rr.ResourceRecords = append(rr.ResourceRecords, &route53.ResourceRecord{Value: aws.String(value)})
+		}
+	}
+	out := make([]*route53.ResourceRecordSet, 0, len(sets))
+	for _, rr := range sets {
+		out = append(out, rr)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if a, b := dnsOrder(*out[i].Name), dnsOrder(*out[j].Name); a != b {
+			return a < b
+		}
+		return *out[i].Type < *out[j].Type
+	})
+	return out, nil
+}
+
+// dnsOrder returns sort key of the name ordering names like Route 53
+// listings do: by labels, starting from the rightmost one, so that names of
+// a domain and its subdomains make a contiguous range
+func dnsOrder(name string) string {
+	labels := strings.Split(strings.ToLower(strings.TrimSuffix(name, ".")), ".")
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+	return strings.Join(labels, "\x00")
+}
+
+// dnsHeader returns DNS message header with random id and the given flags
+func dnsHeader(flags uint16) []byte {
+	msg := make([]byte, 12)
+	if _, err := rand.Read(msg[:2]); err != nil {
+		panic(err)
+	}
+	binary.BigEndian.PutUint16(msg[2:], flags)
+	return msg
+}
+
+// appendName appends name in uncompressed wire format to b
+func appendName(b []byte, name string) ([]byte, error) {
+	if name = strings.TrimSuffix(name, "."); name != "" {
+		for _, label := range strings.Split(name, ".") {
+			if label == "" || len(label) > 63 {
+				return nil, fmt.Errorf("invalid name %q", name)
+			}
+			b = append(append(b, byte(len(label))), label...)
+		}
+	}
+	return append(b, 0), nil
+}
+
+// appendQuestion appends question (or zone) section entry of class IN to msg
+func appendQuestion(msg []byte, name string, typ uint16) ([]byte, error) {
+	msg, err := appendName(msg, name)
+	if err != nil {
+		return nil, err
+	}
+	return binary.BigEndian.AppendUint16(binary.BigEndian.AppendUint16(msg, typ), dnsClassIN), nil
+}
+
+// appendRR appends resource record to msg
+func appendRR(msg []byte, name string, typ, class uint16, ttl uint32, rdata []byte) ([]byte, error) {
+	msg, err := appendName(msg, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(rdata) > 0xffff {
+		return nil, fmt.Errorf("record %s: data too long", name)
+	}
+	msg = binary.BigEndian.AppendUint16(msg, typ)
+	msg = binary.BigEndian.AppendUint16(msg, class)
+	msg = binary.BigEndian.AppendUint32(msg, ttl)
+	msg = binary.BigEndian.AppendUint16(msg, uint16(len(rdata)))
+	return append(msg, rdata...), nil
+}
+
+// encodeRData returns wire format of record value in Route 53 presentation
+// format, like "10 example.com" for MX record
+func encodeRData(typ, value string) ([]byte, error) {
+	fields := strings.Fields(value)
+	switch typ {
+	case "A":
+		if ip := net.ParseIP(value).To4(); ip != nil {
+			return ip, nil
+		}
+	case "AAAA":
+		if ip := net.ParseIP(value); ip != nil && ip.To4() == nil {
+			return ip.To16(), nil
+		}
+	case "CNAME", "NS", "PTR":
+		return appendName(nil, value)
+	case "MX":
+		if len(fields) == 2 {
+			if pref, err := strconv.ParseUint(fields[0], 10, 16); err == nil {
+				return appendName(binary.BigEndian.AppendUint16(nil, uint16(pref)), fields[1])
+			}
+		}
+	case "SRV":
+		if len(fields) == 4 {
+			var b []byte
+			for _, f := range fields[:3] {
+				n, err := strconv.ParseUint(f, 10, 16)
+				if err != nil {
+					return nil, fmt.Errorf("invalid value %q", value)
+				}
+				b = binary.BigEndian.AppendUint16(b, uint16(n))
+			}
+			return appendName(b, fields[3])
+		}
+	case "TXT":
+		strs, err := parseTXT(value)
+		if err != nil {
+			return nil, err
+		}
+		var b []byte
+		for _, s := range strs {
+			if len(s) > 255 {
+				return nil, fmt.Errorf("TXT string longer than 255 bytes")
+			}
+			b = append(append(b, byte(len(s))), s...)
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("invalid value %q", value)
+}
+
+// parseTXT parses TXT record value in Route 53 format, a sequence of quoted
+// strings like `"v=spf1 -all" "second"`, with `\"`, `\\` and `\DDD` escapes
+func parseTXT(value string) ([]string, error) {
+	var out []string
+	for i := 0; i < len(value); {
+		if value[i] == ' ' {
+			i++
+			continue
+		}
+		if value[i] != '"' {
+			return nil, fmt.Errorf("invalid TXT value %q", value)
+		}
+		var b []byte
+		for i++; ; i++ {
+			if i == len(value) {
+				return nil, fmt.Errorf("invalid TXT value %q", value)
+			}
+			if value[i] == '"' {
+				i++
+				break
+			}
+			if value[i] == '\\' && octalEscape(value[i:]) {
+				n, _ := strconv.ParseUint(value[i+1:i+4], 8, 8)
+				b = append(b, byte(n))
+				i += 3
+				continue
+			}
+			if value[i] == '\\' && i+1 < len(value) {
+				i++
+			}
+			b = append(b, value[i])
+		}
+		out = append(out, string(b))
+	}
+	return out, nil
+}
+
+// dnsRecord is a resource record read from DNS message
+type dnsRecord struct {
+	name  string // without trailing dot
+	typ   uint16
+	ttl   uint32
+	start int // offset of data in the message
+	end   int // offset past data in the message
+}
+
+// readRR reads resource record at msg[off:], returning it and offset past it
+func readRR(msg []byte, off int) (dnsRecord, int, error) {
+	name, off, err := readName(msg, off)
+	if err != nil {
+		return dnsRecord{}, 0, err
+	}
+	if off+10 > len(msg) {
+		return dnsRecord{}, 0, io.ErrUnexpectedEOF
+	}
+	rec := dnsRecord{
+		name:  name,
+		typ:   binary.BigEndian.Uint16(msg[off:]),
+		ttl:   binary.BigEndian.Uint32(msg[off+4:]),
+		start: off + 10,
+	}
+	rec.end = rec.start + int(binary.BigEndian.Uint16(msg[off+8:]))
+	if rec.end > len(msg) {
+		return dnsRecord{}, 0, io.ErrUnexpectedEOF
+	}
+	return rec, rec.end, nil
+}
+
+// decodeRData returns type name and value of the record in Route 53
+// presentation format; ok is false for unsupported types
+func decodeRData(msg []byte, rec dnsRecord) (typ, value string, ok bool, err error) {
+	for name, code := range dnsTypes {
+		if code == rec.typ {
+			typ = name
+		}
+	}
+	data := msg[rec.start:rec.end]
+	switch typ {
+	case "":
+		return "", "", false, nil
+	case "A", "AAAA":
+		if typ == "A" && len(data) != 4 || typ == "AAAA" && len(data) != 16 {
+			return "", "", false, errors.New("invalid address length")
+		}
+		return typ, net.IP(data).String(), true, nil
+	case "CNAME", "NS", "PTR":
+		name, _, err := readName(msg, rec.start)
+		return typ, name + ".", err == nil, err
+	case "MX", "SRV":
+		n := 2
+		if typ == "SRV" {
+			n = 6
+		}
+		if len(data) < n {
+			return "", "", false, io.ErrUnexpectedEOF
+		}
+		var fields []string
+		for i := 0; i < n; i += 2 {
+			fields = append(fields, strconv.Itoa(int(binary.BigEndian.Uint16(data[i:]))))
+		}
+		name, _, err := readName(msg, rec.start+n)
+		return typ, strings.Join(append(fields, name+"."), " "), err == nil, err
+	}
+	// TXT
+	var strs []string
+	for len(data) > 0 {
+		n := int(data[0])
+		if 1+n > len(data) {
+			return "", "", false, io.ErrUnexpectedEOF
+		}
+		s := strings.ReplaceAll(strings.ReplaceAll(string(data[1:1+n]), `\`, `\\`), `"`, `\"`)
+		strs = append(strs, `"`+s+`"`)
+		data = data[1+n:]
+	}
+	return typ, strings.Join(strs, " "), true, nil
+}
+
+// readName reads possibly compressed name at msg[off:], returning it without
+// trailing dot, and offset past it
+func readName(msg []byte, off int) (string, int, error) {
+	var labels []string
+	end := -1 // offset past the name, once a pointer is followed
+	for jumps := 0; ; {
+		if off >= len(msg) {
+			return "", 0, io.ErrUnexpectedEOF
+		}
+		n := int(msg[off])
+		switch {
+		case n == 0:
+			if end < 0 {
+				end = off + 1
+			}
+			return strings.ToLower(strings.Join(labels, ".")), end, nil
+		case n&0xc0 == 0xc0:
+			if off+1 >= len(msg) {
+				return "", 0, io.ErrUnexpectedEOF
+			}
+			if jumps++; jumps > 64 {
+				return "", 0, errors.New("too many compression pointers")
+			}
+			if end < 0 {
+				end = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3fff)
+		case n > 63:
+			return "", 0, errors.New("invalid label length")
+		default:
+			if off+1+n > len(msg) {
+				return "", 0, io.ErrUnexpectedEOF
+			}
+			labels = append(labels, string(msg[off+1:off+1+n]))
+			off += 1 + n
+		}
+	}
+}
+
+// checkRcode returns an error if DNS response has non-zero response code
+func checkRcode(msg []byte) error {
+	if len(msg) < 12 {
+		return io.ErrUnexpectedEOF
+	}
+	rcode := int(msg[3] & 0xf)
+	if rcode == 0 {
+		return nil
+	}
+	if rcode < len(dnsRcodes) {
+		return fmt.Errorf("DNS server responded with %s", dnsRcodes[rcode])
+	}
+	return fmt.Errorf("DNS server responded with code %d", rcode)
+}
+
+// writeDNSMessage writes DNS message to TCP connection, prefixed with its
+// length
+func writeDNSMessage(w io.Writer, msg []byte) error {
+	_, err := w.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(msg))), msg...))
+	return err
+}
+
+// readDNSMessage reads DNS message prefixed with its length from TCP
+// connection
+func readDNSMessage(r io.Reader) ([]byte, error) {
+	var size [2]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, binary.BigEndian.Uint16(size[:]))
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	if len(msg) < 12 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return msg, nil
+}
+
+// tsigFudge is the permitted clock skew of signed requests, in seconds
+const tsigFudge = 300
+
+// tsigKey is a TSIG key signing DNS requests (RFC 8945)
+type tsigKey struct {
+	algorithm string // like "hmac-sha256"
+	name      string
+	secret    []byte
+}
+
+// tsigAlgorithms are supported TSIG algorithms
+var tsigAlgorithms = map[string]func() hash.Hash{
+	"hmac-sha1":   sha1.New,
+	"hmac-sha256": sha256.New,
+	"hmac-sha512": sha512.New,
+}
+
+// parseTSIGKey parses TSIG key in algorithm:name:secret form, where secret is
+// base64-encoded, like "hmac-sha256:awsns:c2VjcmV0". It returns nil for empty
+// string.
+func parseTSIGKey(s string) (*tsigKey, error) {
+	if s == "" {
+		return nil, nil
+	}
+	parts := strings.SplitN(s, ":", 3)
+	if len(parts) != 3 || parts[1] == "" {
+		return nil, errors.New("invalid TSIG key, want algorithm:name:secret")
+	}
+	alg := strings.ToLower(parts[0])
+	if _, ok := tsigAlgorithms[alg]; !ok {
+		return nil, fmt.Errorf("unsupported TSIG algorithm %q", parts[0])
+	}
+	secret, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid TSIG secret: %w", err)
+	}
+	return &tsigKey{algorithm: alg, name: strings.ToLower(strings.TrimSuffix(parts[1], ".")), secret: secret}, nil
+}
+
+// sign returns msg with TSIG record signing it at the given time appended. If
+// k is nil, msg is returned as is.
+func (k *tsigKey) sign(msg []byte, now time.Time) ([]byte, error) {
+	if k == nil {
+		return msg, nil
+	}
+	keyName, err := appendName(nil, k.name)
+	if err != nil {
+		return nil, err
+	}
+	alg, err := appendName(nil, k.algorithm)
+	if err != nil {
+		return nil, err
+	}
+	signed := uint64(now.Unix())
+	timers := []byte{byte(signed >> 40), byte(signed >> 32), byte(signed >> 24), byte(signed >> 16),
+		byte(signed >> 8), byte(signed), 0, 0}
+	binary.BigEndian.PutUint16(timers[6:], tsigFudge)
+	mac := hmac.New(tsigAlgorithms[k.algorithm], k.secret)
+	mac.Write(msg)
+	mac.Write(keyName)
+	mac.Write([]byte{0, dnsClassAny, 0, 0, 0, 0}) // class and TTL
+	mac.Write(alg)
+	mac.Write(timers)
+	mac.Write([]byte{0, 0, 0, 0}) // error and other data length
+	sum := mac.Sum(nil)
+	rdata := append(append([]byte(nil), alg...), timers...)
+	rdata = append(binary.BigEndian.AppendUint16(rdata, uint16(len(sum))), sum...)
+	rdata = append(rdata, msg[0], msg[1], 0, 0, 0, 0) // original id, error and other data length
+	out, err := appendRR(append([]byte(nil), msg...), k.name, dnsTypeTSIG, dnsClassAny, 0, rdata)
+	if err != nil {
+		return nil, err
+	}
+	binary.BigEndian.PutUint16(out[10:], binary.BigEndian.Uint16(out[10:])+1)
+	return out, nil
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+func TestRFC2136Provider(t *testing.T) {
+	key, err := parseTSIGKey("hmac-sha256:awsns.:c2VjcmV0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newFakeDNSServer(t, "corp.example.com", key)
+	p := &rfc2136Provider{server: srv.addr, zone: "corp.example.com", key: key}
+	ctx := context.Background()
+	_, err = p.apply(ctx, "", "", []*route53.Change{
+		{Action: aws.String(route53.ChangeActionUpsert), ResourceRecordSet: &route53.ResourceRecordSet{
+			Name: aws.String("web.corp.example.com."), Type: aws.String("A"), TTL: aws.Int64(60),
+			ResourceRecords: []*route53.ResourceRecord{{Value: aws.String("10.0.0.1")}, {Value: aws.String("10.0.0.2")}}}},
+		{Action: aws.String(route53.ChangeActionUpsert), ResourceRecordSet: &route53.ResourceRecordSet{
+			Name: aws.String("web.corp.example.com."), Type: aws.String("TXT"), TTL: aws.Int64(60),
+			ResourceRecords: []*route53.ResourceRecord{{Value: aws.String(`"a \"b\"" "c"`)}}}},
+		{Action: aws.String(route53.ChangeActionUpsert), ResourceRecordSet: &route53.ResourceRecordSet{
+			Name: aws.String("www.corp.example.com."), Type: aws.String("CNAME"), TTL: aws.Int64(300),
+			ResourceRecords: []*route53.ResourceRecord{{Value: aws.String("web.corp.example.com")}}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`web.corp.example.com. A 60 10.0.0.1,10.0.0.2`,
+		`web.corp.example.com. TXT 60 "a \"b\"" "c"`,
+		`www.corp.example.com. CNAME 300 web.corp.example.com.`,
+	}
+	if got := listRFC2136(t, p, ""); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	if got := listRFC2136(t, p, "web.corp.example.com."); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q listing from web, want %q", got, want)
+	}
+	_, err = p.apply(ctx, "", "", []*route53.Change{{Action: aws.String(route53.ChangeActionDelete),
+		ResourceRecordSet: &route53.ResourceRecordSet{Name: aws.String("web.corp.example.com."), Type: aws.String("A"),
+			TTL: aws.Int64(60), ResourceRecords: []*route53.ResourceRecord{{Value: aws.String("10.0.0.1")}}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := listRFC2136(t, p, "www.corp.example.com."); !reflect.DeepEqual(got, want[2:]) {
+		t.Fatalf("got %q after deletion, want %q", got, want[2:])
+	}
+
+	wrong, _ := parseTSIGKey("hmac-sha256:awsns:b3RoZXI=")
+	p.key = wrong
+	if _, err := p.apply(ctx, "", "", nil); err == nil || !strings.Contains(err.Error(), "NOTAUTH") {
+		t.Fatalf("got %v with wrong key, want NOTAUTH error", err)
+	}
+	p.key = key
+	_, err = p.apply(ctx, "", "", []*route53.Change{{Action: aws.String(route53.ChangeActionUpsert),
+		ResourceRecordSet: &route53.ResourceRecordSet{Name: aws.String("web.corp.example.com."), Type: aws.String("A"),
+			SetIdentifier: aws.String("i-1"), TTL: aws.Int64(60), ResourceRecords: []*route53.ResourceRecord{{Value: aws.String("10.0.0.1")}}}}})
+	if err == nil {
+		t.Fatal("record set with routing policy accepted")
+	}
+}
+
+func TestWithRFC2136(t *testing.T) {
+	srv := newFakeDNSServer(t, "example.com", nil)
+	inst := testInstance("i-1", "web", "", "1.2.3.4")
+	inst.PrivateIpAddress = aws.String("10.0.0.1")
+	mem := &memProvider{records: map[string]*route53.ResourceRecordSet{}}
+	s := &syncer{ec2: &fakeEC2{instances: []*ec2.Instance{inst}}, dns: mem, suffix: ".foo.example.com", zoneID: "Z1",
+		ttl: defaultTTL, parallelism: 1}
+	if _, err := withRFC2136(s, config{RFC2136Server: srv.addr, RFC2136Zone: "corp.example.com"}); err == nil {
+		t.Fatal("suffix outside of -rfc2136-zone accepted")
+	}
+	router, err := withRFC2136(s, config{RFC2136Server: srv.addr, RFC2136Zone: "example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := router.reconcile(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	if rr := mem.records[recordKey(&route53.ResourceRecordSet{Name: aws.String("web.foo.example.com."),
+		Type: aws.String("A")})]; rr == nil || *rr.ResourceRecords[0].Value != "1.2.3.4" {
+		t.Fatalf("got %v in Route 53, want public address", rr)
+	}
+	want := []string{"web.foo.example.com. A 60 10.0.0.1"}
+	if got := listRFC2136(t, router.envs[1].dns, ""); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q on DNS server, want %q", got, want)
+	}
+}
+
+func TestWithRFC2136_sideEffects(t *testing.T) {
+	s := &syncer{suffix: ".foo.example.com", zoneID: "Z1", snsTopic: "arn:aws:sns:us-east-1:123456789012:dns",
+		auditBucket: "audit", snapshotDir: t.TempDir(), lock: &zoneLock{}, fqdnTag: "dns:fqdn"}
+	router, err := withRFC2136(s, config{RFC2136Server: "127.0.0.1:53"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if router.envs[0].syncer != s {
+		t.Fatal("Route 53 syncer replaced")
+	}
+	m := router.envs[1].syncer
+	if m.snsTopic != "" || m.auditBucket != "" || m.snapshotDir != "" || m.lock != nil || m.fqdnTag != "" {
+		t.Fatalf("RFC 2136 syncer inherited side effects of Route 53 one: %+v", m)
+	}
+}
+
+func TestReadName_compressed(t *testing.T) {
+	msg := make([]byte, 12)
+	msg, _ = appendName(msg, "Example.com")
+	msg = append(msg, 3, 'w', 'w', 'w', 0xc0, 12)
+	name, off, err := readName(msg, 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "www.example.com" || off != len(msg) {
+		t.Fatalf("got %q at %d, want www.example.com at %d", name, off, len(msg))
+	}
+	if _, _, err := readName(append(msg[:12], 0xc0, 12), 12); err == nil {
+		t.Fatal("compression loop not detected")
+	}
+}
+
+// listRFC2136 returns records listed by p, starting from the name, as "name
+// type ttl values" strings
+func listRFC2136(t *testing.T, p provider, start string) []string {
+	t.Helper()
+	var out []string
+	err := p.list(context.Background(), "", start, "", func(rr *route53.ResourceRecordSet) bool {
+		var values []string
+		for _, r := range rr.ResourceRecords {
+			values = append(values, *r.Value)
+		}
+		out = append(out, fmt.Sprintf("%s %s %d %s", *rr.Name, *rr.Type, aws.Int64Value(rr.TTL), strings.Join(values, ",")))
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// fakeDNSServer is DNS server accepting dynamic updates of its zone and
+// serving its transfers over TCP. If key is set, requests must be signed with
+// it.
+type fakeDNSServer struct {
+	t    *testing.T
+	addr string
+	zone string
+	key  *tsigKey
+
+	mu      sync.Mutex
+	records map[string][]string // values in presentation format, by "name. TYPE"
+	ttls    map[string]uint32   // by "name. TYPE"
+}
+
+func newFakeDNSServer(t *testing.T, zone string, key *tsigKey) *fakeDNSServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	srv := &fakeDNSServer{t: t, addr: ln.Addr().String(), zone: zone, key: key,
+		records: make(map[string][]string), ttls: make(map[string]uint32)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(conn)
+		}
+	}()
+	return srv
+}
+
+func (srv *fakeDNSServer) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		msg, err := readDNSMessage(conn)
+		if err != nil {
+			return
+		}
+		for _, resp := range srv.handle(msg) {
+			if err := writeDNSMessage(conn, resp); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// handle returns responses to the request
+func (srv *fakeDNSServer) handle(msg []byte) [][]byte {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	reply := func(rcode byte, answers ...[]byte) []byte {
+		out := append([]byte{msg[0], msg[1], 0x80 | msg[2]&0x78, rcode}, make([]byte, 8)...)
+		binary.BigEndian.PutUint16(out[6:], uint16(len(answers)))
+		return append(out, bytes.Join(answers, nil)...)
+	}
+	if srv.key != nil && !srv.verify(msg) {
+		return [][]byte{reply(9)}
+	}
+	zone, off, err := readName(msg, 12)
+	if err != nil || zone != srv.zone {
+		return [][]byte{reply(10)}
+	}
+	off += 4
+	if msg[2]>>3&0xf != dnsOpcodeUpdate {
+		soa, _ := appendName(nil, "ns."+srv.zone)
+		soa, _ = appendName(soa, "admin."+srv.zone)
+		soa = append(soa, make([]byte, 20)...)
+		soaRR, _ := appendRR(nil, srv.zone, dnsTypeSOA, dnsClassIN, 60, soa)
+		answers := [][]byte{soaRR}
+		for key, values := range srv.records {
+			name, typ, _ := strings.Cut(key, " ")
+			for _, v := range values {
+				rdata, err := encodeRData(typ, v)
+				if err != nil {
+					srv.t.Error(err)
+				}
+				rr, _ := appendRR(nil, name, dnsTypes[typ], dnsClassIN, srv.ttls[key], rdata)
+				answers = append(answers, rr)
+			}
+		}
+		// split transfer into two messages
+		return [][]byte{reply(0, answers...), reply(0, soaRR)}
+	}
+	for i := 0; i < int(binary.BigEndian.Uint16(msg[8:])); i++ {
+		var rec dnsRecord
+		if rec, off, err = readRR(msg, off); err != nil {
+			return [][]byte{reply(1)}
+		}
+		class := binary.BigEndian.Uint16(msg[rec.start-8:])
+		if class == dnsClassAny {
+			for typ, code := range dnsTypes {
+				if code == rec.typ {
+					delete(srv.records, rec.name+". "+typ)
+					delete(srv.ttls, rec.name+". "+typ)
+				}
+			}
+			continue
+		}
+		typ, value, ok, err := decodeRData(msg, rec)
+		if err != nil || !ok {
+			return [][]byte{reply(1)}
+		}
+		if key := rec.name + ". " + typ; class == dnsClassIN {
+			srv.records[key] = append(srv.records[key], value)
+			srv.ttls[key] = rec.ttl
+		}
+	}
+	return [][]byte{reply(0)}
+}
+
+// verify reports whether msg is signed with srv.key
+func (srv *fakeDNSServer) verify(msg []byte) bool {
+	off := 12
+	var err error
+	for i := 0; i < int(binary.BigEndian.Uint16(msg[4:])); i++ {
+		if _, off, err = readName(msg, off); err != nil {
+			return false
+		}
+		off += 4
+	}
+	n := int(binary.BigEndian.Uint16(msg[6:])) + int(binary.BigEndian.Uint16(msg[8:])) +
+		int(binary.BigEndian.Uint16(msg[10:])) - 1
+	for i := 0; i < n; i++ {
+		if _, off, err = readRR(msg, off); err != nil {
+			return false
+		}
+	}
+	tsig, _, err := readRR(msg, off)
+	if err != nil || tsig.typ != dnsTypeTSIG {
+		return false
+	}
+	_, timeOff, err := readName(msg, tsig.start)
+	if err != nil {
+		return false
+	}
+	signed := binary.BigEndian.Uint64(append([]byte{0, 0}, msg[timeOff:timeOff+6]...))
+	unsigned := append([]byte(nil), msg[:off]...)
+	binary.BigEndian.PutUint16(unsigned[10:], binary.BigEndian.Uint16(msg[10:])-1)
+	want, err := srv.key.sign(unsigned, time.Unix(int64(signed), 0))
+	return err == nil && bytes.Equal(want, msg)
+}
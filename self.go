@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+// metadataClient is a subset of ec2 instance metadata API used by the program
+type metadataClient interface {
+	GetMetadataWithContext(aws.Context, string) (string, error)
+	GetInstanceIdentityDocumentWithContext(aws.Context) (ec2metadata.EC2InstanceIdentityDocument, error)
+}
+
+// selfInstance returns the instance the program runs on, as described by its
+// metadata. Instance only has tags if access to tags in instance metadata is
+// enabled.
+func selfInstance(ctx context.Context, md metadataClient) (*ec2.Instance, error) {
+	doc, err := md.GetInstanceIdentityDocumentWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("reading instance identity document: %w", err)
+	}
+	inst := &ec2.Instance{
+		InstanceId: aws.String(doc.InstanceID),
+		State:      &ec2.InstanceState{Name: aws.String(ec2.InstanceStateNameRunning)},
+		Placement:  &ec2.Placement{AvailabilityZone: aws.String(doc.AvailabilityZone)},
+	}
+	if doc.PrivateIP != "" {
+		inst.PrivateIpAddress = aws.String(doc.PrivateIP)
+	}
+	for _, f := range []struct {
+		path string
+		dst  **string
+	}{
+		{"public-ipv4", &inst.PublicIpAddress},
+		{"public-hostname", &inst.PublicDnsName},
+		{"ipv6", &inst.Ipv6Address},
+	} {
+		v, err := optionalMetadata(ctx, md, f.path)
+		if err != nil {
+			return nil, err
+		}
+		if v != "" {
+			*f.dst = aws.String(v)
+		}
+	}
+	keys, err := optionalMetadata(ctx, md, "tags/instance")
+	if err != nil {
+		return nil, err
+	}
+	if keys == "" {
+		logMsg("no instance tags in metadata, access to them may be disabled", "instance_id", doc.InstanceID)
+	}
+	for _, key := range strings.Split(keys, "\n") {
+		if key == "" {
+			continue
+		}
+		v, err := md.GetMetadataWithContext(ctx, "tags/instance/"+key)
+		if err != nil {
+			return nil, fmt.Errorf("reading instance tag %q: %w", key, err)
+		}
+		inst.Tags = append(inst.Tags, &ec2.Tag{Key: aws.String(key), Value: aws.String(v)})
+	}
+	return inst, nil
+}
+
+// optionalMetadata returns instance metadata at path, or empty string if there
+// is no such metadata
+func optionalMetadata(ctx context.Context, md metadataClient, path string) (string, error) {
+	v, err := md.GetMetadataWithContext(ctx, path)
+	var rf awserr.RequestFailure
+	if errors.As(err, &rf) && rf.StatusCode() == http.StatusNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("reading instance metadata %s: %w", path, err)
+	}
+	return v, nil
+}
+
+// registerSelf upserts records of the instance the program runs on, as
+// described by its metadata, leaving records of other instances alone
+func (s *syncer) registerSelf(ctx context.Context, md metadataClient) error {
+	inst, err := selfInstance(ctx, md)
+	if err != nil {
+		return err
+	}
+	id := aws.StringValue(inst.InstanceId)
+	if s.ignored(inst) || s.excluded(inst) {
+		logMsg("instance is not managed", "instance_id", id)
+		return nil
+	}
+	desired := s.desiredRecords([]*ec2.Instance{inst}, new(runStats))
+	if len(desired) == 0 {
+		return fmt.Errorf("instance %s cannot have records: %s", id, s.skipReason(inst))
+	}
+	return s.locked(ctx, func() error {
+		if s.healthCheck != nil {
+			checks, err := s.listHealthChecks(ctx)
+			if err != nil {
+				return err
+			}
+			if _, err := s.attachHealthChecks(ctx, desired, checks); err != nil {
+				return err
+			}
+		}
+		var changes []*route53.Change
+		var summary []recordChange
+		for _, d := range desired {
+			records, err := s.listName(ctx, *d.rr.Name)
+			if err != nil {
+				return err
+			}
+			var old *route53.ResourceRecordSet
+			for _, rr := range records {
+				if recordKey(rr) == recordKey(d.rr) {
+					old = rr
+				}
+			}
+			if old != nil && sameRecord(old, d.rr) {
+				continue
+			}
+			logMsg("upserting record", "zone_id", s.zoneID, "record_name", *d.rr.Name,
+				"action", "UPSERT", "instance_id", id)
+			ch := &route53.Change{
+				Action:            aws.String("UPSERT"),
+				ResourceRecordSet: d.rr,
+			}
+			changes = append(changes, ch)
+			summary = append(summary, newRecordChange(ch, id, old != nil))
+		}
+		if len(changes) == 0 {
+			logMsg("no changes to apply", "zone_id", s.zoneID, "instance_id", id)
+			return s.noChanges()
+		}
+		_, err := s.apply(ctx, id, "automated self-registration of "+id, changes, summary)
+		return err
+	})
+}
+
+// deregisterSelf deletes records of the instance the program runs on, as
+// described by its metadata: record sets of its names having its id as set
+// identifier, or pointing only to its addresses
+func (s *syncer) deregisterSelf(ctx context.Context, md metadataClient) error {
+	inst, err := selfInstance(ctx, md)
+	if err != nil {
+		return err
+	}
+	id := aws.StringValue(inst.InstanceId)
+	if s.ignored(inst) || s.excluded(inst) {
+		logMsg("instance is not managed", "instance_id", id)
+		return nil
+	}
+	names := s.hostNames(inst)
+	if len(names) == 0 {
+		return fmt.Errorf("instance %s cannot have records: %s", id, s.skipReason(inst))
+	}
+	targets := instanceTargets(inst)
+	return s.locked(ctx, func() error {
+		var changes []*route53.Change
+		var summary []recordChange
+		for _, name := range names {
+			records, err := s.listName(ctx, name+s.suffix)
+			if err != nil {
+				return err
+			}
+			for _, rr := range records {
+				if set := aws.StringValue(rr.SetIdentifier); set != id && (set != "" || !allValuesIn(rr, targets)) {
+					continue
+				}
+				logMsg("removing record", "zone_id", s.zoneID, "record_name", name+s.suffix,
+					"action", "DELETE", "instance_id", id)
+				ch := &route53.Change{
+					Action:            aws.String("DELETE"),
+					ResourceRecordSet: rr,
+				}
+				changes = append(changes, ch)
+				summary = append(summary, newRecordChange(ch, id, true))
+			}
+		}
+		if len(changes) == 0 {
+			logMsg("no changes to apply", "zone_id", s.zoneID, "instance_id", id)
+			return s.noChanges()
+		}
+		_, err := s.apply(ctx, id, "automated self-deregistration of "+id, changes, summary)
+		return err
+	})
+}
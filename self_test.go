@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+)
+
+type fakeMetadata struct {
+	doc  ec2metadata.EC2InstanceIdentityDocument
+	data map[string]string
+}
+
+func (f *fakeMetadata) GetMetadataWithContext(_ aws.Context, path string) (string, error) {
+	if v, ok := f.data[path]; ok {
+		return v, nil
+	}
+	return "", awserr.NewRequestFailure(awserr.New("EC2MetadataError", "not found", nil), http.StatusNotFound, "")
+}
+
+func (f *fakeMetadata) GetInstanceIdentityDocumentWithContext(aws.Context) (ec2metadata.EC2InstanceIdentityDocument, error) {
+	return f.doc, nil
+}
+
+func TestRegisterSelf(t *testing.T) {
+	r53svc := newFakeRoute53(t,
+		"web.foo.example.com. A 9.9.9.9",
+		"db.foo.example.com. A 5.6.7.8",
+	)
+	s := &syncer{
+		r53:    r53svc,
+		suffix: ".foo.example.com",
+		zoneID: "Z1",
+	}
+	md := &fakeMetadata{
+		doc: ec2metadata.EC2InstanceIdentityDocument{
+			InstanceID:       "i-1",
+			PrivateIP:        "10.0.0.1",
+			AvailabilityZone: "us-east-1a",
+		},
+		data: map[string]string{
+			"public-ipv4":             "1.2.3.4",
+			"tags/instance":           "Name\n" + ttlTag,
+			"tags/instance/Name":      "web",
+			"tags/instance/" + ttlTag: "300",
+		},
+	}
+	if err := s.registerSelf(context.Background(), md); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"db.foo.example.com. A 5.6.7.8",
+		"web.foo.example.com. A 1.2.3.4",
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if ttl := aws.Int64Value(r53svc.records["web.foo.example.com A "].TTL); ttl != 300 {
+		t.Fatalf("got TTL %d, want 300", ttl)
+	}
+
+	// nothing to do on repeated registration
+	batches := len(r53svc.batches)
+	if err := s.registerSelf(context.Background(), md); err != nil {
+		t.Fatal(err)
+	}
+	if len(r53svc.batches) != batches {
+		t.Fatal("repeated registration made changes")
+	}
+
+	// without tags instance has no name
+	md.data = map[string]string{"public-ipv4": "1.2.3.4"}
+	if err := s.registerSelf(context.Background(), md); err == nil {
+		t.Fatal("instance without name registered")
+	}
+}
+
+func TestDeregisterSelf(t *testing.T) {
+	r53svc := newFakeRoute53(t,
+		"web.foo.example.com. A 1.2.3.4",
+		"www.foo.example.com. A 5.6.7.8",
+		"db.foo.example.com. A 1.2.3.4",
+		"ci.foo.example.com. A 1.2.3.4",
+	)
+	s := &syncer{
+		r53:    r53svc,
+		suffix: ".foo.example.com",
+		zoneID: "Z1",
+	}
+	md := &fakeMetadata{
+		doc: ec2metadata.EC2InstanceIdentityDocument{InstanceID: "i-1"},
+		data: map[string]string{
+			"public-ipv4":                 "1.2.3.4",
+			"tags/instance":               "Name\n" + aliasesTag,
+			"tags/instance/Name":          "web",
+			"tags/instance/" + aliasesTag: "www,db",
+		},
+	}
+	if err := s.deregisterSelf(context.Background(), md); err != nil {
+		t.Fatal(err)
+	}
+	// www record points to other address, and ci is not a name of the
+	// instance, so they stay
+	want := []string{
+		"ci.foo.example.com. A 1.2.3.4",
+		"www.foo.example.com. A 5.6.7.8",
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// s3Getter is a subset of s3 API used to read snapshots
+type s3Getter interface {
+	GetObjectWithContext(aws.Context, *s3.GetObjectInput, ...request.Option) (*s3.GetObjectOutput, error)
+}
+
+// snapshot holds state of records changed by a change batch, both before and
+// after the change, to be restored by "rollback" command
+type snapshot struct {
+	Time    time.Time        `json:"time"`
+	ZoneID  string           `json:"zone_id"`
+	Records []snapshotRecord `json:"records"`
+}
+
+// snapshotRecord is a record set changed by a change batch
+type snapshotRecord struct {
+	Before *route53.ResourceRecordSet `json:"before,omitempty"` // nil if record set was created
+	After  *route53.ResourceRecordSet `json:"after,omitempty"`  // nil if record set was deleted
+}
+
+// newSnapshot returns snapshot of record sets the changes are about to
+// change, looking up current state of upserted ones
+func (s *syncer) newSnapshot(ctx context.Context, zoneID string, changes []*route53.Change) (*snapshot, error) {
+	snap := &snapshot{Time: time.Now().UTC(), ZoneID: zoneID}
+	index := make(map[string]int) // record key to snap.Records index
+	for _, ch := range changes {
+		rr := ch.ResourceRecordSet
+		key := recordKey(rr)
+		i, ok := index[key]
+		if !ok {
+			var before *route53.ResourceRecordSet
+			switch aws.StringValue(ch.Action) {
+			case route53.ChangeActionDelete:
+				before = rr
+			case route53.ChangeActionUpsert:
+				var err error
+				if before, err = s.lookupRecord(ctx, zoneID, rr); err != nil {
+					return nil, err
+				}
+			}
+			i = len(snap.Records)
+			index[key] = i
+			snap.Records = append(snap.Records, snapshotRecord{Before: before})
+		}
+		if aws.StringValue(ch.Action) == route53.ChangeActionDelete {
+			snap.Records[i].After = nil
+		} else {
+			snap.Records[i].After = rr
+		}
+	}
+	return snap, nil
+}
+
+// saveSnapshot saves snapshot of record sets the changes are about to change
+// to the configured destination. It returns the snapshot location, or empty
+// string if snapshots are not enabled.
+func (s *syncer) saveSnapshot(ctx context.Context, zoneID string, changes []*route53.Change) (string, error) {
+	if s.snapshotDir == "" && s.snapshotBucket == "" {
+		return "", nil
+	}
+	snap, err := s.newSnapshot(ctx, zoneID, changes)
+	if err != nil {
+		return "", err
+	}
+	body, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	var where string
+	if s.snapshotDir != "" {
+		where = filepath.Join(s.snapshotDir, zoneID+"-"+snap.Time.Format("20060102T150405.000000000")+".json")
+		if err := os.WriteFile(where, body, 0o644); err != nil {
+			return "", err
+		}
+	} else {
+		key := path.Join(s.snapshotPrefix, zoneID, snap.Time.Format("2006/01/02/150405.000000000")+".json")
+		_, err := s.snapshotS3.PutObjectWithContext(ctx, &s3.PutObjectInput{
+			Bucket:      &s.snapshotBucket,
+			Key:         &key,
+			Body:        bytes.NewReader(body),
+			ContentType: aws.String("application/json"),
+		})
+		if err != nil {
+			return "", err
+		}
+		where = "s3://" + s.snapshotBucket + "/" + key
+	}
+	logMsg("saved snapshot of changed records", "zone_id", zoneID, "snapshot", where)
+	return where, nil
+}
+
+// readSnapshot reads snapshot from local file or s3://bucket/key URL
+func readSnapshot(ctx context.Context, svc s3Getter, where string) (*snapshot, error) {
+	r, err := openLocation(ctx, svc, where)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	var snap snapshot
+	if err := json.NewDecoder(r).Decode(&snap); err != nil {
+		return nil, fmt.Errorf("reading snapshot %s: %w", where, err)
+	}
+	return &snap, nil
+}
+
+// rollback restores record sets of the snapshot to their state before the
+// change: record sets created by the change are deleted, and the ones updated
+// or deleted are upserted, in a single change batch. Record sets already in
+// their prior state are left alone.
+func (s *syncer) rollback(ctx context.Context, snap *snapshot) error {
+	zoneID := snap.ZoneID
+	if zoneID != s.zoneID && (zoneID != s.reverseZoneID || s.reverseZoneID == "") {
+		return fmt.Errorf("snapshot is of zone %s, which is not managed", zoneID)
+	}
+	return s.locked(ctx, func() error {
+		var deletes, upserts []*route53.Change
+		var summary []recordChange
+		for _, sr := range snap.Records {
+			rr := sr.Before
+			if rr == nil {
+				rr = sr.After
+			}
+			if rr == nil {
+				continue
+			}
+			cur, err := s.lookupRecord(ctx, zoneID, rr)
+			if err != nil {
+				return err
+			}
+			name := strings.TrimSuffix(aws.StringValue(rr.Name), ".")
+			if cur != nil && sr.After != nil && !sameRecord(cur, sr.After) ||
+				cur == nil && sr.After != nil {
+				logMsg("record changed after snapshot, restoring anyway", "zone_id", zoneID, "record_name", name)
+			}
+			switch {
+			case sr.Before == nil && cur != nil:
+				ch := &route53.Change{Action: aws.String(route53.ChangeActionDelete), ResourceRecordSet: cur}
+				deletes = append(deletes, ch)
+				summary = append(summary, newRecordChange(ch, aws.StringValue(cur.SetIdentifier), true))
+			case sr.Before != nil && (cur == nil || !sameRecord(cur, sr.Before)):
+				ch := &route53.Change{Action: aws.String(route53.ChangeActionUpsert), ResourceRecordSet: sr.Before}
+				upserts = append(upserts, ch)
+				summary = append(summary, newRecordChange(ch, aws.StringValue(sr.Before.SetIdentifier), cur != nil))
+			default:
+				continue
+			}
+			logMsg("restoring record", "zone_id", zoneID, "record_name", name)
+		}
+		if len(deletes)+len(upserts) == 0 {
+			logMsg("records are already in snapshot state", "zone_id", zoneID)
+			return s.noChanges()
+		}
+		// deletions go first, so that record of one type can be
+		// replaced by record of another type within a single batch
+		sort.SliceStable(summary, func(i, j int) bool {
+			return summary[i].Action == "delete" && summary[j].Action != "delete"
+		})
+		_, err := s.applyZone(ctx, zoneID, "", "rollback to snapshot of "+snap.Time.Format(time.RFC3339),
+			append(deletes, upserts...), summary)
+		return err
+	})
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func TestSnapshotRollback(t *testing.T) {
+	records := []string{
+		"old.foo.example.com. A 1.1.1.1",
+		"web.foo.example.com. A 9.9.9.9",
+	}
+	r53svc := newFakeRoute53(t, records...)
+	dir := t.TempDir()
+	s := &syncer{
+		ec2: &fakeEC2{instances: []*ec2.Instance{
+			testInstance("i-1", "web", "", "1.2.3.4"),
+			testInstance("i-2", "db", "", "5.6.7.8"),
+		}},
+		r53:         r53svc,
+		suffix:      ".foo.example.com",
+		zoneID:      "Z1",
+		ttl:         defaultTTL,
+		snapshotDir: dir,
+	}
+	if err := s.update(context.Background(), "", new(runStats)); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"db.foo.example.com. A 5.6.7.8",
+		"web.foo.example.com. A 1.2.3.4",
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state after update mismatch\ngot:\n%s\nwant:\n%s",
+			strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "Z1-*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("got snapshots %q, want one", files)
+	}
+	snap, err := readSnapshot(context.Background(), nil, files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snap.Records) != 3 {
+		t.Fatalf("got %d records in snapshot, want 3", len(snap.Records))
+	}
+	if err := s.rollback(context.Background(), snap); err != nil {
+		t.Fatal(err)
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, records) {
+		t.Fatalf("zone state after rollback mismatch\ngot:\n%s\nwant:\n%s",
+			strings.Join(got, "\n"), strings.Join(records, "\n"))
+	}
+	// rollback is a change too, and can be undone the same way
+	if files, _ = filepath.Glob(filepath.Join(dir, "Z1-*.json")); len(files) != 2 {
+		t.Fatalf("got snapshots %q, want two", files)
+	}
+	if err := s.rollback(context.Background(), snap); err != nil {
+		t.Fatal(err)
+	}
+	if len(r53svc.batches) != 2 {
+		t.Fatalf("got %d change batches, want no changes on repeated rollback", len(r53svc.batches))
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sns"
+)
+
+// snsClient is a subset of sns API used by the program
+type snsClient interface {
+	PublishWithContext(aws.Context, *sns.PublishInput, ...request.Option) (*sns.PublishOutput, error)
+}
+
+// changeNotification is a message describing applied changes
+type changeNotification struct {
+	ZoneID  string         `json:"zone_id"`
+	Changes []recordChange `json:"changes"`
+}
+
+// publishSNS publishes JSON-encoded changeNotification to SNS topic
+func publishSNS(ctx context.Context, svc snsClient, topicARN, zoneID string, changes []recordChange) error {
+	msg, err := json.Marshal(changeNotification{ZoneID: zoneID, Changes: changes})
+	if err != nil {
+		return err
+	}
+	_, err = svc.PublishWithContext(ctx, &sns.PublishInput{
+		TopicArn: &topicARN,
+		Subject:  aws.String(fmt.Sprintf("awsns: %d record(s) changed in zone %s", len(changes), zoneID)),
+		Message:  aws.String(string(msg)),
+	})
+	return err
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/sns"
+)
+
+func TestNotifySNS(t *testing.T) {
+	svc := &fakeSNS{}
+	s := &syncer{
+		ec2: &fakeEC2{instances: []*ec2.Instance{
+			testInstance("i-1", "jenkins", "", "1.2.3.4"),
+			testInstance("i-2", "db", "", "5.6.7.8"),
+		}},
+		r53: newFakeRoute53(t,
+			"db.foo.example.com. A 1.1.1.1",
+			"old.foo.example.com. A 2.2.2.2",
+		),
+		sns:      svc,
+		snsTopic: "arn:aws:sns:us-east-1:123456789012:dns",
+		suffix:   ".foo.example.com",
+		zoneID:   "Z1",
+	}
+	if err := s.reconcile(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	if len(svc.inputs) != 1 {
+		t.Fatalf("got %d Publish calls, want 1", len(svc.inputs))
+	}
+	in := svc.inputs[0]
+	if aws.StringValue(in.TopicArn) != s.snsTopic {
+		t.Fatalf("unexpected topic %q", aws.StringValue(in.TopicArn))
+	}
+	var msg changeNotification
+	if err := json.Unmarshal([]byte(aws.StringValue(in.Message)), &msg); err != nil {
+		t.Fatal(err)
+	}
+	want := changeNotification{
+		ZoneID: "Z1",
+		Changes: []recordChange{
+			{Action: "create", Name: "jenkins.foo.example.com", Type: "A", Value: "1.2.3.4", InstanceID: "i-1"},
+			{Action: "update", Name: "db.foo.example.com", Type: "A", Value: "5.6.7.8", InstanceID: "i-2"},
+			{Action: "delete", Name: "old.foo.example.com", Type: "A", Value: "2.2.2.2"},
+		},
+	}
+	if !reflect.DeepEqual(msg, want) {
+		t.Fatalf("got message\n%+v\nwant\n%+v", msg, want)
+	}
+}
+
+type fakeSNS struct {
+	inputs []*sns.PublishInput
+}
+
+func (f *fakeSNS) PublishWithContext(_ aws.Context, in *sns.PublishInput, _ ...request.Option) (*sns.PublishOutput, error) {
+	f.inputs = append(f.inputs, in)
+	return &sns.PublishOutput{}, nil
+}
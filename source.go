@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// source kinds which can be listed in -sources
+const (
+	sourceEC2       = "ec2"
+	sourceECS       = "ecs"
+	sourceLightsail = "lightsail"
+)
+
+// host is a resource discovered by a source, normalized so that sources of
+// any kind can be mixed in one run
+type host struct {
+	Name  string   // value of "Name" tag, or its equivalent
+	Addrs []string // public IP addresses or DNS names
+	Kind  string   // kind of the source, like "ec2"
+	ID    string   // unique id, like instance id
+
+	// Instance is the full description records are built from, including
+	// tags. Sources of resources other than ec2 instances may represent
+	// them as ec2 instances with the relevant fields set, or leave it nil,
+	// in which case it is made from the fields above, see instance.
+	Instance *ec2.Instance
+}
+
+// instance returns ec2 instance records of the host are built from
+func (h host) instance() *ec2.Instance {
+	if h.Instance != nil {
+		return h.Instance
+	}
+	inst := &ec2.Instance{
+		InstanceId: aws.String(h.ID),
+		State:      &ec2.InstanceState{Name: aws.String(ec2.InstanceStateNameRunning)},
+	}
+	if h.Name != "" {
+		inst.Tags = []*ec2.Tag{{Key: aws.String("Name"), Value: aws.String(h.Name)}}
+	}
+	for _, addr := range h.Addrs {
+		switch ip := net.ParseIP(addr); {
+		case ip == nil && inst.PublicDnsName == nil:
+			inst.PublicDnsName = aws.String(addr)
+		case ip != nil && ip.To4() != nil && inst.PublicIpAddress == nil:
+			inst.PublicIpAddress = aws.String(addr)
+		case ip != nil && ip.To4() == nil && inst.Ipv6Address == nil:
+			inst.Ipv6Address = aws.String(addr)
+		}
+	}
+	return inst
+}
+
+// source discovers hosts to publish records of
+type source interface {
+	// sourceName names the source in logs and errors, like "ecs" or
+	// "ec2 us-west-2"
+	sourceName() string
+	hosts(ctx context.Context) ([]host, error)
+}
+
+// instanceSource is a source of ec2 instances or resources represented as ec2
+// instances
+type instanceSource struct {
+	name  string
+	kind  string
+	fetch func(context.Context) ([]*ec2.Instance, error)
+}
+
+func (src instanceSource) sourceName() string { return src.name }
+
+func (src instanceSource) hosts(ctx context.Context) ([]host, error) {
+	instances, err := src.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]host, len(instances))
+	for i, inst := range instances {
+		h := host{Name: nameTag(inst), Kind: src.kind, ID: aws.StringValue(inst.InstanceId), Instance: inst}
+		for _, addr := range []*string{inst.PublicIpAddress, inst.Ipv6Address, inst.PublicDnsName} {
+			if aws.StringValue(addr) != "" {
+				h.Addrs = append(h.Addrs, *addr)
+			}
+		}
+		out[i] = h
+	}
+	return out, nil
+}
+
+// parseSources parses comma-separated list of source kinds into a set. Empty
+// list returns nil set, meaning ec2 and sources enabled by their own flags.
+func parseSources(list string) (map[string]bool, error) {
+	kinds := splitList(list)
+	if len(kinds) == 0 {
+		return nil, nil
+	}
+	out := make(map[string]bool)
+	for _, k := range kinds {
+		switch k = strings.ToLower(k); k {
+		case sourceEC2, sourceECS, sourceLightsail:
+			out[k] = true
+		default:
+			return nil, fmt.Errorf("unsupported source %q", k)
+		}
+	}
+	return out, nil
+}
+
+// instanceSources returns sources of instances in the given states, matching
+// ec2 filters, along with s.sources
+func (s *syncer) instanceSources(states []string, filters []*ec2.Filter) []source {
+	var out []source
+	if !s.noEC2 {
+		out = append(out, instanceSource{name: sourceEC2, kind: sourceEC2,
+			fetch: func(ctx context.Context) ([]*ec2.Instance, error) {
+				return runningInstances(ctx, s.ec2, states, s.pageSize, filters...)
+			}})
+		for _, rc := range s.remotes {
+			rc := rc
+			out = append(out, instanceSource{name: rc.name, kind: sourceEC2,
+				fetch: func(ctx context.Context) ([]*ec2.Instance, error) {
+					return runningInstances(ctx, rc.ec2, states, s.pageSize, filters...)
+				}})
+		}
+	}
+	if s.ecsCluster != "" {
+		out = append(out, instanceSource{name: sourceECS, kind: sourceECS, fetch: s.ecsTasks})
+	}
+	if s.lightsail != nil {
+		out = append(out, instanceSource{name: sourceLightsail, kind: sourceLightsail, fetch: s.lightsailInstances})
+	}
+	return append(out, s.sources...)
+}
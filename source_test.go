@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func TestSources(t *testing.T) {
+	static := fakeSource{name: "static", found: []host{
+		{Name: "nas", Addrs: []string{"5.6.7.8"}, Kind: "static", ID: "h-1"},
+		{Name: "vpn", Addrs: []string{"vpn.example.net"}, Kind: "static", ID: "h-2"},
+	}}
+	r53svc := newFakeRoute53(t)
+	s := &syncer{
+		ec2:     &fakeEC2{instances: []*ec2.Instance{testInstance("i-1", "web", "", "1.2.3.4")}},
+		r53:     r53svc,
+		suffix:  ".foo.example.com",
+		zoneID:  "Z1",
+		sources: []source{static},
+	}
+	if err := s.update(context.Background(), "", new(runStats)); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"nas.foo.example.com. A 5.6.7.8",
+		"vpn.foo.example.com. CNAME vpn.example.net",
+		"web.foo.example.com. A 1.2.3.4",
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	s.noEC2 = true
+	if err := s.update(context.Background(), "", new(runStats)); err != nil {
+		t.Fatal(err)
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want[:2]) {
+		t.Fatalf("zone state mismatch without ec2 source\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"),
+			strings.Join(want[:2], "\n"))
+	}
+
+	s.sources = append(s.sources, fakeSource{name: "broken", err: errors.New("boom")})
+	if err := s.update(context.Background(), "", new(runStats)); err == nil || !strings.Contains(err.Error(), "broken: boom") {
+		t.Fatalf("got %v, want error of the failed source", err)
+	}
+}
+
+func TestHostInstance(t *testing.T) {
+	inst := host{Name: "web", Addrs: []string{"2001:db8::1", "1.2.3.4", "web.example.net"}, ID: "h-1"}.instance()
+	if aws.StringValue(inst.PublicIpAddress) != "1.2.3.4" || aws.StringValue(inst.Ipv6Address) != "2001:db8::1" ||
+		aws.StringValue(inst.PublicDnsName) != "web.example.net" || nameTag(inst) != "web" ||
+		aws.StringValue(inst.InstanceId) != "h-1" {
+		t.Fatalf("unexpected instance: %v", inst)
+	}
+}
+
+func TestParseSources(t *testing.T) {
+	got, err := parseSources("ec2, ECS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]bool{"ec2": true, "ecs": true}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if got, err := parseSources(""); got != nil || err != nil {
+		t.Fatalf("got %v, %v for empty list, want nil", got, err)
+	}
+	if _, err := parseSources("ec2,gce"); err == nil {
+		t.Fatal("unsupported source accepted")
+	}
+}
+
+// fakeSource is a source returning the given hosts or error
+type fakeSource struct {
+	name  string
+	found []host
+	err   error
+}
+
+func (f fakeSource) sourceName() string { return f.name }
+
+func (f fakeSource) hosts(context.Context) ([]host, error) { return f.found, f.err }
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+// srvTag is the instance tag listing its services to publish SRV records for,
+// like "_prometheus._tcp:9090" or "_sip._udp:10:5:5060,_sip._tcp:10:5:5060"
+const srvTag = "dns:srv"
+
+// srvEntry is a single service of srvTag
+type srvEntry struct {
+	service  string // like "_prometheus._tcp"
+	priority int64
+	weight   int64
+	port     int64
+}
+
+// parseSRV parses srvTag value: comma-separated list of services in
+// "_service._proto:port" or "_service._proto:priority:weight:port" form
+func parseSRV(s string) ([]srvEntry, error) {
+	var out []srvEntry
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		fields := strings.Split(item, ":")
+		if len(fields) != 2 && len(fields) != 4 {
+			return nil, fmt.Errorf("invalid service %q, want _service._proto:[priority:weight:]port", item)
+		}
+		e := srvEntry{service: strings.ToLower(fields[0])}
+		if !validService(e.service) {
+			return nil, fmt.Errorf("invalid service %q: bad name %q", item, fields[0])
+		}
+		nums := []*int64{&e.port}
+		if len(fields) == 4 {
+			nums = []*int64{&e.priority, &e.weight, &e.port}
+		}
+		for i, p := range nums {
+			n, err := strconv.ParseInt(fields[i+1], 10, 64)
+			if err != nil || n < 0 || n > 65535 {
+				return nil, fmt.Errorf("invalid service %q: bad number %q", item, fields[i+1])
+			}
+			*p = n
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+// validService reports whether name is a valid SRV service name, like
+// "_prometheus._tcp"
+func validService(name string) bool {
+	labels := strings.Split(name, ".")
+	if len(labels) != 2 {
+		return false
+	}
+	for _, l := range labels {
+		if len(l) < 2 || len(l) > 63 || l[0] != '_' {
+			return false
+		}
+		for _, r := range l[1:] {
+			if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// srvRecords returns SRV record sets for services of instances having
+// records, one per service, named like "_prometheus._tcp" plus suffix and
+// pointing to host names of all instances providing the service. Returned
+// records are sorted by name.
+func (s *syncer) srvRecords(records []desiredRecord) []desiredRecord {
+	values := make(map[string]map[string]bool) // service to SRV values
+	for _, d := range records {
+		// only records of host names are SRV targets, not the ones of
+		// aliases
+		if *d.rr.Name != s.hostName(d.inst)+s.suffix {
+			continue
+		}
+		v := tagValue(d.inst, srvTag)
+		if v == "" {
+			continue
+		}
+		entries, err := parseSRV(v)
+		if err != nil {
+			logMsg("ignoring instance tag", "instance_id", aws.StringValue(d.inst.InstanceId), "tag", srvTag,
+				"error", err)
+			continue
+		}
+		for _, e := range entries {
+			if values[e.service] == nil {
+				values[e.service] = make(map[string]bool)
+			}
+			values[e.service][fmt.Sprintf("%d %d %d %s.", e.priority, e.weight, e.port, *d.rr.Name)] = true
+		}
+	}
+	services := make([]string, 0, len(values))
+	for svc := range values {
+		services = append(services, svc)
+	}
+	sort.Strings(services)
+	var out []desiredRecord
+	for _, svc := range services {
+		rr := &route53.ResourceRecordSet{
+			Name: aws.String(svc + s.suffix),
+			Type: aws.String(route53.RRTypeSrv),
+			TTL:  aws.Int64(s.ttl),
+		}
+		list := make([]string, 0, len(values[svc]))
+		for v := range values[svc] {
+			list = append(list, v)
+		}
+		sort.Strings(list)
+		for _, v := range list {
+			rr.ResourceRecords = append(rr.ResourceRecords, &route53.ResourceRecord{Value: aws.String(v)})
+		}
+		out = append(out, desiredRecord{rr: rr, inst: &ec2.Instance{InstanceId: aws.String(svc)}})
+	}
+	return out
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func TestParseSRV(t *testing.T) {
+	got, err := parseSRV("_Prometheus._tcp:9090, _sip._udp:10:5:5060")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []srvEntry{
+		{service: "_prometheus._tcp", port: 9090},
+		{service: "_sip._udp", priority: 10, weight: 5, port: 5060},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	for _, s := range []string{
+		"_prometheus._tcp",
+		"prometheus._tcp:9090",
+		"_prometheus:9090",
+		"_prometheus._tcp:70000",
+		"_sip._udp:10:5060",
+	} {
+		if _, err := parseSRV(s); err == nil {
+			t.Errorf("%q: invalid value accepted", s)
+		}
+	}
+}
+
+func TestReconcile_srv(t *testing.T) {
+	r53svc := newFakeRoute53(t,
+		"_prometheus._tcp.foo.example.com. SRV 0 0 9090 gone.foo.example.com.",
+		"_ldap._tcp.foo.example.com. SRV 0 0 389 gone.foo.example.com.",
+		"_kerberos._udp.example.com. SRV 0 0 88 kdc.example.com.",
+	)
+	instances := []*ec2.Instance{
+		withTag(withTag(testInstance("i-1", "web", "", "1.2.3.4"), srvTag, "_prometheus._tcp:9100"), aliasesTag, "www"),
+		withTag(testInstance("i-2", "db", "", "5.6.7.8"), srvTag, "_prometheus._tcp:9100,_postgresql._tcp:10:0:5432"),
+		withTag(testInstance("i-3", "ci", "", "9.9.9.9"), srvTag, "bogus"),
+	}
+	s := &syncer{
+		ec2:    &fakeEC2{instances: instances},
+		r53:    r53svc,
+		suffix: ".foo.example.com",
+		zoneID: "Z1",
+		srv:    true,
+	}
+	if err := s.update(context.Background(), "", &runStats{}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"_kerberos._udp.example.com. SRV 0 0 88 kdc.example.com.",
+		"_postgresql._tcp.foo.example.com. SRV 10 0 5432 db.foo.example.com.",
+		"_prometheus._tcp.foo.example.com. SRV 0 0 9100 db.foo.example.com.",
+		"_prometheus._tcp.foo.example.com. SRV 0 0 9100 web.foo.example.com.",
+		"ci.foo.example.com. A 9.9.9.9",
+		"db.foo.example.com. A 5.6.7.8",
+		"web.foo.example.com. A 1.2.3.4",
+		"www.foo.example.com. A 1.2.3.4",
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// removed instance takes its SRV values with it
+	instances[1].State.Name = aws.String(ec2.InstanceStateNameStopped)
+	if err := s.removeInstance(context.Background(), "i-2"); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{
+		"_kerberos._udp.example.com. SRV 0 0 88 kdc.example.com.",
+		"_prometheus._tcp.foo.example.com. SRV 0 0 9100 web.foo.example.com.",
+		"ci.foo.example.com. A 9.9.9.9",
+		"web.foo.example.com. A 1.2.3.4",
+		"www.foo.example.com. A 1.2.3.4",
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ssm"
+)
+
+// ssmClient is a subset of ssm API used by the program
+type ssmClient interface {
+	GetParameterWithContext(aws.Context, *ssm.GetParameterInput, ...request.Option) (*ssm.GetParameterOutput, error)
+	GetParametersByPathPagesWithContext(aws.Context, *ssm.GetParametersByPathInput, func(*ssm.GetParametersByPathOutput, bool) bool, ...request.Option) error
+}
+
+// loadSSMConfig returns settings keyed by environment variable names, stored
+// in SSM Parameter Store under name. If name is a path holding parameters,
+// like /awsns/SUFFIX and /awsns/ZONE, last element of each parameter name is
+// used as the key. Otherwise name must be a single parameter with KEY=value
+// lines; empty lines and lines starting with # are ignored.
+func loadSSMConfig(ctx context.Context, svc ssmClient, name string) (map[string]string, error) {
+	out := make(map[string]string)
+	fn := func(page *ssm.GetParametersByPathOutput, lastPage bool) bool {
+		for _, p := range page.Parameters {
+			out[path.Base(aws.StringValue(p.Name))] = aws.StringValue(p.Value)
+		}
+		return true
+	}
+	if err := svc.GetParametersByPathPagesWithContext(ctx, &ssm.GetParametersByPathInput{
+		Path:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	}, fn); err != nil {
+		return nil, fmt.Errorf("reading parameters by path %s: %w", name, err)
+	}
+	if len(out) != 0 {
+		return out, nil
+	}
+	resp, err := svc.GetParameterWithContext(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading parameter %s: %w", name, err)
+	}
+	sc := bufio.NewScanner(strings.NewReader(aws.StringValue(resp.Parameter.Value)))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("parameter %s: invalid line %q, want KEY=value", name, line)
+		}
+		out[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return out, sc.Err()
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ssm"
+)
+
+func TestLoadSSMConfig(t *testing.T) {
+	svc := &fakeSSM{params: map[string]string{
+		"/awsns/prod/SUFFIX": ".foo.example.com",
+		"/awsns/prod/ZONE":   "Z1",
+		"/awsns/staging":     "# staging zone\nSUFFIX=.staging.example.com\n\nFILTER = env=staging,team=web\n",
+	}}
+	table := []struct {
+		name string
+		want map[string]string
+	}{
+		{"/awsns/prod", map[string]string{"SUFFIX": ".foo.example.com", "ZONE": "Z1"}},
+		{"/awsns/staging", map[string]string{"SUFFIX": ".staging.example.com", "FILTER": "env=staging,team=web"}},
+		{"/awsns/missing", nil},
+	}
+	for _, tc := range table {
+		got, err := loadSSMConfig(context.Background(), svc, tc.name)
+		if tc.want == nil {
+			if err == nil {
+				t.Errorf("%s: got %v, want error", tc.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+// fakeSSM serves parameters from a map keyed by parameter names
+type fakeSSM struct {
+	params map[string]string
+}
+
+func (f *fakeSSM) GetParameterWithContext(_ aws.Context, in *ssm.GetParameterInput, _ ...request.Option) (*ssm.GetParameterOutput, error) {
+	v, ok := f.params[aws.StringValue(in.Name)]
+	if !ok {
+		return nil, awserr.New(ssm.ErrCodeParameterNotFound, "parameter not found", nil)
+	}
+	return &ssm.GetParameterOutput{Parameter: &ssm.Parameter{Name: in.Name, Value: aws.String(v)}}, nil
+}
+
+func (f *fakeSSM) GetParametersByPathPagesWithContext(_ aws.Context, in *ssm.GetParametersByPathInput, fn func(*ssm.GetParametersByPathOutput, bool) bool, _ ...request.Option) error {
+	prefix := strings.TrimSuffix(aws.StringValue(in.Path), "/") + "/"
+	page := new(ssm.GetParametersByPathOutput)
+	for name, v := range f.params {
+		if rest := strings.TrimPrefix(name, prefix); rest != name && !strings.Contains(rest, "/") {
+			page.Parameters = append(page.Parameters, &ssm.Parameter{Name: aws.String(name), Value: aws.String(v)})
+		}
+	}
+	fn(page, true)
+	return nil
+}
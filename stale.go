@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// maxHandledEvents limits the number of remembered handled events, see
+// syncer.handledEvents
+const maxHandledEvents = 1000
+
+// staleEvent reports whether state-change event of the instance with the
+// given id, emitted at the given time, no longer describes the instance and
+// should be discarded: event with actionUpsert is stale if the instance is not
+// running anymore, and event with other actions is stale if the instance was
+// started again after the event. It also returns key identifying the event by
+// instance id, launch time and state, which is the same for duplicate
+// deliveries of the event, or empty string if instance is not found.
+func (s *syncer) staleEvent(ctx context.Context, id, state, action string, at time.Time) (bool, string, error) {
+	svc := s.ec2
+	if len(s.envs) != 0 {
+		// all environments share the same account
+		svc = s.envs[0].ec2
+	}
+	inst, err := describeInstance(ctx, svc, id, nil)
+	if err != nil {
+		return false, "", err
+	}
+	if inst == nil {
+		return false, "", nil
+	}
+	launched := aws.TimeValue(inst.LaunchTime)
+	key := id + " " + launched.UTC().Format(time.RFC3339) + " " + state
+	var current string
+	if inst.State != nil {
+		current = aws.StringValue(inst.State.Name)
+	}
+	if action == actionUpsert {
+		return current != ec2.InstanceStateNameRunning && current != ec2.InstanceStateNamePending, key, nil
+	}
+	restarted := current == ec2.InstanceStateNameRunning || current == ec2.InstanceStateNamePending
+	return restarted && !at.IsZero() && launched.After(at), key, nil
+}
+
+// handledEvent reports whether event with the given key, see staleEvent, was
+// already handled
+func (s *syncer) handledEvent(key string) bool { return key != "" && s.handledEvents[key] }
+
+// markHandled remembers that event with the given key was handled
+func (s *syncer) markHandled(key string) {
+	if key == "" {
+		return
+	}
+	if s.handledEvents == nil || len(s.handledEvents) >= maxHandledEvents {
+		s.handledEvents = make(map[string]bool)
+	}
+	s.handledEvents[key] = true
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// actions taken on instance state-change events, see syncer.stateAction
+const (
+	actionUpsert = "upsert" // create records of the instance, with a full update if needed
+	actionDelete = "delete" // remove records of the instance
+	actionIgnore = "ignore" // leave records as they are
+)
+
+// defaultStateActions are actions taken on instance state-change events by
+// state, unless overridden by syncer.stateActions
+var defaultStateActions = map[string]string{
+	ec2.InstanceStateNameRunning:      actionUpsert,
+	ec2.InstanceStateNameStopped:      actionDelete,
+	ec2.InstanceStateNameShuttingDown: actionDelete,
+	ec2.InstanceStateNameTerminated:   actionDelete,
+}
+
+// parseStateActions parses comma-separated list of state=action pairs, like
+// "stopping=delete,stopped=ignore", into map of instance states to actions
+func parseStateActions(s string) (map[string]string, error) {
+	out := make(map[string]string)
+	for _, item := range splitList(s) {
+		state, action, ok := strings.Cut(item, "=")
+		if state, action = strings.TrimSpace(state), strings.TrimSpace(action); !ok {
+			return nil, fmt.Errorf("invalid state action %q, want state=action", item)
+		}
+		switch state {
+		case ec2.InstanceStateNamePending, ec2.InstanceStateNameRunning, ec2.InstanceStateNameStopping,
+			ec2.InstanceStateNameStopped, ec2.InstanceStateNameShuttingDown, ec2.InstanceStateNameTerminated:
+		default:
+			return nil, fmt.Errorf("unsupported instance state %q", state)
+		}
+		switch action {
+		case actionUpsert, actionDelete, actionIgnore:
+		default:
+			return nil, fmt.Errorf("unsupported state action %q", action)
+		}
+		out[state] = action
+	}
+	return out, nil
+}
+
+// stateAction returns action to take on state-change event of instance which
+// entered the given state: one set in s.stateActions, or the default one. With
+// s.keepStopped, "stopped" state is ignored by default. It returns empty string
+// for states having no action.
+func (s *syncer) stateAction(state string) string {
+	if action, ok := s.stateActions[state]; ok {
+		return action
+	}
+	if state == ec2.InstanceStateNameStopped && s.keepStopped {
+		return actionIgnore
+	}
+	return defaultStateActions[state]
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func TestParseStateActions(t *testing.T) {
+	got, err := parseStateActions("stopping=delete, stopped = ignore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"stopping": "delete", "stopped": "ignore"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for _, s := range []string{"stopping", "rebooting=delete", "running=restart"} {
+		if _, err := parseStateActions(s); err == nil {
+			t.Errorf("%q: got no error", s)
+		}
+	}
+}
+
+func TestHandleEvent_stateActions(t *testing.T) {
+	r53svc := newFakeRoute53(t, "web.foo.example.com. A 1.2.3.4", "db.foo.example.com. A 5.6.7.8")
+	s := &syncer{
+		ec2: &fakeEC2{instances: []*ec2.Instance{
+			stateOf(testInstance("i-1", "web", "", "1.2.3.4"), ec2.InstanceStateNameStopping),
+			stopped(testInstance("i-2", "db", "", "5.6.7.8")),
+		}},
+		r53:          r53svc,
+		suffix:       ".foo.example.com",
+		zoneID:       "Z1",
+		stateActions: map[string]string{"stopping": actionDelete, "stopped": actionIgnore},
+	}
+	ctx := context.Background()
+	if err := s.handleEvent(ctx, stateChangeEvent(t, "i-1", "stopping")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.handleEvent(ctx, stateChangeEvent(t, "i-2", "stopped")); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := r53svc.dump(), []string{"db.foo.example.com. A 5.6.7.8"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
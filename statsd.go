@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// statsd sends run statistics to statsd or DogStatsD agent over UDP. Metrics
+// have zone_id and suffix DogStatsD tags, which plain statsd ignores.
+type statsd struct {
+	w         io.Writer
+	tags      string // "|#key:value,..." suffix of each metric line
+	apiErrors int64  // failed AWS API calls since the last publish, updated atomically
+}
+
+// newStatsd returns statsd client sending metrics to addr, host:port of the
+// agent
+func newStatsd(addr, zoneID, suffix string) (*statsd, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("statsd address %q: %w", addr, err)
+	}
+	return &statsd{
+		w:    conn,
+		tags: "|#zone_id:" + zoneID + ",suffix:" + strings.TrimPrefix(suffix, "."),
+	}, nil
+}
+
+// countAPIErrors is a request handler that counts failed AWS API calls; it
+// should be attached to session Complete handlers list
+func (c *statsd) countAPIErrors(r *request.Request) {
+	if r.Error != nil {
+		atomic.AddInt64(&c.apiErrors, 1)
+	}
+}
+
+// publish sends statistics of a reconciliation run, along with the number of
+// AWS API errors since the previous call, in a single datagram; runErr is the
+// run result
+func (c *statsd) publish(st runStats, runErr error) error {
+	var b bytes.Buffer
+	metric := func(name string, value int64, typ string) {
+		fmt.Fprintf(&b, "awsns.%s:%d|%s%s\n", name, value, typ, c.tags)
+	}
+	metric("reconcile.duration", st.Duration.Milliseconds(), "ms")
+	metric("records.upserted", int64(st.Upserted), "c")
+	metric("records.deleted", int64(st.Deleted), "c")
+	metric("instances.skipped", int64(st.Skipped), "g")
+	if runErr == nil {
+		metric("records.managed", int64(st.Managed), "g")
+	} else {
+		metric("reconcile.errors", 1, "c")
+	}
+	metric("aws_api.errors", atomic.SwapInt64(&c.apiErrors, 0), "c")
+	_, err := c.w.Write(bytes.TrimSuffix(b.Bytes(), []byte("\n")))
+	return err
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+func TestStatsdPublish(t *testing.T) {
+	var buf bytes.Buffer
+	c := &statsd{w: &buf, tags: "|#zone_id:Z1,suffix:foo.example.com"}
+	c.countAPIErrors(&request.Request{Error: errors.New("throttled")})
+	c.countAPIErrors(&request.Request{})
+	st := runStats{Managed: 5, Upserted: 2, Deleted: 1, Skipped: 3, Duration: 1500 * time.Millisecond}
+	if err := c.publish(st, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := "awsns.reconcile.duration:1500|ms|#zone_id:Z1,suffix:foo.example.com\n" +
+		"awsns.records.upserted:2|c|#zone_id:Z1,suffix:foo.example.com\n" +
+		"awsns.records.deleted:1|c|#zone_id:Z1,suffix:foo.example.com\n" +
+		"awsns.instances.skipped:3|g|#zone_id:Z1,suffix:foo.example.com\n" +
+		"awsns.records.managed:5|g|#zone_id:Z1,suffix:foo.example.com\n" +
+		"awsns.aws_api.errors:1|c|#zone_id:Z1,suffix:foo.example.com"
+	if got := buf.String(); got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+	buf.Reset()
+	if err := c.publish(runStats{}, errors.New("failed")); err != nil {
+		t.Fatal(err)
+	}
+	want = "awsns.reconcile.duration:0|ms|#zone_id:Z1,suffix:foo.example.com\n" +
+		"awsns.records.upserted:0|c|#zone_id:Z1,suffix:foo.example.com\n" +
+		"awsns.records.deleted:0|c|#zone_id:Z1,suffix:foo.example.com\n" +
+		"awsns.instances.skipped:0|g|#zone_id:Z1,suffix:foo.example.com\n" +
+		"awsns.reconcile.errors:1|c|#zone_id:Z1,suffix:foo.example.com\n" +
+		"awsns.aws_api.errors:0|c|#zone_id:Z1,suffix:foo.example.com"
+	if got := buf.String(); got != want {
+		t.Fatalf("failed run, got:\n%s\nwant:\n%s", got, want)
+	}
+}
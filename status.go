@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// errOutOfSync is returned by reportStatus if records are not in sync with
+// instances
+var errOutOfSync = errors.New("records are not in sync")
+
+// statusOutOfSync is the exit code of "status" command if records are not in
+// sync; log.Fatal exits with 1 on errors
+const statusOutOfSync = 2
+
+// reportStatus writes changes a regular update would make to w, grouped by
+// zone, without making them. It returns errOutOfSync if there are any.
+func (s *syncer) reportStatus(ctx context.Context, w io.Writer) error {
+	p, err := s.makePlan(ctx)
+	if err != nil {
+		return err
+	}
+	var count int
+	for _, b := range p.Batches {
+		fmt.Fprintf(w, "zone %s:\n", b.ZoneID)
+		printChanges(w, b.Summary)
+		count += len(b.Summary)
+	}
+	if count == 0 {
+		fmt.Fprintln(w, "records are in sync")
+		return nil
+	}
+	return fmt.Errorf("%w: %d changes needed", errOutOfSync, count)
+}
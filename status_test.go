@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func TestReportStatus(t *testing.T) {
+	for _, synced := range []bool{true, false} {
+		records := []string{"web.foo.example.com. A 1.2.3.4"}
+		if !synced {
+			records = append(records, "old.foo.example.com. A 1.1.1.1")
+		}
+		r53svc := newFakeRoute53(t, records...)
+		s := &syncer{
+			ec2:    &fakeEC2{instances: []*ec2.Instance{testInstance("i-1", "web", "", "1.2.3.4")}},
+			r53:    r53svc,
+			suffix: ".foo.example.com",
+			zoneID: "Z1",
+			ttl:    defaultTTL,
+		}
+		var buf bytes.Buffer
+		err := s.reportStatus(context.Background(), &buf)
+		if len(r53svc.batches) != 0 {
+			t.Fatalf("status applied %d change batches", len(r53svc.batches))
+		}
+		if synced {
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(buf.String(), "records are in sync") {
+				t.Fatalf("unexpected output:\n%s", buf.String())
+			}
+			continue
+		}
+		if !errors.Is(err, errOutOfSync) {
+			t.Fatalf("got error %v, want %v", err, errOutOfSync)
+		}
+		if !strings.Contains(buf.String(), "delete old.foo.example.com A 1.1.1.1") {
+			t.Fatalf("unexpected output:\n%s", buf.String())
+		}
+	}
+}
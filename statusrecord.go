@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+// statusLabel is the leftmost label of TXT record with status of the last
+// successful full update, see writeStatus
+const statusLabel = "_awsns"
+
+// writeStatus upserts TXT record named statusLabel under s.suffix recording
+// time, program version and number of changes of the just finished full
+// update, like:
+//
+//	"time=2024-05-01T10:00:00Z" "version=v1.2.0" "changes=3"
+func (s *syncer) writeStatus(ctx context.Context, st runStats, now time.Time) error {
+	value := fmt.Sprintf("%q %q %q", "time="+now.UTC().Format(time.RFC3339), "version="+programVersion(),
+		fmt.Sprintf("changes=%d", st.Upserted+st.Deleted))
+	_, err := s.provider().apply(ctx, s.zoneID, "awsns status", []*route53.Change{{
+		Action: aws.String(route53.ChangeActionUpsert),
+		ResourceRecordSet: &route53.ResourceRecordSet{
+			Name:            aws.String(statusLabel + s.suffix),
+			Type:            aws.String(route53.RRTypeTxt),
+			TTL:             aws.Int64(s.ttl),
+			ResourceRecords: []*route53.ResourceRecord{{Value: aws.String(value)}},
+		},
+	}})
+	if err != nil {
+		return fmt.Errorf("writing status record: %w", err)
+	}
+	return nil
+}
+
+// programVersion returns module version the program was built from, as
+// recorded in its binary
+func programVersion() string {
+	if bi, ok := debug.ReadBuildInfo(); ok && bi.Main.Version != "" {
+		return bi.Main.Version
+	}
+	return "unknown"
+}
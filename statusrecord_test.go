@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+func TestReconcile_statusRecord(t *testing.T) {
+	p := &memProvider{records: map[string]*route53.ResourceRecordSet{}}
+	ec2svc := &fakeEC2{instances: []*ec2.Instance{testInstance("i-1", "web", "", "1.2.3.4")}}
+	s := &syncer{ec2: ec2svc, dns: p, suffix: ".example.com", zoneID: "Z1", ttl: defaultTTL, statusRecord: true}
+	ctx := context.Background()
+	for _, changes := range []string{"1", "0"} {
+		if err := s.reconcile(ctx, ""); err != nil {
+			t.Fatal(err)
+		}
+		rr := p.records[recordKey(&route53.ResourceRecordSet{Name: aws.String("_awsns.example.com."), Type: aws.String("TXT")})]
+		if rr == nil {
+			t.Fatalf("no status record, got %q", p.dump())
+		}
+		value := aws.StringValue(rr.ResourceRecords[0].Value)
+		if !regexp.MustCompile(`^"time=\d{4}-\d\d-\d\dT\d\d:\d\d:\d\dZ" "version=[^"]+" "changes=` + changes + `"$`).MatchString(value) {
+			t.Fatalf("got status %s, want %s changes", value, changes)
+		}
+	}
+}
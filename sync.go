@@ -0,0 +1,1779 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+// syncer keeps A/CNAME records under suffix in Route 53 hosted zone in sync
+// with running ec2 instances
+type syncer struct {
+	ec2    ec2Client
+	r53    route53Client
+	dns    provider // if set, records are kept there instead of Route 53, see syncer.provider
+	asg    autoscalingClient
+	suffix string
+	zoneID string
+	ttl    int64 // default record TTL
+
+	ignoreTag string        // instances with this tag set to true are not managed
+	filters   []*ec2.Filter // if set, only instances matching these are managed
+	exclude   []*ec2.Filter // tag filters, instances matching any of these are not managed
+
+	sanitize     bool   // if set, invalid instance names are sanitized instead of skipped
+	idn          bool   // if set, internationalized instance names are converted to punycode
+	requireEIP   bool   // if set, instances without elastic IP get no records
+	keepStopped  bool   // if set, records of stopped instances are kept, or point to their elastic IPs
+	fallbackName string // if set, how to name instances without "Name" tag, see fallback names
+	eksCluster   string // if set, nodes of this EKS cluster are named by their Kubernetes node names
+	allAddresses bool   // if set, A records list public IPs of all network interfaces
+
+	minAge time.Duration // if set, instances launched less than this long ago are skipped
+
+	twoPhase    bool // if set, full update applies upserts before deletions, see applyPhases
+	keepOnError bool // if set, two-phase update skips deletions if upserts fail
+
+	addressWait       time.Duration // if set, launch events wait this long for instance to get addresses, see awaitAddress
+	addressRetryDelay time.Duration // base delay between describing instance again, addressRetryBaseDelay if zero
+
+	metrics *metrics         // optional
+	budget  *apiBudget       // optional, reset on each Lambda invocation and -watch update
+	cw      cloudwatchClient // optional, publishes per-run metrics if set
+	statsd  *statsd          // optional, sends per-run metrics if set
+
+	sns      snsClient // optional, used with snsTopic
+	snsTopic string    // if set, change summaries are published to this topic
+	webhook  *webhook  // optional
+
+	events   eventBridgeClient // optional, used with eventBus
+	eventBus string            // if set, change events are sent to this EventBridge event bus
+
+	lock *zoneLock // optional, serializes zone updates across processes
+
+	auditS3     s3Client       // optional, used with auditBucket
+	auditBucket string         // if set, audit records are saved to this S3 bucket
+	auditPrefix string         // key prefix for audit records in auditBucket
+	auditDB     dynamodbClient // optional, used with auditTable
+	auditTable  string         // if set, audit records are saved to this DynamoDB table
+
+	auditMetadata bool   // if set, change batch comments and audit records describe who made the change
+	principal     string // ARN of AWS identity the program runs as, used with auditMetadata
+
+	snapshotS3     s3Client // optional, used with snapshotBucket
+	snapshotBucket string   // if set, snapshots of changed records are saved to this S3 bucket
+	snapshotPrefix string   // key prefix for snapshots in snapshotBucket
+	snapshotDir    string   // if set, snapshots of changed records are saved to this directory
+
+	checkpointS3     checkpointS3Client // optional, used with checkpointBucket
+	checkpointBucket string             // if set, checkpoints of interrupted listings are saved to this S3 bucket
+	checkpointPrefix string             // key prefix for checkpoints in checkpointBucket
+	checkpointDir    string             // if set, checkpoints of interrupted listings are saved to this directory
+
+	listPageSize     int           // if set, records are listed in pages of this size
+	listPageInterval time.Duration // if set, minimum interval between listing page requests
+
+	groupPolicy string // how to publish instances sharing the same name, see groupPolicies
+	vpcCheck    string // whether to check private zone association with VPCs of instances, see VPC check policies; empty means vpcCheckOff
+	onConflict  string // which of instances sharing the same name without groupPolicy gets the record, see conflict policies; empty means conflictNewest
+	mode        string // which changes are made, see operation modes; empty means modeFull
+	prefer      string // record type of instances without recordTypeTag, A or CNAME; empty means automatic choice
+	fastLaunch  bool   // if set, launch events only upsert records of the launched instance, see launchInstance
+
+	deletionGrace time.Duration // if set, records are only deleted after being removal candidates this long, see deferDeletions
+
+	statusRecord bool // if set, full updates record their outcome in TXT record, see writeStatus
+
+	healthCheck *healthCheckSpec // if set, records get health checks with this default spec
+
+	probePort    int           // if set, new records are only created once instances accept connections on this port
+	probeTimeout time.Duration // how long to wait for probe connection
+
+	expectChanges bool       // if set, update without changes to apply is an error
+	summary       io.Writer  // if set, summary of each reconciliation is written here as JSON
+	confirm       *confirmer // if set, changes are only applied after user confirms them
+
+	comment *template.Template // if set, change batch comments are rendered from it, see commentData
+
+	plan *changePlan // if set, change batches are added to it instead of being applied, see makePlan
+
+	wait     bool                            // if set, applied changes are waited for to propagate
+	resolver func(server string) dnsResolver // if set, upserted records are verified using it, see verifyChange
+
+	envs   []envSyncer // if set, updates are dispatched to these per-environment syncers, see setupEnvs
+	envTag string      // instance tag holding environment name, used with envs
+	env    string      // name of the environment managed by this per-environment syncer
+
+	handledEvents map[string]bool   // keys of handled state-change events, see staleEvent
+	stateActions  map[string]string // if set, overrides actions taken on state-change events, see stateAction
+
+	elb   elbClient   // optional, used with lbTag
+	elbv2 elbv2Client // optional, used with lbTag
+	lbTag string      // if set, load balancers with this tag get alias records named by its value
+
+	manageAliases bool // if set, alias records not created by the program may be deleted or overwritten, see managedAlias
+
+	managePattern *regexp.Regexp // if set, only names under suffix matching it are managed, see managedName
+	ignorePattern *regexp.Regexp // if set, names under suffix matching it are not managed, see managedName
+	coexist       string         // if set, names owned by this other controller are not managed, see foreignNames
+
+	privateAddresses bool // if set, A records point to private addresses of instances, see withRFC2136
+
+	rds         rdsClient         // optional, used with dbTag
+	elasticache elasticacheClient // optional, used with dbTag
+	dbTag       string            // if set, datastores with this tag get CNAME records named by its value
+
+	ecs        ecsClient // optional, used with ecsCluster
+	enis       eniClient // optional, used with ecsCluster
+	ecsCluster string    // if set, running tasks of this ECS cluster are managed as instances
+
+	lightsail lightsailClient // if set, running Lightsail instances are managed too
+
+	manifest *manifestSource // if set, static records listed in it are kept too
+
+	noEC2   bool     // if set, ec2 instances are not discovered, see -sources
+	sources []source // additional sources of hosts, see instanceSources
+
+	remotes     []remoteEC2 // additional regions and accounts to discover instances in
+	parallelism int         // maximum number of concurrent discovery calls, see parallel
+	pageSize    int         // if set, instances are described in pages of this size, see runningInstances
+
+	srv         bool // if set, SRV records are kept for services set by srvTag
+	txtMetadata bool // if set, TXT records with instance metadata are kept next to A records
+	dualstack   bool // if set, AAAA records are kept next to A records of instances with IPv6 addresses
+
+	tagger  ec2Tagger // optional, used with fqdnTag
+	fqdnTag string    // if set, instances are tagged with their DNS names using this tag key
+
+	reverseZoneID string // if set, PTR records of instances private addresses are kept in this zone
+	reverseZone   string // name of reverseZoneID zone with leading dot, like ".10.in-addr.arpa"
+
+	canaryZoneID string // if set, changes to zoneID are applied to this zone first, see applyCanary
+	canaryFrom   string // name of zoneID zone with leading dot
+	canaryTo     string // name of canaryZoneID zone with leading dot
+}
+
+// group policies, see syncer.groupPolicy
+const (
+	groupWeighted   = "weighted"   // weighted record sets with equal weights
+	groupMultivalue = "multivalue" // multivalue answer record sets
+	groupLatency    = "latency"    // latency record sets with regions of instances
+)
+
+func validGroupPolicy(policy string) bool {
+	switch policy {
+	case "", groupWeighted, groupMultivalue, groupLatency:
+		return true
+	}
+	return false
+}
+
+// validPreference reports whether pref is a valid -prefer value, returning
+// it as syncer.prefer value
+func validPreference(pref string) (string, bool) {
+	switch pref = strings.ToUpper(pref); pref {
+	case "", "AUTO":
+		return "", true
+	case "A", "CNAME":
+		return pref, true
+	}
+	return "", false
+}
+
+// operation modes, see syncer.mode
+const (
+	modeFull    = "full"    // both create/update and delete records
+	modeUpsert  = "upsert"  // only create/update records, never delete them
+	modeCleanup = "cleanup" // only delete records without backing instances
+)
+
+func validMode(mode string) bool {
+	switch mode {
+	case "", modeFull, modeUpsert, modeCleanup:
+		return true
+	}
+	return false
+}
+
+// mayUpsert reports whether records may be created or updated
+func (s *syncer) mayUpsert() bool { return s.mode != modeCleanup }
+
+// mayDelete reports whether records may be deleted
+func (s *syncer) mayDelete() bool { return s.mode != modeUpsert }
+
+// newSyncer validates its arguments and returns syncer using AWS clients
+// created from the session.
+func newSyncer(sess *session.Session, suffix, zoneID string) (*syncer, error) {
+	if suffix == "." || !strings.HasPrefix(suffix, ".") {
+		return nil, fmt.Errorf("invalid suffix %q, must start with dot, like '.example.com'", suffix)
+	}
+	if zoneID == "" {
+		return nil, fmt.Errorf("hosted zone id cannot be empty")
+	}
+	return &syncer{
+		ec2:    ec2.New(sess),
+		r53:    route53.New(sess),
+		asg:    autoscaling.New(sess),
+		suffix: suffix,
+		zoneID: zoneID,
+		ttl:    defaultTTL,
+
+		ignoreTag: defaultIgnoreTag,
+	}, nil
+}
+
+// ec2Client is a subset of ec2 API used by the program
+type ec2Client interface {
+	DescribeInstancesWithContext(aws.Context, *ec2.DescribeInstancesInput, ...request.Option) (*ec2.DescribeInstancesOutput, error)
+}
+
+// route53Client is a subset of route53 API used by the program
+type route53Client interface {
+	ListResourceRecordSetsPagesWithContext(aws.Context, *route53.ListResourceRecordSetsInput, func(*route53.ListResourceRecordSetsOutput, bool) bool, ...request.Option) error
+	ChangeResourceRecordSetsWithContext(aws.Context, *route53.ChangeResourceRecordSetsInput, ...request.Option) (*route53.ChangeResourceRecordSetsOutput, error)
+	ListHostedZonesByNameWithContext(aws.Context, *route53.ListHostedZonesByNameInput, ...request.Option) (*route53.ListHostedZonesByNameOutput, error)
+	GetHostedZoneWithContext(aws.Context, *route53.GetHostedZoneInput, ...request.Option) (*route53.GetHostedZoneOutput, error)
+	WaitUntilResourceRecordSetsChangedWithContext(aws.Context, *route53.GetChangeInput, ...request.WaiterOption) error
+	ListHealthChecksPagesWithContext(aws.Context, *route53.ListHealthChecksInput, func(*route53.ListHealthChecksOutput, bool) bool, ...request.Option) error
+	CreateHealthCheckWithContext(aws.Context, *route53.CreateHealthCheckInput, ...request.Option) (*route53.CreateHealthCheckOutput, error)
+	DeleteHealthCheckWithContext(aws.Context, *route53.DeleteHealthCheckInput, ...request.Option) (*route53.DeleteHealthCheckOutput, error)
+}
+
+// autoscalingClient is a subset of autoscaling API used by the program
+type autoscalingClient interface {
+	CompleteLifecycleActionWithContext(aws.Context, *autoscaling.CompleteLifecycleActionInput, ...request.Option) (*autoscaling.CompleteLifecycleActionOutput, error)
+}
+
+// reconcile brings A/CNAME records under suffix in sync with the running
+// non-spot instances. If invokerID is not empty, reconcile returns early
+// unless such instance is found among running non-spot ones.
+func (s *syncer) reconcile(ctx context.Context, invokerID string) error {
+	if len(s.envs) != 0 {
+		return s.eachEnv(ctx, func(e *syncer) error { return e.reconcile(ctx, invokerID) })
+	}
+	start := time.Now()
+	var st runStats
+	err := s.locked(ctx, func() error {
+		if err := s.update(ctx, invokerID, &st); err != nil || !s.statusRecord {
+			return err
+		}
+		return s.writeStatus(ctx, st, time.Now())
+	})
+	if errors.Is(err, errLockHeld) {
+		return err // nothing was done, lock holder reports its own run
+	}
+	st.Duration = time.Since(start)
+	s.report(ctx, st, err)
+	return err
+}
+
+// scheduledReconcile is reconcile of a periodic run: unlike event-driven
+// updates, it is skipped if the zone is locked by another process, as the
+// lock holder does the same work and the next run catches up anyway.
+func (s *syncer) scheduledReconcile(ctx context.Context) error {
+	if len(s.envs) != 0 {
+		return s.eachEnv(ctx, func(e *syncer) error { return e.scheduledReconcile(ctx) })
+	}
+	err := s.reconcile(ctx, "")
+	if errors.Is(err, errLockHeld) {
+		logMsg("zone is locked by another process, skipping", "zone_id", s.zoneID)
+		return nil
+	}
+	return err
+}
+
+// update does the actual work of reconcile, collecting run statistics into st
+func (s *syncer) update(ctx context.Context, invokerID string, st *runStats) error {
+	instances, err := s.managedInstances(ctx)
+	if err != nil {
+		return err
+	}
+	if invokerID != "" {
+		var found bool
+		for _, inst := range instances {
+			if inst.InstanceId != nil && *inst.InstanceId == invokerID {
+				found = true
+				break
+			}
+		}
+		// return rigth away if invoked by spot instance launch
+		if !found {
+			return nil
+		}
+	}
+	instances, protected := s.excludeIgnored(s.dropCollisions(instances))
+	st.Instances = len(instances)
+	if err := s.checkZoneVPCs(ctx, instances); err != nil {
+		return err
+	}
+	// manifest must be loaded before listing records, which lists
+	// manifest records of types not managed otherwise
+	static, err := s.manifest.load(ctx, s.suffix, s.ttl)
+	if err != nil {
+		return err
+	}
+	// zones are independent, so reverse zone is updated while main zone
+	// records are listed
+	zones := []string{s.zoneID}
+	if s.reverseZoneID != "" {
+		zones = append(zones, s.reverseZoneID)
+	}
+	var records []record
+	if err := parallel(ctx, s.parallelism, zones, func(ctx context.Context, i int) error {
+		if i == 0 {
+			var err error
+			records, err = s.listRecords(ctx)
+			return err
+		}
+		return s.syncReverse(ctx, invokerID, instances, protected, st)
+	}); err != nil {
+		return err
+	}
+	toRemove := make(map[string]*record, len(records))
+	existing := make(map[string]*record, len(records))
+	foreign := s.foreignNames(records)
+	for i := range records {
+		r := &records[i]
+		key, name := r.key(), strings.TrimSuffix(r.name, ".")
+		existing[key] = r
+		if r.typ == route53.RRTypeTxt && !s.derived(r.recordSet()) || s.manifest.hasKey(key) {
+			continue
+		}
+		if foreign[name] {
+			debugMsg("record name is owned by another controller, keeping it", "zone_id", s.zoneID,
+				"record_name", name, "type", r.typ, "owner", s.coexist)
+			continue
+		}
+		if protected[name] {
+			debugMsg("record is used by ignored instance, keeping it", "zone_id", s.zoneID,
+				"record_name", name, "type", r.typ)
+			continue
+		}
+		// simple record sets are never aliases
+		if r.rr != nil && !s.managedAlias(r.rr) {
+			debugMsg("alias record was not created by the program, keeping it", "zone_id", s.zoneID,
+				"record_name", name, "type", r.typ)
+			continue
+		}
+		if !s.managedName(r.name) {
+			debugMsg("record name is not managed, keeping it", "zone_id", s.zoneID,
+				"record_name", name, "type", r.typ)
+			continue
+		}
+		toRemove[key] = r
+	}
+	logMsg("removal candidates", "zone_id", s.zoneID, "count", len(toRemove))
+	own := s.desiredRecords(instances, st)
+	if st.Conflicts != 0 && s.onConflict == conflictFail {
+		return fmt.Errorf("%w: %d names", errNameConflict, st.Conflicts)
+	}
+	var desired []desiredRecord
+	taken := make(map[string]bool)
+	for _, d := range own {
+		// aliases may clash with names of ignored instances
+		if !protected[*d.rr.Name] {
+			desired = append(desired, d)
+			taken[*d.rr.Name] = true
+		}
+	}
+	desired = append(desired, s.derivedRecords(desired)...)
+	extra, err := s.extraRecords(ctx)
+	if err != nil {
+		return err
+	}
+	for _, d := range extra {
+		if protected[*d.rr.Name] || taken[*d.rr.Name] {
+			logMsg("name is already taken, skipping", "record_name", *d.rr.Name, "resource", *d.inst.InstanceId)
+			continue
+		}
+		desired = append(desired, d)
+		taken[*d.rr.Name] = true
+	}
+	var manifested int
+	if len(static) != 0 {
+		// manifest records may share names with records of other
+		// types, unless either is CNAME
+		keys, types := make(map[string]bool), make(map[string]string)
+		for _, d := range desired {
+			keys[recordKey(d.rr)] = true
+			if types[*d.rr.Name] != "CNAME" {
+				types[*d.rr.Name] = aws.StringValue(d.rr.Type)
+			}
+		}
+		for _, rr := range static {
+			if protected[*rr.Name] || keys[recordKey(rr)] || types[*rr.Name] == "CNAME" ||
+				aws.StringValue(rr.Type) == "CNAME" && types[*rr.Name] != "" {
+				logMsg("name is already taken, skipping", "record_name", *rr.Name, "resource", manifestResource)
+				continue
+			}
+			desired = append(desired, desiredRecord{rr: rr, inst: &ec2.Instance{InstanceId: aws.String(manifestResource)}})
+			manifested++
+		}
+	}
+	var checks map[string][]*route53.HealthCheck
+	var checksInUse map[string]bool
+	if s.healthCheck != nil && s.mayUpsert() {
+		if checks, err = s.listHealthChecks(ctx); err != nil {
+			return err
+		}
+		if checksInUse, err = s.attachHealthChecks(ctx, desired, checks); err != nil {
+			return err
+		}
+	}
+	var unready map[string]bool
+	if s.mayUpsert() {
+		unready = s.probeNew(ctx, desired, existing, st)
+	}
+	var upserts []*route53.Change
+	var summary []recordChange
+	for _, d := range desired {
+		rr, id := d.rr, aws.StringValue(d.inst.InstanceId)
+		key := recordKey(rr)
+		delete(toRemove, key)
+		old := existing[key]
+		if old != nil && aws.StringValue(rr.Type) == route53.RRTypeTxt && !s.derived(old.recordSet()) && id != manifestResource {
+			logMsg("name has TXT record not created by the program, skipping", "record_name", *rr.Name)
+			continue
+		}
+		if old != nil && old.rr != nil && !s.managedAlias(old.rr) {
+			logMsg("name has alias record not created by the program, skipping", "record_name", *rr.Name)
+			continue
+		}
+		if !s.managedName(*rr.Name) {
+			logMsg("name is not managed, skipping", "record_name", *rr.Name)
+			continue
+		}
+		if foreign[*rr.Name] {
+			logMsg("name is owned by another controller, skipping", "record_name", *rr.Name,
+				"owner", s.coexist, "instance_id", id)
+			continue
+		}
+		if unready[key] {
+			continue
+		}
+		if !s.mayUpsert() || old != nil && old.same(rr) {
+			continue
+		}
+		logMsg("upserting record", "zone_id", s.zoneID, "record_name", *rr.Name,
+			"action", "UPSERT", "instance_id", id)
+		ch := &route53.Change{
+			Action:            aws.String("UPSERT"),
+			ResourceRecordSet: rr,
+		}
+		upserts = append(upserts, ch)
+		summary = append(summary, newRecordChange(ch, id, old != nil))
+	}
+	keys := make([]string, 0, len(toRemove))
+	for k := range toRemove {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		r := toRemove[k]
+		debugMsg("no managed instance or resource has this record, it is a removal candidate", "zone_id", s.zoneID,
+			"record_name", strings.TrimSuffix(r.name, "."), "type", r.typ, "set_identifier", r.setID())
+	}
+	if len(desired) == manifested {
+		// may be caused by misconfiguration or eventual consistency,
+		// better keep existing records
+		logMsg("no instances to create records for, not removing any", "zone_id", s.zoneID)
+		if len(upserts) == 0 {
+			return s.noChanges()
+		}
+		toRemove, keys = nil, nil
+	}
+	st.Managed = len(desired)
+	if !s.mayDelete() && len(toRemove) != 0 {
+		logMsg("not removing records in upsert mode", "zone_id", s.zoneID, "count", len(toRemove))
+		toRemove, keys = nil, nil
+	}
+	var stateChanges []*route53.Change
+	if s.deletionGrace > 0 && s.mayDelete() && len(desired) != manifested {
+		var stateSummary []recordChange
+		if keys, stateChanges, stateSummary, err = s.deferDeletions(ctx, toRemove); err != nil {
+			return err
+		}
+		summary = append(summary, stateSummary...)
+	}
+	if len(upserts) == 0 && len(toRemove) == 0 && len(stateChanges) == 0 {
+		logMsg("records are up to date", "zone_id", s.zoneID, "count", len(desired))
+		s.tagFQDNs(ctx, desired)
+		return s.noChanges()
+	}
+	logMsg("actually removing", "zone_id", s.zoneID, "count", len(toRemove))
+	// deletions go first, so that record of one type can be replaced by
+	// record of another type within a single batch
+	var changes []*route53.Change
+	for _, k := range keys {
+		r := toRemove[k]
+		logMsg("removing record", "zone_id", s.zoneID, "record_name", strings.TrimSuffix(r.name, "."),
+			"action", "DELETE")
+		ch := &route53.Change{
+			Action:            aws.String("DELETE"),
+			ResourceRecordSet: r.recordSet(),
+		}
+		changes = append(changes, ch)
+		summary = append(summary, newRecordChange(ch, "", true))
+	}
+	changes = append(changes, upserts...)
+	changes = append(changes, stateChanges...)
+	// https://docs.aws.amazon.com/Route53/latest/DeveloperGuide/DNSLimitations.html?shortFooter=true#limits-api-requests
+	//
+	// ResourceRecord elements
+	// A request cannot contain more than 1,000 ResourceRecord elements.
+	// When the value of the Action element is UPSERT, each ResourceRecord
+	// element is counted twice.
+	//
+	// Maximum number of characters
+	// The sum of the number of characters (including spaces) in all Value
+	// elements in a request cannot exceed 32,000 characters. When the value
+	// of the Action element is UPSERT, each character in a Value element is
+	// counted twice.
+	//
+	// TODO: call API in batches of no more than 500 records
+	// see https://play.golang.org/p/KZEk2qhcA-F
+	if s.twoPhase {
+		if err := s.applyPhases(ctx, invokerID, changes, summary, len(upserts), len(toRemove), st); err != nil {
+			return err
+		}
+	} else {
+		changeID, err := s.apply(ctx, invokerID, "automated update for running instances", changes, summary)
+		if err != nil {
+			return err
+		}
+		st.ChangeIDs = append(st.ChangeIDs, changeID)
+		st.Upserted += len(upserts)
+		st.Deleted += len(toRemove)
+	}
+	if checks != nil && s.mayDelete() {
+		s.deleteHealthChecks(ctx, checks, checksInUse)
+	}
+	s.tagFQDNs(ctx, desired)
+	return nil
+}
+
+// defaultIgnoreTag is the default instance tag to opt out of DNS management
+const defaultIgnoreTag = "awsns:ignore"
+
+// ignored reports whether instance opted out of DNS management by having
+// s.ignoreTag set to true
+func (s *syncer) ignored(inst *ec2.Instance) bool {
+	if s.ignoreTag == "" {
+		return false
+	}
+	v, _ := strconv.ParseBool(tagValue(inst, s.ignoreTag))
+	return v
+}
+
+// excludeIgnored returns instances without ignored ones, and names of records
+// (without trailing dot) of ignored instances, which must be left intact.
+// Instances sharing such names are excluded too. Stopped instances which
+// records are kept, see keptStopped, are excluded as well, and their names are
+// protected unless other instances have them. So are instances launched less
+// than s.minAge ago, see tooYoung.
+func (s *syncer) excludeIgnored(instances []*ec2.Instance) ([]*ec2.Instance, map[string]bool) {
+	protected := make(map[string]bool)
+	claimed := make(map[string]bool) // names of instances neither ignored nor kept
+	var kept []*ec2.Instance
+	for _, inst := range instances {
+		switch {
+		case s.ignored(inst):
+			for _, name := range s.hostNames(inst) {
+				protected[name+s.suffix] = true
+			}
+		case s.keptStopped(inst), s.tooYoung(inst):
+			kept = append(kept, inst)
+		default:
+			for _, name := range s.hostNames(inst) {
+				claimed[name+s.suffix] = true
+			}
+		}
+	}
+	for _, inst := range kept {
+		for _, name := range s.hostNames(inst) {
+			if !claimed[name+s.suffix] {
+				protected[name+s.suffix] = true
+			}
+		}
+	}
+	if len(protected) == 0 && len(kept) == 0 {
+		return instances, protected
+	}
+	var out []*ec2.Instance
+	for _, inst := range instances {
+		name := s.hostName(inst)
+		switch {
+		case s.ignored(inst):
+			debugMsg("skipping ignored instance", "instance_id", aws.StringValue(inst.InstanceId),
+				"tag", s.ignoreTag)
+			continue
+		case s.keptStopped(inst):
+			debugMsg("keeping records of stopped instance as is", "instance_id", aws.StringValue(inst.InstanceId))
+			continue
+		case s.tooYoung(inst):
+			logMsg("instance was launched too recently, skipping it in this update", "instance_id",
+				aws.StringValue(inst.InstanceId), "launch_time", inst.LaunchTime.Format(time.RFC3339))
+			continue
+		case protected[name+s.suffix]:
+			logMsg("name is used by ignored instance, skipping", "record_name", name+s.suffix,
+				"instance_id", aws.StringValue(inst.InstanceId))
+			continue
+		}
+		out = append(out, inst)
+	}
+	return out, protected
+}
+
+// keptStopped reports whether instance is a stopped one which records are
+// kept as is: s.keepStopped is set and instance has no elastic IP to point its
+// records to
+func (s *syncer) keptStopped(inst *ec2.Instance) bool {
+	return s.keepStopped && inst.State != nil && aws.StringValue(inst.State.Name) == ec2.InstanceStateNameStopped &&
+		s.instanceRecord(inst) == nil
+}
+
+// tooYoung reports whether instance was launched less than s.minAge ago, so
+// that its addresses may not be populated yet
+func (s *syncer) tooYoung(inst *ec2.Instance) bool {
+	return s.minAge > 0 && inst.LaunchTime != nil && time.Since(*inst.LaunchTime) < s.minAge
+}
+
+// errNoChanges is returned by update if there are no changes to apply and
+// s.expectChanges is set
+var errNoChanges = errors.New("no changes to apply")
+
+// noChanges returns result of update that has nothing to change
+func (s *syncer) noChanges() error {
+	if s.expectChanges {
+		return errNoChanges
+	}
+	return nil
+}
+
+// sameRecord reports whether existing record set has the same type, TTL,
+// values and routing policy as the desired one, so it doesn't need an update
+func sameRecord(existing, desired *route53.ResourceRecordSet) bool {
+	if aws.StringValue(existing.Type) != aws.StringValue(desired.Type) ||
+		aws.Int64Value(existing.TTL) != aws.Int64Value(desired.TTL) ||
+		aws.StringValue(existing.SetIdentifier) != aws.StringValue(desired.SetIdentifier) ||
+		aws.Int64Value(existing.Weight) != aws.Int64Value(desired.Weight) ||
+		aws.BoolValue(existing.MultiValueAnswer) != aws.BoolValue(desired.MultiValueAnswer) ||
+		aws.StringValue(existing.Failover) != aws.StringValue(desired.Failover) ||
+		geoLocationString(existing.GeoLocation) != geoLocationString(desired.GeoLocation) ||
+		aws.StringValue(existing.Region) != aws.StringValue(desired.Region) ||
+		aws.StringValue(existing.HealthCheckId) != aws.StringValue(desired.HealthCheckId) ||
+		!sameAlias(existing.AliasTarget, desired.AliasTarget) {
+		return false
+	}
+	return sameValues(recordValues(existing), recordValues(desired))
+}
+
+// recordValues returns values of record set
+func recordValues(rr *route53.ResourceRecordSet) []string {
+	out := make([]string, len(rr.ResourceRecords))
+	for i, r := range rr.ResourceRecords {
+		out[i] = aws.StringValue(r.Value)
+	}
+	return out
+}
+
+// sameValues reports whether a and b have the same values in any order. It
+// doesn't modify either slice.
+func sameValues(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	if len(a) == 1 {
+		return a[0] == b[0]
+	}
+	a, b = append([]string(nil), a...), append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// desiredRecord is a record set that should exist for an instance
+type desiredRecord struct {
+	rr   *route53.ResourceRecordSet
+	inst *ec2.Instance
+}
+
+// derivedRecords returns record sets derived from records of instances: SRV
+// records of their services, TXT records with their metadata and AAAA records
+// of their IPv6 addresses, if enabled
+func (s *syncer) derivedRecords(records []desiredRecord) []desiredRecord {
+	var out []desiredRecord
+	if s.dualstack {
+		out = append(out, s.dualstackRecords(records)...)
+	}
+	if s.srv {
+		out = append(out, s.srvRecords(records)...)
+	}
+	if s.txtMetadata {
+		out = append(out, s.metadataRecords(records)...)
+	}
+	return out
+}
+
+// derived reports whether existing record set is of the kind derivedRecords
+// returns
+func (s *syncer) derived(rr *route53.ResourceRecordSet) bool {
+	switch aws.StringValue(rr.Type) {
+	case route53.RRTypeSrv:
+		return s.srv
+	case route53.RRTypeAaaa:
+		return s.dualstack
+	case route53.RRTypeTxt:
+		return s.txtMetadata && isMetadataRecord(rr)
+	}
+	return false
+}
+
+// hasDerived reports whether any kind of derived records is enabled
+func (s *syncer) hasDerived() bool { return s.srv || s.txtMetadata || s.dualstack }
+
+// derivedChanges returns changes bringing existing derived record sets in
+// line with instances, which are the only instances having records now. It
+// returns no changes if none of instances have records.
+func (s *syncer) derivedChanges(ctx context.Context, instances []*ec2.Instance) ([]*route53.Change, []recordChange, error) {
+	records := s.desiredRecords(instances, new(runStats))
+	if len(records) == 0 {
+		return nil, nil, nil
+	}
+	desired := s.derivedRecords(records)
+	zone, err := s.listRecords(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	existing := make(map[string]*route53.ResourceRecordSet)
+	foreign := make(map[string]bool)
+	for _, r := range zone {
+		if r.typ == "A" || r.typ == "CNAME" {
+			continue
+		}
+		rr := r.recordSet()
+		switch {
+		case s.derived(rr):
+			existing[recordKey(rr)] = rr
+		case aws.StringValue(rr.Type) == route53.RRTypeTxt:
+			foreign[recordKey(rr)] = true
+		}
+	}
+	var out []*route53.Change
+	var summary []recordChange
+	for _, d := range desired {
+		old := existing[recordKey(d.rr)]
+		delete(existing, recordKey(d.rr))
+		if !s.mayUpsert() || foreign[recordKey(d.rr)] || old != nil && sameRecord(old, d.rr) {
+			continue
+		}
+		ch := &route53.Change{Action: aws.String("UPSERT"), ResourceRecordSet: d.rr}
+		out = append(out, ch)
+		summary = append(summary, newRecordChange(ch, "", old != nil))
+	}
+	if !s.mayDelete() {
+		return out, summary, nil
+	}
+	keys := make([]string, 0, len(existing))
+	for k := range existing {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		ch := &route53.Change{Action: aws.String("DELETE"), ResourceRecordSet: existing[k]}
+		out = append(out, ch)
+		summary = append(summary, newRecordChange(ch, "", true))
+	}
+	return out, summary, nil
+}
+
+// recordKey returns key identifying record set by its name, type and set
+// identifier
+func recordKey(rr *route53.ResourceRecordSet) string {
+	return strings.TrimSuffix(aws.StringValue(rr.Name), ".") + " " + aws.StringValue(rr.Type) +
+		" " + aws.StringValue(rr.SetIdentifier)
+}
+
+// desiredRecords returns record sets that should exist for instances,
+// applying failover roles, geolocations, weights or group policy to instances
+// sharing the same name.
+// Instances that cannot have records are counted in st.Skipped.
+func (s *syncer) desiredRecords(instances []*ec2.Instance, st *runStats) []desiredRecord {
+	var out []desiredRecord
+	groups := make(map[string][]desiredRecord)
+	var names []string
+	for _, inst := range instances {
+		records := s.instanceRecords(inst)
+		if len(records) == 0 {
+			st.skip(inst, s.skipReason(inst))
+			continue
+		}
+		for _, rr := range records {
+			if _, ok := groups[*rr.Name]; !ok {
+				names = append(names, *rr.Name)
+			}
+			groups[*rr.Name] = append(groups[*rr.Name], desiredRecord{rr: rr, inst: inst})
+		}
+	}
+	for _, name := range names {
+		group := groups[name]
+		if hasPolicy(group) {
+			sortByInstanceID(group)
+			out = append(out, s.policyRecords(group, st)...)
+			continue
+		}
+		if hasFailoverRole(group) {
+			sortByInstanceID(group)
+			out = append(out, s.failoverRecords(group, st)...)
+			continue
+		}
+		if hasGeoLocation(group) {
+			sortByInstanceID(group)
+			out = append(out, s.geoRecords(group, st)...)
+			continue
+		}
+		if hasWeight(group) {
+			sortByInstanceID(group)
+			out = append(out, s.weightedRecords(group, st)...)
+			continue
+		}
+		if len(group) == 1 {
+			out = append(out, group...)
+			continue
+		}
+		if s.groupPolicy == "" {
+			out = append(out, s.resolveConflict(group, st))
+			continue
+		}
+		sortByInstanceID(group)
+		// multivalue answer routing does not support CNAME records
+		members := homogenize(group, s.groupPolicy == groupMultivalue)
+		skipDropped(st, group, members)
+		for _, d := range members {
+			d.rr.SetIdentifier = d.inst.InstanceId
+			switch s.groupPolicy {
+			case groupWeighted:
+				d.rr.Weight = aws.Int64(defaultWeight)
+			case groupMultivalue:
+				d.rr.MultiValueAnswer = aws.Bool(true)
+			case groupLatency:
+				region := instanceRegion(d.inst)
+				if region == "" {
+					logMsg("skipping instance of unknown region", "record_name", *d.rr.Name,
+						"instance_id", aws.StringValue(d.inst.InstanceId))
+					st.skip(d.inst, "unknown region")
+					continue
+				}
+				d.rr.Region = aws.String(region)
+			}
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// extraRecords returns records of resources other than instances: load
+// balancers, then datastores, if enabled
+func (s *syncer) extraRecords(ctx context.Context) ([]desiredRecord, error) {
+	var units []string
+	var fetch []func(context.Context) ([]desiredRecord, error)
+	if s.lbTag != "" {
+		units, fetch = append(units, "load balancers"), append(fetch, s.loadBalancerRecords)
+	}
+	if s.dbTag != "" {
+		units, fetch = append(units, "datastores"), append(fetch, s.datastoreRecords)
+	}
+	found := make([][]desiredRecord, len(units))
+	if err := parallel(ctx, s.parallelism, units, func(ctx context.Context, i int) error {
+		var err error
+		found[i], err = fetch[i](ctx)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	var out []desiredRecord
+	for _, list := range found {
+		out = append(out, list...)
+	}
+	return out, nil
+}
+
+// skipReason returns the reason why instance has no records
+func (s *syncer) skipReason(inst *ec2.Instance) string {
+	switch {
+	case s.hostName(inst) == "":
+		return "invalid name"
+	case !s.managedName(s.hostName(inst) + s.suffix):
+		return "name not managed"
+	case s.requireEIP && elasticIP(inst) == "":
+		return "no elastic IP"
+	}
+	return "no public address"
+}
+
+// skipDropped records instances of the group which are missing from members
+// as skipped due to lack of public IP address
+func skipDropped(st *runStats, group, members []desiredRecord) {
+	if len(group) == len(members) {
+		return
+	}
+	kept := make(map[*ec2.Instance]bool)
+	for _, d := range members {
+		kept[d.inst] = true
+	}
+	for _, d := range group {
+		if !kept[d.inst] {
+			st.skip(d.inst, "no public IP for A record")
+		}
+	}
+}
+
+func sortByInstanceID(group []desiredRecord) {
+	sort.Slice(group, func(i, j int) bool {
+		return aws.StringValue(group[i].inst.InstanceId) < aws.StringValue(group[j].inst.InstanceId)
+	})
+}
+
+// homogenize ensures all records of the group are of the same type, as
+// required for record sets sharing the same name: if group has both A and
+// CNAME records, or if onlyA is true, it replaces CNAME records with A records
+// pointing to the public IP address, dropping instances without one.
+func homogenize(group []desiredRecord, onlyA bool) []desiredRecord {
+	mixed := onlyA
+	for _, d := range group[1:] {
+		if aws.StringValue(d.rr.Type) != aws.StringValue(group[0].rr.Type) {
+			mixed = true
+			break
+		}
+	}
+	if !mixed {
+		return group
+	}
+	var out []desiredRecord
+	for _, d := range group {
+		if aws.StringValue(d.rr.Type) == "CNAME" {
+			ip := aws.StringValue(d.inst.PublicIpAddress)
+			if ip == "" {
+				continue
+			}
+			d.rr.Type = aws.String("A")
+			d.rr.ResourceRecords = []*route53.ResourceRecord{{Value: &ip}}
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
+// instanceRecords returns record sets that should exist for the instance: the
+// one returned by instanceRecord, followed by the ones for its aliases, see
+// hostNames
+func (s *syncer) instanceRecords(inst *ec2.Instance) []*route53.ResourceRecordSet {
+	rr := s.instanceRecord(inst)
+	if rr == nil {
+		return nil
+	}
+	var out []*route53.ResourceRecordSet
+	for i, name := range s.hostNames(inst) {
+		if !s.managedName(name + s.suffix) {
+			debugMsg("name is not managed, skipping", "record_name", name+s.suffix,
+				"instance_id", aws.StringValue(inst.InstanceId))
+			continue
+		}
+		if i == 0 {
+			out = append(out, rr)
+			continue
+		}
+		cp := *rr
+		cp.Name = aws.String(name + s.suffix)
+		out = append(out, &cp)
+	}
+	return out
+}
+
+// recordTypeTag is the instance tag forcing type of its record, A or CNAME
+const recordTypeTag = "dns:record-type"
+
+// targetTag is the instance tag overriding its record target: host name to
+// point CNAME record to, or IPv4 address for A record, like CloudFront
+// distribution or Global Accelerator in front of the instance
+const targetTag = "dns:target"
+
+// instanceTarget returns valid value of the instance targetTag, if any
+func instanceTarget(inst *ec2.Instance) string {
+	v := strings.TrimSuffix(strings.TrimSpace(tagValue(inst, targetTag)), ".")
+	if v == "" {
+		return ""
+	}
+	if ip := net.ParseIP(v); ip != nil && ip.To4() != nil {
+		return ip.String()
+	}
+	labels := strings.Split(v, ".")
+	ok := len(v) <= 253 && len(labels) > 1
+	for _, l := range labels {
+		ok = ok && len(l) <= 63 && valid(l)
+	}
+	if !ok {
+		logMsg("ignoring instance tag", "instance_id", aws.StringValue(inst.InstanceId), "tag", targetTag,
+			"error", fmt.Sprintf("invalid target %q, must be host name or IPv4 address", v))
+		return ""
+	}
+	return strings.ToLower(v)
+}
+
+// instanceRecord returns record set that should exist for the instance, or
+// nil if instance has no valid name or public address of the required type.
+// Returned record name has no trailing dot.
+func (s *syncer) instanceRecord(inst *ec2.Instance) *route53.ResourceRecordSet {
+	name := s.hostName(inst)
+	if name == "" {
+		return nil
+	}
+	rr := &route53.ResourceRecordSet{
+		Name: aws.String(name + s.suffix),
+		TTL:  aws.Int64(s.instanceTTL(inst)),
+	}
+	typ := strings.ToUpper(tagValue(inst, recordTypeTag))
+	switch typ {
+	case "", "A", "CNAME":
+	default:
+		logMsg("ignoring instance tag", "instance_id", aws.StringValue(inst.InstanceId), "tag", recordTypeTag,
+			"error", fmt.Sprintf("unsupported record type %q, must be A or CNAME", typ))
+		typ = ""
+	}
+	if typ == "" && s.dualstack && len(s.ipv6Addresses(inst)) != 0 {
+		// AAAA record cannot coexist with CNAME one
+		typ = "A"
+	}
+	if typ == "" {
+		typ = s.prefer
+	}
+	eip := elasticIP(inst)
+	if eip == "" && s.requireEIP {
+		return nil
+	}
+	if target := instanceTarget(inst); target != "" {
+		rr.Type = aws.String("CNAME")
+		if net.ParseIP(target) != nil {
+			rr.Type = aws.String("A")
+		}
+		rr.ResourceRecords = []*route53.ResourceRecord{{Value: aws.String(target)}}
+		return rr
+	}
+	if s.privateAddresses {
+		ip := aws.StringValue(inst.PrivateIpAddress)
+		if ip == "" {
+			return nil
+		}
+		rr.Type = aws.String("A")
+		rr.ResourceRecords = []*route53.ResourceRecord{{Value: aws.String(ip)}}
+		return rr
+	}
+	var ips []string
+	if s.allAddresses {
+		ips = publicAddresses(inst)
+	}
+	switch {
+	case typ != "CNAME" && len(ips) != 0:
+		rr.Type = aws.String("A")
+		for _, ip := range ips {
+			rr.ResourceRecords = append(rr.ResourceRecords, &route53.ResourceRecord{Value: aws.String(ip)})
+		}
+	case typ != "CNAME" && eip != "":
+		// unlike public DNS name, elastic IP survives stop/start
+		rr.Type = aws.String("A")
+		rr.ResourceRecords = []*route53.ResourceRecord{{Value: aws.String(eip)}}
+	case typ != "A" && inst.PublicDnsName != nil && *inst.PublicDnsName != "":
+		rr.Type = aws.String("CNAME")
+		rr.ResourceRecords = []*route53.ResourceRecord{{
+			Value: aws.String(*inst.PublicDnsName),
+		}}
+	case typ != "CNAME" && inst.PublicIpAddress != nil && *inst.PublicIpAddress != "":
+		rr.Type = aws.String("A")
+		rr.ResourceRecords = []*route53.ResourceRecord{{
+			Value: aws.String(*inst.PublicIpAddress),
+		}}
+	default:
+		return nil
+	}
+	return rr
+}
+
+// elasticIP returns elastic IP address associated with the instance, if any,
+// preferring the one of its primary network interface
+func elasticIP(inst *ec2.Instance) string {
+	var out string
+	for _, ni := range inst.NetworkInterfaces {
+		// automatically assigned public addresses are owned by "amazon"
+		if ni.Association == nil || aws.StringValue(ni.Association.IpOwnerId) == "amazon" {
+			continue
+		}
+		ip := aws.StringValue(ni.Association.PublicIp)
+		if ni.Attachment != nil && aws.Int64Value(ni.Attachment.DeviceIndex) == 0 && ip != "" {
+			return ip
+		}
+		if out == "" {
+			out = ip
+		}
+	}
+	return out
+}
+
+// publicAddresses returns sorted public IP addresses of all instance network
+// interfaces, including the ones associated with secondary private addresses
+func publicAddresses(inst *ec2.Instance) []string {
+	seen := make(map[string]struct{})
+	var out []string
+	add := func(a *ec2.InstanceNetworkInterfaceAssociation) {
+		if a == nil || aws.StringValue(a.PublicIp) == "" {
+			return
+		}
+		if _, ok := seen[*a.PublicIp]; !ok {
+			seen[*a.PublicIp] = struct{}{}
+			out = append(out, *a.PublicIp)
+		}
+	}
+	for _, ni := range inst.NetworkInterfaces {
+		add(ni.Association)
+		for _, addr := range ni.PrivateIpAddresses {
+			add(addr.Association)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+const (
+	ttlTag     = "dns:ttl" // instance tag overriding record TTL, in seconds
+	defaultTTL = 60
+	maxTTL     = 172800 // 2 days
+)
+
+// instanceTTL returns record TTL for the instance: the one set by its ttlTag,
+// if valid, or the default one
+func (s *syncer) instanceTTL(inst *ec2.Instance) int64 {
+	v := tagValue(inst, ttlTag)
+	if v == "" {
+		return s.ttl
+	}
+	ttl, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || !validTTL(ttl) {
+		logMsg("ignoring instance tag", "instance_id", aws.StringValue(inst.InstanceId), "tag", ttlTag,
+			"error", fmt.Sprintf("invalid TTL %q, must be between 0 and %d seconds", v, maxTTL))
+		return s.ttl
+	}
+	return ttl
+}
+
+func validTTL(ttl int64) bool { return ttl >= 0 && ttl <= maxTTL }
+
+// listRecords returns A/CNAME records located under suffix, and derived ones,
+// if enabled. Only the part of the zone from the suffix domain to the last
+// name under it is listed. If checkpoints are enabled, listing interrupted by
+// approaching context deadline or by exhausted API call budget is saved to be
+// resumed by the next run, and errListingInterrupted is returned. Listed
+// record sets are kept in compact form only, see record.
+func (s *syncer) listRecords(ctx context.Context) ([]record, error) {
+	var out []record
+	suffix := s.suffix + "."
+	checkpoints := s.checkpointDir != "" || s.checkpointBucket != ""
+	cp, err := s.loadCheckpoint(ctx)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool) // keys of records listed before checkpoint
+	resumed := cp != nil
+	if resumed {
+		out = make([]record, len(cp.Records))
+		for i, rr := range cp.Records {
+			out[i] = compactRecord(rr)
+			seen[recordKey(rr)] = true
+		}
+		logMsg("resuming listing from checkpoint", "zone_id", s.zoneID, "records", len(cp.Records),
+			"record_name", strings.TrimSuffix(cp.Name, "."))
+	} else {
+		cp = &listCheckpoint{ZoneID: s.zoneID, Suffix: s.suffix}
+	}
+	startName, startType := strings.TrimPrefix(suffix, "."), ""
+	if cp.Name != "" {
+		startName, startType = cp.Name, cp.Type
+	}
+	suffixOrder := dnsOrder(startName)
+	var interrupted bool
+	fn := func(rr *route53.ResourceRecordSet) bool {
+		if deadline, ok := ctx.Deadline(); ok && checkpoints && time.Until(deadline) < checkpointMargin {
+			interrupted = true
+			return false
+		}
+		if seen[recordKey(rr)] {
+			return true
+		}
+		cp.Name, cp.Type = aws.StringValue(rr.Name), aws.StringValue(rr.Type)
+		if rr.Name == nil || *rr.Name == suffix || !strings.HasSuffix(*rr.Name, suffix) {
+			// records under suffix are listed one after another,
+			// once past them the rest of the zone is irrelevant
+			return rr.Name == nil || dnsOrder(*rr.Name) <= suffixOrder
+		}
+		switch aws.StringValue(rr.Type) {
+		case "A", "CNAME":
+		case route53.RRTypeSrv:
+			if !s.srv && !s.manifest.has(rr) {
+				return true
+			}
+		case route53.RRTypeAaaa:
+			if !s.dualstack && !s.manifest.has(rr) {
+				return true
+			}
+		case route53.RRTypeTxt:
+			// TXT records not created by the program are
+			// listed too, so that they are not overwritten
+			if !s.txtMetadata && !s.manifest.has(rr) && (s.coexist == "" || externalDNSOwned(rr) == nil) {
+				return true
+			}
+		default:
+			if !s.manifest.has(rr) {
+				return true
+			}
+		}
+		out = append(out, compactRecord(rr))
+		return true
+	}
+	err = s.provider().list(ctx, s.zoneID, startName, startType, fn)
+	if interrupted && err == nil {
+		err = context.DeadlineExceeded
+	}
+	if checkpoints && cp.Name != "" && (errors.Is(err, context.DeadlineExceeded) || errors.Is(err, errBudgetExceeded)) {
+		cp.Time, cp.Records = time.Now().UTC(), make([]*route53.ResourceRecordSet, len(out))
+		for i, r := range out {
+			cp.Records[i] = r.recordSet()
+		}
+		if err := s.saveCheckpoint(ctx, cp); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w after %d records under suffix, next run resumes it", errListingInterrupted, len(out))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if resumed {
+		if err := s.clearCheckpoint(ctx); err != nil {
+			return nil, fmt.Errorf("removing checkpoint: %w", err)
+		}
+	}
+	return out, nil
+}
+
+// runningInstances returns non-spot instances in one of the given states,
+// usually just running ones, matching optional extra filters. Instances are
+// fetched in pages of up to pageSize instances, or of the API default size if
+// pageSize is zero, and only their compact copies are kept, see
+// compactInstance.
+func runningInstances(ctx context.Context, svc ec2Client, states []string, pageSize int, filters ...*ec2.Filter) ([]*ec2.Instance, error) {
+	in := &ec2.DescribeInstancesInput{
+		Filters: append([]*ec2.Filter{{
+			Name:   aws.String("instance-state-name"),
+			Values: aws.StringSlice(states),
+		}}, filters...),
+	}
+	if pageSize != 0 {
+		in.MaxResults = aws.Int64(int64(pageSize))
+	}
+	var out []*ec2.Instance
+	for {
+		resp, err := svc.DescribeInstancesWithContext(ctx, in)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range resp.Reservations {
+			for _, inst := range r.Instances {
+				if inst.InstanceLifecycle != nil {
+					debugMsg("skipping spot instance", "instance_id", aws.StringValue(inst.InstanceId))
+					continue
+				}
+				out = append(out, compactInstance(inst))
+			}
+		}
+		if aws.StringValue(resp.NextToken) == "" {
+			return out, nil
+		}
+		in.NextToken = resp.NextToken
+	}
+}
+
+// managedInstances returns running non-spot instances matching s.filters and
+// optional extra filters, except for the ones matching s.exclude. If
+// s.keepStopped is set, stopped ec2 instances are returned too. If names of
+// instances can only come from their "Name" tag, instances without it are
+// not fetched at all.
+func (s *syncer) managedInstances(ctx context.Context, filters ...*ec2.Filter) ([]*ec2.Instance, error) {
+	filters = append(filters, s.filters...)
+	if s.eksCluster == "" && s.fallbackName == "" {
+		filters = append(filters, &ec2.Filter{Name: aws.String("tag-key"), Values: aws.StringSlice([]string{"Name"})})
+	}
+	states := []string{ec2.InstanceStateNameRunning}
+	if s.keepStopped {
+		states = append(states, ec2.InstanceStateNameStopped)
+	}
+	// sources are queried concurrently
+	sources := s.instanceSources(states, filters)
+	units := make([]string, len(sources))
+	for i, src := range sources {
+		units[i] = src.sourceName()
+	}
+	found := make([][]host, len(sources))
+	if err := parallel(ctx, s.parallelism, units, func(ctx context.Context, i int) error {
+		var err error
+		found[i], err = sources[i].hosts(ctx)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	var instances []*ec2.Instance
+	for i, list := range found {
+		debugMsg("discovered hosts", "source", units[i], "count", len(list))
+		for _, h := range list {
+			instances = append(instances, h.instance())
+		}
+	}
+	if len(s.exclude) == 0 {
+		return instances, nil
+	}
+	var out []*ec2.Instance
+	for _, inst := range instances {
+		if s.excluded(inst) {
+			debugMsg("skipping instance matching exclude filter", "instance_id", aws.StringValue(inst.InstanceId))
+			continue
+		}
+		out = append(out, inst)
+	}
+	return out, nil
+}
+
+// describeInstance returns instance with the given id matching filters, or
+// nil if there is no such instance, which is also the case for instances
+// terminated long enough ago.
+func describeInstance(ctx context.Context, svc ec2Client, id string, filters []*ec2.Filter) (*ec2.Instance, error) {
+	resp, err := svc.DescribeInstancesWithContext(ctx, &ec2.DescribeInstancesInput{
+		InstanceIds: []*string{&id},
+		Filters:     filters,
+	})
+	var aerr awserr.Error
+	if errors.As(err, &aerr) && aerr.Code() == "InvalidInstanceID.NotFound" {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range resp.Reservations {
+		for _, inst := range r.Instances {
+			if aws.StringValue(inst.InstanceId) == id {
+				return inst, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// removeInstance deletes A/CNAME record of the non-running instance with the
+// given id, unless some other running non-spot instance has the same name. In
+// the latter case only record set with instance id as its set identifier is
+// deleted, if any.
+func (s *syncer) removeInstance(ctx context.Context, instanceID string) error {
+	if len(s.envs) != 0 {
+		return s.eachEnv(ctx, func(e *syncer) error { return e.removeInstance(ctx, instanceID) })
+	}
+	return s.locked(ctx, func() error { return s.removeInstanceLocked(ctx, instanceID) })
+}
+
+func (s *syncer) removeInstanceLocked(ctx context.Context, instanceID string) error {
+	if !s.mayDelete() {
+		logMsg("not removing records in upsert mode", "zone_id", s.zoneID, "instance_id", instanceID)
+		return nil
+	}
+	if s.deletionGrace > 0 {
+		// records are not deleted right away, but full update
+		// remembers when they became removal candidates
+		return s.update(ctx, "", new(runStats))
+	}
+	inst, err := describeInstance(ctx, s.ec2, instanceID, s.filters)
+	if err != nil {
+		return err
+	}
+	if inst == nil && len(s.filters) != 0 {
+		logMsg("instance does not match filters", "instance_id", instanceID)
+		return nil
+	}
+	if inst == nil {
+		// terminated instances are only described for a while, and
+		// without its name there is no telling which records it had;
+		// full update removes them as records of no running instance
+		logMsg("instance not found, leaving its records to full update", "instance_id", instanceID)
+		return nil
+	}
+	if inst.InstanceLifecycle != nil || s.ignored(inst) || s.excluded(inst) {
+		return nil // spot, ignored and excluded instances are not managed
+	}
+	names := s.hostNames(inst)
+	if len(names) == 0 {
+		return nil
+	}
+	others, err := s.managedInstances(ctx)
+	if err != nil {
+		return err
+	}
+	owners := make(map[string]string) // names used by other instances to their ids
+	var remaining []*ec2.Instance
+	for _, other := range others {
+		// instance may still be running if removal is triggered by
+		// autoscaling lifecycle hook
+		if id := aws.StringValue(other.InstanceId); id != instanceID {
+			remaining = append(remaining, other)
+			for _, name := range s.hostNames(other) {
+				owners[name] = id
+			}
+		}
+	}
+	remaining, protected := s.excludeIgnored(remaining)
+	if err := s.syncReverse(ctx, instanceID, remaining, protected, new(runStats)); err != nil {
+		return err
+	}
+	var changes []*route53.Change
+	for _, name := range names {
+		records, err := s.listName(ctx, name+s.suffix)
+		if err != nil {
+			return err
+		}
+		otherID := owners[name]
+		var found bool
+		for _, rr := range records {
+			// if name is shared with other running instances, only
+			// remove record set belonging to this instance
+			if otherID != "" && aws.StringValue(rr.SetIdentifier) != instanceID || !s.managedAlias(rr) || !s.managedName(*rr.Name) {
+				continue
+			}
+			found = true
+			changes = append(changes, &route53.Change{
+				Action:            aws.String("DELETE"),
+				ResourceRecordSet: rr,
+			})
+		}
+		switch {
+		case found:
+			logMsg("removing record", "zone_id", s.zoneID, "record_name", name+s.suffix,
+				"action", "DELETE", "instance_id", instanceID)
+		case otherID != "":
+			logMsg("name is used by another running instance, not removing", "zone_id", s.zoneID,
+				"record_name", name+s.suffix, "instance_id", instanceID, "other_instance_id", otherID)
+		default:
+			logMsg("no records to remove", "zone_id", s.zoneID, "record_name", name+s.suffix, "instance_id", instanceID)
+		}
+	}
+	summary := make([]recordChange, len(changes))
+	for i, ch := range changes {
+		summary[i] = newRecordChange(ch, instanceID, true)
+	}
+	if s.hasDerived() {
+		more, moreSummary, err := s.derivedChanges(ctx, remaining)
+		if err != nil {
+			return err
+		}
+		changes, summary = append(changes, more...), append(summary, moreSummary...)
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	if _, err := s.apply(ctx, instanceID, "automated removal of "+instanceID, changes, summary); err != nil {
+		return err
+	}
+	if s.healthCheck != nil {
+		checks, err := s.listHealthChecks(ctx)
+		if err != nil {
+			return err
+		}
+		s.deleteHealthChecks(ctx, map[string][]*route53.HealthCheck{instanceID: checks[instanceID]}, nil)
+	}
+	return nil
+}
+
+// listName returns A/CNAME record sets with the given name, which must have no
+// trailing dot
+func (s *syncer) listName(ctx context.Context, name string) ([]*route53.ResourceRecordSet, error) {
+	fqdn := name + "."
+	var out []*route53.ResourceRecordSet
+	fn := func(rr *route53.ResourceRecordSet) bool {
+		if aws.StringValue(rr.Name) != fqdn {
+			return false
+		}
+		if t := aws.StringValue(rr.Type); t == "A" || t == "CNAME" {
+			out = append(out, rr)
+		}
+		return true
+	}
+	if err := s.provider().list(ctx, s.zoneID, fqdn, "", fn); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// renameInstance updates record of the running instance after its name
+// change: it upserts record for the new name and removes records pointing to
+// this instance under other names, unless such names are used by other running
+// non-spot instances.
+func (s *syncer) renameInstance(ctx context.Context, instanceID string) error {
+	if len(s.envs) != 0 {
+		return s.eachEnv(ctx, func(e *syncer) error { return e.renameInstance(ctx, instanceID) })
+	}
+	return s.locked(ctx, func() error { return s.renameInstanceLocked(ctx, instanceID) })
+}
+
+func (s *syncer) renameInstanceLocked(ctx context.Context, instanceID string) error {
+	instances, err := s.managedInstances(ctx)
+	if err != nil {
+		return err
+	}
+	var inst *ec2.Instance
+	inUse := make(map[string]struct{})
+	for _, i := range instances {
+		if aws.StringValue(i.InstanceId) == instanceID {
+			inst = i
+			continue
+		}
+		for _, name := range s.hostNames(i) {
+			inUse[name+s.suffix] = struct{}{}
+		}
+	}
+	if inst == nil {
+		logMsg("instance is not a running non-spot one", "instance_id", instanceID)
+		return nil
+	}
+	if s.ignored(inst) {
+		logMsg("instance is ignored", "instance_id", instanceID)
+		return nil
+	}
+	// manifest records are kept even if they point to this instance
+	if _, err := s.manifest.load(ctx, s.suffix, s.ttl); err != nil {
+		return err
+	}
+	records, err := s.listRecords(ctx)
+	if err != nil {
+		return err
+	}
+	var changes []*route53.Change
+	var summary []recordChange
+	var desired []desiredRecord
+	current := make(map[string]bool) // names of records being upserted
+	managed, protected := s.excludeIgnored(instances)
+	if err := s.syncReverse(ctx, instanceID, managed, protected, new(runStats)); err != nil {
+		return err
+	}
+	foreign := s.foreignNames(records)
+	for _, rr := range s.instanceRecords(inst) {
+		if protected[*rr.Name] {
+			logMsg("name is used by ignored instance, skipping", "record_name", *rr.Name, "instance_id", instanceID)
+			continue
+		}
+		if foreign[*rr.Name] {
+			logMsg("name is owned by another controller, skipping", "record_name", *rr.Name,
+				"owner", s.coexist, "instance_id", instanceID)
+			continue
+		}
+		current[*rr.Name] = true
+		if s.mayUpsert() {
+			desired = append(desired, desiredRecord{rr: rr, inst: inst})
+		}
+	}
+	if len(desired) != 0 && s.healthCheck != nil {
+		checks, err := s.listHealthChecks(ctx)
+		if err != nil {
+			return err
+		}
+		if _, err := s.attachHealthChecks(ctx, desired, checks); err != nil {
+			return err
+		}
+	}
+	for _, d := range desired {
+		rr := d.rr
+		logMsg("upserting record", "zone_id", s.zoneID, "record_name", *rr.Name,
+			"action", "UPSERT", "instance_id", instanceID)
+		var existed bool
+		for _, old := range records {
+			if old.name == *rr.Name+"." {
+				existed = true
+				break
+			}
+		}
+		ch := &route53.Change{
+			Action:            aws.String("UPSERT"),
+			ResourceRecordSet: rr,
+		}
+		changes = append(changes, ch)
+		summary = append(summary, newRecordChange(ch, instanceID, existed))
+	}
+	targets := instanceTargets(inst)
+	for _, r := range records {
+		name := strings.TrimSuffix(r.name, ".")
+		if current[name] || foreign[name] || !s.mayDelete() || !s.managedName(name) || s.manifest.hasKey(r.key()) {
+			continue
+		}
+		if protected[name] {
+			debugMsg("record is used by ignored instance, keeping it", "zone_id", s.zoneID,
+				"record_name", name, "type", r.typ)
+			continue
+		}
+		if _, ok := inUse[name]; ok {
+			continue
+		}
+		old := r.recordSet()
+		if !allValuesIn(old, targets) {
+			continue
+		}
+		logMsg("removing record", "zone_id", s.zoneID, "record_name", name,
+			"action", "DELETE", "instance_id", instanceID)
+		ch := &route53.Change{
+			Action:            aws.String("DELETE"),
+			ResourceRecordSet: old,
+		}
+		changes = append(changes, ch)
+		summary = append(summary, newRecordChange(ch, instanceID, true))
+	}
+	if s.hasDerived() {
+		more, moreSummary, err := s.derivedChanges(ctx, managed)
+		if err != nil {
+			return err
+		}
+		changes, summary = append(changes, more...), append(summary, moreSummary...)
+	}
+	if len(changes) == 0 {
+		logMsg("no changes to apply", "zone_id", s.zoneID, "instance_id", instanceID)
+		return nil
+	}
+	if _, err = s.apply(ctx, instanceID, "automated update after rename of "+instanceID, changes, summary); err != nil {
+		return err
+	}
+	s.tagFQDNs(ctx, desired)
+	return nil
+}
+
+// instanceTargets returns public DNS name and addresses of the instance, and
+// its targetTag value, which its records may point to
+func instanceTargets(inst *ec2.Instance) map[string]struct{} {
+	targets := make(map[string]struct{})
+	if v := instanceTarget(inst); v != "" {
+		targets[v] = struct{}{}
+	}
+	for _, v := range []*string{inst.PublicDnsName, inst.PublicIpAddress} {
+		if aws.StringValue(v) != "" {
+			targets[*v] = struct{}{}
+		}
+	}
+	for _, ip := range publicAddresses(inst) {
+		targets[ip] = struct{}{}
+	}
+	return targets
+}
+
+// allValuesIn reports whether record set has values and all of them are in
+// the set
+func allValuesIn(rr *route53.ResourceRecordSet, set map[string]struct{}) bool {
+	for _, r := range rr.ResourceRecords {
+		if _, ok := set[aws.StringValue(r.Value)]; !ok {
+			return false
+		}
+	}
+	return len(rr.ResourceRecords) != 0
+}
+
+// apply submits changes to Route 53 as a single change batch with the given
+// comment, then records audit trail and sends notifications about applied
+// changes described by summary. invokerID is the id of the instance which
+// event triggered the update, if any. It returns id of the applied change
+// batch.
+func (s *syncer) apply(ctx context.Context, invokerID, comment string, changes []*route53.Change, summary []recordChange) (string, error) {
+	return s.applyZone(ctx, s.zoneID, invokerID, comment, changes, summary)
+}
+
+// applyZone is like apply, but submits changes to the given hosted zone
+func (s *syncer) applyZone(ctx context.Context, zoneID, invokerID, comment string, changes []*route53.Change, summary []recordChange) (string, error) {
+	if s.plan != nil {
+		return "", s.addToPlan(ctx, zoneID, invokerID, comment, changes, summary)
+	}
+	comment = s.changeComment(ctx, zoneID, invokerID, comment, summary)
+	if s.confirm != nil {
+		ok, err := s.confirm.ask(zoneID, summary)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return "", errNotConfirmed
+		}
+	}
+	if s.canaryZoneID != "" && zoneID == s.zoneID {
+		if err := s.applyCanary(ctx, comment, changes); err != nil {
+			return "", err
+		}
+	}
+	if _, err := s.saveSnapshot(ctx, zoneID, changes); err != nil {
+		return "", fmt.Errorf("saving snapshot: %w", err)
+	}
+	changeID, err := s.provider().apply(ctx, zoneID, comment, changes)
+	if err != nil {
+		return "", err
+	}
+	rec := newAuditRecord(ctx, zoneID, changeID, invokerID, comment, summary)
+	if s.auditMetadata {
+		rec.Principal, rec.Version, rec.InstanceIDs = s.principal, programVersion(), summaryInstances(summary)
+	}
+	s.audit(ctx, rec)
+	s.notify(ctx, zoneID, summary)
+	return changeID, s.verifyChange(ctx, zoneID, changeID, changes)
+}
+
+// nameTag returns value of the instance "Name" tag
+func nameTag(inst *ec2.Instance) string { return tagValue(inst, "Name") }
+
+// tagValue returns value of the instance tag with the given key
+func tagValue(inst *ec2.Instance, key string) string {
+	for _, tag := range inst.Tags {
+		if aws.StringValue(tag.Key) == key {
+			return aws.StringValue(tag.Value)
+		}
+	}
+	return ""
+}
+
+func valid(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		switch {
+		case 'a' <= r && r <= 'z':
+		case 'A' <= r && r <= 'Z':
+		case '0' <= r && r <= '9':
+		case r == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,46 @@
+package main
+
+// samTemplate returns AWS SAM template deploying the program as Lambda
+// function configured according to cfg: function code is expected in
+// awsns.zip file holding Linux binary named bootstrap; the function is invoked
+// by EC2 instance state-change events and runs with least-privilege policy,
+// see iamPolicy.
+func samTemplate(cfg config) (map[string]interface{}, error) {
+	policy, err := iamPolicy(cfg)
+	if err != nil {
+		return nil, err
+	}
+	type object = map[string]interface{}
+	return object{
+		"AWSTemplateFormatVersion": "2010-09-09",
+		"Transform":                "AWS::Serverless-2016-10-31",
+		"Description":              "awsns: Route 53 records for running EC2 instances",
+		"Resources": object{
+			"Function": object{
+				"Type": "AWS::Serverless::Function",
+				"Properties": object{
+					"CodeUri":     "awsns.zip",
+					"Handler":     "bootstrap",
+					"Runtime":     "provided.al2",
+					"Timeout":     60,
+					"Environment": object{"Variables": cfg.env()},
+					"Policies":    []interface{}{policy},
+					"Events": object{
+						"StateChange": object{
+							"Type": "EventBridgeRule",
+							"Properties": object{
+								"Pattern": object{
+									"source":      []string{"aws.ec2"},
+									"detail-type": []string{"EC2 Instance State-change Notification"},
+									"detail": object{
+										"state": []string{"running", "shutting-down", "stopped", "terminated"},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+// splitPhases splits changes of a full update in two change batches: the
+// first one has upserts, along with deletions of records sharing names with
+// upserted ones, which may be replaced by records of other types within a
+// single batch; the second one has the remaining deletions. Summary is split
+// the same way.
+func splitPhases(changes []*route53.Change, summary []recordChange) (first, second []*route53.Change, firstSummary, secondSummary []recordChange) {
+	upserted := make(map[string]bool)
+	for _, ch := range changes {
+		if aws.StringValue(ch.Action) != route53.ChangeActionDelete {
+			upserted[strings.TrimSuffix(aws.StringValue(ch.ResourceRecordSet.Name), ".")] = true
+		}
+	}
+	for _, ch := range changes {
+		if aws.StringValue(ch.Action) == route53.ChangeActionDelete &&
+			!upserted[strings.TrimSuffix(aws.StringValue(ch.ResourceRecordSet.Name), ".")] {
+			second = append(second, ch)
+		} else {
+			first = append(first, ch)
+		}
+	}
+	for _, c := range summary {
+		if c.Action == "delete" && !upserted[c.Name] {
+			secondSummary = append(secondSummary, c)
+		} else {
+			firstSummary = append(firstSummary, c)
+		}
+	}
+	return first, second, firstSummary, secondSummary
+}
+
+// applyPhases applies changes of a full update in two change batches, see
+// splitPhases, so that no name is left without records while stale records
+// are deleted: deletions are only submitted after upserts are applied, and,
+// with -wait or -verify, propagated. If upserts fail, deletions are still
+// applied, unless s.keepOnError is set, and the error of upserts is returned.
+// Upserted and deleted are numbers of upserted and deleted records for stats.
+func (s *syncer) applyPhases(ctx context.Context, invokerID string, changes []*route53.Change, summary []recordChange, upserted, deleted int, st *runStats) error {
+	const comment = "automated update for running instances"
+	first, second, firstSummary, secondSummary := splitPhases(changes, summary)
+	if len(first) == 0 || len(second) == 0 {
+		changeID, err := s.apply(ctx, invokerID, comment, changes, summary)
+		if err != nil {
+			return err
+		}
+		st.ChangeIDs = append(st.ChangeIDs, changeID)
+		st.Upserted += upserted
+		st.Deleted += deleted
+		return nil
+	}
+	changeID, upsertErr := s.apply(ctx, invokerID, comment+", upserts", first, firstSummary)
+	switch {
+	case upsertErr == nil:
+		st.ChangeIDs = append(st.ChangeIDs, changeID)
+		st.Upserted += upserted
+		st.Deleted += deleted - len(second)
+	case s.keepOnError || errors.Is(upsertErr, errNotConfirmed) || ctx.Err() != nil:
+		return upsertErr
+	default:
+		logMsg("upserts failed, applying deletions anyway", "zone_id", s.zoneID, "error", upsertErr)
+	}
+	changeID, err := s.apply(ctx, invokerID, comment+", deletions", second, secondSummary)
+	if err != nil {
+		if upsertErr != nil {
+			return upsertErr
+		}
+		return err
+	}
+	st.ChangeIDs = append(st.ChangeIDs, changeID)
+	st.Deleted += len(second)
+	return upsertErr
+}
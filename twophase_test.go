@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+func TestSplitPhases(t *testing.T) {
+	change := func(action, name, typ string) *route53.Change {
+		return &route53.Change{Action: aws.String(action),
+			ResourceRecordSet: &route53.ResourceRecordSet{Name: aws.String(name), Type: aws.String(typ)}}
+	}
+	changes := []*route53.Change{
+		change(route53.ChangeActionDelete, "app.foo.example.com.", "CNAME"),
+		change(route53.ChangeActionDelete, "old.foo.example.com.", "A"),
+		change(route53.ChangeActionUpsert, "app.foo.example.com", "A"),
+		change(route53.ChangeActionUpsert, "web.foo.example.com", "A"),
+	}
+	summary := []recordChange{
+		{Action: "create", Name: "app.foo.example.com", Type: "A"},
+		{Action: "update", Name: "web.foo.example.com", Type: "A"},
+		{Action: "delete", Name: "app.foo.example.com", Type: "CNAME"},
+		{Action: "delete", Name: "old.foo.example.com", Type: "A"},
+	}
+	first, second, firstSummary, secondSummary := splitPhases(changes, summary)
+	if want := []*route53.Change{changes[0], changes[2], changes[3]}; !reflect.DeepEqual(first, want) {
+		t.Fatalf("got first batch %v, want %v", first, want)
+	}
+	if want := changes[1:2]; !reflect.DeepEqual(second, want) {
+		t.Fatalf("got second batch %v, want %v", second, want)
+	}
+	if want := summary[:3]; !reflect.DeepEqual(firstSummary, want) {
+		t.Fatalf("got first summary %v, want %v", firstSummary, want)
+	}
+	if want := summary[3:]; !reflect.DeepEqual(secondSummary, want) {
+		t.Fatalf("got second summary %v, want %v", secondSummary, want)
+	}
+}
+
+func TestReconcile_twoPhase(t *testing.T) {
+	for _, keepOnError := range []bool{false, true} {
+		r53svc := newFakeRoute53(t,
+			"web.foo.example.com. A 5.6.7.8",
+			"old.foo.example.com. A 9.9.9.9",
+		)
+		fr := &failingUpserts{fakeRoute53: r53svc}
+		s := &syncer{
+			ec2:         &fakeEC2{instances: []*ec2.Instance{testInstance("i-1", "web", "", "1.2.3.4")}},
+			r53:         r53svc,
+			suffix:      ".foo.example.com",
+			zoneID:      "Z1",
+			ttl:         defaultTTL,
+			twoPhase:    true,
+			keepOnError: keepOnError,
+		}
+		var st runStats
+		if err := s.update(context.Background(), "", &st); err != nil {
+			t.Fatal(err)
+		}
+		if l := len(r53svc.batches); l != 2 {
+			t.Fatalf("got %d change batches, want 2", l)
+		}
+		for i, action := range []string{route53.ChangeActionUpsert, route53.ChangeActionDelete} {
+			if b := r53svc.batches[i]; len(b) != 1 || aws.StringValue(b[0].Action) != action {
+				t.Fatalf("got change batch %d %v, want single %s", i, b, action)
+			}
+		}
+		if st.Upserted != 1 || st.Deleted != 1 || len(st.ChangeIDs) != 2 {
+			t.Fatalf("got %d upserted, %d deleted, change ids %q; want 1, 1 and two ids",
+				st.Upserted, st.Deleted, st.ChangeIDs)
+		}
+
+		s.ec2.(*fakeEC2).instances[0].PublicIpAddress = aws.String("4.3.2.1")
+		old := &route53.ResourceRecordSet{Name: aws.String("old.foo.example.com."), Type: aws.String("A"),
+			TTL: aws.Int64(60), ResourceRecords: []*route53.ResourceRecord{{Value: aws.String("9.9.9.9")}}}
+		r53svc.add(old)
+		s.r53 = fr
+		if err := s.update(context.Background(), "", new(runStats)); !errors.Is(err, errUpsertFailed) {
+			t.Fatalf("got error %v, want %v", err, errUpsertFailed)
+		}
+		_, kept := r53svc.records[recordKey(old)]
+		if kept != keepOnError {
+			t.Fatalf("with keepOnError=%v stale record kept: %v", keepOnError, kept)
+		}
+	}
+}
+
+var errUpsertFailed = errors.New("upsert failed")
+
+// failingUpserts is fakeRoute53 rejecting change batches with upserts
+type failingUpserts struct {
+	*fakeRoute53
+}
+
+func (f *failingUpserts) ChangeResourceRecordSetsWithContext(ctx aws.Context, in *route53.ChangeResourceRecordSetsInput, opts ...request.Option) (*route53.ChangeResourceRecordSetsOutput, error) {
+	for _, ch := range in.ChangeBatch.Changes {
+		if aws.StringValue(ch.Action) == route53.ChangeActionUpsert {
+			return nil, errUpsertFailed
+		}
+	}
+	return f.fakeRoute53.ChangeResourceRecordSetsWithContext(ctx, in, opts...)
+}
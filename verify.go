@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+// maxVerified is the maximum number of upserted records verified after each
+// change batch
+const maxVerified = 10
+
+// dnsResolver is a subset of net.Resolver methods used to verify records
+type dnsResolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+	LookupCNAME(ctx context.Context, host string) (string, error)
+}
+
+// nameserverResolver returns resolver sending all queries to the given
+// nameserver
+func nameserverResolver(server string) dnsResolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, net.JoinHostPort(server, "53"))
+		},
+	}
+}
+
+// verifyChange waits for the applied change to propagate to all Route 53
+// nameservers if s.wait is set, then, if s.resolver is set, checks that
+// authoritative nameservers of the zone serve up to maxVerified of upserted
+// simple A/CNAME records with the expected values. Private zones have no
+// public nameservers to query, so their records are not checked.
+func (s *syncer) verifyChange(ctx context.Context, zoneID, changeID string, changes []*route53.Change) error {
+	if s.wait && changeID != "" {
+		logMsg("waiting for change to propagate", "zone_id", zoneID, "change_id", changeID)
+		if err := s.r53.WaitUntilResourceRecordSetsChangedWithContext(ctx, &route53.GetChangeInput{Id: &changeID}); err != nil {
+			return fmt.Errorf("waiting for change %s: %w", changeID, err)
+		}
+	}
+	if s.resolver == nil {
+		return nil
+	}
+	var records []*route53.ResourceRecordSet
+	for _, ch := range changes {
+		rr := ch.ResourceRecordSet
+		switch aws.StringValue(ch.Action) {
+		case route53.ChangeActionUpsert, route53.ChangeActionCreate:
+		default:
+			continue
+		}
+		// answers for record sets with routing policies depend on who
+		// is asking
+		if t := aws.StringValue(rr.Type); t != "A" && t != "CNAME" || rr.SetIdentifier != nil || rr.AliasTarget != nil {
+			continue
+		}
+		if records = append(records, rr); len(records) == maxVerified {
+			break
+		}
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	zone, err := s.provider().zoneInfo(ctx, zoneID)
+	if err != nil {
+		return err
+	}
+	if len(zone.NameServers) == 0 {
+		logMsg("zone has no public nameservers, not verifying records", "zone_id", zoneID)
+		return nil
+	}
+	for _, ns := range zone.NameServers {
+		r := s.resolver(ns)
+		for _, rr := range records {
+			if err := verifyRecord(ctx, r, rr); err != nil {
+				return fmt.Errorf("verifying records on %s: %w", ns, err)
+			}
+		}
+	}
+	logMsg("records verified", "zone_id", zoneID, "count", len(records),
+		"nameservers", len(zone.NameServers))
+	return nil
+}
+
+// verifyRecord checks that resolver returns values of A or CNAME record set
+func verifyRecord(ctx context.Context, r dnsResolver, rr *route53.ResourceRecordSet) error {
+	name := strings.TrimSuffix(aws.StringValue(rr.Name), ".") + "."
+	var want []string
+	for _, v := range rr.ResourceRecords {
+		want = append(want, strings.ToLower(strings.TrimSuffix(aws.StringValue(v.Value), ".")))
+	}
+	sort.Strings(want)
+	var got []string
+	if aws.StringValue(rr.Type) == "CNAME" {
+		cname, err := r.LookupCNAME(ctx, name)
+		if err != nil {
+			return err
+		}
+		got = []string{strings.ToLower(strings.TrimSuffix(cname, "."))}
+	} else {
+		addrs, err := r.LookupHost(ctx, name)
+		if err != nil {
+			return err
+		}
+		for _, a := range addrs {
+			if ip := net.ParseIP(a); ip != nil && ip.To4() != nil {
+				got = append(got, a)
+			}
+		}
+		sort.Strings(got)
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		return fmt.Errorf("%s %s resolves to %q, want %q", name, aws.StringValue(rr.Type), got, want)
+	}
+	return nil
+}
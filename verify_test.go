@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+func TestVerifyChange(t *testing.T) {
+	for _, served := range []string{"1.2.3.4", "9.9.9.9"} {
+		r53svc := newFakeRoute53(t)
+		r53svc.zones = []*route53.HostedZone{{Id: aws.String("/hostedzone/Z1"), Name: aws.String("example.com.")}}
+		r53svc.nameServers = []string{"ns-1.awsdns-01.org", "ns-2.awsdns-02.com"}
+		var queried []string
+		s := &syncer{
+			ec2: &fakeEC2{instances: []*ec2.Instance{
+				testInstance("i-1", "web", "", "1.2.3.4"),
+				testInstance("i-2", "db", "ec2-5-6-7-8.compute.amazonaws.com", ""),
+			}},
+			r53:    r53svc,
+			suffix: ".foo.example.com",
+			zoneID: "Z1",
+			ttl:    defaultTTL,
+			wait:   true,
+			resolver: func(server string) dnsResolver {
+				return fakeResolver{server: server, queried: &queried, records: map[string]string{
+					"web.foo.example.com.": served,
+					"db.foo.example.com.":  "ec2-5-6-7-8.compute.amazonaws.com.",
+				}}
+			},
+		}
+		err := s.update(context.Background(), "", new(runStats))
+		if served == "1.2.3.4" && err != nil {
+			t.Fatal(err)
+		}
+		if served != "1.2.3.4" && (err == nil || !strings.Contains(err.Error(), "web.foo.example.com.")) {
+			t.Fatalf("got error %v, want verification failure", err)
+		}
+		if len(r53svc.waited) != 1 || r53svc.waited[0] != "/change/C1" {
+			t.Fatalf("waited for changes %q, want one", r53svc.waited)
+		}
+		if served == "1.2.3.4" && len(queried) != 4 {
+			t.Fatalf("got queries %q, want 2 records on 2 nameservers", queried)
+		}
+	}
+}
+
+// fakeResolver serves records from map of names to comma-separated values
+type fakeResolver struct {
+	server  string
+	records map[string]string
+	queried *[]string
+}
+
+func (r fakeResolver) LookupHost(_ context.Context, host string) ([]string, error) {
+	*r.queried = append(*r.queried, r.server+" "+host)
+	v, ok := r.records[host]
+	if !ok {
+		return nil, fmt.Errorf("lookup %s: no such host", host)
+	}
+	return strings.Split(v, ","), nil
+}
+
+func (r fakeResolver) LookupCNAME(_ context.Context, host string) (string, error) {
+	*r.queried = append(*r.queried, r.server+" "+host)
+	v, ok := r.records[host]
+	if !ok {
+		return "", fmt.Errorf("lookup %s: no such host", host)
+	}
+	return v, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// VPC check policies, see syncer.vpcCheck
+const (
+	vpcCheckOff  = "off"
+	vpcCheckWarn = "warn" // log VPCs the private zone is not associated with
+	vpcCheckFail = "fail" // fail update if private zone is not associated with some VPCs
+)
+
+func validVPCCheck(policy string) bool {
+	switch policy {
+	case "", vpcCheckOff, vpcCheckWarn, vpcCheckFail:
+		return true
+	}
+	return false
+}
+
+// errZoneVPC is returned by update with vpcCheckFail policy if private zone is
+// not associated with VPCs of some instances
+var errZoneVPC = errors.New("private zone is not associated with VPCs of instances")
+
+// checkZoneVPCs checks that s.zoneID, if it is a private zone, is associated
+// with VPCs of instances, as their records are not resolvable otherwise. It
+// logs each VPC missing from zone associations along with its instances, and
+// with vpcCheckFail policy returns errZoneVPC if there are any.
+func (s *syncer) checkZoneVPCs(ctx context.Context, instances []*ec2.Instance) error {
+	if s.vpcCheck == "" || s.vpcCheck == vpcCheckOff {
+		return nil
+	}
+	zone, err := s.provider().zoneInfo(ctx, s.zoneID)
+	if err != nil {
+		return err
+	}
+	if !zone.Private {
+		return nil
+	}
+	associated := make(map[string]bool)
+	for _, vpc := range zone.VPCs {
+		associated[vpc] = true
+	}
+	missing := make(map[string][]string) // VPC ids to ids of their instances
+	for _, inst := range instances {
+		// ECS tasks and Lightsail instances have no VPC id
+		if vpc := aws.StringValue(inst.VpcId); vpc != "" && !associated[vpc] {
+			missing[vpc] = append(missing[vpc], aws.StringValue(inst.InstanceId))
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	vpcs := make([]string, 0, len(missing))
+	for vpc := range missing {
+		vpcs = append(vpcs, vpc)
+	}
+	sort.Strings(vpcs)
+	for _, vpc := range vpcs {
+		logMsg("private zone is not associated with VPC of instances, their records are not resolvable there",
+			"zone_id", s.zoneID, "vpc_id", vpc, "instance_ids", strings.Join(missing[vpc], ","))
+	}
+	if s.vpcCheck == vpcCheckFail {
+		return fmt.Errorf("%w: %s", errZoneVPC, strings.Join(vpcs, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+func TestCheckZoneVPCs(t *testing.T) {
+	inVPC := func(inst *ec2.Instance, vpc string) *ec2.Instance {
+		inst.VpcId = aws.String(vpc)
+		return inst
+	}
+	instances := []*ec2.Instance{
+		inVPC(testInstance("i-1", "web", "", "1.2.3.4"), "vpc-1"),
+		inVPC(testInstance("i-2", "db", "", "5.6.7.8"), "vpc-2"),
+		testInstance("i-3", "task", "", "9.9.9.9"),
+	}
+	for _, tc := range []struct {
+		private bool
+		vpcs    []string
+		policy  string
+		wantErr bool
+	}{
+		{private: true, vpcs: []string{"vpc-1", "vpc-2"}, policy: vpcCheckFail},
+		{private: true, vpcs: []string{"vpc-1"}, policy: vpcCheckWarn},
+		{private: true, vpcs: []string{"vpc-1"}, policy: vpcCheckFail, wantErr: true},
+		{private: true, policy: vpcCheckOff},
+		{private: false, policy: vpcCheckFail},
+	} {
+		r53svc := newFakeRoute53(t)
+		r53svc.zones = []*route53.HostedZone{{
+			Id:     aws.String("/hostedzone/Z1"),
+			Name:   aws.String("foo.example.com."),
+			Config: &route53.HostedZoneConfig{PrivateZone: aws.Bool(tc.private)},
+		}}
+		for _, id := range tc.vpcs {
+			r53svc.vpcs = append(r53svc.vpcs, &route53.VPC{VPCId: aws.String(id), VPCRegion: aws.String("us-east-1")})
+		}
+		s := &syncer{r53: r53svc, zoneID: "Z1", vpcCheck: tc.policy}
+		err := s.checkZoneVPCs(context.Background(), instances)
+		if tc.wantErr != errors.Is(err, errZoneVPC) || !tc.wantErr && err != nil {
+			t.Fatalf("%+v: got error %v", tc, err)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxBackoff caps delay between reconciliations after repeated failures
+const maxBackoff = time.Hour
+
+// watch runs reconciliation every interval until context is canceled. On
+// repeated failures delay between runs doubles with each consecutive failure,
+// up to maxBackoff or interval, whichever is larger. If ws is not nil, it is
+// updated after each run, and reconciliation it triggers runs right away.
+func (s *syncer) watch(ctx context.Context, interval time.Duration, ws *watchStatus) error {
+	var trigger <-chan struct{}
+	if ws != nil {
+		trigger = ws.trigger
+	}
+	var failures int
+	for {
+		s.resetBudget()
+		err := s.scheduledReconcile(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			failures++
+			logMsg("reconciliation failed", "failures", failures, "error", err)
+		} else {
+			failures = 0
+		}
+		ws.observe(err, failures)
+		delay := backoffDelay(interval, failures)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-trigger:
+			timer.Stop()
+			logMsg("reconciliation triggered")
+		case <-timer.C:
+		}
+	}
+}
+
+// backoffDelay returns delay before the next run after given number of
+// consecutive failures
+func backoffDelay(interval time.Duration, failures int) time.Duration {
+	limit := maxBackoff
+	if interval > limit {
+		limit = interval
+	}
+	delay := interval
+	for i := 0; i < failures && delay < limit; i++ {
+		delay *= 2
+	}
+	if delay > limit {
+		delay = limit
+	}
+	return delay
+}
+
+// watchStatus holds outcome of the latest reconciliation in -watch mode, and
+// serves it on /healthz along with /sync endpoint triggering reconciliation.
+// Methods of nil *watchStatus are no-ops.
+type watchStatus struct {
+	trigger chan struct{} // of capacity 1, so that triggers coalesce
+
+	mu          sync.Mutex
+	lastRun     time.Time
+	lastSuccess time.Time
+	lastErr     error
+	failures    int
+}
+
+func newWatchStatus() *watchStatus {
+	return &watchStatus{trigger: make(chan struct{}, 1)}
+}
+
+// observe records result of a reconciliation run
+func (ws *watchStatus) observe(err error, failures int) {
+	if ws == nil {
+		return
+	}
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	ws.lastRun, ws.lastErr, ws.failures = time.Now(), err, failures
+	if err == nil {
+		ws.lastSuccess = ws.lastRun
+	}
+}
+
+// healthz serves status of the latest reconciliation as JSON object. Response
+// status is 503 if the latest run failed.
+func (ws *watchStatus) healthz(w http.ResponseWriter, r *http.Request) {
+	ws.mu.Lock()
+	out := struct {
+		LastRun     *time.Time `json:"last_run,omitempty"`
+		LastSuccess *time.Time `json:"last_success,omitempty"`
+		LastError   string     `json:"last_error,omitempty"`
+		Failures    int        `json:"consecutive_failures"`
+	}{Failures: ws.failures}
+	if !ws.lastRun.IsZero() {
+		t := ws.lastRun.UTC()
+		out.LastRun = &t
+	}
+	if !ws.lastSuccess.IsZero() {
+		t := ws.lastSuccess.UTC()
+		out.LastSuccess = &t
+	}
+	if ws.lastErr != nil {
+		out.LastError = ws.lastErr.Error()
+	}
+	ws.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	if out.LastError != "" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(out)
+}
+
+// sync handles POST request triggering reconciliation right away, or as soon
+// as the running one completes
+func (ws *watchStatus) sync(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	select {
+	case ws.trigger <- struct{}{}:
+	default: // already triggered
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	table := []struct {
+		interval time.Duration
+		failures int
+		want     time.Duration
+	}{
+		{5 * time.Minute, 0, 5 * time.Minute},
+		{5 * time.Minute, 1, 10 * time.Minute},
+		{5 * time.Minute, 3, 40 * time.Minute},
+		{5 * time.Minute, 4, time.Hour},
+		{5 * time.Minute, 100, time.Hour},
+		{2 * time.Hour, 0, 2 * time.Hour},
+		{2 * time.Hour, 1, 2 * time.Hour},
+	}
+	for _, tc := range table {
+		if got := backoffDelay(tc.interval, tc.failures); got != tc.want {
+			t.Errorf("backoffDelay(%v, %d) = %v, want %v", tc.interval, tc.failures, got, tc.want)
+		}
+	}
+}
+
+func TestWatchStatus(t *testing.T) {
+	ws := newWatchStatus()
+	s := &syncer{
+		ec2:       &fakeEC2{instances: []*ec2.Instance{testInstance("i-1", "web", "", "1.2.3.4")}},
+		r53:       newFakeRoute53(t),
+		suffix:    ".foo.example.com",
+		zoneID:    "Z1",
+		ignoreTag: defaultIgnoreTag,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- s.watch(ctx, time.Hour, ws) }()
+	lastRun := func() time.Time {
+		ws.mu.Lock()
+		defer ws.mu.Unlock()
+		return ws.lastRun
+	}
+	waitRun := func(after time.Time) time.Time {
+		t.Helper()
+		for i := 0; i < 500; i++ {
+			if at := lastRun(); at.After(after) {
+				return at
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatal("reconciliation did not run")
+		return time.Time{}
+	}
+	first := waitRun(time.Time{})
+
+	rec := httptest.NewRecorder()
+	ws.healthz(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	var health struct {
+		LastSuccess *time.Time `json:"last_success"`
+		LastError   string     `json:"last_error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &health); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK || health.LastSuccess == nil || health.LastError != "" {
+		t.Fatalf("unexpected /healthz response %d: %s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	ws.sync(rec, httptest.NewRequest(http.MethodGet, "/sync", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("GET /sync: got status %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	ws.sync(rec, httptest.NewRequest(http.MethodPost, "/sync", nil))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("POST /sync: got status %d", rec.Code)
+	}
+	waitRun(first)
+
+	ws.observe(errors.New("throttled"), 1)
+	rec = httptest.NewRecorder()
+	ws.healthz(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "throttled") {
+		t.Fatalf("unexpected /healthz response after failure %d: %s", rec.Code, rec.Body)
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("watch returned %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// webhook posts change summaries to HTTP endpoint
+type webhook struct {
+	url    string
+	slack  bool // send Slack-compatible {"text": "..."} payload
+	client *http.Client
+}
+
+// newWebhook returns webhook posting to url; format is either "json" or
+// "slack"
+func newWebhook(url, format string) (*webhook, error) {
+	w := &webhook{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+	switch format {
+	case "", "json":
+	case "slack":
+		w.slack = true
+	default:
+		return nil, fmt.Errorf("unsupported notification format %q", format)
+	}
+	return w, nil
+}
+
+// post sends description of changes applied to the zone
+func (w *webhook) post(ctx context.Context, zoneID string, changes []recordChange) error {
+	var payload interface{} = changeNotification{ZoneID: zoneID, Changes: changes}
+	if w.slack {
+		payload = struct {
+			Text string `json:"text"`
+		}{Text: changesText(changes)}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook: unexpected response status %q", resp.Status)
+	}
+	return nil
+}
+
+// changesText returns human-readable one line description of changes, like
+// "awsns created a.example.com → 1.2.3.4, deleted b.example.com"
+func changesText(changes []recordChange) string {
+	var b strings.Builder
+	b.WriteString("awsns ")
+	for i, c := range changes {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(c.Action)
+		b.WriteString("d ")
+		b.WriteString(c.Name)
+		if c.Action != "delete" && c.Value != "" {
+			b.WriteString(" → ")
+			b.WriteString(c.Value)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebhook(t *testing.T) {
+	changes := []recordChange{
+		{Action: "create", Name: "jenkins.foo.example.com", Type: "A", Value: "54.1.2.3", InstanceID: "i-1"},
+		{Action: "delete", Name: "old-box.foo.example.com", Type: "A", Value: "1.1.1.1"},
+	}
+	table := []struct {
+		format string
+		want   string
+	}{
+		{"json", `{"zone_id":"Z1","changes":[` +
+			`{"action":"create","name":"jenkins.foo.example.com","type":"A","value":"54.1.2.3","instance_id":"i-1"},` +
+			`{"action":"delete","name":"old-box.foo.example.com","type":"A","value":"1.1.1.1"}]}`},
+		{"slack", `{"text":"awsns created jenkins.foo.example.com → 54.1.2.3, deleted old-box.foo.example.com"}`},
+	}
+	for _, tc := range table {
+		t.Run(tc.format, func(t *testing.T) {
+			var got []byte
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost {
+					t.Errorf("unexpected method %q", r.Method)
+				}
+				got, _ = io.ReadAll(r.Body)
+			}))
+			defer srv.Close()
+			w, err := newWebhook(srv.URL, tc.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := w.post(context.Background(), "Z1", changes); err != nil {
+				t.Fatal(err)
+			}
+			if !json.Valid(got) || string(got) != tc.want {
+				t.Fatalf("got payload\n%s\nwant\n%s", got, tc.want)
+			}
+		})
+	}
+}
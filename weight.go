@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+const (
+	weightTag     = "dns:weight" // instance tag setting its weighted record set weight
+	defaultWeight = 1
+	maxWeight     = 255
+)
+
+// instanceWeight returns weight set by the instance weightTag and whether it
+// is set and valid
+func instanceWeight(d desiredRecord) (int64, bool) {
+	v := tagValue(d.inst, weightTag)
+	if v == "" {
+		return 0, false
+	}
+	w, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || w < 0 || w > maxWeight {
+		logMsg("ignoring instance tag", "instance_id", aws.StringValue(d.inst.InstanceId), "tag", weightTag,
+			"error", fmt.Sprintf("invalid weight %q, must be between 0 and %d", v, maxWeight))
+		return 0, false
+	}
+	return w, true
+}
+
+// hasWeight reports whether any instance of the group has weight set
+func hasWeight(group []desiredRecord) bool {
+	for _, d := range group {
+		if tagValue(d.inst, weightTag) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// weightedRecords returns weighted record sets for the group of instances
+// sharing the same name, using weights from their weightTag; instances without
+// valid weight get the default one. Instances dropped to keep record sets of
+// the same type are counted in st.Skipped.
+func (s *syncer) weightedRecords(group []desiredRecord, st *runStats) []desiredRecord {
+	members := homogenize(group, false)
+	skipDropped(st, group, members)
+	for _, d := range members {
+		w, ok := instanceWeight(d)
+		if !ok {
+			w = defaultWeight
+		}
+		d.rr.SetIdentifier = d.inst.InstanceId
+		d.rr.Weight = aws.Int64(w)
+	}
+	return members
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func TestReconcile_weight(t *testing.T) {
+	r53svc := newFakeRoute53(t, "web.foo.example.com. A 1.2.3.4")
+	instances := []*ec2.Instance{
+		withTag(testInstance("i-1", "web", "", "1.2.3.4"), weightTag, "90"),
+		withTag(testInstance("i-2", "web", "", "5.6.7.8"), weightTag, "10"),
+		withTag(testInstance("i-3", "web", "", "9.9.9.9"), weightTag, "bogus"),
+		withTag(testInstance("i-4", "db", "", "3.3.3.3"), weightTag, "0"),
+		testInstance("i-5", "ci", "", "2.2.2.2"),
+	}
+	s := &syncer{
+		ec2:    &fakeEC2{instances: instances},
+		r53:    r53svc,
+		suffix: ".foo.example.com",
+		zoneID: "Z1",
+	}
+	if err := s.update(context.Background(), "", &runStats{}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"ci.foo.example.com. A 2.2.2.2",
+		"db.foo.example.com. A 3.3.3.3 set=i-4 weight=0",
+		"web.foo.example.com. A 1.2.3.4 set=i-1 weight=90",
+		"web.foo.example.com. A 5.6.7.8 set=i-2 weight=10",
+		"web.foo.example.com. A 9.9.9.9 set=i-3 weight=1",
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// shifting traffic is a matter of re-tagging
+	for i, w := range []string{"0", "100"} {
+		for _, tag := range instances[i].Tags {
+			if *tag.Key == weightTag {
+				tag.Value = aws.String(w)
+			}
+		}
+	}
+	if err := s.update(context.Background(), "", &runStats{}); err != nil {
+		t.Fatal(err)
+	}
+	want[2] = "web.foo.example.com. A 1.2.3.4 set=i-1 weight=0"
+	want[3] = "web.foo.example.com. A 5.6.7.8 set=i-2 weight=100"
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
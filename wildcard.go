@@ -0,0 +1,18 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// wildcardTag is the instance tag which, if set to true, makes instance get
+// wildcard record too, like *.review.foo.example.com next to
+// review.foo.example.com, for hosts serving many virtual hosts
+const wildcardTag = "dns:wildcard"
+
+// wildcard reports whether instance has wildcardTag set to true
+func wildcard(inst *ec2.Instance) bool {
+	v, _ := strconv.ParseBool(tagValue(inst, wildcardTag))
+	return v
+}
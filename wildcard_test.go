@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func TestReconcile_wildcard(t *testing.T) {
+	r53svc := newFakeRoute53(t,
+		`\052.review.foo.example.com. A 9.9.9.9`,
+		`\052.old.foo.example.com. A 1.1.1.1`,
+	)
+	instances := []*ec2.Instance{
+		withTag(testInstance("i-1", "review", "", "1.2.3.4"), wildcardTag, "true"),
+		withTag(testInstance("i-2", "ingress", "ec2-5-6-7-8.compute.amazonaws.com", "5.6.7.8"), wildcardTag, "1"),
+		withTag(testInstance("i-3", "db", "", "9.9.9.8"), wildcardTag, "no"),
+	}
+	s := &syncer{
+		ec2:    &fakeEC2{instances: instances},
+		r53:    r53svc,
+		suffix: ".foo.example.com",
+		zoneID: "Z1",
+		ttl:    defaultTTL,
+	}
+	if err := s.update(context.Background(), "", &runStats{}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`\052.ingress.foo.example.com. CNAME ec2-5-6-7-8.compute.amazonaws.com`,
+		`\052.review.foo.example.com. A 1.2.3.4`,
+		"db.foo.example.com. A 9.9.9.8",
+		"ingress.foo.example.com. CNAME ec2-5-6-7-8.compute.amazonaws.com",
+		"review.foo.example.com. A 1.2.3.4",
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// escaped names of listed records match wildcard names
+	batches := len(r53svc.batches)
+	if err := s.update(context.Background(), "", &runStats{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(r53svc.batches) != batches {
+		t.Fatalf("update of converged zone applied changes: %v", r53svc.batches[batches:])
+	}
+
+	// removed instance takes its wildcard record with it
+	instances[0].State.Name = aws.String(ec2.InstanceStateNameStopped)
+	if err := s.removeInstance(context.Background(), "i-1"); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{
+		`\052.ingress.foo.example.com. CNAME ec2-5-6-7-8.compute.amazonaws.com`,
+		"db.foo.example.com. A 9.9.9.8",
+		"ingress.foo.example.com. CNAME ec2-5-6-7-8.compute.amazonaws.com",
+	}
+	if got := r53svc.dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("zone state mismatch\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
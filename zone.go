@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+// errNoZone is returned by findZone if there is no hosted zone for the domain
+var errNoZone = errors.New("no hosted zone found")
+
+// findZone returns id of the hosted zone for the domain. If both public and
+// private zones exist for the domain, preferPrivate selects which one to
+// return. It is an error if there are several zones of the selected kind.
+func findZone(ctx context.Context, svc route53Client, domain string, preferPrivate bool) (string, error) {
+	name := strings.TrimSuffix(domain, ".") + "."
+	var public, private []string
+	input := &route53.ListHostedZonesByNameInput{DNSName: &name}
+	for {
+		out, err := svc.ListHostedZonesByNameWithContext(ctx, input)
+		if err != nil {
+			return "", err
+		}
+		var done bool
+		for _, z := range out.HostedZones {
+			if aws.StringValue(z.Name) != name {
+				done = true
+				break
+			}
+			id := strings.TrimPrefix(aws.StringValue(z.Id), "/hostedzone/")
+			if z.Config != nil && aws.BoolValue(z.Config.PrivateZone) {
+				private = append(private, id)
+			} else {
+				public = append(public, id)
+			}
+		}
+		if done || !aws.BoolValue(out.IsTruncated) {
+			break
+		}
+		input.DNSName, input.HostedZoneId = out.NextDNSName, out.NextHostedZoneId
+	}
+	zones, kind := public, "public"
+	if len(public) == 0 || (preferPrivate && len(private) != 0) {
+		zones, kind = private, "private"
+	}
+	switch len(zones) {
+	case 0:
+		return "", fmt.Errorf("%w for domain %q", errNoZone, domain)
+	case 1:
+		return zones[0], nil
+	}
+	return "", fmt.Errorf("found %d %s hosted zones for domain %q: %s, use zone id instead",
+		len(zones), kind, domain, strings.Join(zones, ", "))
+}
+
+// zoneSuffix returns suffix matching the hosted zone name, i.e. ".example.com"
+// for example.com zone
+func zoneSuffix(ctx context.Context, p provider, zoneID string) (string, error) {
+	zone, err := p.zoneInfo(ctx, zoneID)
+	if err != nil {
+		return "", err
+	}
+	return "." + zone.Name, nil
+}
+
+// checkSuffix returns an error if suffix is outside of the zone with the given
+// name, or is the zone apex while allowApex is false
+func checkSuffix(suffix, zone string, allowApex bool) error {
+	suffix = strings.ToLower(strings.TrimSuffix(suffix, "."))
+	apex := "." + strings.ToLower(strings.TrimSuffix(zone, "."))
+	switch {
+	case suffix == apex && !allowApex:
+		return fmt.Errorf("suffix %q is the apex of zone %q, set -allow-apex to publish records right under it", suffix, zone)
+	case suffix != apex && !strings.HasSuffix(suffix, apex):
+		return fmt.Errorf("suffix %q is outside of zone %q", suffix, zone)
+	}
+	return nil
+}
+
+// validateSuffix checks that s.suffix is within s.zoneID zone, see
+// checkSuffix, and that no part of it is delegated to another zone by NS
+// record, so that misconfiguration fails early rather than with
+// InvalidChangeBatch errors on update. Check is skipped with a warning if
+// route53:GetHostedZone permission is missing.
+func (s *syncer) validateSuffix(ctx context.Context, allowApex bool) error {
+	zone, err := s.provider().zoneInfo(ctx, s.zoneID)
+	var aerr awserr.Error
+	switch {
+	case errors.As(err, &aerr) && aerr.Code() == "AccessDenied":
+		logMsg("cannot validate suffix, route53:GetHostedZone is not permitted", "zone_id", s.zoneID, "suffix", s.suffix)
+		return nil
+	case err != nil:
+		return err
+	}
+	if err := checkSuffix(s.suffix, zone.Name, allowApex); err != nil {
+		return fmt.Errorf("zone %s: %w", s.zoneID, err)
+	}
+	apex := strings.ToLower(strings.TrimSuffix(zone.Name, "."))
+	for name := strings.ToLower(strings.TrimSuffix(s.suffix[1:], ".")); name != apex; name = name[strings.IndexByte(name, '.')+1:] {
+		ns, err := s.lookupRecord(ctx, s.zoneID, &route53.ResourceRecordSet{Name: aws.String(name), Type: aws.String(route53.RRTypeNs)})
+		if err != nil {
+			return err
+		}
+		if ns != nil {
+			return fmt.Errorf("zone %s: suffix %q is delegated to another zone by NS record of %s", s.zoneID, s.suffix, name)
+		}
+	}
+	return nil
+}
+
+// zoneCreator is a subset of route53 API used to create hosted zones
+type zoneCreator interface {
+	CreateHostedZoneWithContext(aws.Context, *route53.CreateHostedZoneInput, ...request.Option) (*route53.CreateHostedZoneOutput, error)
+	AssociateVPCWithHostedZoneWithContext(aws.Context, *route53.AssociateVPCWithHostedZoneInput, ...request.Option) (*route53.AssociateVPCWithHostedZoneOutput, error)
+}
+
+// createZone creates hosted zone for the domain and returns its id. If vpcs
+// are given, zone is private and associated with these VPCs of the region,
+// otherwise it is public.
+func createZone(ctx context.Context, svc zoneCreator, domain, region string, vpcs []string) (string, error) {
+	in := &route53.CreateHostedZoneInput{
+		Name:            aws.String(strings.TrimSuffix(domain, ".")),
+		CallerReference: aws.String(fmt.Sprintf("awsns-%d", time.Now().UnixNano())),
+		HostedZoneConfig: &route53.HostedZoneConfig{
+			Comment:     aws.String("created by awsns"),
+			PrivateZone: aws.Bool(len(vpcs) != 0),
+		},
+	}
+	if len(vpcs) != 0 {
+		in.VPC = &route53.VPC{VPCId: &vpcs[0], VPCRegion: &region}
+	}
+	out, err := svc.CreateHostedZoneWithContext(ctx, in)
+	if err != nil {
+		return "", fmt.Errorf("creating hosted zone for domain %q: %w", domain, err)
+	}
+	id := strings.TrimPrefix(aws.StringValue(out.HostedZone.Id), "/hostedzone/")
+	for i := 1; i < len(vpcs); i++ {
+		vpc := vpcs[i]
+		_, err := svc.AssociateVPCWithHostedZoneWithContext(ctx, &route53.AssociateVPCWithHostedZoneInput{
+			HostedZoneId: &id,
+			VPC:          &route53.VPC{VPCId: &vpc, VPCRegion: &region},
+		})
+		if err != nil {
+			return "", fmt.Errorf("associating VPC %s with hosted zone %s: %w", vpc, id, err)
+		}
+	}
+	return id, nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+func TestFindZone(t *testing.T) {
+	zone := func(id, name string, private bool) *route53.HostedZone {
+		return &route53.HostedZone{
+			Id:     aws.String("/hostedzone/" + id),
+			Name:   aws.String(name),
+			Config: &route53.HostedZoneConfig{PrivateZone: aws.Bool(private)},
+		}
+	}
+	svc := newFakeRoute53(t)
+	svc.zones = []*route53.HostedZone{
+		zone("Z1", "example.com.", false),
+		zone("Z2", "foo.example.com.", false),
+		zone("Z3", "foo.example.com.", true),
+		zone("Z4", "bar.example.com.", true),
+		zone("Z5", "dup.example.com.", false),
+		zone("Z6", "dup.example.com.", false),
+	}
+	table := []struct {
+		domain        string
+		preferPrivate bool
+		want          string // empty if error expected
+	}{
+		{"example.com", false, "Z1"},
+		{"foo.example.com", false, "Z2"},
+		{"foo.example.com.", true, "Z3"},
+		{"bar.example.com", false, "Z4"},
+		{"baz.example.com", false, ""},
+		{"dup.example.com", false, ""},
+	}
+	for _, tc := range table {
+		got, err := findZone(context.Background(), svc, tc.domain, tc.preferPrivate)
+		if tc.want == "" {
+			if err == nil {
+				t.Errorf("findZone(%q, %v): got %q, want error", tc.domain, tc.preferPrivate, got)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("findZone(%q, %v): got %q, %v, want %q", tc.domain, tc.preferPrivate, got, err, tc.want)
+		}
+	}
+}
+
+func TestZoneSuffix(t *testing.T) {
+	svc := newFakeRoute53(t)
+	svc.zones = []*route53.HostedZone{{
+		Id:   aws.String("/hostedzone/Z1"),
+		Name: aws.String("foo.example.com."),
+	}}
+	got, err := zoneSuffix(context.Background(), route53Provider{svc: svc}, "Z1")
+	if err != nil || got != ".foo.example.com" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+	if _, err := zoneSuffix(context.Background(), route53Provider{svc: svc}, "Z2"); err == nil {
+		t.Fatal("non-existent zone lookup succeeded")
+	}
+}
+
+func TestCheckSuffix(t *testing.T) {
+	for _, tc := range []struct {
+		suffix, zone string
+		allowApex    bool
+		ok           bool
+	}{
+		{".foo.example.com", "example.com", false, true},
+		{".Foo.Example.com.", "example.com.", false, true},
+		{".example.com", "example.com", true, true},
+		{".example.com", "example.com", false, false},
+		{".example.net", "example.com", true, false},
+		{".fooexample.com", "example.com", true, false},
+	} {
+		if err := checkSuffix(tc.suffix, tc.zone, tc.allowApex); (err == nil) != tc.ok {
+			t.Errorf("checkSuffix(%q, %q, %v) = %v, want ok=%v", tc.suffix, tc.zone, tc.allowApex, err, tc.ok)
+		}
+	}
+}
+
+func TestValidateSuffix(t *testing.T) {
+	svc := newFakeRoute53(t, "bar.example.com. NS ns-1.example.net.")
+	svc.zones = []*route53.HostedZone{{Id: aws.String("/hostedzone/Z1"), Name: aws.String("example.com.")}}
+	ctx := context.Background()
+	s := &syncer{r53: svc, zoneID: "Z1", suffix: ".foo.example.com"}
+	if err := s.validateSuffix(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	s.suffix = ".baz.bar.example.com"
+	if err := s.validateSuffix(ctx, false); err == nil || !strings.Contains(err.Error(), "delegated") {
+		t.Fatalf("got %v for delegated suffix, want delegation error", err)
+	}
+	s.suffix = ".example.org"
+	if err := s.validateSuffix(ctx, true); err == nil || !strings.Contains(err.Error(), "outside") {
+		t.Fatalf("got %v for suffix of another domain, want error", err)
+	}
+}
+
+func TestCreateZone(t *testing.T) {
+	for _, vpcs := range [][]string{nil, {"vpc-1", "vpc-2"}} {
+		svc := &fakeZoneCreator{}
+		id, err := createZone(context.Background(), svc, "pr-42.example.com.", "us-east-1", vpcs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != "Z42" {
+			t.Fatalf("got zone id %q, want Z42", id)
+		}
+		in := svc.created
+		if aws.StringValue(in.Name) != "pr-42.example.com" ||
+			aws.BoolValue(in.HostedZoneConfig.PrivateZone) != (vpcs != nil) {
+			t.Fatalf("unexpected zone creation: %v", in)
+		}
+		if vpcs == nil {
+			if in.VPC != nil || len(svc.associated) != 0 {
+				t.Fatalf("public zone is associated with VPCs: %v, %v", in.VPC, svc.associated)
+			}
+			continue
+		}
+		if aws.StringValue(in.VPC.VPCId) != "vpc-1" || aws.StringValue(in.VPC.VPCRegion) != "us-east-1" {
+			t.Fatalf("unexpected VPC of created zone: %v", in.VPC)
+		}
+		if len(svc.associated) != 1 || svc.associated[0] != "Z42 vpc-2" {
+			t.Fatalf("got associations %q, want one with vpc-2", svc.associated)
+		}
+	}
+}
+
+type fakeZoneCreator struct {
+	created    *route53.CreateHostedZoneInput
+	associated []string // "zone-id vpc-id"
+}
+
+func (f *fakeZoneCreator) CreateHostedZoneWithContext(_ aws.Context, in *route53.CreateHostedZoneInput, _ ...request.Option) (*route53.CreateHostedZoneOutput, error) {
+	f.created = in
+	return &route53.CreateHostedZoneOutput{HostedZone: &route53.HostedZone{Id: aws.String("/hostedzone/Z42"), Name: in.Name}}, nil
+}
+
+func (f *fakeZoneCreator) AssociateVPCWithHostedZoneWithContext(_ aws.Context, in *route53.AssociateVPCWithHostedZoneInput, _ ...request.Option) (*route53.AssociateVPCWithHostedZoneOutput, error) {
+	f.associated = append(f.associated, aws.StringValue(in.HostedZoneId)+" "+aws.StringValue(in.VPC.VPCId))
+	return &route53.AssociateVPCWithHostedZoneOutput{}, nil
+}
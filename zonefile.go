@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+// suffixOrigin returns zone file origin of suffix, like "foo.example.com."
+// for ".foo.example.com"
+func suffixOrigin(suffix string) string { return strings.Trim(suffix, ".") + "." }
+
+// exportRecords returns record sets of all types named by the suffix domain
+// or located under it, in listing order
+func (s *syncer) exportRecords(ctx context.Context) ([]*route53.ResourceRecordSet, error) {
+	var out []*route53.ResourceRecordSet
+	origin := suffixOrigin(s.suffix)
+	suffixOrder := dnsOrder(origin)
+	fn := func(rr *route53.ResourceRecordSet) bool {
+		name := aws.StringValue(rr.Name)
+		if name != origin && !strings.HasSuffix(name, "."+origin) {
+			return dnsOrder(name) <= suffixOrder
+		}
+		out = append(out, rr)
+		return true
+	}
+	if err := s.provider().list(ctx, s.zoneID, origin, "", fn); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// writeZoneFile writes record sets to w in zone file format, with names
+// relative to origin, which must end with a dot. Alias records, which zone
+// files cannot express, are written as comments, and record sets with routing
+// policies are written as plain ones, with their set identifiers in comments.
+func writeZoneFile(w io.Writer, origin string, records []*route53.ResourceRecordSet) error {
+	fmt.Fprintf(w, "$ORIGIN %s\n", origin)
+	tw := tabwriter.NewWriter(w, 0, 4, 1, ' ', 0)
+	for _, rr := range records {
+		name := strings.TrimSuffix(aws.StringValue(rr.Name), ".") + "."
+		if name == origin {
+			name = "@"
+		} else {
+			name = strings.TrimSuffix(name, "."+origin)
+		}
+		typ := aws.StringValue(rr.Type)
+		if rr.AliasTarget != nil {
+			fmt.Fprintf(tw, "; %s\t\t\t%s\talias %s\n", name, typ,
+				strings.TrimSuffix(aws.StringValue(rr.AliasTarget.DNSName), ".")+".")
+			continue
+		}
+		var note string
+		if id := aws.StringValue(rr.SetIdentifier); id != "" {
+			note = " ; set identifier " + id
+		}
+		for _, r := range rr.ResourceRecords {
+			value := mapTarget(typ, aws.StringValue(r.Value), func(target string) string {
+				return strings.TrimSuffix(target, ".") + "."
+			})
+			fmt.Fprintf(tw, "%s\t%d\tIN\t%s\t%s%s\n", name, aws.Int64Value(rr.TTL), typ, value, note)
+		}
+	}
+	return tw.Flush()
+}
+
+// mapTarget returns record value with domain name it points to, like the
+// exchange of MX record, replaced by fn applied to it. Values of other types
+// are returned as is.
+func mapTarget(typ, value string, fn func(string) string) string {
+	switch typ {
+	case "CNAME", "NS", "PTR":
+		return fn(value)
+	case "MX", "SRV", "NAPTR":
+		if i := strings.LastIndexByte(value, ' '); i >= 0 && i < len(value)-1 {
+			return value[:i+1] + fn(value[i+1:])
+		}
+	}
+	return value
+}
+
+// readZoneFile parses zone file and returns its record sets, named without
+// trailing dot, with values of the same name and type merged into one record
+// set, in order of their first appearance. Names, and domain names record
+// values point to, that don't end with a dot are relative to origin, which is
+// also the initial $ORIGIN. Record sets without TTL and without $TTL
+// directive before them get zero TTL.
+func readZoneFile(r io.Reader, origin string) ([]*route53.ResourceRecordSet, error) {
+	qualify := func(name string) string {
+		switch {
+		case name == "@":
+			return origin
+		case strings.HasSuffix(name, "."):
+			return strings.ToLower(name)
+		}
+		return strings.ToLower(name) + "." + origin
+	}
+	var out []*route53.ResourceRecordSet
+	byKey := make(map[string]*route53.ResourceRecordSet)
+	var owner string
+	var dirTTL, lastTTL int64 // of $TTL directive, and the default one
+	sc := bufio.NewScanner(r)
+	var lineno, depth int
+	var pending []string
+	var continued bool // the record started on a line starting with blank
+	for sc.Scan() {
+		lineno++
+		line := sc.Text()
+		tokens, d, err := zoneTokens(line, depth)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineno, err)
+		}
+		if depth == 0 {
+			continued = line != "" && (line[0] == ' ' || line[0] == '\t')
+		}
+		pending, depth = append(pending, tokens...), d
+		if depth != 0 || len(pending) == 0 {
+			continue
+		}
+		tokens, pending = pending, nil
+		switch strings.ToUpper(tokens[0]) {
+		case "$ORIGIN":
+			if len(tokens) != 2 {
+				return nil, fmt.Errorf("line %d: invalid $ORIGIN directive", lineno)
+			}
+			origin = qualify(tokens[1])
+			continue
+		case "$TTL":
+			if len(tokens) != 2 {
+				return nil, fmt.Errorf("line %d: invalid $TTL directive", lineno)
+			}
+			if dirTTL, err = parseZoneTTL(tokens[1]); err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineno, err)
+			}
+			lastTTL = dirTTL
+			continue
+		}
+		if strings.HasPrefix(tokens[0], "$") {
+			return nil, fmt.Errorf("line %d: unsupported directive %s", lineno, tokens[0])
+		}
+		if !continued {
+			owner, tokens = qualify(tokens[0]), tokens[1:]
+		}
+		if owner == "" {
+			return nil, fmt.Errorf("line %d: record without name", lineno)
+		}
+		recTTL := lastTTL
+		// TTL and class may come in either order before the type
+		for len(tokens) != 0 {
+			if strings.EqualFold(tokens[0], "IN") {
+				tokens = tokens[1:]
+				continue
+			}
+			if tokens[0] == "" || tokens[0][0] < '0' || tokens[0][0] > '9' {
+				break
+			}
+			if recTTL, err = parseZoneTTL(tokens[0]); err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineno, err)
+			}
+			if dirTTL == 0 {
+				// without $TTL, TTL of the last record is the default
+				lastTTL = recTTL
+			}
+			tokens = tokens[1:]
+		}
+		if len(tokens) < 2 {
+			return nil, fmt.Errorf("line %d: record without type or value", lineno)
+		}
+		typ := strings.ToUpper(tokens[0])
+		values := tokens[1:]
+		if typ == "TXT" || typ == "SPF" {
+			for i, v := range values {
+				if !strings.HasPrefix(v, `"`) {
+					values[i] = `"` + v + `"`
+				}
+			}
+		}
+		value := mapTarget(typ, strings.Join(values, " "), func(target string) string {
+			return strings.TrimSuffix(qualify(target), ".")
+		})
+		name := strings.TrimSuffix(owner, ".")
+		key := name + " " + typ
+		rr := byKey[key]
+		if rr == nil {
+			rr = &route53.ResourceRecordSet{Name: aws.String(name), Type: aws.String(typ), TTL: aws.Int64(recTTL)}
+			byKey[key] = rr
+			out = append(out, rr)
+		}
+		rr.ResourceRecords = append(rr.ResourceRecords, &route53.ResourceRecord{Value: aws.String(value)})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("line %d: unbalanced parentheses", lineno)
+	}
+	return out, nil
+}
+
+// zoneTokens splits zone file line into tokens, dropping comments and
+// parentheses, which let records span several lines. Quoted strings are
+// returned as single tokens, quotes included. Depth is the number of
+// parentheses left open by the previous lines; the number of ones left open
+// by this line is returned.
+func zoneTokens(line string, depth int) ([]string, int, error) {
+	var out []string
+	var cur strings.Builder
+	flush := func() {
+		if cur.Len() != 0 {
+			out = append(out, cur.String())
+			cur.Reset()
+		}
+	}
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; c {
+		case ';':
+			flush()
+			return out, depth, nil
+		case ' ', '\t':
+			flush()
+		case '(':
+			flush()
+			depth++
+		case ')':
+			flush()
+			if depth--; depth < 0 {
+				return nil, 0, fmt.Errorf("unbalanced parentheses")
+			}
+		case '"':
+			cur.WriteByte(c)
+			for i++; ; i++ {
+				if i == len(line) {
+					return nil, 0, fmt.Errorf("unterminated quoted string")
+				}
+				cur.WriteByte(line[i])
+				if line[i] == '\\' && i+1 < len(line) {
+					i++
+					cur.WriteByte(line[i])
+					continue
+				}
+				if line[i] == '"' {
+					break
+				}
+			}
+		default:
+			cur.WriteByte(c)
+		}
+	}
+	flush()
+	return out, depth, nil
+}
+
+// parseZoneTTL parses TTL in seconds, or with BIND unit suffixes, like 1h30m
+func parseZoneTTL(s string) (int64, error) {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if !validTTL(n) {
+			return 0, fmt.Errorf("invalid TTL %q", s)
+		}
+		return n, nil
+	}
+	units := map[byte]int64{'s': 1, 'm': 60, 'h': 3600, 'd': 86400, 'w': 7 * 86400}
+	var total, n int64
+	var digits bool
+	for i := 0; i < len(s); i++ {
+		c := s[i] | 0x20
+		switch {
+		case s[i] >= '0' && s[i] <= '9':
+			n, digits = n*10+int64(s[i]-'0'), true
+		case units[c] != 0 && digits:
+			total, n, digits = total+n*units[c], 0, false
+		default:
+			return 0, fmt.Errorf("invalid TTL %q", s)
+		}
+	}
+	if s == "" || digits || !validTTL(total) {
+		return 0, fmt.Errorf("invalid TTL %q", s)
+	}
+	return total, nil
+}
+
+// writeManifest writes record sets located under suffix to w as JSON
+// manifest, see parseManifest. Record sets that manifest cannot have, like
+// the ones named by the suffix domain itself or of unsupported types, are
+// skipped and logged; record sets outside of suffix are an error.
+func writeManifest(w io.Writer, records []*route53.ResourceRecordSet, suffix string) error {
+	suffix = "." + strings.ToLower(strings.Trim(suffix, "."))
+	doc := struct {
+		Records []manifestRecord `json:"records"`
+	}{Records: []manifestRecord{}}
+	for _, rr := range records {
+		name, typ := strings.TrimSuffix(aws.StringValue(rr.Name), "."), aws.StringValue(rr.Type)
+		switch {
+		case name == strings.TrimPrefix(suffix, "."):
+			logMsg("skipping record named by suffix domain", "record_name", name, "record_type", typ)
+			continue
+		case !strings.HasSuffix(name, suffix):
+			return fmt.Errorf("%s %s: outside of suffix %s", name, typ, suffix)
+		case !manifestTypes[typ]:
+			logMsg("skipping record of unsupported type", "record_name", name, "record_type", typ)
+			continue
+		}
+		mr := manifestRecord{Name: strings.TrimSuffix(name, suffix), Type: typ, TTL: aws.Int64Value(rr.TTL)}
+		for _, r := range rr.ResourceRecords {
+			mr.Values = append(mr.Values, aws.StringValue(r.Value))
+		}
+		doc.Records = append(doc.Records, mr)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(doc)
+}
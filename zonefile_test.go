@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+func TestExportImport(t *testing.T) {
+	r53svc := newFakeRoute53(t,
+		"foo.example.com. NS ns-1.awsdns-01.org",
+		"web.foo.example.com. A 1.2.3.4",
+		"www.foo.example.com. CNAME web.foo.example.com",
+		"mail.foo.example.com. MX 10 mx.example.net",
+		`_dmarc.foo.example.com. TXT "v=DMARC1; p=none"`,
+		"bar.example.com. A 5.6.7.8",
+	)
+	r53svc.add(&route53.ResourceRecordSet{Name: aws.String("lb.foo.example.com."), Type: aws.String("A"),
+		AliasTarget: &route53.AliasTarget{DNSName: aws.String("lb-1.elb.amazonaws.com.")}})
+	s := &syncer{r53: r53svc, suffix: ".foo.example.com", zoneID: "Z1"}
+	records, err := s.exportRecords(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := writeZoneFile(&buf, suffixOrigin(s.suffix), records); err != nil {
+		t.Fatal(err)
+	}
+	zone := buf.String()
+	for _, want := range []string{
+		"$ORIGIN foo.example.com.\n",
+		"@ ",
+		"\nweb ",
+		" IN CNAME web.foo.example.com.\n",
+		" IN MX    10 mx.example.net.\n",
+		` IN TXT   "v=DMARC1; p=none"` + "\n",
+		"; lb ",
+	} {
+		if !strings.Contains(zone, want) {
+			t.Fatalf("exported zone has no %q:\n%s", want, zone)
+		}
+	}
+	if strings.Contains(zone, "bar") {
+		t.Fatalf("exported zone has record outside of suffix:\n%s", zone)
+	}
+
+	imported, err := readZoneFile(strings.NewReader(zone), suffixOrigin(s.suffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err := writeManifest(&buf, imported, s.suffix); err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := parseManifest(&buf, s.suffix, defaultTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, rr := range manifest {
+		got = append(got, *rr.Name+" "+*rr.Type+" "+*rr.ResourceRecords[0].Value)
+	}
+	want := []string{
+		`_dmarc.foo.example.com TXT "v=DMARC1; p=none"`,
+		"mail.foo.example.com MX 10 mx.example.net",
+		"web.foo.example.com A 1.2.3.4",
+		"www.foo.example.com CNAME web.foo.example.com",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got manifest records %q, want %q", got, want)
+	}
+}
+
+func TestReadZoneFile(t *testing.T) {
+	const zone = `$TTL 1h
+@       IN SOA ns.example.com. admin.example.com. (
+               1 ; serial
+               7200 3600 1209600 300 )
+web     300 IN A 10.0.0.1
+        IN 300 A 10.0.0.2 ; same name
+txt     TXT v=spf1 "-all"
+$ORIGIN sub.foo.example.com.
+srv     SRV 0 5 443 web.foo.example.com.
+alias   CNAME srv
+`
+	records, err := readZoneFile(strings.NewReader(zone), "foo.example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, rr := range records {
+		var values []string
+		for _, r := range rr.ResourceRecords {
+			values = append(values, *r.Value)
+		}
+		got = append(got, *rr.Name+" "+*rr.Type+" "+strconv.FormatInt(*rr.TTL, 10)+" "+strings.Join(values, ","))
+	}
+	want := []string{
+		"foo.example.com SOA 3600 ns.example.com. admin.example.com. 1 7200 3600 1209600 300",
+		"web.foo.example.com A 300 10.0.0.1,10.0.0.2",
+		`txt.foo.example.com TXT 3600 "v=spf1" "-all"`,
+		"srv.sub.foo.example.com SRV 3600 0 5 443 web.foo.example.com",
+		"alias.sub.foo.example.com CNAME 3600 srv.sub.foo.example.com",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	for _, bad := range []string{
+		"web A (10.0.0.1\n",
+		`web TXT "unterminated` + "\n",
+		"$INCLUDE other.zone\n",
+		"web 1x A 10.0.0.1\n",
+		"web A\n",
+	} {
+		if _, err := readZoneFile(strings.NewReader(bad), "foo.example.com."); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
+
+func TestParseZoneTTL(t *testing.T) {
+	for s, want := range map[string]int64{"300": 300, "1h30m": 5400, "1D": 86400, "2d": 172800} {
+		if got, err := parseZoneTTL(s); err != nil || got != want {
+			t.Errorf("parseZoneTTL(%q) = %d, %v; want %d", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "h", "1h5", "-1"} {
+		if _, err := parseZoneTTL(s); err == nil {
+			t.Errorf("parseZoneTTL(%q) succeeded", s)
+		}
+	}
+}